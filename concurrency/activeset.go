@@ -0,0 +1,139 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// activeMembersScript returns the members of the active set
+// KEYS[1] is the active set
+var activeMembersScript = newScript(`
+return redis.call('SMEMBERS', KEYS[1])
+`)
+
+// releaseActiveScript deletes the slots of a job, removes them from the active set and returns their keys
+// members whose slot already expired are removed on the way
+// KEYS[1] is the active set, KEYS[2] the counters hash, KEYS[3..] the members read by activeMembersScript
+// ARGV[1] is the jobID, ARGV[2] 1 to update the counters
+var releaseActiveScript = newScript(luaJobID + `
+local released = {}
+for i = 3, #KEYS do
+	local key = KEYS[i]
+	local v = redis.call('GET', key)
+	if not v then
+		redis.call('SREM', KEYS[1], key)
+	elseif jobid(v) == ARGV[1] then
+		redis.call('DEL', key)
+		redis.call('SREM', KEYS[1], key)
+		table.insert(released, key)
+	end
+end
+if ARGV[2] == '1' and #released > 0 then
+	redis.call('HINCRBY', KEYS[2], 'releases', #released)
+end
+return released
+`)
+
+// listActiveScript returns the active slots as key, value pairs
+// members whose slot already expired are removed on the way
+// KEYS[1] is the active set, KEYS[2..] the members read by activeMembersScript
+var listActiveScript = newScript(`
+local result = {}
+for i = 2, #KEYS do
+	local key = KEYS[i]
+	local v = redis.call('GET', key)
+	if v then
+		table.insert(result, key)
+		table.insert(result, v)
+	else
+		redis.call('SREM', KEYS[1], key)
+	end
+end
+return result
+`)
+
+// activeSetKey returns the key of the set tracking the occupied slots of jobType
+func activeSetKey(jobType string) string {
+	return fmt.Sprintf("%s-active", jobType)
+}
+
+// slotIndex parses the index of a slot key generated by GenJobKeys
+func slotIndex(jobType, key string) (int, bool) {
+	prefix := jobType + "-"
+	if !strings.HasPrefix(key, prefix) {
+		return 0, false
+	}
+	index, err := strconv.Atoi(key[len(prefix):])
+	if err != nil {
+		return 0, false
+	}
+
+	return index, true
+}
+
+// activeMembers returns the slot keys in the active set of jobType
+// the scripts working on them take them as KEYS, so every key they touch is declared
+func (rl *RateLimiter) activeMembers(ctx context.Context, jobType string) ([]string, error) {
+	reply, err := activeMembersScript.Run(ctx, rl.redisConnector, []string{activeSetKey(jobType)})
+	if err != nil {
+		return nil, err
+	}
+
+	return toStrings(reply)
+}
+
+// releaseActive deletes the slots of jobID through the active set and returns the freed keys
+func (rl *RateLimiter) releaseActive(ctx context.Context, jobType, jobID string) ([]string, error) {
+	members, err := rl.activeMembers(ctx, jobType)
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+	keys := append([]string{activeSetKey(jobType), countersKey(jobType)}, members...)
+	reply, err := releaseActiveScript.Run(ctx, rl.redisConnector, keys, jobID, boolArg(rl.persistentCounters))
+	if err != nil {
+		return nil, err
+	}
+
+	return toStrings(reply)
+}
+
+// ListActiveJobs returns the occupied slots of jobType with map[string]string format
+// only the members of the active set are read, which is much cheaper than ListJobs
+// for pools with a large limit and few active jobs
+// it requires WithActiveSet, and runs on the primary since it prunes expired members
+func (rl *RateLimiter) ListActiveJobs(ctx context.Context, jobType string, limit int) (map[string]string, error) {
+	members, err := rl.activeMembers(ctx, jobType)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{activeSetKey(jobType)}
+	for _, member := range members {
+		if index, ok := slotIndex(jobType, member); ok && index < limit {
+			keys = append(keys, member)
+		}
+	}
+	result := map[string]string{}
+	if len(keys) == 1 {
+		return result, nil
+	}
+
+	reply, err := listActiveScript.Run(ctx, rl.redisConnector, keys)
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := toStrings(reply)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		slot, err := rl.decodeSlot(pairs[i], pairs[i+1])
+		if err != nil {
+			return nil, err
+		}
+		result[pairs[i]] = slot.JobID
+	}
+
+	return result, nil
+}
@@ -0,0 +1,105 @@
+package concurrency_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// assertActiveSetInSync fails t if the active set of jobType differs from its occupied slots
+func assertActiveSetInSync(t *testing.T, rl *concurrency.RateLimiter, mr *miniredis.Miniredis, jobType string, limit int) {
+	t.Helper()
+	jobs, err := rl.ListJobs(jobType, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var slots []string
+	for key, jobID := range jobs {
+		if jobID != "" {
+			slots = append(slots, key)
+		}
+	}
+	members, _ := mr.Members(jobType + "-active")
+	sort.Strings(slots)
+	sort.Strings(members)
+	if fmt.Sprint(slots) != fmt.Sprint(members) {
+		t.Errorf("the active set holds %v, the occupied slots are %v", members, slots)
+	}
+}
+
+func TestActiveSetStaysInSync(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithActiveSet())
+	defer mr.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := rl.AddJob("pool", 8, fmt.Sprintf("job-%d", i), 0); err != nil {
+			t.Fatal(err)
+		}
+		assertActiveSetInSync(t, rl, mr, "pool", 8)
+	}
+	for _, jobID := range []string{"job-1", "job-3"} {
+		if _, err := rl.DeleteJob("pool", 8, jobID); err != nil {
+			t.Fatal(err)
+		}
+		assertActiveSetInSync(t, rl, mr, "pool", 8)
+	}
+
+	jobs, err := rl.ListActiveJobs(ctx, "pool", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 || jobs["pool-0"] != "job-0" || jobs["pool-2"] != "job-2" || jobs["pool-4"] != "job-4" {
+		t.Errorf("ListActiveJobs returned %v", jobs)
+	}
+
+	// an expired slot is pruned from the set by the next read
+	if _, err := rl.AddJob("pool", 8, "short", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(2 * time.Second)
+	jobs, err = rl.ListActiveJobs(ctx, "pool", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 {
+		t.Errorf("ListActiveJobs returned %v after a slot expired", jobs)
+	}
+	assertActiveSetInSync(t, rl, mr, "pool", 8)
+}
+
+// benchmarkSparsePool fills 10 of 10000 slots and runs list on it
+func benchmarkSparsePool(b *testing.B, list func(rl *concurrency.RateLimiter) (map[string]string, error)) {
+	const limit = 10000
+	rl, mr := newTestLimiter(b, concurrency.WithActiveSet())
+	defer mr.Close()
+	for i := 0; i < 10; i++ {
+		if _, err := rl.AddJob("pool", limit, fmt.Sprintf("job-%d", i), 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := list(rl); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSparsePoolActiveSet(b *testing.B) {
+	benchmarkSparsePool(b, func(rl *concurrency.RateLimiter) (map[string]string, error) {
+		return rl.ListActiveJobs(context.Background(), "pool", 10000)
+	})
+}
+
+func BenchmarkSparsePoolMGet(b *testing.B) {
+	benchmarkSparsePool(b, func(rl *concurrency.RateLimiter) (map[string]string, error) {
+		return rl.ListJobs("pool", 10000)
+	})
+}
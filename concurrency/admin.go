@@ -0,0 +1,127 @@
+package concurrency
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// adminRequest is the json body of the admin write endpoints
+type adminRequest struct {
+	JobType string `json:"job_type"`
+	Limit   int    `json:"limit"`
+	JobID   string `json:"job_id"`
+}
+
+// AdminHandler serves an admin api of rl for debugging:
+//
+//	GET  /jobtypes/{type}?limit=N                              the DumpState of the jobType
+//	POST /release {"job_type": ..., "limit": N, "job_id": ...} deletes a job
+//	POST /clear   {"job_type": ..., "limit": N}                deletes every job of the jobType
+//
+// every request has to pass authorize first, a nil authorize rejects everything
+func AdminHandler(rl *RateLimiter, authorize func(r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorize == nil || !authorize(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/jobtypes/"):
+			adminDump(rl, w, r)
+		case r.URL.Path == "/release":
+			adminRelease(rl, w, r)
+		case r.URL.Path == "/clear":
+			adminClear(rl, w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func adminDump(rl *RateLimiter, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	jobType := strings.TrimPrefix(r.URL.Path, "/jobtypes/")
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if jobType == "" || err != nil {
+		http.Error(w, "job type and limit are required", http.StatusBadRequest)
+		return
+	}
+	if err := rl.checkLimit(limit); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dump, err := rl.DumpState(r.Context(), jobType, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, dump)
+}
+
+func adminRelease(rl *RateLimiter, w http.ResponseWriter, r *http.Request) {
+	req, ok := readAdminRequest(rl, w, r)
+	if !ok {
+		return
+	}
+	if req.JobID == "" {
+		http.Error(w, "job_id is required", http.StatusBadRequest)
+		return
+	}
+
+	released, err := rl.DeleteJob(req.JobType, req.Limit, req.JobID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]bool{"released": released})
+}
+
+func adminClear(rl *RateLimiter, w http.ResponseWriter, r *http.Request) {
+	req, ok := readAdminRequest(rl, w, r)
+	if !ok {
+		return
+	}
+
+	released, err := rl.ClearJobs(r.Context(), req.JobType, req.Limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]int{"released": released})
+}
+
+// readAdminRequest decodes the body of a write endpoint, it writes the error response itself
+func readAdminRequest(rl *RateLimiter, w http.ResponseWriter, r *http.Request) (adminRequest, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return adminRequest{}, false
+	}
+
+	var req adminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return adminRequest{}, false
+	}
+	if req.JobType == "" {
+		http.Error(w, "job_type is required", http.StatusBadRequest)
+		return adminRequest{}, false
+	}
+	if err := rl.checkLimit(req.Limit); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return adminRequest{}, false
+	}
+
+	return req, true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
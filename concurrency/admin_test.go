@@ -0,0 +1,121 @@
+package concurrency_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// adminRequest sends a request to handler with the admin token unless token is empty
+func adminRequest(handler http.Handler, method, target, body, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+func newAdminHandler(rl *concurrency.RateLimiter) http.Handler {
+	return concurrency.AdminHandler(rl, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer secret"
+	})
+}
+
+func TestAdminHandlerDump(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	handler := newAdminHandler(rl)
+	for _, jobID := range []string{"a", "b"} {
+		if _, err := rl.AddJob("pool", 3, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := adminRequest(handler, http.MethodGet, "/jobtypes/pool?limit=3", "", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /jobtypes/pool answered %d: %s", w.Code, w.Body)
+	}
+	var dump concurrency.StateDump
+	if err := json.NewDecoder(w.Body).Decode(&dump); err != nil {
+		t.Fatal(err)
+	}
+	if dump.JobType != "pool" || dump.Limit != 3 || len(dump.Jobs) != 2 || dump.Jobs[0].JobID != "a" || dump.Jobs[1].JobID != "b" {
+		t.Errorf("GET /jobtypes/pool returned %+v", dump)
+	}
+
+	for _, target := range []string{"/jobtypes/pool", "/jobtypes/pool?limit=x", "/jobtypes/pool?limit=-1", "/jobtypes/?limit=3"} {
+		if w := adminRequest(handler, http.MethodGet, target, "", "secret"); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s answered %d, want 400", target, w.Code)
+		}
+	}
+	if w := adminRequest(handler, http.MethodPost, "/jobtypes/pool?limit=3", "", "secret"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /jobtypes/pool answered %d, want 405", w.Code)
+	}
+}
+
+func TestAdminHandlerReleaseAndClear(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	handler := newAdminHandler(rl)
+	for _, jobID := range []string{"a", "b", "c"} {
+		if _, err := rl.AddJob("pool", 3, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := adminRequest(handler, http.MethodPost, "/release", `{"job_type": "pool", "limit": 3, "job_id": "b"}`, "secret")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"released":true}` {
+		t.Errorf("POST /release answered %d: %s", w.Code, w.Body)
+	}
+	if n := occupied(t, rl, "pool", 3); n != 2 {
+		t.Errorf("%d slots occupied after the release, want 2", n)
+	}
+	if w := adminRequest(handler, http.MethodPost, "/release", `{"job_type": "pool", "limit": 3}`, "secret"); w.Code != http.StatusBadRequest {
+		t.Errorf("POST /release without job_id answered %d, want 400", w.Code)
+	}
+
+	w = adminRequest(handler, http.MethodPost, "/clear", `{"job_type": "pool", "limit": 3}`, "secret")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"released":2}` {
+		t.Errorf("POST /clear answered %d: %s", w.Code, w.Body)
+	}
+	if n := occupied(t, rl, "pool", 3); n != 0 {
+		t.Errorf("%d slots occupied after the clear, want 0", n)
+	}
+	if w := adminRequest(handler, http.MethodPost, "/clear", `{"job_type": "pool", "limit": 2000000}`, "secret"); w.Code != http.StatusBadRequest {
+		t.Errorf("POST /clear with a limit above the max answered %d, want 400", w.Code)
+	}
+}
+
+func TestAdminHandlerAuth(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	if _, err := rl.AddJob("pool", 1, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := newAdminHandler(rl)
+	for _, token := range []string{"", "wrong"} {
+		if w := adminRequest(handler, http.MethodGet, "/jobtypes/pool?limit=1", "", token); w.Code != http.StatusForbidden {
+			t.Errorf("GET with token %q answered %d, want 403", token, w.Code)
+		}
+		if w := adminRequest(handler, http.MethodPost, "/clear", `{"job_type": "pool", "limit": 1}`, token); w.Code != http.StatusForbidden {
+			t.Errorf("POST /clear with token %q answered %d, want 403", token, w.Code)
+		}
+	}
+	if n := occupied(t, rl, "pool", 1); n != 1 {
+		t.Error("an unauthorized clear released the job")
+	}
+
+	// without an auth check nothing is served
+	handler = concurrency.AdminHandler(rl, nil)
+	if w := adminRequest(handler, http.MethodGet, "/jobtypes/pool?limit=1", "", "secret"); w.Code != http.StatusForbidden {
+		t.Errorf("GET without an auth check answered %d, want 403", w.Code)
+	}
+}
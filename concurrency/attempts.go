@@ -0,0 +1,52 @@
+package concurrency
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrAttemptRateExceeded defines the error when a jobType gets more acquire attempts than WithAttemptRateLimit allows
+var ErrAttemptRateExceeded = errors.New("attempt rate exceeded")
+
+// attemptLimiter is an in-process sliding window log of the acquire attempts per jobType
+type attemptLimiter struct {
+	perSecond int
+	now       func() time.Time
+
+	mu       sync.Mutex
+	attempts map[string][]time.Time
+}
+
+func newAttemptLimiter(perSecond int) *attemptLimiter {
+	return &attemptLimiter{
+		perSecond: perSecond,
+		attempts:  map[string][]time.Time{},
+	}
+}
+
+// allow records an attempt of jobType and reports whether it is within the rate
+// rejected attempts are not recorded, so a storm does not extend its own penalty
+func (l *attemptLimiter) allow(jobType string) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	window := l.attempts[jobType]
+	expired := 0
+	for expired < len(window) && now.Sub(window[expired]) >= time.Second {
+		expired++
+	}
+	window = window[expired:]
+	if len(window) >= l.perSecond {
+		l.attempts[jobType] = window
+		return false
+	}
+	l.attempts[jobType] = append(window, now)
+
+	return true
+}
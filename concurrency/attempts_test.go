@@ -0,0 +1,52 @@
+package concurrency_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+	"github.com/y4h2/golang-concurrency-limit/concurrency/concurrencytest"
+)
+
+func TestAttemptRateLimit(t *testing.T) {
+	clock := newFakeClock()
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(newTestConnector(mr))
+	rl := concurrency.NewRateLimiter(conn, testTTL,
+		concurrency.WithClock(clock.Now),
+		concurrency.WithAttemptRateLimit(3))
+
+	if _, err := rl.AddJob("pool", 1, "holder", 0); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := rl.AddJob("pool", 1, fmt.Sprintf("rejected-%d", i), 0); !errors.Is(err, concurrency.ErrNoSlot) {
+			t.Fatalf("attempt %d returned %v, want ErrNoSlot", i, err)
+		}
+	}
+
+	// the fourth attempt within a second fails without a redis call
+	calls := len(conn.Trace())
+	if _, err := rl.AddJob("pool", 1, "storm", 0); !errors.Is(err, concurrency.ErrAttemptRateExceeded) {
+		t.Errorf("AddJob beyond the rate returned %v, want ErrAttemptRateExceeded", err)
+	}
+	if n := len(conn.Trace()) - calls; n != 0 {
+		t.Errorf("AddJob beyond the rate made %d redis calls", n)
+	}
+
+	// the rate is per jobType
+	if _, err := rl.AddJob("other", 1, "job", 0); err != nil {
+		t.Errorf("AddJob of another jobType returned %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if _, err := rl.DeleteJob("pool", 1, "holder"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.AddJob("pool", 1, "later", 0); err != nil {
+		t.Errorf("AddJob in the next second returned %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package concurrency
+
+import "context"
+
+// audit actions written to the audit stream
+const (
+	auditAcquire  = "acquire"
+	auditExtend   = "extend"
+	auditRelease  = "release"
+	auditReassign = "reassign"
+)
+
+const defaultAuditMaxLen = 100000
+
+// metricAuditErrors counts the audit entries which could not be written
+// labels: job_type and action
+const metricAuditErrors = "audit_errors_total"
+
+// audit appends a slot state change to the audit stream if one is configured
+// the slot operation already happened, so a failed write is reported through the metrics hook
+// instead of failing the operation
+// token is the fencing token of the slot for acquire, extend and reassign entries and zero for releases
+func (rl *RateLimiter) audit(ctx context.Context, action, jobType, slotKey, jobID string, token int64) {
+	if rl.auditStream == "" {
+		return
+	}
+
+	err := rl.redisConnector.XAdd(ctx, rl.auditStream, rl.auditMaxLen, map[string]interface{}{
+		"job_type":  jobType,
+		"slot":      slotKey,
+		"job_id":    jobID,
+		"action":    action,
+		"timestamp": unixMilli(rl.now()),
+		"token":     token,
+	})
+	if err != nil {
+		rl.emitMetric(ctx, metricAuditErrors, 1, map[string]string{
+			"job_type": jobType,
+			"action":   action,
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package concurrency_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// auditEntries returns the fields of every entry of the audit stream, oldest first
+func auditEntries(t *testing.T, mr *miniredis.Miniredis, stream string) []map[string]string {
+	t.Helper()
+	entries, err := mr.Stream(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []map[string]string
+	for _, entry := range entries {
+		fields := map[string]string{}
+		for i := 0; i+1 < len(entry.Values); i += 2 {
+			fields[entry.Values[i]] = entry.Values[i+1]
+		}
+		result = append(result, fields)
+	}
+
+	return result
+}
+
+func TestAuditStreamRecordsOperations(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now), concurrency.WithAuditStream("audit"))
+	defer mr.Close()
+	ctx := context.Background()
+
+	_, token, err := rl.AddJobWithToken(ctx, "pool", 2, "job", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second)
+	if err := rl.ExtendJob(ctx, "pool", 2, "job", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second)
+	if _, err := rl.DeleteJob("pool", 2, "job"); err != nil {
+		t.Fatal(err)
+	}
+
+	start := clock.Now().Add(-2*time.Second).UnixNano() / int64(time.Millisecond)
+	want := []map[string]string{
+		{"action": "acquire", "timestamp": strconv.FormatInt(start, 10), "token": strconv.FormatInt(token, 10)},
+		{"action": "extend", "timestamp": strconv.FormatInt(start+1000, 10), "token": strconv.FormatInt(token, 10)},
+		{"action": "release", "timestamp": strconv.FormatInt(start+2000, 10), "token": "0"},
+	}
+	entries := auditEntries(t, mr, "audit")
+	if len(entries) != len(want) {
+		t.Fatalf("the audit stream holds %v, want %d entries", entries, len(want))
+	}
+	for i, entry := range entries {
+		want[i]["job_type"] = "pool"
+		want[i]["slot"] = "pool-0"
+		want[i]["job_id"] = "job"
+		if fmt.Sprint(entry) != fmt.Sprint(want[i]) {
+			t.Errorf("entry %d is %v, want %v", i, entry, want[i])
+		}
+	}
+}
+
+func TestAuditStreamMaxLen(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithAuditStream("audit"), concurrency.WithAuditMaxLen(2))
+	defer mr.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := rl.AddJob("pool", 4, fmt.Sprintf("job-%d", i), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries := auditEntries(t, mr, "audit")
+	if len(entries) != 2 || entries[0]["job_id"] != "job-1" || entries[1]["job_id"] != "job-2" {
+		t.Errorf("the audit stream holds %v, want the two latest entries", entries)
+	}
+}
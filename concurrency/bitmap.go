@@ -0,0 +1,36 @@
+package concurrency
+
+import "context"
+
+// OccupancyBitmap returns a bit per slot of jobType, set if the slot is occupied
+// slot i is bit i%8 of byte i/8, counting from the least significant bit
+// it reads the slots like ListJobs, from the read replica if one is configured
+func (rl *RateLimiter) OccupancyBitmap(ctx context.Context, jobType string, limit int) ([]byte, error) {
+	_, slots, err := rl.listSlots(ctx, rl.reader(), jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	bitmap := make([]byte, (len(slots)+7)/8)
+	for i, slot := range slots {
+		if slot.JobID != "" {
+			bitmap[i/8] |= 1 << uint(i%8)
+		}
+	}
+
+	return bitmap, nil
+}
+
+// OccupiedIndices returns the indices of the set bits of a bitmap returned by OccupancyBitmap
+func OccupiedIndices(bitmap []byte) []int {
+	var indices []int
+	for i, b := range bitmap {
+		for bit := 0; bit < 8; bit++ {
+			if b&(1<<uint(bit)) != 0 {
+				indices = append(indices, i*8+bit)
+			}
+		}
+	}
+
+	return indices
+}
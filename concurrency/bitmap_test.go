@@ -0,0 +1,38 @@
+package concurrency_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestOccupancyBitmap(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	for _, i := range []int{0, 3, 8, 10} {
+		mr.Set(fmt.Sprintf("pool-%d", i), fmt.Sprint("job-", i))
+	}
+	bitmap, err := rl.OccupancyBitmap(ctx, "pool", 11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x09, 0x05}; !bytes.Equal(bitmap, want) {
+		t.Errorf("OccupancyBitmap returned %08b, want %08b", bitmap, want)
+	}
+	if indices := concurrency.OccupiedIndices(bitmap); fmt.Sprint(indices) != "[0 3 8 10]" {
+		t.Errorf("OccupiedIndices returned %v, want [0 3 8 10]", indices)
+	}
+
+	bitmap, err = rl.OccupancyBitmap(ctx, "empty", 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bitmap) != 2 || len(concurrency.OccupiedIndices(bitmap)) != 0 {
+		t.Errorf("OccupancyBitmap of an empty pool returned %08b", bitmap)
+	}
+}
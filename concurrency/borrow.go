@@ -0,0 +1,290 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// luaPruneBorrowing removes the jobs whose ttl passed and counts the live jobs of every member
+// KEYS[1] is the jobs hash mapping jobID to member, KEYS[2] the expiry set, ARGV[1] the current time in milliseconds
+const luaPruneBorrowing = `
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, id in ipairs(expired) do
+	redis.call('HDEL', KEYS[1], id)
+	redis.call('ZREM', KEYS[2], id)
+end
+local counts = {}
+local total = 0
+local all = redis.call('HGETALL', KEYS[1])
+for i = 1, #all, 2 do
+	counts[all[i + 1]] = (counts[all[i + 1]] or 0) + 1
+	total = total + 1
+end
+`
+
+// borrowAcquireScript admits a job of a member of a borrowing group
+// a member below its guarantee is always admitted, if the group is at its ceiling the borrowed job
+// with the most time left of the member furthest above its guarantee is reclaimed for it;
+// a member at or above its guarantee borrows while the group is below its ceiling
+// ARGV[2] is the member, ARGV[3] the jobID, ARGV[4] the ttl in milliseconds, ARGV[5] the ceiling
+// and ARGV[6..] the member, guarantee pairs of the group
+// it returns {1} or {1, member, jobID} of the reclaimed job if admitted, {0} if not and {-1, member}
+// if the jobID already holds a slot of another member
+var borrowAcquireScript = newScript(luaPruneBorrowing + `
+local guarantees = {}
+for i = 6, #ARGV, 2 do
+	guarantees[ARGV[i]] = tonumber(ARGV[i + 1])
+end
+local member = ARGV[2]
+local reply = {1}
+local holder = redis.call('HGET', KEYS[1], ARGV[3])
+if holder and holder ~= member then
+	return {-1, holder}
+end
+if not holder then
+	local used = counts[member] or 0
+	if used < guarantees[member] then
+		if total >= tonumber(ARGV[5]) then
+			local victim, excess = nil, 0
+			for m, n in pairs(counts) do
+				local g = guarantees[m] or 0
+				if m ~= member and n - g > excess then
+					victim, excess = m, n - g
+				end
+			end
+			if not victim then
+				return {0}
+			end
+			local ids = redis.call('ZREVRANGE', KEYS[2], 0, -1)
+			for _, id in ipairs(ids) do
+				if redis.call('HGET', KEYS[1], id) == victim then
+					redis.call('HDEL', KEYS[1], id)
+					redis.call('ZREM', KEYS[2], id)
+					reply = {1, victim, id}
+					break
+				end
+			end
+		end
+	elseif total >= tonumber(ARGV[5]) then
+		return {0}
+	end
+end
+local ttl = tonumber(ARGV[4])
+redis.call('HSET', KEYS[1], ARGV[3], member)
+if ttl > 0 then
+	redis.call('ZADD', KEYS[2], tonumber(ARGV[1]) + ttl, ARGV[3])
+else
+	redis.call('ZADD', KEYS[2], '+inf', ARGV[3])
+end
+local last = redis.call('ZRANGE', KEYS[2], -1, -1, 'WITHSCORES')
+if last[2] ~= 'inf' then
+	for i = 1, 2 do
+		redis.call('PEXPIRE', KEYS[i], math.max(1, tonumber(last[2]) - tonumber(ARGV[1])))
+	end
+else
+	for i = 1, 2 do
+		redis.call('PERSIST', KEYS[i])
+	end
+end
+return reply
+`)
+
+// borrowReleaseScript removes ARGV[3] if it is a job of the member ARGV[2] and returns 1 if it was
+var borrowReleaseScript = newScript(luaPruneBorrowing + `
+if redis.call('HGET', KEYS[1], ARGV[3]) ~= ARGV[2] then
+	return 0
+end
+redis.call('ZREM', KEYS[2], ARGV[3])
+return redis.call('HDEL', KEYS[1], ARGV[3])
+`)
+
+// borrowHoldsScript returns 1 if ARGV[3] is a live job of the member ARGV[2]
+var borrowHoldsScript = newScript(luaPruneBorrowing + `
+if redis.call('HGET', KEYS[1], ARGV[3]) == ARGV[2] then
+	return 1
+end
+return 0
+`)
+
+// borrowUsageScript returns the member, count pairs of the live jobs
+var borrowUsageScript = newScript(luaPruneBorrowing + `
+local reply = {}
+for m, n in pairs(counts) do
+	table.insert(reply, m)
+	table.insert(reply, n)
+end
+return reply
+`)
+
+// BorrowingGroup shares a ceiling between related jobTypes, its members, e.g. import-high and import-low
+// every member is guaranteed a number of slots and borrows beyond it while the group is below its ceiling;
+// a member asking for a slot within its guarantee while the group is full reclaims a borrowed slot,
+// whose holder finds out through Holds or a failing Release, so borrowers should check Holds between steps
+// jobIDs are unique within the group and every job carries its own ttl like a slot
+type BorrowingGroup struct {
+	rl         *RateLimiter
+	name       string
+	ceiling    int
+	guarantees map[string]int
+}
+
+// NewBorrowingGroup is the constructor of BorrowingGroup
+// guarantees maps every member to its guaranteed slots, their sum must not exceed ceiling
+// it uses the connector, default ttl, clock and metrics of rl
+func NewBorrowingGroup(rl *RateLimiter, name string, ceiling int, guarantees map[string]int) (*BorrowingGroup, error) {
+	if err := rl.checkLimit(ceiling); err != nil {
+		return nil, err
+	}
+	sum := 0
+	for member, guarantee := range guarantees {
+		if guarantee < 0 {
+			return nil, fmt.Errorf("%w: guarantee %d of %s", ErrInvalidLimit, guarantee, member)
+		}
+		sum += guarantee
+	}
+	if sum > ceiling {
+		return nil, fmt.Errorf("%w: guarantees sum to %d, ceiling %d", ErrInvalidLimit, sum, ceiling)
+	}
+
+	copied := make(map[string]int, len(guarantees))
+	for member, guarantee := range guarantees {
+		copied[member] = guarantee
+	}
+
+	return &BorrowingGroup{rl: rl, name: name, ceiling: ceiling, guarantees: copied}, nil
+}
+
+// keys returns the jobs hash and the expiry set of the group
+func (g *BorrowingGroup) keys() []string {
+	return []string{fmt.Sprintf("%s-borrowing", g.name), fmt.Sprintf("%s-borrowing-expiry", g.name)}
+}
+
+// guaranteeArgs returns the member, guarantee pairs in a stable order
+func (g *BorrowingGroup) guaranteeArgs() []interface{} {
+	members := make([]string, 0, len(g.guarantees))
+	for member := range g.guarantees {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+
+	args := make([]interface{}, 0, 2*len(members))
+	for _, member := range members {
+		args = append(args, member, g.guarantees[member])
+	}
+
+	return args
+}
+
+// Acquire admits jobID as a job of member, see BorrowingGroup for when a member may borrow
+// it returns a *RejectedError matching ErrNoSlot if the group has no slot for member
+// a jobID is generated if the given one is empty, acquiring again renews the ttl of the job
+func (g *BorrowingGroup) Acquire(ctx context.Context, member, jobID string, ttl time.Duration) (_ string, err error) {
+	start := time.Now()
+	defer func() {
+		g.rl.observeOperation(ctx, "borrowing_acquire", member, start, err)
+		err = rejection(member, err)
+	}()
+
+	if err := g.rl.rejectDryRun("BorrowingGroup.Acquire"); err != nil {
+		return "", err
+	}
+
+	if _, ok := g.guarantees[member]; !ok {
+		return "", fmt.Errorf("%s is not a member of borrowing group %s", member, g.name)
+	}
+	if jobID == "" {
+		if jobID, err = newJobID(); err != nil {
+			return "", err
+		}
+	}
+	if err := g.rl.validateJobID(jobID); err != nil {
+		return "", err
+	}
+	ttl, err = g.rl.acquireTTL(ctx, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	args := append([]interface{}{unixMilli(g.rl.now()), member, jobID, ttlMilli(ttl), g.ceiling}, g.guaranteeArgs()...)
+	reply, err := borrowAcquireScript.Run(ctx, g.rl.redisConnector, g.keys(), args...)
+	if err != nil {
+		return "", err
+	}
+	items, ok := reply.([]interface{})
+	if !ok || len(items) == 0 {
+		return "", fmt.Errorf("unexpected script reply %v", reply)
+	}
+	status, err := toInt64(items[0])
+	if err != nil {
+		return "", err
+	}
+	switch status {
+	case 0:
+		return "", ErrNoSlot
+	case -1:
+		return "", fmt.Errorf("job %s already holds a slot of %v in borrowing group %s", jobID, items[1], g.name)
+	}
+	if len(items) == 3 {
+		g.rl.logf("concurrency: %s reclaimed the slot borrowed by job %v of %v in borrowing group %s", member, items[2], items[1], g.name)
+	}
+
+	return jobID, nil
+}
+
+// Release gives the slot of jobID back, it reports whether the job still held one of member
+func (g *BorrowingGroup) Release(ctx context.Context, member, jobID string) (_ bool, err error) {
+	start := time.Now()
+	defer func() {
+		g.rl.observeOperation(ctx, "borrowing_release", member, start, err)
+	}()
+
+	reply, err := borrowReleaseScript.Run(ctx, g.rl.redisConnector, g.keys(), unixMilli(g.rl.now()), member, jobID)
+	if err != nil {
+		return false, err
+	}
+	released, err := toInt64(reply)
+
+	return released == 1, err
+}
+
+// Holds reports whether jobID still holds a slot of member, a borrowed slot may have been reclaimed
+// it runs on the primary since it removes expired jobs on the way
+func (g *BorrowingGroup) Holds(ctx context.Context, member, jobID string) (bool, error) {
+	reply, err := borrowHoldsScript.Run(ctx, g.rl.redisConnector, g.keys(), unixMilli(g.rl.now()), member, jobID)
+	if err != nil {
+		return false, err
+	}
+	held, err := toInt64(reply)
+
+	return held == 1, err
+}
+
+// Usage returns the number of live jobs of every member with at least one
+// it runs on the primary since it removes expired jobs on the way
+func (g *BorrowingGroup) Usage(ctx context.Context) (map[string]int, error) {
+	reply, err := borrowUsageScript.Run(ctx, g.rl.redisConnector, g.keys(), unixMilli(g.rl.now()))
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected script reply %v", reply)
+	}
+
+	usage := make(map[string]int, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		member, ok := items[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected script reply item %v", items[i])
+		}
+		n, err := toInt64(items[i+1])
+		if err != nil {
+			return nil, err
+		}
+		usage[member] = int(n)
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,113 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestBorrowingGroup(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now), concurrency.WithLogger(&testLogger{}))
+	defer mr.Close()
+	ctx := context.Background()
+
+	g, err := concurrency.NewBorrowingGroup(rl, "import", 4, map[string]int{"import-high": 2, "import-low": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	usage := func() string {
+		t.Helper()
+		u, err := g.Usage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(u)
+	}
+
+	// the high pool is idle, the low pool borrows its capacity
+	for i := 0; i < 4; i++ {
+		if _, err := g.Acquire(ctx, "import-low", fmt.Sprintf("low-%d", i), 0); err != nil {
+			t.Fatalf("import-low borrowing slot %d: %v", i, err)
+		}
+	}
+	if _, err := g.Acquire(ctx, "import-low", "low-4", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("import-low beyond the ceiling returned %v, want ErrNoSlot", err)
+	}
+	if got := usage(); got != "map[import-low:4]" {
+		t.Errorf("usage %s, want import-low borrowing the whole ceiling", got)
+	}
+
+	// the high pool reclaims its guarantee from the borrower
+	for _, jobID := range []string{"high-0", "high-1"} {
+		if _, err := g.Acquire(ctx, "import-high", jobID, 0); err != nil {
+			t.Fatalf("import-high taking its guarantee with %s: %v", jobID, err)
+		}
+	}
+	if got := usage(); got != "map[import-high:2 import-low:2]" {
+		t.Errorf("usage %s after the reclaim, want both pools at their guarantee", got)
+	}
+	if _, err := g.Acquire(ctx, "import-high", "high-2", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("import-high beyond its guarantee in a full group returned %v, want ErrNoSlot", err)
+	}
+	if _, err := g.Acquire(ctx, "import-low", "low-4", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("import-low beyond its guarantee in a full group returned %v, want ErrNoSlot", err)
+	}
+
+	// the borrowers find out that their slots were reclaimed
+	held := 0
+	for i := 0; i < 4; i++ {
+		ok, err := g.Holds(ctx, "import-low", fmt.Sprintf("low-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok {
+			held++
+		} else if released, err := g.Release(ctx, "import-low", fmt.Sprintf("low-%d", i)); err != nil || released {
+			t.Errorf("Release of a reclaimed slot returned %v, %v", released, err)
+		}
+	}
+	if held != 2 {
+		t.Errorf("import-low still holds %d slots, want 2", held)
+	}
+
+	// a released slot can be borrowed again
+	if released, err := g.Release(ctx, "import-high", "high-1"); err != nil || !released {
+		t.Fatalf("Release returned %v, %v", released, err)
+	}
+	if _, err := g.Acquire(ctx, "import-low", "low-4", 0); err != nil {
+		t.Errorf("import-low borrowing a released slot: %v", err)
+	}
+	if _, err := g.Acquire(ctx, "import-high", "low-4", 0); err == nil || errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("import-high acquiring a jobID of import-low returned %v", err)
+	}
+
+	// jobs expire with their ttl
+	clock.Advance(testTTL + time.Second)
+	if got := usage(); got != "map[]" {
+		t.Errorf("usage %s after the ttl passed, want none", got)
+	}
+}
+
+func TestBorrowingGroupGuarantees(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	if _, err := concurrency.NewBorrowingGroup(rl, "import", 3, map[string]int{"a": 2, "b": 2}); !errors.Is(err, concurrency.ErrInvalidLimit) {
+		t.Errorf("guarantees beyond the ceiling returned %v, want ErrInvalidLimit", err)
+	}
+	if _, err := concurrency.NewBorrowingGroup(rl, "import", 3, map[string]int{"a": -1}); !errors.Is(err, concurrency.ErrInvalidLimit) {
+		t.Errorf("a negative guarantee returned %v, want ErrInvalidLimit", err)
+	}
+	g, err := concurrency.NewBorrowingGroup(rl, "import", 3, map[string]int{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Acquire(context.Background(), "stranger", "job", 0); err == nil {
+		t.Error("a jobType outside the group acquired a slot")
+	}
+}
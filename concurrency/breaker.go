@@ -0,0 +1,226 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrBackendUnavailable defines the error when the circuit breaker is open
+var ErrBackendUnavailable = errors.New("backend unavailable")
+
+// metricBreakerState is the state of the circuit breaker, 0 closed, 1 half-open and 2 open
+const metricBreakerState = "circuit_breaker_state"
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerHalfOpen
+	breakerOpen
+)
+
+// circuitBreaker fails calls fast after a number of consecutive failures
+// once the cooldown has passed, a single probe call is let through to test the backend
+type circuitBreaker struct {
+	failures int
+	cooldown time.Duration
+	now      func() time.Time
+	onChange func(ctx context.Context, state breakerState)
+
+	mu          sync.Mutex
+	state       breakerState
+	consecutive int
+	openedAt    time.Time
+	probing     bool
+}
+
+// allow reports whether a call may go to the backend
+// a call whose context is already done fails with ctx.Err() and does not count as a probe
+func (b *circuitBreaker) allow(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			b.mu.Unlock()
+			return ErrBackendUnavailable
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		b.mu.Unlock()
+		b.onChange(ctx, breakerHalfOpen)
+		return nil
+	case breakerHalfOpen:
+		defer b.mu.Unlock()
+		if b.probing {
+			return ErrBackendUnavailable
+		}
+		b.probing = true
+		return nil
+	}
+	b.mu.Unlock()
+
+	return nil
+}
+
+// record updates the breaker with the result of a call
+// only a reply of the backend closes the breaker, a call which ended without one, e.g. because it was
+// cancelled, leaves the state as it is and a half-open breaker lets the next call probe again
+func (b *circuitBreaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	previous := b.state
+	switch {
+	case isBackendFailure(err):
+		b.consecutive++
+		if b.state == breakerHalfOpen || b.consecutive >= b.failures {
+			b.state = breakerOpen
+			b.openedAt = b.now()
+		}
+	case isBackendReply(err):
+		b.consecutive = 0
+		b.state = breakerClosed
+	}
+	b.probing = false
+	current := b.state
+	b.mu.Unlock()
+
+	if current != previous {
+		b.onChange(ctx, current)
+	}
+}
+
+// isBackendFailure reports whether err indicates an unhealthy backend, a transport, connection or timeout error
+// an error reply, e.g. a failing script or a WRONGTYPE key, or a caller giving up is not the backend's fault,
+// so one bad key or script does not trip the breaker for every jobType
+func isBackendFailure(err error) bool {
+	return err != nil && !isBackendReply(err) && !errors.Is(err, context.Canceled)
+}
+
+// isBackendReply reports whether the backend answered the call
+// a missing key, an unloaded script and every other error reply of redis is an answer
+func isBackendReply(err error) bool {
+	var reply redis.Error
+	return err == nil || errors.Is(err, redis.Nil) || isNoScript(err) || errors.As(err, &reply)
+}
+
+// breakerConnector guards every call to conn with a circuit breaker
+type breakerConnector struct {
+	conn    RedisConnector
+	breaker *circuitBreaker
+}
+
+func (c *breakerConnector) MGet(ctx context.Context, keys []string) ([]string, error) {
+	if err := c.breaker.allow(ctx); err != nil {
+		return nil, err
+	}
+	values, err := c.conn.MGet(ctx, keys)
+	c.breaker.record(ctx, err)
+
+	return values, err
+}
+
+func (c *breakerConnector) Get(ctx context.Context, key string) (string, error) {
+	if err := c.breaker.allow(ctx); err != nil {
+		return "", err
+	}
+	value, err := c.conn.Get(ctx, key)
+	c.breaker.record(ctx, err)
+
+	return value, err
+}
+
+func (c *breakerConnector) Del(ctx context.Context, keys ...string) error {
+	if err := c.breaker.allow(ctx); err != nil {
+		return err
+	}
+	err := c.conn.Del(ctx, keys...)
+	c.breaker.record(ctx, err)
+
+	return err
+}
+
+func (c *breakerConnector) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	if err := c.breaker.allow(ctx); err != nil {
+		return err
+	}
+	err := c.conn.Set(ctx, key, value, ttl)
+	c.breaker.record(ctx, err)
+
+	return err
+}
+
+func (c *breakerConnector) PTTL(ctx context.Context, keys []string) ([]time.Duration, error) {
+	if err := c.breaker.allow(ctx); err != nil {
+		return nil, err
+	}
+	ttls, err := c.conn.PTTL(ctx, keys)
+	c.breaker.record(ctx, err)
+
+	return ttls, err
+}
+
+func (c *breakerConnector) BLPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error) {
+	if err := c.breaker.allow(ctx); err != nil {
+		return nil, err
+	}
+	popped, err := c.conn.BLPop(ctx, timeout, keys...)
+	c.breaker.record(ctx, err)
+
+	return popped, err
+}
+
+func (c *breakerConnector) RPush(ctx context.Context, key string, values ...string) error {
+	if err := c.breaker.allow(ctx); err != nil {
+		return err
+	}
+	err := c.conn.RPush(ctx, key, values...)
+	c.breaker.record(ctx, err)
+
+	return err
+}
+
+func (c *breakerConnector) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) error {
+	if err := c.breaker.allow(ctx); err != nil {
+		return err
+	}
+	err := c.conn.XAdd(ctx, stream, maxLen, values)
+	c.breaker.record(ctx, err)
+
+	return err
+}
+
+func (c *breakerConnector) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	if err := c.breaker.allow(ctx); err != nil {
+		return nil, err
+	}
+	reply, err := c.conn.Eval(ctx, script, keys, args...)
+	c.breaker.record(ctx, err)
+
+	return reply, err
+}
+
+func (c *breakerConnector) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	if err := c.breaker.allow(ctx); err != nil {
+		return nil, err
+	}
+	reply, err := c.conn.EvalSha(ctx, sha, keys, args...)
+	c.breaker.record(ctx, err)
+
+	return reply, err
+}
+
+func (c *breakerConnector) ScriptLoad(ctx context.Context, script string) (string, error) {
+	if err := c.breaker.allow(ctx); err != nil {
+		return "", err
+	}
+	sha, err := c.conn.ScriptLoad(ctx, script)
+	c.breaker.record(ctx, err)
+
+	return sha, err
+}
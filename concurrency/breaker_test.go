@@ -0,0 +1,201 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// stallingConnector blocks Get calls until their context is done while stalled is set
+// Get is the first call of an acquisition with WithPause, it reads the pause flag
+type stallingConnector struct {
+	concurrency.RedisConnector
+	stalled int32
+	calls   chan struct{}
+}
+
+func (c *stallingConnector) Get(ctx context.Context, key string) (string, error) {
+	if atomic.LoadInt32(&c.stalled) == 1 {
+		c.calls <- struct{}{}
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+	return c.RedisConnector.Get(ctx, key)
+}
+
+// downConnector fails the calls of an acquisition with a connection error while down is set
+type downConnector struct {
+	concurrency.RedisConnector
+	down int32
+}
+
+// err returns the connection error while down is set
+func (c *downConnector) err() error {
+	if atomic.LoadInt32(&c.down) == 1 {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	return nil
+}
+
+func (c *downConnector) Get(ctx context.Context, key string) (string, error) {
+	if err := c.err(); err != nil {
+		return "", err
+	}
+	return c.RedisConnector.Get(ctx, key)
+}
+
+func (c *downConnector) MGet(ctx context.Context, keys []string) ([]string, error) {
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	return c.RedisConnector.MGet(ctx, keys)
+}
+
+func (c *downConnector) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	if err := c.err(); err != nil {
+		return nil, err
+	}
+	return c.RedisConnector.EvalSha(ctx, sha, keys, args...)
+}
+
+// breakerStates returns the values of the circuit breaker state metrics emitted to sink
+func breakerStates(sink *metricSink) []float64 {
+	var states []float64
+	for _, m := range sink.Metrics() {
+		if m.Name == "circuit_breaker_state" {
+			states = append(states, m.Value)
+		}
+	}
+
+	return states
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	clock := newFakeClock()
+	sink := &metricSink{}
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := &downConnector{RedisConnector: newTestConnector(mr)}
+	rl := concurrency.NewRateLimiter(conn, testTTL,
+		concurrency.WithClock(clock.Now),
+		concurrency.WithMetricsHook(sink.hook),
+		concurrency.WithCircuitBreaker(2, time.Minute))
+
+	// closed: failures reach the backend until the threshold
+	atomic.StoreInt32(&conn.down, 1)
+	for i := 0; i < 2; i++ {
+		if _, err := rl.AddJob("pool", 2, "job", 0); err == nil || errors.Is(err, concurrency.ErrBackendUnavailable) {
+			t.Fatalf("AddJob %d returned %v, want the backend error", i, err)
+		}
+	}
+
+	// open: calls fail fast, even once the backend is back
+	atomic.StoreInt32(&conn.down, 0)
+	if _, err := rl.AddJob("pool", 2, "job", 0); !errors.Is(err, concurrency.ErrBackendUnavailable) {
+		t.Fatalf("AddJob on an open breaker returned %v, want ErrBackendUnavailable", err)
+	}
+	if mr.Exists("pool-0") || mr.Exists("pool-1") {
+		t.Fatal("a slot was taken while the breaker is open")
+	}
+
+	// half-open: a failed probe opens the breaker again
+	clock.Advance(time.Minute)
+	atomic.StoreInt32(&conn.down, 1)
+	if _, err := rl.AddJob("pool", 2, "job", 0); err == nil || errors.Is(err, concurrency.ErrBackendUnavailable) {
+		t.Fatalf("the probe returned %v, want the backend error", err)
+	}
+	atomic.StoreInt32(&conn.down, 0)
+	if _, err := rl.AddJob("pool", 2, "job", 0); !errors.Is(err, concurrency.ErrBackendUnavailable) {
+		t.Fatalf("AddJob after a failed probe returned %v, want ErrBackendUnavailable", err)
+	}
+
+	// half-open: a successful probe closes the breaker
+	clock.Advance(time.Minute)
+	if _, err := rl.AddJob("pool", 2, "job", 0); err != nil {
+		t.Fatalf("the probe returned %v", err)
+	}
+	if _, err := rl.AddJob("pool", 2, "other", 0); err != nil {
+		t.Fatalf("AddJob on a closed breaker returned %v", err)
+	}
+
+	want := []float64{2, 1, 2, 1, 0}
+	if got := breakerStates(sink); len(got) != len(want) {
+		t.Errorf("the breaker went through states %v, want %v", got, want)
+	} else {
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("the breaker went through states %v, want %v", got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestCircuitBreakerCancelledProbe(t *testing.T) {
+	clock := newFakeClock()
+	mr := newTestRedis(t)
+	defer mr.Close()
+	down := &downConnector{RedisConnector: newTestConnector(mr)}
+	conn := &stallingConnector{RedisConnector: down, calls: make(chan struct{}, 1)}
+	sink := &metricSink{}
+	rl := concurrency.NewRateLimiter(conn, testTTL,
+		concurrency.WithClock(clock.Now),
+		concurrency.WithMetricsHook(sink.hook),
+		concurrency.WithCircuitBreaker(1, time.Minute),
+		concurrency.WithPause())
+
+	atomic.StoreInt32(&down.down, 1)
+	if _, err := rl.AddJob("pool", 2, "job", 0); err == nil {
+		t.Fatal("AddJob succeeded on a failing backend")
+	}
+	atomic.StoreInt32(&down.down, 0)
+	clock.Advance(time.Minute)
+
+	// the probe is cancelled before the backend answers
+	atomic.StoreInt32(&conn.stalled, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	probe := make(chan error, 1)
+	go func() {
+		_, err := rl.AcquireWait(ctx, "pool", 2, "job", 0, 0)
+		probe <- err
+	}()
+	<-conn.calls
+	cancel()
+	if err := <-probe; !errors.Is(err, context.Canceled) {
+		t.Fatalf("the cancelled probe returned %v, want context.Canceled", err)
+	}
+	atomic.StoreInt32(&conn.stalled, 0)
+
+	// the cancellation neither closed nor reopened the breaker, the next call probes
+	if got := breakerStates(sink); len(got) != 2 || got[0] != 2 || got[1] != 1 {
+		t.Errorf("the breaker went through states %v, want it left half-open", got)
+	}
+	if _, err := rl.AddJob("pool", 2, "job", 0); err != nil {
+		t.Fatalf("the next probe returned %v", err)
+	}
+	if n := occupied(t, rl, "pool", 2); n != 1 {
+		t.Errorf("%d slots occupied, want the probe's slot", n)
+	}
+}
+
+func TestCircuitBreakerIgnoresErrorReplies(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithCircuitBreaker(1, time.Minute))
+	defer mr.Close()
+
+	// an error reply of redis is an answer, it says nothing about the health of the backend
+	mr.SetError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	for i := 0; i < 3; i++ {
+		if _, err := rl.AddJob("pool", 2, "job", 0); err == nil || errors.Is(err, concurrency.ErrBackendUnavailable) {
+			t.Fatalf("AddJob %d returned %v, want the error reply", i, err)
+		}
+	}
+	mr.SetError("")
+	if _, err := rl.AddJob("other", 2, "job", 0); err != nil {
+		t.Errorf("AddJob after error replies returned %v, want the breaker still closed", err)
+	}
+}
@@ -0,0 +1,55 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// BucketedLimiter limits a jobType to limit concurrent jobs within each time window
+// every window gets its own set of slots, so acquisitions in a new window start with a full pool
+// a slot belongs to the window it was acquired in, a job held across the boundary keeps it
+// until it is deleted or its ttl passes but no longer counts against the following windows
+type BucketedLimiter struct {
+	rl     *RateLimiter
+	window time.Duration
+}
+
+// NewBucketedLimiter is the constructor of BucketedLimiter
+// it uses the connector, clock and options of rl, it returns an error if window is not positive
+func NewBucketedLimiter(rl *RateLimiter, window time.Duration) (*BucketedLimiter, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("bucket window must be positive, got %v", window)
+	}
+
+	return &BucketedLimiter{rl: rl, window: window}, nil
+}
+
+// Bucket returns the bucket of the current window
+func (b *BucketedLimiter) Bucket() int64 {
+	return b.rl.now().UnixNano() / int64(b.window)
+}
+
+// bucketJobType returns the jobType of bucket, its slot keys are derived by GenJobKeys as usual
+func bucketJobType(jobType string, bucket int64) string {
+	return fmt.Sprintf("%s-bucket-%d", jobType, bucket)
+}
+
+// AddJob adds a job to the slots of jobType in the current window, see AddJob
+// it returns the bucket the slot belongs to, DeleteJob needs it to release the slot
+func (b *BucketedLimiter) AddJob(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) (bucket int64, id string, err error) {
+	bucket = b.Bucket()
+	id, err = b.rl.addJob(ctx, bucketJobType(jobType, bucket), limit, jobID, ttl)
+
+	return bucket, id, err
+}
+
+// ListJobs lists the jobs of jobType in bucket, see ListJobs
+func (b *BucketedLimiter) ListJobs(ctx context.Context, jobType string, limit int, bucket int64) (map[string]string, error) {
+	return b.rl.listJobs(ctx, b.rl.reader(), bucketJobType(jobType, bucket), limit)
+}
+
+// DeleteJob releases the slot jobID holds in bucket, see DeleteJob
+func (b *BucketedLimiter) DeleteJob(ctx context.Context, jobType string, limit int, bucket int64, jobID string) (bool, error) {
+	return b.rl.deleteJob(ctx, bucketJobType(jobType, bucket), limit, jobID)
+}
@@ -0,0 +1,73 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestBucketedLimiterResetsEachWindow(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now))
+	defer mr.Close()
+	ctx := context.Background()
+
+	// the fake clock starts on a minute boundary
+	b, err := concurrency.NewBucketedLimiter(rl, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := b.Bucket()
+	for _, jobID := range []string{"a", "b"} {
+		bucket, _, err := b.AddJob(ctx, "pool", 2, jobID, 0)
+		if err != nil || bucket != first {
+			t.Fatalf("AddJob %s returned bucket %d, %v, want %d", jobID, bucket, err, first)
+		}
+	}
+	clock.Advance(59 * time.Second)
+	if _, _, err := b.AddJob(ctx, "pool", 2, "c", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("AddJob at the end of a full window returned %v, want ErrNoSlot", err)
+	}
+
+	// the next window starts with a full pool while the held jobs stay in theirs
+	clock.Advance(time.Second)
+	for _, jobID := range []string{"c", "d"} {
+		bucket, _, err := b.AddJob(ctx, "pool", 2, jobID, 0)
+		if err != nil || bucket != first+1 {
+			t.Fatalf("AddJob %s in the next window returned bucket %d, %v, want %d", jobID, bucket, err, first+1)
+		}
+	}
+	if _, _, err := b.AddJob(ctx, "pool", 2, "e", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("AddJob beyond the limit of the next window returned %v, want ErrNoSlot", err)
+	}
+	jobs, err := b.ListJobs(ctx, "pool", 2, first)
+	if err != nil || jobs[fmt.Sprintf("pool-bucket-%d-0", first)] != "a" || len(jobs) != 2 {
+		t.Errorf("ListJobs of the first window returned %v, %v", jobs, err)
+	}
+
+	// a job is released in the window it was acquired in
+	if released, err := b.DeleteJob(ctx, "pool", 2, first+1, "a"); err != nil || released {
+		t.Errorf("DeleteJob in another window returned %v, %v", released, err)
+	}
+	if released, err := b.DeleteJob(ctx, "pool", 2, first, "a"); err != nil || !released {
+		t.Errorf("DeleteJob in the acquisition window returned %v, %v", released, err)
+	}
+	if _, _, err := b.AddJob(ctx, "pool", 2, "e", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("a release in the first window freed a slot of the current one: %v", err)
+	}
+}
+
+func TestBucketedLimiterWindow(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	for _, window := range []time.Duration{0, -time.Minute} {
+		if _, err := concurrency.NewBucketedLimiter(rl, window); err == nil {
+			t.Errorf("NewBucketedLimiter with window %v succeeded", window)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// metricChurnRate is the rate of acquisitions and releases per second computed by ChurnRate
+// labels: job_type
+const metricChurnRate = "churn_rate_per_second"
+
+// churnWindow is the window ChurnRate averages over
+const churnWindow = time.Minute
+
+// churnSample is the number of grants and releases of a jobType seen at a time
+type churnSample struct {
+	at    time.Time
+	total int64
+}
+
+// churnSamples keeps the samples of the persistent counters taken by ChurnRate per jobType
+type churnSamples struct {
+	mu      sync.Mutex
+	samples map[string][]churnSample
+}
+
+// add records a sample and returns the oldest one within the window, which is s itself for the first sample
+func (c *churnSamples) add(jobType string, s churnSample) churnSample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.samples == nil {
+		c.samples = map[string][]churnSample{}
+	}
+	samples := append(c.samples[jobType], s)
+	expired := 0
+	for expired < len(samples)-1 && s.at.Sub(samples[expired+1].at) >= churnWindow {
+		expired++
+	}
+	samples = samples[expired:]
+	c.samples[jobType] = samples
+
+	return samples[0]
+}
+
+// ChurnRate returns the acquisitions plus releases of jobType per second over about the last minute
+// and emits it to the metrics hook
+// it samples the persistent counters on every call, so it requires WithPersistentCounters and
+// has to be called periodically, e.g. from a metrics scrape; the first call returns zero
+// without WithPersistentCounters it returns an error since the counters never change
+func (rl *RateLimiter) ChurnRate(ctx context.Context, jobType string) (perSecond float64, err error) {
+	if !rl.persistentCounters {
+		return 0, errors.New("ChurnRate requires WithPersistentCounters")
+	}
+	stats, err := rl.LifetimeStats(ctx, jobType)
+	if err != nil {
+		return 0, err
+	}
+
+	now := churnSample{at: rl.now(), total: stats.Grants + stats.Releases}
+	oldest := rl.churn.add(jobType, now)
+	if elapsed := now.at.Sub(oldest.at).Seconds(); elapsed > 0 {
+		perSecond = float64(now.total-oldest.total) / elapsed
+	}
+	rl.emitMetric(ctx, metricChurnRate, perSecond, map[string]string{"job_type": jobType})
+
+	return perSecond, nil
+}
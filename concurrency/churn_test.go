@@ -0,0 +1,64 @@
+package concurrency_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestChurnRate(t *testing.T) {
+	clock := newFakeClock()
+	sink := &metricSink{}
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now), concurrency.WithPersistentCounters(),
+		concurrency.WithMetricsHook(sink.hook))
+	defer mr.Close()
+	ctx := context.Background()
+
+	if rate, err := rl.ChurnRate(ctx, "pool"); err != nil || rate != 0 {
+		t.Fatalf("the first ChurnRate returned %v, %v, want zero", rate, err)
+	}
+
+	// 10 acquisitions and 10 releases within 10 seconds
+	for i := 0; i < 10; i++ {
+		jobID := fmt.Sprint("job-", i)
+		if _, err := rl.AddJob("pool", 2, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rl.DeleteJob("pool", 2, jobID); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Second)
+	}
+	rate, err := rl.ChurnRate(ctx, "pool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate != 2 {
+		t.Errorf("ChurnRate returned %v, want 2 per second", rate)
+	}
+
+	// the samples from before the window are dropped
+	clock.Advance(time.Minute)
+	if rate, err := rl.ChurnRate(ctx, "pool"); err != nil || rate != 0 {
+		t.Errorf("ChurnRate after an idle minute returned %v, %v, want zero", rate, err)
+	}
+
+	var emitted []float64
+	for _, m := range sink.Metrics() {
+		if m.Name == "churn_rate_per_second" && m.Labels["job_type"] == "pool" {
+			emitted = append(emitted, m.Value)
+		}
+	}
+	if fmt.Sprint(emitted) != "[0 2 0]" {
+		t.Errorf("emitted churn rates %v, want [0 2 0]", emitted)
+	}
+
+	rl, mr2 := newTestLimiter(t)
+	defer mr2.Close()
+	if _, err := rl.ChurnRate(ctx, "pool"); err == nil {
+		t.Error("ChurnRate without persistent counters succeeded")
+	}
+}
@@ -0,0 +1,70 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrClockSkew defines the error when the clock of the limiter and the clock of redis differ beyond the tolerance
+var ErrClockSkew = errors.New("clock skew")
+
+// serverTimeScript returns the redis server time as {seconds, microseconds}
+// it goes through a script so every connector supports it without a dedicated method
+var serverTimeScript = newScript(`
+return redis.call('TIME')
+`)
+
+// serverTime returns the current time of the redis server
+func (rl *RateLimiter) serverTime(ctx context.Context) (time.Time, error) {
+	reply, err := serverTimeScript.Run(ctx, rl.redisConnector, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	parts, err := toStrings(reply)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(parts) != 2 {
+		return time.Time{}, fmt.Errorf("unexpected TIME reply %v", reply)
+	}
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("TIME seconds %q: %w", parts[0], err)
+	}
+	usec, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("TIME microseconds %q: %w", parts[1], err)
+	}
+
+	return time.Unix(sec, usec*int64(time.Microsecond)), nil
+}
+
+// CheckClockSkew compares the clock of the limiter with the time of the redis server
+// and returns ErrClockSkew if they differ by more than tolerance
+// stored acquisition and renewal timestamps come from the limiter clock, so orphan detection,
+// WithMaxHoldTime and ReleaseIfStale assume the clocks of every instance are close; call it at
+// startup to fail fast on a misconfigured host, it is never run automatically
+// the local time is taken halfway through the round trip, so network latency does not count as skew
+func (rl *RateLimiter) CheckClockSkew(ctx context.Context, tolerance time.Duration) error {
+	before := rl.now()
+	server, err := rl.serverTime(ctx)
+	if err != nil {
+		return err
+	}
+	after := rl.now()
+
+	local := before.Add(after.Sub(before) / 2)
+	skew := server.Sub(local)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > tolerance {
+		return fmt.Errorf("%w: redis time %s, local time %s, skew %s, tolerance %s",
+			ErrClockSkew, server.UTC().Format(time.RFC3339Nano), local.UTC().Format(time.RFC3339Nano), skew, tolerance)
+	}
+
+	return nil
+}
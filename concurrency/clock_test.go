@@ -0,0 +1,63 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// skewedTimeConnector answers every script, the TIME call of CheckClockSkew, with a fixed server time
+type skewedTimeConnector struct {
+	concurrency.RedisConnector
+	server time.Time
+}
+
+func (c skewedTimeConnector) reply() []interface{} {
+	return []interface{}{
+		strconv.FormatInt(c.server.Unix(), 10),
+		strconv.FormatInt(int64(c.server.Nanosecond()/1000), 10),
+	}
+}
+
+func (c skewedTimeConnector) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return c.reply(), nil
+}
+
+func (c skewedTimeConnector) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	return c.reply(), nil
+}
+
+func TestCheckClockSkew(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	clock := newFakeClock()
+
+	for _, tt := range []struct {
+		skew time.Duration
+		err  bool
+	}{
+		{0, false},
+		{4 * time.Second, false},
+		{-4 * time.Second, false},
+		{5 * time.Second, false},
+		{6 * time.Second, true},
+		{-6 * time.Second, true},
+	} {
+		conn := skewedTimeConnector{RedisConnector: newTestConnector(mr), server: clock.Now().Add(tt.skew)}
+		rl := concurrency.NewRateLimiter(conn, testTTL, concurrency.WithClock(clock.Now))
+		err := rl.CheckClockSkew(context.Background(), 5*time.Second)
+		if tt.err != errors.Is(err, concurrency.ErrClockSkew) || (!tt.err && err != nil) {
+			t.Errorf("CheckClockSkew with a skew of %v returned %v", tt.skew, err)
+		}
+	}
+
+	// the real server shares the clock of the test
+	rl := concurrency.NewRateLimiter(newTestConnector(mr), testTTL)
+	if err := rl.CheckClockSkew(context.Background(), 5*time.Second); err != nil {
+		t.Errorf("CheckClockSkew against redis: %v", err)
+	}
+}
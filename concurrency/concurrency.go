@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -13,96 +14,900 @@ import (
 // ErrNoSlot defines the error when beyond concurrency
 var ErrNoSlot = errors.New("beyond concurrency")
 
+// ErrInvalidLimit defines the error when a limit is negative, or zero for an operation which needs slots
+var ErrInvalidLimit = errors.New("invalid limit")
+
+// ErrLimitTooLarge defines the error when a limit exceeds the max limit
+var ErrLimitTooLarge = errors.New("limit too large")
+
+// ErrPoolDisabled defines the error when a job is added to a jobType with a limit of zero
+var ErrPoolDisabled = errors.New("pool disabled")
+
+// DefaultMaxLimit is the max limit unless WithMaxLimit says otherwise
+const DefaultMaxLimit = 1000000
+
+// defaultDelBatchSize is the max number of keys per Del unless WithDelBatchSize says otherwise
+const defaultDelBatchSize = 500
+
+// ErrJobNotFound defines the error when a job does not hold any slot
+var ErrJobNotFound = errors.New("job not found")
+
+// extendScript resets the ttl of every slot held by a job, stamps the renewal time
+// and returns their keys and fencing tokens as pairs
+// KEYS are the slot keys, ARGV[1] the jobID, ARGV[2] the ttl in milliseconds,
+// ARGV[3] the renewal time, ARGV[4] the position of the renewal field and ARGV[5] the position of the token field
+var extendScript = newScript(luaJobID + luaSlotFields + `
+local extended = {}
+local ttl = tonumber(ARGV[2])
+local field = tonumber(ARGV[4])
+for _, key in ipairs(KEYS) do
+	local v = redis.call('GET', key)
+	if jobid(v) == ARGV[1] then
+		local fields = splitslot(v)
+		fields[field] = ARGV[3]
+		local value = joinslot(fields, field)
+		if ttl > 0 then
+			redis.call('SET', key, value, 'PX', ttl)
+		else
+			redis.call('SET', key, value)
+		end
+		table.insert(extended, key)
+		table.insert(extended, tonumber(fields[tonumber(ARGV[5])]) or 0)
+	end
+end
+return extended
+`)
+
+// acquireAllScript writes the values into free slots, it writes nothing unless there is a free slot for every value
+// KEYS[1] is the active set, KEYS[2] the counters hash, KEYS[3] the fencing token counter, KEYS[4..] the slot keys
+// ARGV[1] is the ttl in milliseconds, ARGV[2] 1 to track the slots in the active set,
+// ARGV[3] 1 to update the counters, ARGV[4..] the slot values
+// it returns the number of slots occupied before followed by the slot key and fencing token of every value,
+// or only the number of occupied slots if not all values fit
+var acquireAllScript = newScript(luaJobID + luaSlotFields + luaFence + `
+local need = #ARGV - 3
+local count = ARGV[3] == '1'
+local occupied = 0
+local free = {}
+for i = 4, #KEYS do
+	local v = redis.call('GET', KEYS[i])
+	if v and v ~= '' then
+		occupied = occupied + 1
+	elseif #free < need then
+		table.insert(free, KEYS[i])
+	end
+end
+if #free < need then
+	if count then
+		redis.call('HINCRBY', KEYS[2], 'rejections', need)
+	end
+	return {occupied}
+end
+local ttl = tonumber(ARGV[1])
+local granted = {occupied}
+for i, key in ipairs(free) do
+	local value, token = fence(ARGV[i + 3], KEYS[3])
+	if ttl > 0 then
+		redis.call('SET', key, value, 'PX', ttl)
+	else
+		redis.call('SET', key, value)
+	end
+	if ARGV[2] == '1' then
+		redis.call('SADD', KEYS[1], key)
+	end
+	table.insert(granted, key)
+	table.insert(granted, token)
+end
+if count then
+	redis.call('HINCRBY', KEYS[2], 'grants', need)
+end
+return granted
+`)
+
+// setIfFreeScript writes a slot stamped with the next fencing token only if it is still free
+// KEYS[1] is the slot key, KEYS[2] the token counter, ARGV[1] the value and ARGV[2] the ttl in milliseconds
+// it returns the token, or 0 if the slot was taken
+var setIfFreeScript = newScript(luaJobID + luaSlotFields + luaFence + `
+local v = redis.call('GET', KEYS[1])
+if v and v ~= '' then
+	return 0
+end
+local value, token = fence(ARGV[1], KEYS[2])
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('SET', KEYS[1], value, 'PX', ttl)
+else
+	redis.call('SET', KEYS[1], value)
+end
+return token
+`)
+
 // RedisConnector contains all function to access redis
+// a free slot is a missing key, MGet returns an empty string for it,
+// while Get returns an error matching redis.Nil with errors.Is
+// PTTL returns one ttl per key in the order of keys, TTLNoExpiry for a key without expiry
+// and TTLMissing for a missing key, it is the batch primitive of every ttl reading feature
 type RedisConnector interface {
 	MGet(ctx context.Context, keys []string) ([]string, error)
 	Get(ctx context.Context, key string) (string, error)
 	Del(ctx context.Context, keys ...string) error
 	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	PTTL(ctx context.Context, keys []string) ([]time.Duration, error)
+	BLPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error)
+	RPush(ctx context.Context, key string, values ...string) error
+	XAdd(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) error
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+	EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error)
+	ScriptLoad(ctx context.Context, script string) (string, error)
 }
 
 // RateLimiter defines the concurrency job limiter
 type RateLimiter struct {
-	redisConnector RedisConnector
-	defaultTTL     time.Duration
+	redisConnector      RedisConnector
+	readReplica         RedisConnector
+	defaultTTL          time.Duration
+	utilization         *utilizationWatcher
+	expvarStats         *expvarStats
+	randomProbe         bool
+	jobIDValidator      func(string) error
+	maxJobIDLength      int
+	maxMetadataSize     int
+	maxLimit            int
+	clock               func() time.Time
+	activeSet           bool
+	persistentCounters  bool
+	tokenList           bool
+	tokens              tokenState
+	metricsHook         func(Metric)
+	metricLabels        func(ctx context.Context) map[string]string
+	auditStream         string
+	auditMaxLen         int64
+	breaker             *circuitBreaker
+	logger              Logger
+	acquireHook         func(ctx context.Context, jobType, jobID, slotKey string)
+	releaseHook         func(ctx context.Context, jobType, jobID, slotKey string)
+	attemptLimiter      *attemptLimiter
+	partialReads        bool
+	ownerIdentity       string
+	retryBudget         *retryBudget
+	delBatchSize        int
+	maxTTL              time.Duration
+	strictMaxTTL        bool
+	owned               *ownedSlots
+	ownedInstance       string
+	ownedTTL            time.Duration
+	acquirePolicy       AcquirePolicy
+	duplicateWarnings   bool
+	traceID             func(ctx context.Context) string
+	ttlBoundedByContext bool
+	policies            policyRegistry
+	churn               churnSamples
+	readCache           *readCache
+	draining            int32
+	shutdownGrace       time.Duration
+	readConnector       RedisConnector
+	readTimeout         time.Duration
+	writeTimeout        time.Duration
+	maxHoldTime         time.Duration
+	slotContention      bool
+	jobIndex            bool
+	pausable            bool
+	dryRun              bool
+	dynamicLimit        *dynamicLimit
+	idNamespace         uuid.UUID
+}
+
+// NewRateLimiter is the constructor of RateLimiter
+// defaultTTL is used when a job is added with zero ttl, if it is zero as well
+// the job is rejected with ErrNoTTLConfigured
+// it returns the struct, code that wants to replace it in tests can depend on Limiter instead
+func NewRateLimiter(redisConnector RedisConnector, defaultTTL time.Duration, opts ...Option) *RateLimiter {
+	rl := &RateLimiter{
+		redisConnector: redisConnector,
+		defaultTTL:     defaultTTL,
+	}
+	for _, opt := range opts {
+		opt(rl)
+	}
+	if rl.retryBudget != nil {
+		rl.retryBudget.now = rl.now
+	}
+	if rl.breaker != nil {
+		rl.breaker.now = rl.now
+		rl.breaker.onChange = func(ctx context.Context, state breakerState) {
+			rl.emitMetric(ctx, metricBreakerState, float64(state), nil)
+		}
+	}
+	primary := rl.redisConnector
+	rl.redisConnector = rl.wrapConnector(primary, rl.writeTimeout, true)
+	rl.readConnector = rl.redisConnector
+	if rl.readReplica != nil {
+		rl.readReplica = rl.wrapConnector(rl.readReplica, rl.readTimeout, false)
+		rl.readConnector = rl.readReplica
+	} else if rl.readTimeout != rl.writeTimeout {
+		rl.readConnector = rl.wrapConnector(primary, rl.readTimeout, true)
+	}
+	if rl.attemptLimiter != nil {
+		rl.attemptLimiter.now = rl.now
+	}
+	if rl.readCache != nil {
+		rl.readCache.now = rl.now
+	}
+	if rl.dynamicLimit != nil {
+		rl.dynamicLimit.now = rl.now
+	}
+	if rl.expvarStats != nil {
+		rl.expvarStats.logf = rl.logf
+	}
+	if rl.ownedInstance != "" {
+		rl.owned.persist = rl.persistOwned
+	}
+
+	return rl
+}
+
+// wrapConnector wraps conn with the panic recovery, the timeout, the retries and the circuit breaker
+// the read replica does not go through the breaker, which only watches the primary
+func (rl *RateLimiter) wrapConnector(conn RedisConnector, timeout time.Duration, withBreaker bool) RedisConnector {
+	conn = &safeConnector{conn: conn}
+	if timeout > 0 {
+		conn = &timeoutConnector{conn: conn, timeout: timeout}
+	}
+	if rl.retryBudget != nil {
+		conn = &retryConnector{RedisConnector: conn, budget: rl.retryBudget}
+	}
+	if withBreaker && rl.breaker != nil {
+		conn = &breakerConnector{conn: conn, breaker: rl.breaker}
+	}
+
+	return conn
 }
 
 // GenJobKeys generates job keys by job type and limit
-func (rl *RateLimiter) GenJobKeys(jobType string, limit int) []string {
+// it returns ErrInvalidLimit for a negative limit and ErrLimitTooLarge above the max limit
+func (rl *RateLimiter) GenJobKeys(jobType string, limit int) ([]string, error) {
+	if err := rl.checkLimit(limit); err != nil {
+		return nil, err
+	}
+
 	slotKeys := make([]string, limit)
 	for i := 0; i < limit; i++ {
-		slotKeys[i] = fmt.Sprintf("%s-%d", jobType, i)
+		slotKeys[i] = slotKey(jobType, i)
+	}
+
+	return slotKeys, nil
+}
+
+// slotKey returns the key of slot index i of jobType
+func slotKey(jobType string, i int) string {
+	return fmt.Sprintf("%s-%d", jobType, i)
+}
+
+// checkLimit validates limit against the max limit
+func (rl *RateLimiter) checkLimit(limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidLimit, limit)
+	}
+	maxLimit := rl.maxLimit
+	if maxLimit == 0 {
+		maxLimit = DefaultMaxLimit
+	}
+	if maxLimit > 0 && limit > maxLimit {
+		return fmt.Errorf("%w: %d, max %d", ErrLimitTooLarge, limit, maxLimit)
 	}
 
-	return slotKeys
+	return nil
 }
 
 // AddJob adds a new job, if all slots are taken, an error will be return
+// a limit of zero disables the jobType, the error is ErrPoolDisabled then
+// rejections by a guard of the pool are a *RejectedError carrying the RejectReason
+// a jobID is generated if the given one is empty
+// the free slot with the lowest index is taken, see WithRandomProbe
 func (rl *RateLimiter) AddJob(jobType string, limit int, jobID string, ttl time.Duration) (string, error) {
-	slots, err := rl.ListJobs(jobType, limit)
+	return rl.addJob(context.TODO(), jobType, limit, jobID, ttl)
+}
+
+func (rl *RateLimiter) addJob(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) (string, error) {
+	_, id, _, err := rl.acquire(ctx, jobType, limit, jobID, ttl)
+
+	return id, err
+}
+
+// acquire adds a job like AddJob and returns the key of the slot it took together with the jobID and the fencing token
+func (rl *RateLimiter) acquire(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) (string, string, int64, error) {
+	if rl.dryRun {
+		return rl.dryRunAcquire(ctx, jobType, limit, jobID, ttl)
+	}
+
+	return rl.acquireSlot(ctx, jobType, limit, jobID, ttl)
+}
+
+// acquireSlot takes a slot for acquire
+func (rl *RateLimiter) acquireSlot(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) (_, _ string, _ int64, err error) {
+	start := time.Now()
+	defer func() {
+		rl.readCache.invalidate(jobType)
+		rl.observeOperation(ctx, "add_job", jobType, start, err)
+		err = rejection(jobType, err)
+	}()
+
+	if jobID == "" {
+		if jobID, err = newJobID(); err != nil {
+			return "", "", 0, err
+		}
+	}
+	if err := rl.validateJobID(jobID); err != nil {
+		return "", "", 0, err
+	}
+	if limit == 0 {
+		return "", "", 0, ErrPoolDisabled
+	}
+	if !rl.attemptLimiter.allow(jobType) {
+		return "", "", 0, ErrAttemptRateExceeded
+	}
+	if err := rl.checkAdmission(ctx, jobType); err != nil {
+		return "", "", 0, err
+	}
+	if err := rl.checkSlotMetadata(ctx); err != nil {
+		return "", "", 0, err
+	}
+	ttl, err = rl.acquireTTL(ctx, ttl)
 	if err != nil {
-		return "", err
+		return "", "", 0, err
+	}
+
+	if rl.tokenList {
+		value := encodeSlotValue(rl.newSlot(ctx, jobID, rl.now()))
+		slotKey, token, err := rl.takeToken(ctx, jobType, limit, value, ttl)
+		if err == ErrNoSlot {
+			rl.count(ctx, jobType, counterRejections, 1)
+		}
+		if err != nil {
+			return "", "", 0, err
+		}
+		rl.acquired(ctx, jobType, slotKey, jobID, token)
+		rl.count(ctx, jobType, counterGrants, 1)
+		return slotKey, jobID, token, nil
+	}
+
+	if rl.activeSet {
+		value := encodeSlotValue(rl.newSlot(ctx, jobID, rl.now()))
+		slotKeys, tokens, occupied, err := rl.acquireAll(ctx, jobType, limit, []string{value}, ttl)
+		if err != nil {
+			return "", "", 0, err
+		}
+		rl.acquired(ctx, jobType, slotKeys[0], jobID, tokens[0])
+		rl.observeUtilization(jobType, occupied+1, limit)
+		return slotKeys[0], jobID, tokens[0], nil
 	}
 
-	if jobID != "" {
-		jobID = uuid.NewString()
+	if rl.acquirePolicy == LRUFree {
+		slotKey, token, occupied, err := rl.acquireLRU(ctx, jobType, limit, encodeSlotValue(rl.newSlot(ctx, jobID, rl.now())), ttl)
+		if err != nil {
+			return "", "", 0, err
+		}
+		rl.acquired(ctx, jobType, slotKey, jobID, token)
+		rl.observeUtilization(jobType, occupied+1, limit)
+		return slotKey, jobID, token, nil
 	}
-	findASlot := false
-	for k, slot := range slots {
-		if slot != "" {
+
+	if rl.jobIndex {
+		slotKey, token, occupied, err := rl.acquireIndexed(ctx, jobType, limit, jobID, encodeSlotValue(rl.newSlot(ctx, jobID, rl.now())), ttl)
+		if err == ErrNoSlot {
+			rl.count(ctx, jobType, counterRejections, 1)
+		}
+		if err != nil {
+			return "", "", 0, err
+		}
+		rl.acquired(ctx, jobType, slotKey, jobID, token)
+		rl.count(ctx, jobType, counterGrants, 1)
+		rl.observeUtilization(jobType, occupied+1, limit)
+		return slotKey, jobID, token, nil
+	}
+
+	slotKeys, slots, err := rl.listSlots(ctx, rl.redisConnector, jobType, limit)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	var contended []int
+	for _, i := range rl.probeOrder(len(slotKeys)) {
+		if slots[i].JobID != "" {
+			if rl.slotContention {
+				contended = append(contended, i)
+			}
 			continue
 		}
-		if ttl == 0 {
-			ttl = rl.defaultTTL
+		value := encodeSlotValue(rl.newSlot(ctx, jobID, rl.now()))
+		token, err := rl.setIfFree(ctx, jobType, slotKeys[i], value, ttl)
+		if err != nil {
+			if errors.Is(err, ErrConnectorPanic) {
+				rl.rollback(ctx, jobID, slotKeys[i])
+			}
+			return "", "", 0, err
 		}
-		if err := rl.redisConnector.Set(context.TODO(), k, jobID, ttl); err != nil {
-			return "", err
+		if token == 0 {
+			rl.logf("concurrency: slot %s was taken concurrently after it was read as free, trying another slot", slotKeys[i])
+			if rl.slotContention {
+				contended = append(contended, i)
+			}
+			continue
 		}
-		findASlot = true
-		break
+		rl.acquired(ctx, jobType, slotKeys[i], jobID, token)
+		rl.count(ctx, jobType, counterGrants, 1)
+		rl.recordContention(ctx, jobType, contended)
+		rl.observeUtilization(jobType, countOccupied(slots)+1, limit)
+		return slotKeys[i], jobID, token, nil
+	}
+	rl.count(ctx, jobType, counterRejections, 1)
+	rl.recordContention(ctx, jobType, contended)
+
+	return "", "", 0, ErrNoSlot
+}
+
+// setIfFree writes value into slotKey unless another acquisition took it since it was read as free,
+// so a race between two acquisitions never overwrites a holder
+// it returns the fencing token the slot was taken with, or 0 if it was taken by another acquisition
+func (rl *RateLimiter) setIfFree(ctx context.Context, jobType, slotKey, value string, ttl time.Duration) (int64, error) {
+	reply, err := setIfFreeScript.Run(ctx, rl.redisConnector, []string{slotKey, fenceKey(jobType)}, value, ttlMilli(ttl))
+	if err != nil {
+		return 0, err
+	}
+
+	return toInt64(reply)
+}
+
+// acquireAll writes values into free slots in one script, tracking them in the active set with WithActiveSet
+// it returns the slot keys and fencing tokens in the order of values and the number of slots occupied before,
+// or ErrNoSlot if not all values fit
+func (rl *RateLimiter) acquireAll(ctx context.Context, jobType string, limit int, values []string, ttl time.Duration) ([]string, []int64, int, error) {
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	keys := append([]string{activeSetKey(jobType), countersKey(jobType), fenceKey(jobType)}, slotKeys...)
+	args := make([]interface{}, 0, len(values)+3)
+	args = append(args, ttlMilli(ttl), boolArg(rl.activeSet), boolArg(rl.persistentCounters))
+	for _, value := range values {
+		args = append(args, value)
+	}
+
+	reply, err := acquireAllScript.Run(ctx, rl.redisConnector, keys, args...)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, nil, 0, fmt.Errorf("unexpected script reply %v", reply)
 	}
-	if findASlot {
-		return jobID, nil
+	occupied, err := toInt64(items[0])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	granted, tokens, err := toSlotTokens(items[1:])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if len(granted) < len(values) {
+		return nil, nil, int(occupied), ErrNoSlot
+	}
+
+	return granted, tokens, int(occupied), nil
+}
+
+// probeOrder returns the order in which the slot indexes are tried
+// the lowest index comes first unless random probing is enabled
+func (rl *RateLimiter) probeOrder(n int) []int {
+	if rl.randomProbe {
+		return rand.Perm(n)
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
 	}
 
-	return "", ErrNoSlot
+	return order
+}
+
+// AddJobs adds all jobs at once, either every job gets a slot or none does
+// empty jobIDs are generated, the jobIDs are returned in the given order
+// the free slots are checked and written in a single script, it is not available with WithTokenList
+func (rl *RateLimiter) AddJobs(ctx context.Context, jobType string, limit int, jobIDs []string, ttl time.Duration) (_ []string, err error) {
+	start := time.Now()
+	defer func() {
+		rl.observeOperation(ctx, "add_jobs", jobType, start, err)
+		err = rejection(jobType, err)
+	}()
+
+	if err := rl.rejectDryRun("AddJobs"); err != nil {
+		return nil, err
+	}
+
+	if rl.tokenList {
+		return nil, errors.New("AddJobs is not available with WithTokenList")
+	}
+	ids := make([]string, len(jobIDs))
+	for i, jobID := range jobIDs {
+		if jobID == "" {
+			if jobID, err = newJobID(); err != nil {
+				return nil, err
+			}
+		}
+		if err := rl.validateJobID(jobID); err != nil {
+			return nil, err
+		}
+		ids[i] = jobID
+	}
+	if limit == 0 {
+		return nil, ErrPoolDisabled
+	}
+	if err := rl.checkAdmission(ctx, jobType); err != nil {
+		return nil, err
+	}
+	if err := rl.checkSlotMetadata(ctx); err != nil {
+		return nil, err
+	}
+	ttl, err = rl.acquireTTL(ctx, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, len(ids))
+	now := rl.now()
+	for i, id := range ids {
+		values[i] = encodeSlotValue(rl.newSlot(ctx, id, now))
+	}
+	slotKeys, tokens, occupied, err := rl.acquireAll(ctx, jobType, limit, values, ttl)
+	if err != nil {
+		return nil, err
+	}
+	for i, k := range slotKeys {
+		rl.acquired(ctx, jobType, k, ids[i], tokens[i])
+	}
+	rl.observeUtilization(jobType, occupied+len(ids), limit)
+
+	return ids, nil
 }
 
 // ListJobs return all active jobs with map[string]string format
+// ListJobs is served by the read replica if one is configured
+// with WithPartialReads unreadable slots are left out of the result
+// with WithReadCache a result read less than the cache ttl ago is returned without asking redis
 func (rl *RateLimiter) ListJobs(jobType string, limit int) (map[string]string, error) {
+	cached, generation, ok := rl.readCache.get(jobType, limit)
+	if ok {
+		return cached, nil
+	}
+	slotKeys, slots, errs, err := rl.listSlotsPartial(context.TODO(), rl.reader(), jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+
 	result := map[string]string{}
-	slotKeys := rl.GenJobKeys(jobType, limit)
+	complete := true
+	for i, slot := range slots {
+		if errs[i] == nil {
+			result[slotKeys[i]] = slot.JobID
+		} else {
+			complete = false
+		}
+	}
+	rl.warnDuplicates(jobType, result)
+	if complete {
+		rl.readCache.put(jobType, limit, generation, result)
+	}
 
-	values, err := rl.redisConnector.MGet(context.TODO(), slotKeys)
+	return result, nil
+}
+
+// listJobs reads all slots of jobType through conn
+func (rl *RateLimiter) listJobs(ctx context.Context, conn RedisConnector, jobType string, limit int) (map[string]string, error) {
+	result := map[string]string{}
+	slotKeys, slots, err := rl.listSlots(ctx, conn, jobType, limit)
 	if err != nil {
 		return nil, err
 	}
-	for i, value := range values {
-		result[slotKeys[i]] = value
+	for i, slot := range slots {
+		result[slotKeys[i]] = slot.JobID
 	}
 
 	return result, nil
 }
 
+// ListJobsByIndex returns the jobID of every slot of jobType keyed by its index, empty for a free slot
+// it is served by the read replica if one is configured, like ListJobs
+func (rl *RateLimiter) ListJobsByIndex(ctx context.Context, jobType string, limit int) (map[int]string, error) {
+	_, slots, err := rl.listSlots(ctx, rl.reader(), jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int]string, len(slots))
+	for i, slot := range slots {
+		result[i] = slot.JobID
+	}
+
+	return result, nil
+}
+
+// CanAcquire reports whether jobType has at least one free slot without taking it
+// the answer is advisory, a concurrent AddJob can take the slot right after the check
+func (rl *RateLimiter) CanAcquire(ctx context.Context, jobType string, limit int) (bool, error) {
+	slots, err := rl.listJobs(ctx, rl.reader(), jobType, limit)
+	if err != nil {
+		return false, err
+	}
+
+	return countActive(slots) < limit, nil
+}
+
+// CanAcquireBatch returns how many of n jobs jobType could admit right now, at most n
+// the answer is advisory like CanAcquire, size a FillSlots call with it and expect it to grant fewer
+// it is zero without reading redis when n or limit is not positive
+func (rl *RateLimiter) CanAcquireBatch(ctx context.Context, jobType string, limit, n int) (int, error) {
+	if n <= 0 || limit <= 0 {
+		return 0, nil
+	}
+	_, slots, err := rl.listSlots(ctx, rl.reader(), jobType, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	free := len(slots) - countOccupied(slots)
+	if free > n {
+		free = n
+	}
+
+	return free, nil
+}
+
+// MapJobsToSlots returns the slot key held by each of jobIDs, jobs holding no slot are left out
+// a job holding several slots is mapped to the one with the lowest index
+func (rl *RateLimiter) MapJobsToSlots(ctx context.Context, jobType string, limit int, jobIDs []string) (map[string]string, error) {
+	slotKeys, slots, err := rl.listSlots(ctx, rl.reader(), jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(jobIDs))
+	for _, jobID := range jobIDs {
+		wanted[jobID] = true
+	}
+	result := map[string]string{}
+	for i, slot := range slots {
+		if _, found := result[slot.JobID]; slot.JobID != "" && wanted[slot.JobID] && !found {
+			result[slot.JobID] = slotKeys[i]
+		}
+	}
+
+	return result, nil
+}
+
+// FreeSlots returns the keys of the free slots of jobType in index order
+// the answer is advisory like CanAcquire, a slot has to be taken with AddJob
+// and may be gone by then
+func (rl *RateLimiter) FreeSlots(ctx context.Context, jobType string, limit int) ([]string, error) {
+	slotKeys, slots, err := rl.listSlots(ctx, rl.reader(), jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var free []string
+	for i, slot := range slots {
+		if slot.JobID == "" {
+			free = append(free, slotKeys[i])
+		}
+	}
+
+	return free, nil
+}
+
 // DeleteJob deletes a job by its jobID
-func (rl *RateLimiter) DeleteJob(jobType string, limit int, jobID string) error {
-	slots, err := rl.ListJobs(jobType, limit)
+// released reports whether the job still held a slot, it is false if the job already expired or never existed
+func (rl *RateLimiter) DeleteJob(jobType string, limit int, jobID string) (released bool, err error) {
+	return rl.deleteJob(context.TODO(), jobType, limit, jobID)
+}
+
+func (rl *RateLimiter) deleteJob(ctx context.Context, jobType string, limit int, jobID string) (_ bool, err error) {
+	if rl.dryRun {
+		jobType = dryRunJobType(jobType)
+	}
+	start := time.Now()
+	defer func() {
+		rl.readCache.invalidate(jobType)
+		rl.observeOperation(ctx, "delete_job", jobType, start, err)
+	}()
+
+	if err := rl.validateJobID(jobID); err != nil {
+		return false, err
+	}
+
+	if rl.tokenList {
+		released, err := rl.returnTokens(ctx, jobType, limit, jobID)
+		if err != nil {
+			return false, err
+		}
+		for _, k := range released {
+			rl.released(ctx, jobType, k, jobID)
+		}
+		rl.count(ctx, jobType, counterReleases, len(released))
+		return len(released) > 0, nil
+	}
+
+	if rl.activeSet {
+		released, err := rl.releaseActive(ctx, jobType, jobID)
+		if err != nil {
+			return false, err
+		}
+		for _, k := range released {
+			rl.released(ctx, jobType, k, jobID)
+		}
+		return len(released) > 0, nil
+	}
+
+	if rl.jobIndex {
+		slotKey, occupied, err := rl.releaseIndexed(ctx, jobType, limit, jobID)
+		if err != nil {
+			return false, err
+		}
+		if slotKey != "" {
+			rl.released(ctx, jobType, slotKey, jobID)
+			rl.count(ctx, jobType, counterReleases, 1)
+			rl.observeUtilization(jobType, occupied, limit)
+			return true, nil
+		}
+		// slots taken outside of the index are still found by reading all of them
+	}
+
+	slots, err := rl.listJobs(ctx, rl.redisConnector, jobType, limit)
 	if err != nil {
-		return err
+		return false, err
 	}
 
+	var keys []string
 	for k, v := range slots {
-		if v != jobID {
-			continue
+		if v == jobID {
+			keys = append(keys, k)
+		}
+	}
+	deleted, err := rl.del(ctx, keys)
+	for _, k := range keys[:deleted] {
+		rl.released(ctx, jobType, k, jobID)
+	}
+	rl.markFreed(ctx, jobType, keys[:deleted])
+	if err != nil {
+		return deleted > 0, err
+	}
+	rl.count(ctx, jobType, counterReleases, deleted)
+	rl.observeUtilization(jobType, countActive(slots)-deleted, limit)
+
+	return deleted > 0, nil
+}
+
+// del deletes keys with one Del per batch of at most the del batch size
+// it returns how many keys, in order, were deleted before a batch failed
+func (rl *RateLimiter) del(ctx context.Context, keys []string) (int, error) {
+	size := rl.delBatchSize
+	if size <= 0 {
+		size = defaultDelBatchSize
+	}
+
+	for start := 0; start < len(keys); start += size {
+		end := start + size
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err := rl.redisConnector.Del(ctx, keys[start:end]...); err != nil {
+			return start, err
+		}
+	}
+
+	return len(keys), nil
+}
+
+// ExtendJob resets the ttl of the slot held by jobID
+// it returns ErrJobNotFound if the job does not hold a slot anymore, e.g. it already expired
+func (rl *RateLimiter) ExtendJob(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) (err error) {
+	if rl.dryRun {
+		jobType = dryRunJobType(jobType)
+	}
+	start := time.Now()
+	defer func() {
+		rl.observeOperation(ctx, "extend_job", jobType, start, err)
+	}()
+
+	if err := rl.validateJobID(jobID); err != nil {
+		return err
+	}
+	ttl, err = rl.jobTTL(ttl)
+	if err != nil {
+		return err
+	}
+
+	if rl.jobIndex {
+		keys, err := rl.indexedKeys(jobType, limit)
+		if err != nil {
+			return err
 		}
-		if err := rl.redisConnector.Del(context.TODO(), k); err != nil {
+		reply, err := extendIndexedScript.Run(ctx, rl.redisConnector, keys,
+			jobID, ttlMilli(ttl), unixMilli(rl.now()), slotFieldLastRenewedAt+1, slotFieldToken+1)
+		if err != nil {
 			return err
 		}
+		// a nil reply means the index has no slot of the job
+		if items, ok := reply.([]interface{}); ok {
+			extended, tokens, err := toSlotTokens(items)
+			if err != nil {
+				return err
+			}
+			for i, k := range extended {
+				rl.audit(ctx, auditExtend, jobType, k, jobID, tokens[i])
+			}
+			return nil
+		}
+	}
+
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return err
+	}
+	reply, err := extendScript.Run(ctx, rl.redisConnector, slotKeys,
+		jobID, ttlMilli(ttl), unixMilli(rl.now()), slotFieldLastRenewedAt+1, slotFieldToken+1)
+	if err != nil {
+		return err
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected script reply %v", reply)
+	}
+	extended, tokens, err := toSlotTokens(items)
+	if err != nil {
+		return err
+	}
+	if len(extended) == 0 {
+		return ErrJobNotFound
+	}
+	for i, k := range extended {
+		rl.audit(ctx, auditExtend, jobType, k, jobID, tokens[i])
 	}
 
 	return nil
 }
 
+// reader returns the connector used by read-only operations
+// it is the read replica if one is configured, otherwise the primary with the read timeout
+func (rl *RateLimiter) reader() RedisConnector {
+	return rl.readConnector
+}
+
+// countOccupied counts the occupied slots
+func countOccupied(slots []SlotValue) int {
+	occupied := 0
+	for _, slot := range slots {
+		if slot.JobID != "" {
+			occupied++
+		}
+	}
+
+	return occupied
+}
+
+// countActive counts the occupied slots
+func countActive(slots map[string]string) int {
+	active := 0
+	for _, v := range slots {
+		if v != "" {
+			active++
+		}
+	}
+
+	return active
+}
+
+var _ RedisConnector = (*Redis)(nil)
+
 // Redis defines a wrapper of go-redis
 // The API is set with chaining style, so the commands cannot be used directly
 type Redis struct {
@@ -123,7 +928,7 @@ func (r *Redis) Get(ctx context.Context, key string) (string, error) {
 }
 
 // MGet wraps redis.MGet
-func (r *Redis) MGet(ctx context.Context, keys ...string) ([]string, error) {
+func (r *Redis) MGet(ctx context.Context, keys []string) ([]string, error) {
 	values, err := r.Client.MGet(ctx, keys...).Result()
 	if err != nil {
 		return nil, err
@@ -131,10 +936,13 @@ func (r *Redis) MGet(ctx context.Context, keys ...string) ([]string, error) {
 
 	result := make([]string, len(values))
 	for i, value := range values {
-		if s, ok := value.(string); ok {
-			result[i] = s
-		} else {
-			return nil, errors.New("invalid type")
+		switch v := value.(type) {
+		case nil:
+			// a missing key is a free slot
+		case string:
+			result[i] = v
+		default:
+			return nil, fmt.Errorf("unexpected mget value %v", value)
 		}
 	}
 
@@ -147,6 +955,86 @@ func (r *Redis) Del(ctx context.Context, keys ...string) error {
 }
 
 // Set wraps redis.Set
+// it writes a PX expiry for ttls which are not whole seconds, so sub-second ttls are kept
+// a ttl below one millisecond is rounded up to one
 func (r *Redis) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
 	return r.Client.Set(ctx, key, value, ttl).Err()
 }
+
+// PTTL returns the remaining ttl of every key in one pipeline
+// keys without expiry are TTLNoExpiry and missing keys TTLMissing
+func (r *Redis) PTTL(ctx context.Context, keys []string) ([]time.Duration, error) {
+	pipe := r.Client.Pipeline()
+	cmds := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.PTTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	result := make([]time.Duration, len(keys))
+	for i, cmd := range cmds {
+		result[i] = cmd.Val()
+	}
+
+	return result, nil
+}
+
+// BLPop wraps redis.BLPop
+// it returns the key and the popped value, or nil if the timeout passed
+func (r *Redis) BLPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error) {
+	result, err := r.Client.BLPop(ctx, timeout, keys...).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	return result, err
+}
+
+// RPush wraps redis.RPush
+func (r *Redis) RPush(ctx context.Context, key string, values ...string) error {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+
+	return r.Client.RPush(ctx, key, args...).Err()
+}
+
+// XAdd wraps redis.XAdd
+// the stream is trimmed to about maxLen entries, 0 disables trimming
+func (r *Redis) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) error {
+	return r.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream:       stream,
+		MaxLenApprox: maxLen,
+		Values:       values,
+	}).Err()
+}
+
+// Eval wraps redis.Eval
+// a nil reply is returned as nil instead of redis.Nil
+func (r *Redis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	result, err := r.Client.Eval(ctx, script, keys, args...).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	return result, err
+}
+
+// EvalSha wraps redis.EvalSha
+// a nil reply is returned as nil instead of redis.Nil
+func (r *Redis) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	result, err := r.Client.EvalSha(ctx, sha, keys, args...).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	return result, err
+}
+
+// ScriptLoad wraps redis.ScriptLoad
+func (r *Redis) ScriptLoad(ctx context.Context, script string) (string, error) {
+	return r.Client.ScriptLoad(ctx, script).Result()
+}
@@ -0,0 +1,532 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+	"github.com/y4h2/golang-concurrency-limit/concurrency/concurrencytest"
+)
+
+func TestCanAcquire(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(newTestConnector(mr))
+	rl := concurrency.NewRateLimiter(conn, testTTL)
+	ctx := context.Background()
+
+	for _, jobID := range []string{"a", "b"} {
+		ok, err := rl.CanAcquire(ctx, "pool", 2)
+		if err != nil || !ok {
+			t.Fatalf("CanAcquire with a free slot returned %v, %v", ok, err)
+		}
+		if _, err := rl.AddJob("pool", 2, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ok, err := rl.CanAcquire(ctx, "pool", 2)
+	if err != nil || ok {
+		t.Fatalf("CanAcquire on a full pool returned %v, %v", ok, err)
+	}
+
+	before := len(conn.Trace())
+	keysBefore := len(mr.Keys())
+	if _, err := rl.CanAcquire(ctx, "pool", 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, call := range conn.Trace()[before:] {
+		if call.Method != "MGet" {
+			t.Errorf("CanAcquire called %s, want a single MGet", call.Method)
+		}
+	}
+	if len(conn.Trace()[before:]) != 1 {
+		t.Errorf("CanAcquire made %d calls, want one MGet", len(conn.Trace()[before:]))
+	}
+	if len(mr.Keys()) != keysBefore {
+		t.Error("CanAcquire changed the keys")
+	}
+}
+
+func TestRedisPTTL(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := newTestConnector(mr)
+
+	mr.Set("expiring", "1")
+	mr.SetTTL("expiring", 1500*time.Millisecond)
+	mr.Set("persistent", "2")
+	keys := []string{"persistent", "missing", "expiring", "expiring"}
+	ttls, err := conn.PTTL(context.Background(), keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{concurrency.TTLNoExpiry, concurrency.TTLMissing, 1500 * time.Millisecond, 1500 * time.Millisecond}
+	if fmt.Sprint(ttls) != fmt.Sprint(want) {
+		t.Errorf("PTTL of %v returned %v, want %v", keys, ttls, want)
+	}
+
+	if ttls, err := conn.PTTL(context.Background(), nil); err != nil || len(ttls) != 0 {
+		t.Errorf("PTTL without keys returned %v, %v", ttls, err)
+	}
+}
+
+func TestAddJobsWritesEverySlotWithTTL(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	ids, err := rl.AddJobs(context.Background(), "pool", 4, []string{"a", "b", "c"}, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 {
+		t.Fatalf("AddJobs returned %v, want three jobIDs", ids)
+	}
+	if n := occupied(t, rl, "pool", 4); n != 3 {
+		t.Errorf("%d slots occupied, want 3", n)
+	}
+	for _, jobID := range ids {
+		key, err := rl.FindJobSlot(context.Background(), "pool", 4, jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl := mr.TTL(key); ttl != 2*time.Second {
+			t.Errorf("%s has ttl %v, want 2s", key, ttl)
+		}
+	}
+}
+
+func TestAddJobTakesLowestFreeSlot(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		for _, jobID := range []string{"a", "b", "c", "d", "e"} {
+			if _, err := rl.AddJob("pool", 8, jobID, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, jobID := range []string{"d", "b"} {
+			if _, err := rl.DeleteJob("pool", 8, jobID); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for _, want := range []string{"pool-1", "pool-3", "pool-5"} {
+			jobID := "new-" + want
+			if _, err := rl.AddJob("pool", 8, jobID, 0); err != nil {
+				t.Fatal(err)
+			}
+			if key, err := rl.FindJobSlot(ctx, "pool", 8, jobID); err != nil || key != want {
+				t.Fatalf("AddJob took %q (%v), want the lowest free slot %s", key, err, want)
+			}
+		}
+		mr.FlushAll()
+	}
+}
+
+// racingConnector lets another writer take a slot right after the slots were read
+type racingConnector struct {
+	concurrency.RedisConnector
+	race func()
+}
+
+func (c *racingConnector) MGet(ctx context.Context, keys []string) ([]string, error) {
+	values, err := c.RedisConnector.MGet(ctx, keys)
+	if c.race != nil {
+		c.race()
+		c.race = nil
+	}
+
+	return values, err
+}
+
+func TestAddJobNeverOverwritesConcurrentWriter(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	logger := &testLogger{}
+	conn := &racingConnector{RedisConnector: newTestConnector(mr)}
+	rl := concurrency.NewRateLimiter(conn, testTTL, concurrency.WithLogger(logger))
+	other := concurrency.NewRateLimiter(newTestConnector(mr), testTTL)
+
+	conn.race = func() {
+		if _, err := other.AddJob("pool", 3, "winner", 0); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := rl.AddJob("pool", 3, "loser", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := rl.ListJobs("pool", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs["pool-0"] != "winner" || jobs["pool-1"] != "loser" {
+		t.Errorf("the pool holds %v, want winner kept in pool-0 and loser moved on to pool-1", jobs)
+	}
+	lines := logger.Lines()
+	if len(lines) != 1 || !strings.Contains(lines[0], "slot pool-0 was taken concurrently") {
+		t.Errorf("logged %q, want a warning about pool-0", lines)
+	}
+
+	// many writers racing for the same slots never exceed the limit
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := rl.AddJob("race", 4, fmt.Sprintf("job-%d", i), 0); err != nil && !errors.Is(err, concurrency.ErrNoSlot) {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	concurrencytest.AssertInvariant(t, rl, "race", 4)
+	if n := occupied(t, rl, "race", 4); n != 4 {
+		t.Errorf("%d slots occupied after the race, want 4", n)
+	}
+}
+
+func TestAddJobRandomProbe(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithRandomProbe())
+	defer mr.Close()
+	ctx := context.Background()
+
+	taken := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		if _, err := rl.AddJob("pool", 8, "job", 0); err != nil {
+			t.Fatal(err)
+		}
+		key, err := rl.FindJobSlot(ctx, "pool", 8, "job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		taken[key] = true
+		mr.FlushAll()
+	}
+	if len(taken) == 1 {
+		t.Errorf("AddJob always took %v on an empty pool, want random slots", taken)
+	}
+}
+
+func TestLimitValidation(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithMaxLimit(10))
+	defer mr.Close()
+
+	for _, tt := range []struct {
+		limit int
+		keys  int
+		err   error
+	}{
+		{limit: -1, err: concurrency.ErrInvalidLimit},
+		{limit: 0, keys: 0},
+		{limit: 10, keys: 10},
+		{limit: 11, err: concurrency.ErrLimitTooLarge},
+	} {
+		keys, err := rl.GenJobKeys("pool", tt.limit)
+		if !errors.Is(err, tt.err) || len(keys) != tt.keys {
+			t.Errorf("GenJobKeys with limit %d returned %d keys, %v, want %d keys, %v", tt.limit, len(keys), err, tt.keys, tt.err)
+		}
+		if tt.err == nil {
+			continue
+		}
+		if _, err := rl.AddJob("pool", tt.limit, "job", 0); !errors.Is(err, tt.err) {
+			t.Errorf("AddJob with limit %d returned %v, want %v", tt.limit, err, tt.err)
+		}
+		if _, err := rl.ListJobs("pool", tt.limit); !errors.Is(err, tt.err) {
+			t.Errorf("ListJobs with limit %d returned %v, want %v", tt.limit, err, tt.err)
+		}
+	}
+
+	// a zero limit disables the pool
+	if _, err := rl.AddJob("pool", 0, "job", 0); !errors.Is(err, concurrency.ErrPoolDisabled) {
+		t.Errorf("AddJob with limit 0 returned %v, want ErrPoolDisabled", err)
+	}
+
+	rl, mr = newTestLimiter(t)
+	defer mr.Close()
+	if _, err := rl.GenJobKeys("pool", concurrency.DefaultMaxLimit+1); !errors.Is(err, concurrency.ErrLimitTooLarge) {
+		t.Errorf("GenJobKeys above the default max limit returned %v, want ErrLimitTooLarge", err)
+	}
+}
+
+func TestDeleteJobReportsRelease(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 2, "present", 0); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := rl.DeleteJob("pool", 2, "present"); err != nil || !ok {
+		t.Errorf("DeleteJob of a present job returned %v, %v, want released", ok, err)
+	}
+	if ok, err := rl.DeleteJob("pool", 2, "present"); err != nil || ok {
+		t.Errorf("a second DeleteJob returned %v, %v, want a no-op", ok, err)
+	}
+	if ok, err := rl.DeleteJob("pool", 2, "absent"); err != nil || ok {
+		t.Errorf("DeleteJob of an absent job returned %v, %v, want a no-op", ok, err)
+	}
+
+	if _, err := rl.AddJob("pool", 2, "held", 0); err != nil {
+		t.Fatal(err)
+	}
+	mr.SetError("ERR backend down")
+	if ok, err := rl.DeleteJob("pool", 2, "held"); err == nil || ok {
+		t.Errorf("DeleteJob on a failing backend returned %v, %v, want the error", ok, err)
+	}
+	mr.SetError("")
+	if n := occupied(t, rl, "pool", 2); n != 1 {
+		t.Errorf("%d slots occupied after the failed delete, want the job kept", n)
+	}
+}
+
+func TestListJobsByIndex(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	for _, jobID := range []string{"a", "b", "c"} {
+		if _, err := rl.AddJob("pool", 4, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rl.DeleteJob("pool", 4, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]string{0: "a", 1: "", 2: "c", 3: ""}
+	for i := 0; i < 3; i++ {
+		jobs, err := rl.ListJobsByIndex(ctx, "pool", 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) != len(want) {
+			t.Fatalf("ListJobsByIndex returned %v, want %v", jobs, want)
+		}
+		for index, jobID := range want {
+			if jobs[index] != jobID {
+				t.Errorf("ListJobsByIndex returned %v, want %v", jobs, want)
+				break
+			}
+		}
+	}
+}
+
+func TestMapJobsToSlots(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(newTestConnector(mr))
+	rl := concurrency.NewRateLimiter(conn, testTTL)
+	ctx := context.Background()
+
+	for _, jobID := range []string{"a", "b", "c"} {
+		if _, err := rl.AddJob("pool", 4, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rl.DeleteJob("pool", 4, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	before := len(conn.Trace())
+	slots, err := rl.MapJobsToSlots(ctx, "pool", 4, []string{"c", "b", "a", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "map[a:pool-0 c:pool-2]"; fmt.Sprint(slots) != want {
+		t.Errorf("MapJobsToSlots returned %v, want %s", slots, want)
+	}
+	var methods []string
+	for _, call := range conn.Trace()[before:] {
+		methods = append(methods, call.Method)
+	}
+	if fmt.Sprint(methods) != "[MGet]" {
+		t.Errorf("MapJobsToSlots called %v, want a single MGet", methods)
+	}
+
+	if slots, err := rl.MapJobsToSlots(ctx, "pool", 4, nil); err != nil || len(slots) != 0 {
+		t.Errorf("MapJobsToSlots without jobIDs returned %v, %v", slots, err)
+	}
+}
+
+func TestFreeSlots(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	for _, jobID := range []string{"a", "b", "c", "d"} {
+		if _, err := rl.AddJob("pool", 6, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, jobID := range []string{"c", "a"} {
+		if _, err := rl.DeleteJob("pool", 6, jobID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	free, err := rl.FreeSlots(ctx, "pool", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[pool-0 pool-2 pool-4 pool-5]"; fmt.Sprint(free) != want {
+		t.Errorf("FreeSlots returned %v, want %s", free, want)
+	}
+
+	for _, jobID := range []string{"e", "f", "g", "h"} {
+		if _, err := rl.AddJob("pool", 6, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if free, err := rl.FreeSlots(ctx, "pool", 6); err != nil || len(free) != 0 {
+		t.Errorf("FreeSlots of a full pool returned %v, %v", free, err)
+	}
+}
+
+func TestSubSecondTTLExpires(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	if err := newTestConnector(mr).Set(ctx, "key", "value", 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.AddJob("pool", 2, "job", 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.AddJob("pool", 2, "tiny", 500*time.Microsecond); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]time.Duration{"key": 500 * time.Millisecond, "pool-0": 500 * time.Millisecond, "pool-1": time.Millisecond} {
+		if ttl := mr.TTL(key); ttl != want {
+			t.Errorf("%s has ttl %v, want %v", key, ttl, want)
+		}
+	}
+
+	mr.FastForward(500 * time.Millisecond)
+	for _, key := range []string{"key", "pool-0", "pool-1"} {
+		if mr.Exists(key) {
+			t.Errorf("%s still exists after its ttl", key)
+		}
+	}
+	if n := occupied(t, rl, "pool", 2); n != 0 {
+		t.Errorf("%d slots occupied after their ttl", n)
+	}
+}
+
+func TestDeleteJobBatchesDel(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(newTestConnector(mr))
+	rl := concurrency.NewRateLimiter(conn, testTTL, concurrency.WithDelBatchSize(10))
+
+	// a job holding many slots is deleted from all of them
+	const limit = 25
+	for i := 0; i < limit; i++ {
+		if _, err := rl.AddJob("pool", limit, "job", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := occupied(t, rl, "pool", limit); n != limit {
+		t.Fatalf("%d slots occupied, want %d", n, limit)
+	}
+
+	before := len(conn.Trace())
+	if ok, err := rl.DeleteJob("pool", limit, "job"); err != nil || !ok {
+		t.Fatalf("DeleteJob returned %v, %v", ok, err)
+	}
+	var sizes []int
+	for _, call := range conn.Trace()[before:] {
+		if call.Method == "Del" {
+			sizes = append(sizes, len(call.Keys))
+		}
+	}
+	if len(sizes) != 3 || sizes[0] != 10 || sizes[1] != 10 || sizes[2] != 5 {
+		t.Errorf("DeleteJob issued Del calls of %v keys, want [10 10 5]", sizes)
+	}
+	if n := occupied(t, rl, "pool", limit); n != 0 {
+		t.Errorf("%d slots occupied after the delete", n)
+	}
+}
+
+func TestDisabledPool(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	if _, err := rl.AddJob("pool", 0, "job", 0); !errors.Is(err, concurrency.ErrPoolDisabled) {
+		t.Errorf("AddJob returned %v, want ErrPoolDisabled", err)
+	}
+	if _, err := rl.AddJobs(ctx, "pool", 0, []string{"a", "b"}, 0); !errors.Is(err, concurrency.ErrPoolDisabled) {
+		t.Errorf("AddJobs returned %v, want ErrPoolDisabled", err)
+	}
+	if _, _, err := rl.AcquireOrListHolders(ctx, "pool", 0, "job", 0); !errors.Is(err, concurrency.ErrPoolDisabled) {
+		t.Errorf("AcquireOrListHolders returned %v, want ErrPoolDisabled", err)
+	}
+	if err := concurrency.NewCounterLimiter(rl).AddJob(ctx, "pool", 0, 0); !errors.Is(err, concurrency.ErrPoolDisabled) {
+		t.Errorf("CounterLimiter.AddJob returned %v, want ErrPoolDisabled", err)
+	}
+	if ok, err := rl.CanAcquire(ctx, "pool", 0); ok || err != nil {
+		t.Errorf("CanAcquire returned %v, %v, want false without an error", ok, err)
+	}
+	if jobs, err := rl.ListJobs("pool", 0); len(jobs) != 0 || err != nil {
+		t.Errorf("ListJobs returned %v, %v, want no slots", jobs, err)
+	}
+	if len(mr.Keys()) != 0 {
+		t.Errorf("the disabled pool wrote %v", mr.Keys())
+	}
+
+	// a full pool is still told apart from a disabled one
+	if _, err := rl.AddJob("pool", 1, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.AddJob("pool", 1, "b", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("AddJob on a full pool returned %v, want ErrNoSlot", err)
+	}
+}
+
+func TestCanAcquireBatch(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(newTestConnector(mr))
+	rl := concurrency.NewRateLimiter(conn, testTTL)
+	ctx := context.Background()
+
+	for _, jobID := range []string{"a", "b", "c"} {
+		if _, err := rl.AddJob("pool", 5, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tt := range []struct {
+		limit, n, want int
+	}{
+		{limit: 5, n: 10, want: 2},
+		{limit: 5, n: 1, want: 1},
+		{limit: 3, n: 10, want: 0},
+		{limit: 5, n: 0, want: 0},
+		{limit: 5, n: -1, want: 0},
+		{limit: 0, n: 10, want: 0},
+	} {
+		before := len(conn.Trace())
+		got, err := rl.CanAcquireBatch(ctx, "pool", tt.limit, tt.n)
+		if err != nil || got != tt.want {
+			t.Errorf("CanAcquireBatch with limit %d for %d jobs returned %d, %v, want %d", tt.limit, tt.n, got, err, tt.want)
+		}
+		calls := len(conn.Trace()) - before
+		if tt.n > 0 && tt.limit > 0 && calls != 1 {
+			t.Errorf("CanAcquireBatch made %d calls, want a single MGet", calls)
+		}
+		if (tt.n <= 0 || tt.limit <= 0) && calls != 0 {
+			t.Errorf("CanAcquireBatch with limit %d for %d jobs made %d calls, want none", tt.limit, tt.n, calls)
+		}
+	}
+	if n := occupied(t, rl, "pool", 5); n != 3 {
+		t.Errorf("%d slots occupied, want CanAcquireBatch to take none", n)
+	}
+}
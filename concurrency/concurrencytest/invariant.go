@@ -0,0 +1,45 @@
+package concurrencytest
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// AssertInvariant reads the pool of jobType and fails t if more than limit slots are occupied
+// or a jobID holds more than one slot, e.g. after a randomized sequence of concurrent operations
+// a job legitimately holding several slots through AddJobs or FillSlots fails the check as well
+func AssertInvariant(t testing.TB, rl *concurrency.RateLimiter, jobType string, limit int) {
+	t.Helper()
+
+	slots, err := rl.ListJobs(jobType, limit)
+	if err != nil {
+		t.Errorf("reading the pool %s: %v", jobType, err)
+		return
+	}
+	occupied := 0
+	for _, jobID := range slots {
+		if jobID != "" {
+			occupied++
+		}
+	}
+	if occupied > limit {
+		t.Errorf("pool %s has %d occupied slots, more than its limit of %d", jobType, occupied, limit)
+	}
+
+	duplicates, err := rl.DetectDuplicates(context.Background(), jobType, limit)
+	if err != nil {
+		t.Errorf("reading the pool %s: %v", jobType, err)
+		return
+	}
+	jobIDs := make([]string, 0, len(duplicates))
+	for jobID := range duplicates {
+		jobIDs = append(jobIDs, jobID)
+	}
+	sort.Strings(jobIDs)
+	for _, jobID := range jobIDs {
+		t.Errorf("job %s holds several slots of pool %s: %v", jobID, jobType, duplicates[jobID])
+	}
+}
@@ -0,0 +1,133 @@
+package concurrencytest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+var _ concurrency.RedisConnector = (*RecordingConnector)(nil)
+
+// RecordingConnector passes every call to another connector and records it with its result
+type RecordingConnector struct {
+	conn concurrency.RedisConnector
+
+	mu    sync.Mutex
+	trace Trace
+}
+
+// NewRecordingConnector is the constructor of RecordingConnector
+func NewRecordingConnector(conn concurrency.RedisConnector) *RecordingConnector {
+	return &RecordingConnector{conn: conn}
+}
+
+// Trace returns a copy of the calls recorded so far
+func (c *RecordingConnector) Trace() Trace {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append(Trace(nil), c.trace...)
+}
+
+func (c *RecordingConnector) record(call Call) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.trace = append(c.trace, call)
+}
+
+func (c *RecordingConnector) MGet(ctx context.Context, keys []string) ([]string, error) {
+	values, err := c.conn.MGet(ctx, keys)
+	c.record(Call{Method: "MGet", Keys: keys, Strings: values, Err: errString(err)})
+
+	return values, err
+}
+
+func (c *RecordingConnector) Get(ctx context.Context, key string) (string, error) {
+	value, err := c.conn.Get(ctx, key)
+	c.record(Call{Method: "Get", Keys: []string{key}, String: value, Err: errString(err)})
+
+	return value, err
+}
+
+func (c *RecordingConnector) Del(ctx context.Context, keys ...string) error {
+	err := c.conn.Del(ctx, keys...)
+	c.record(Call{Method: "Del", Keys: keys, Err: errString(err)})
+
+	return err
+}
+
+func (c *RecordingConnector) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	err := c.conn.Set(ctx, key, value, ttl)
+	c.record(Call{Method: "Set", Keys: []string{key}, Args: []string{value, ttl.String()}, Err: errString(err)})
+
+	return err
+}
+
+func (c *RecordingConnector) PTTL(ctx context.Context, keys []string) ([]time.Duration, error) {
+	ttls, err := c.conn.PTTL(ctx, keys)
+	c.record(Call{Method: "PTTL", Keys: keys, Durations: ttls, Err: errString(err)})
+
+	return ttls, err
+}
+
+func (c *RecordingConnector) BLPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error) {
+	popped, err := c.conn.BLPop(ctx, timeout, keys...)
+	c.record(Call{Method: "BLPop", Keys: keys, Args: []string{timeout.String()}, Strings: popped, Err: errString(err)})
+
+	return popped, err
+}
+
+func (c *RecordingConnector) RPush(ctx context.Context, key string, values ...string) error {
+	err := c.conn.RPush(ctx, key, values...)
+	c.record(Call{Method: "RPush", Keys: []string{key}, Args: values, Err: errString(err)})
+
+	return err
+}
+
+func (c *RecordingConnector) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) error {
+	err := c.conn.XAdd(ctx, stream, maxLen, values)
+	c.record(Call{Method: "XAdd", Keys: []string{stream}, Args: []string{fmt.Sprint(maxLen), fmt.Sprint(values)}, Err: errString(err)})
+
+	return err
+}
+
+func (c *RecordingConnector) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	reply, err := c.conn.Eval(ctx, script, keys, args...)
+	c.recordScript("Eval", keys, args, reply, err)
+
+	return reply, err
+}
+
+func (c *RecordingConnector) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	reply, err := c.conn.EvalSha(ctx, sha, keys, args...)
+	c.recordScript("EvalSha", keys, append([]interface{}{sha}, args...), reply, err)
+
+	return reply, err
+}
+
+func (c *RecordingConnector) ScriptLoad(ctx context.Context, script string) (string, error) {
+	sha, err := c.conn.ScriptLoad(ctx, script)
+	c.record(Call{Method: "ScriptLoad", String: sha, Err: errString(err)})
+
+	return sha, err
+}
+
+// recordScript records a script call, a reply which cannot be recorded is kept as its error
+func (c *RecordingConnector) recordScript(method string, keys []string, args []interface{}, reply interface{}, err error) {
+	call := Call{Method: method, Keys: keys, Err: errString(err)}
+	for _, arg := range args {
+		call.Args = append(call.Args, fmt.Sprint(arg))
+	}
+	if err == nil {
+		r, rerr := newReply(reply)
+		if rerr != nil {
+			call.Err = rerr.Error()
+		}
+		call.Reply = r
+	}
+	c.record(call)
+}
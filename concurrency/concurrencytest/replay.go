@@ -0,0 +1,173 @@
+package concurrencytest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+var _ concurrency.RedisConnector = (*ReplayConnector)(nil)
+
+// ErrUnexpectedCall defines the error when a replayed call does not match the next recorded call
+var ErrUnexpectedCall = errors.New("unexpected call")
+
+// ReplayConnector serves the results of a recorded trace in order without redis
+// every call has to match the method and the keys of the next recorded call, other arguments
+// like slot values are not compared, so use fixed jobIDs and WithClock for a faithful replay
+type ReplayConnector struct {
+	mu    sync.Mutex
+	trace Trace
+	next  int
+}
+
+// NewReplayConnector is the constructor of ReplayConnector
+func NewReplayConnector(trace Trace) *ReplayConnector {
+	return &ReplayConnector{trace: trace}
+}
+
+// Remaining returns the number of recorded calls not replayed yet
+func (c *ReplayConnector) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.trace) - c.next
+}
+
+// take returns the next recorded call if it matches method and keys
+func (c *ReplayConnector) take(method string, keys []string) (Call, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.next >= len(c.trace) {
+		return Call{}, fmt.Errorf("%w: %s %v after the end of the trace", ErrUnexpectedCall, method, keys)
+	}
+	call := c.trace[c.next]
+	if call.Method != method || !equalKeys(call.Keys, keys) {
+		return Call{}, fmt.Errorf("%w: %s %v, recorded %s %v at %d", ErrUnexpectedCall, method, keys, call.Method, call.Keys, c.next)
+	}
+	c.next++
+
+	return call, nil
+}
+
+func equalKeys(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *ReplayConnector) MGet(ctx context.Context, keys []string) ([]string, error) {
+	call, err := c.take("MGet", keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return call.Strings, restoreErr(call.Err)
+}
+
+func (c *ReplayConnector) Get(ctx context.Context, key string) (string, error) {
+	call, err := c.take("Get", []string{key})
+	if err != nil {
+		return "", err
+	}
+
+	return call.String, restoreErr(call.Err)
+}
+
+func (c *ReplayConnector) Del(ctx context.Context, keys ...string) error {
+	call, err := c.take("Del", keys)
+	if err != nil {
+		return err
+	}
+
+	return restoreErr(call.Err)
+}
+
+func (c *ReplayConnector) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	call, err := c.take("Set", []string{key})
+	if err != nil {
+		return err
+	}
+
+	return restoreErr(call.Err)
+}
+
+func (c *ReplayConnector) PTTL(ctx context.Context, keys []string) ([]time.Duration, error) {
+	call, err := c.take("PTTL", keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return call.Durations, restoreErr(call.Err)
+}
+
+func (c *ReplayConnector) BLPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error) {
+	call, err := c.take("BLPop", keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return call.Strings, restoreErr(call.Err)
+}
+
+func (c *ReplayConnector) RPush(ctx context.Context, key string, values ...string) error {
+	call, err := c.take("RPush", []string{key})
+	if err != nil {
+		return err
+	}
+
+	return restoreErr(call.Err)
+}
+
+func (c *ReplayConnector) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) error {
+	call, err := c.take("XAdd", []string{stream})
+	if err != nil {
+		return err
+	}
+
+	return restoreErr(call.Err)
+}
+
+func (c *ReplayConnector) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	call, err := c.take("Eval", keys)
+	if err != nil {
+		return nil, err
+	}
+	if call.Err != "" {
+		return nil, restoreErr(call.Err)
+	}
+
+	return call.Reply.value(), nil
+}
+
+func (c *ReplayConnector) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	call, err := c.take("EvalSha", keys)
+	if err != nil {
+		return nil, err
+	}
+	if call.Err != "" {
+		return nil, restoreErr(call.Err)
+	}
+
+	return call.Reply.value(), nil
+}
+
+func (c *ReplayConnector) ScriptLoad(ctx context.Context, script string) (string, error) {
+	call, err := c.take("ScriptLoad", nil)
+	if err != nil {
+		return "", err
+	}
+
+	return call.String, restoreErr(call.Err)
+}
@@ -0,0 +1,85 @@
+package concurrencytest_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+	"github.com/y4h2/golang-concurrency-limit/concurrency/concurrencytest"
+)
+
+// session runs a fixed sequence of limiter calls on conn and returns their outcomes
+func session(conn concurrency.RedisConnector) []string {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	rl := concurrency.NewRateLimiter(conn, time.Minute, concurrency.WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	var outcomes []string
+	record := func(name string, result interface{}, err error) {
+		outcomes = append(outcomes, fmt.Sprintf("%s: %v, %v", name, result, err))
+	}
+	for _, jobID := range []string{"a", "b", "c"} {
+		id, err := rl.AddJob("pool", 2, jobID, 0)
+		record("AddJob "+jobID, id, err)
+	}
+	jobs, err := rl.ListJobs("pool", 2)
+	record("ListJobs", jobs, err)
+	record("ExtendJob", nil, rl.ExtendJob(ctx, "pool", 2, "b", 0))
+	ok, err := rl.DeleteJob("pool", 2, "a")
+	record("DeleteJob a", ok, err)
+	ok, err = rl.DeleteJob("pool", 2, "absent")
+	record("DeleteJob absent", ok, err)
+	key, err := rl.FindJobSlot(ctx, "pool", 2, "b")
+	record("FindJobSlot", key, err)
+	jobs, err = rl.ListJobs("pool", 2)
+	record("ListJobs", jobs, err)
+
+	return outcomes
+}
+
+func TestRecordThenReplay(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	recorder := concurrencytest.NewRecordingConnector(concurrency.NewRedis(&redis.Options{Addr: mr.Addr()}))
+	recorded := session(recorder)
+
+	// the trace survives serialization
+	var buf bytes.Buffer
+	if _, err := recorder.Trace().WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	trace, err := concurrencytest.ReadTrace(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trace) == 0 {
+		t.Fatal("nothing was recorded")
+	}
+
+	replay := concurrencytest.NewReplayConnector(trace)
+	replayed := session(replay)
+	if fmt.Sprint(replayed) != fmt.Sprint(recorded) {
+		t.Errorf("the replay behaved differently:\n%q\nrecorded:\n%q", replayed, recorded)
+	}
+	if n := replay.Remaining(); n != 0 {
+		t.Errorf("%d recorded calls were not replayed", n)
+	}
+
+	// a call the trace does not expect is reported
+	if _, err := replay.Get(context.Background(), "pool-paused"); !errors.Is(err, concurrencytest.ErrUnexpectedCall) {
+		t.Errorf("a call after the end of the trace returned %v, want ErrUnexpectedCall", err)
+	}
+	replay = concurrencytest.NewReplayConnector(trace)
+	if _, err := replay.MGet(context.Background(), []string{"other-0"}); !errors.Is(err, concurrencytest.ErrUnexpectedCall) {
+		t.Errorf("a call diverging from the trace returned %v, want ErrUnexpectedCall", err)
+	}
+}
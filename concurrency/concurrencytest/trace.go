@@ -0,0 +1,129 @@
+// Package concurrencytest records the redis calls of a concurrency.RateLimiter and replays them,
+// so a bug reported with a captured trace can be reproduced without redis
+package concurrencytest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Call is a recorded connector call with its result
+type Call struct {
+	Method string   `json:"method"`
+	Keys   []string `json:"keys,omitempty"`
+	// Args are the other arguments formatted for reading, they are not compared on replay
+	Args []string `json:"args,omitempty"`
+
+	// Strings is the result of MGet and BLPop
+	Strings []string `json:"strings,omitempty"`
+	// String is the result of Get and ScriptLoad
+	String string `json:"string,omitempty"`
+	// Durations is the result of PTTL
+	Durations []time.Duration `json:"durations,omitempty"`
+	// Reply is the result of Eval and EvalSha
+	Reply *Reply `json:"reply,omitempty"`
+	Err   string `json:"err,omitempty"`
+}
+
+// Reply is a script reply keeping the redis types apart, a nil reply has no field set
+type Reply struct {
+	Int   *int64  `json:"int,omitempty"`
+	Str   *string `json:"str,omitempty"`
+	Array []Reply `json:"array,omitempty"`
+	// IsArray tells an empty array apart from a nil reply
+	IsArray bool `json:"is_array,omitempty"`
+}
+
+// Trace is a sequence of recorded calls
+type Trace []Call
+
+// WriteTo writes the trace as json
+func (t Trace) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(data)
+
+	return int64(n), err
+}
+
+// ReadTrace reads a trace written by Trace.WriteTo
+func ReadTrace(r io.Reader) (Trace, error) {
+	var t Trace
+	if err := json.NewDecoder(r).Decode(&t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// newReply converts a script reply of a connector
+func newReply(reply interface{}) (*Reply, error) {
+	switch v := reply.(type) {
+	case nil:
+		return &Reply{}, nil
+	case int64:
+		return &Reply{Int: &v}, nil
+	case string:
+		return &Reply{Str: &v}, nil
+	case []interface{}:
+		r := &Reply{IsArray: true}
+		for _, item := range v {
+			ir, err := newReply(item)
+			if err != nil {
+				return nil, err
+			}
+			r.Array = append(r.Array, *ir)
+		}
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("unsupported script reply %T", reply)
+}
+
+// value converts the reply back into the form a connector returns
+func (r *Reply) value() interface{} {
+	switch {
+	case r == nil:
+		return nil
+	case r.Int != nil:
+		return *r.Int
+	case r.Str != nil:
+		return *r.Str
+	case r.IsArray:
+		items := make([]interface{}, len(r.Array))
+		for i := range r.Array {
+			items[i] = r.Array[i].value()
+		}
+		return items
+	}
+
+	return nil
+}
+
+// errString records err, redis.Nil keeps its message so it is restored on replay
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
+// restoreErr returns the error recorded by errString
+func restoreErr(s string) error {
+	switch s {
+	case "":
+		return nil
+	case redis.Nil.Error():
+		return redis.Nil
+	}
+
+	return errors.New(s)
+}
@@ -0,0 +1,71 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// incrContentionScript increments the counter of every slot index given in ARGV
+// KEYS[1] is the contention hash
+var incrContentionScript = newScript(`
+for _, index in ipairs(ARGV) do
+	redis.call('HINCRBY', KEYS[1], index, 1)
+end
+return #ARGV
+`)
+
+// readContentionScript returns the contention hash as index, count pairs
+// KEYS[1] is the contention hash
+var readContentionScript = newScript(`
+return redis.call('HGETALL', KEYS[1])
+`)
+
+// contentionKey returns the key of the hash holding the contention counters of jobType
+func contentionKey(jobType string) string {
+	return fmt.Sprintf("%s-contention", jobType)
+}
+
+// recordContention counts that an acquisition wanted the slots at indexes but found them taken
+// a failed increment is ignored like the persistent counters
+func (rl *RateLimiter) recordContention(ctx context.Context, jobType string, indexes []int) {
+	if !rl.slotContention || len(indexes) == 0 {
+		return
+	}
+
+	args := make([]interface{}, len(indexes))
+	for i, index := range indexes {
+		args[i] = index
+	}
+	incrContentionScript.Run(ctx, rl.redisConnector, []string{contentionKey(jobType)}, args...)
+}
+
+// SlotContention returns per slot index how often an acquisition found the slot taken
+// before it took a later one in probe order or was rejected, see WithSlotContention
+// with the lowest index first the low indexes run hot, which WithRandomProbe spreads out
+// indexes without contention and indexes beyond limit are left out
+func (rl *RateLimiter) SlotContention(ctx context.Context, jobType string, limit int) (map[int]int64, error) {
+	reply, err := readContentionScript.Run(ctx, rl.reader(), []string{contentionKey(jobType)})
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := toStrings(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[int]int64{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		index, err := strconv.Atoi(pairs[i])
+		if err != nil || index < 0 || index >= limit {
+			continue
+		}
+		n, err := strconv.ParseInt(pairs[i+1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: contention counter %q", ErrCorruptSlotValue, pairs[i+1])
+		}
+		result[index] = n
+	}
+
+	return result, nil
+}
@@ -0,0 +1,67 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestSlotContention(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithSlotContention())
+	defer mr.Close()
+	ctx := context.Background()
+
+	// the lowest index is probed first, so every acquisition runs into the holder of slot 0
+	if _, err := rl.AddJob("pool", 3, "holder", 0); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		jobID := fmt.Sprintf("job-%d", i)
+		if _, err := rl.AddJob("pool", 3, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rl.DeleteJob("pool", 3, jobID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	contention, err := rl.SlotContention(ctx, "pool", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(contention) != "map[0:5]" {
+		t.Errorf("SlotContention returned %v, want only slot 0 contended 5 times", contention)
+	}
+
+	// a rejected acquisition found every slot taken
+	for _, jobID := range []string{"a", "b"} {
+		if _, err := rl.AddJob("pool", 3, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rl.AddJob("pool", 3, "rejected", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Fatalf("AddJob into a full pool returned %v", err)
+	}
+	if contention, err := rl.SlotContention(ctx, "pool", 3); err != nil || fmt.Sprint(contention) != "map[0:8 1:2 2:1]" {
+		t.Errorf("SlotContention returned %v, %v, want map[0:8 1:2 2:1]", contention, err)
+	}
+}
+
+func TestSlotContentionOptIn(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	for _, jobID := range []string{"a", "b", "c"} {
+		if _, err := rl.AddJob("pool", 2, jobID, 0); err != nil && !errors.Is(err, concurrency.ErrNoSlot) {
+			t.Fatal(err)
+		}
+	}
+	if mr.Exists("pool-contention") {
+		t.Error("contention was counted without WithSlotContention")
+	}
+	if contention, err := rl.SlotContention(context.Background(), "pool", 2); err != nil || len(contention) != 0 {
+		t.Errorf("SlotContention returned %v, %v, want no counters", contention, err)
+	}
+}
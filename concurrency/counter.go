@@ -0,0 +1,151 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// counterIncrScript increments the counter unless it already reached the limit
+// the ttl is reset on every grant, so a counter leaked by crashed holders resets itself
+// once no job was added for a whole ttl
+// it returns -1 when the limit is reached and -2 when the counter is not a number
+// KEYS[1] is the counter, ARGV[1] the limit, ARGV[2] the ttl in milliseconds
+var counterIncrScript = newScript(`
+local count = tonumber(redis.call('GET', KEYS[1]) or '0')
+if not count then
+	return -2
+end
+if count >= tonumber(ARGV[1]) then
+	return -1
+end
+count = redis.call('INCR', KEYS[1])
+if tonumber(ARGV[2]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return count
+`)
+
+// counterDecrScript decrements the counter without going below zero and returns the new count
+// it returns -2 when the counter is not a number
+// KEYS[1] is the counter
+var counterDecrScript = newScript(`
+local count = tonumber(redis.call('GET', KEYS[1]) or '0')
+if not count then
+	return -2
+end
+if count <= 0 then
+	return 0
+end
+return redis.call('DECR', KEYS[1])
+`)
+
+// CounterLimiter limits the concurrency of a jobType with a single counter key
+// it is cheaper than the slots of a RateLimiter but does not know who holds the slots,
+// so holder level features like ListJobs, ExtendJob, ReassignJob or leases are not available
+type CounterLimiter struct {
+	rl *RateLimiter
+}
+
+// NewCounterLimiter is the constructor of CounterLimiter
+// it uses the connector, default ttl, metrics and max limit of rl
+func NewCounterLimiter(rl *RateLimiter) *CounterLimiter {
+	return &CounterLimiter{rl: rl}
+}
+
+// counterKey returns the key of the counter of jobType
+func counterKey(jobType string) string {
+	return fmt.Sprintf("%s-count", jobType)
+}
+
+// errCorruptCounter returns the error for a counter of jobType which is not a number
+func errCorruptCounter(jobType string) error {
+	return fmt.Errorf("%w: counter %s is not a number", ErrCorruptSlotValue, counterKey(jobType))
+}
+
+// AddJob takes a slot of jobType, if all slots are taken ErrNoSlot is returned
+// ttl bounds how long the counter survives without new jobs, the default ttl is used when it is zero
+func (c *CounterLimiter) AddJob(ctx context.Context, jobType string, limit int, ttl time.Duration) (err error) {
+	start := time.Now()
+	defer func() {
+		c.rl.observeOperation(ctx, "counter_add_job", jobType, start, err)
+		err = rejection(jobType, err)
+	}()
+
+	if err := c.rl.rejectDryRun("CounterLimiter.AddJob"); err != nil {
+		return err
+	}
+
+	if err := c.rl.checkLimit(limit); err != nil {
+		return err
+	}
+	if limit == 0 {
+		return ErrPoolDisabled
+	}
+	ttl, err = c.rl.acquireTTL(ctx, ttl)
+	if err != nil {
+		return err
+	}
+
+	reply, err := counterIncrScript.Run(ctx, c.rl.redisConnector, []string{counterKey(jobType)}, limit, ttlMilli(ttl))
+	if err != nil {
+		return err
+	}
+	count, err := toInt64(reply)
+	if err != nil {
+		return err
+	}
+	if count == -2 {
+		return errCorruptCounter(jobType)
+	}
+	if count < 0 {
+		return ErrNoSlot
+	}
+	c.rl.observeUtilization(jobType, int(count), limit)
+
+	return nil
+}
+
+// DeleteJob gives a slot of jobType back, the counter never goes below zero
+func (c *CounterLimiter) DeleteJob(ctx context.Context, jobType string) (err error) {
+	start := time.Now()
+	defer func() {
+		c.rl.observeOperation(ctx, "counter_delete_job", jobType, start, err)
+	}()
+
+	reply, err := counterDecrScript.Run(ctx, c.rl.redisConnector, []string{counterKey(jobType)})
+	if err != nil {
+		return err
+	}
+	count, err := toInt64(reply)
+	if err != nil {
+		return err
+	}
+	if count == -2 {
+		return errCorruptCounter(jobType)
+	}
+
+	return nil
+}
+
+// Count returns the number of taken slots of jobType
+func (c *CounterLimiter) Count(ctx context.Context, jobType string) (int64, error) {
+	reply, err := c.rl.reader().Get(ctx, counterKey(jobType))
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := strconv.ParseInt(reply, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: counter %s %q", ErrCorruptSlotValue, counterKey(jobType), reply)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,123 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestCounterLimiterNeverExceedsLimit(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	c := concurrency.NewCounterLimiter(rl)
+	ctx := context.Background()
+	const limit = 3
+
+	var held, maxHeld int32
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				err := c.AddJob(ctx, "pool", limit, 0)
+				if errors.Is(err, concurrency.ErrNoSlot) {
+					continue
+				}
+				if err != nil {
+					t.Errorf("AddJob: %v", err)
+					return
+				}
+				n := atomic.AddInt32(&held, 1)
+				for {
+					max := atomic.LoadInt32(&maxHeld)
+					if n <= max || atomic.CompareAndSwapInt32(&maxHeld, max, n) {
+						break
+					}
+				}
+				if count, err := c.Count(ctx, "pool"); err != nil || count > limit {
+					t.Errorf("Count returned %d, %v, want at most %d", count, err, limit)
+				}
+				atomic.AddInt32(&held, -1)
+				if err := c.DeleteJob(ctx, "pool"); err != nil {
+					t.Errorf("DeleteJob: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if maxHeld > limit {
+		t.Errorf("%d jobs held a slot at once, want at most %d", maxHeld, limit)
+	}
+	if count, err := c.Count(ctx, "pool"); err != nil || count != 0 {
+		t.Errorf("Count returned %d, %v after every job was deleted", count, err)
+	}
+}
+
+func TestCounterLimiterDecrement(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	c := concurrency.NewCounterLimiter(rl)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := c.AddJob(ctx, "pool", 2, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.AddJob(ctx, "pool", 2, time.Minute); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("AddJob on a full counter returned %v, want ErrNoSlot", err)
+	}
+	if err := c.DeleteJob(ctx, "pool"); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := c.Count(ctx, "pool"); err != nil || count != 1 {
+		t.Errorf("Count returned %d, %v, want 1", count, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := c.DeleteJob(ctx, "pool"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count, err := c.Count(ctx, "pool"); err != nil || count != 0 {
+		t.Errorf("Count returned %d, %v, want the counter kept at zero", count, err)
+	}
+
+	// a counter leaked by crashed holders resets itself after the ttl
+	for i := 0; i < 2; i++ {
+		if err := c.AddJob(ctx, "pool", 2, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mr.FastForward(time.Minute)
+	if err := c.AddJob(ctx, "pool", 2, time.Minute); err != nil {
+		t.Errorf("AddJob after the counter expired returned %v", err)
+	}
+}
+
+func TestCounterLimiterCorruptCounter(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	c := concurrency.NewCounterLimiter(rl)
+	ctx := context.Background()
+
+	mr.Set("pool-count", "three")
+	if _, err := c.Count(ctx, "pool"); !errors.Is(err, concurrency.ErrCorruptSlotValue) {
+		t.Errorf("Count returned %v, want ErrCorruptSlotValue", err)
+	}
+	if err := c.AddJob(ctx, "pool", 3, 0); !errors.Is(err, concurrency.ErrCorruptSlotValue) {
+		t.Errorf("AddJob returned %v, want ErrCorruptSlotValue", err)
+	}
+	if err := c.DeleteJob(ctx, "pool"); !errors.Is(err, concurrency.ErrCorruptSlotValue) {
+		t.Errorf("DeleteJob returned %v, want ErrCorruptSlotValue", err)
+	}
+	if got, _ := mr.Get("pool-count"); got != "three" {
+		t.Errorf("the corrupt counter was changed to %q", got)
+	}
+}
@@ -0,0 +1,91 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// fields of the persistent counters hash
+const (
+	counterGrants     = "grants"
+	counterRejections = "rejections"
+	counterReleases   = "releases"
+)
+
+// incrCounterScript increments a field of the counters hash
+// KEYS[1] is the counters hash, ARGV[1] the field and ARGV[2] the increment
+var incrCounterScript = newScript(`
+return redis.call('HINCRBY', KEYS[1], ARGV[1], ARGV[2])
+`)
+
+// readCountersScript returns the counter fields given in ARGV
+// KEYS[1] is the counters hash
+var readCountersScript = newScript(`
+return redis.call('HMGET', KEYS[1], unpack(ARGV))
+`)
+
+// LifetimeStats holds the cumulative counters of a jobType persisted in redis
+type LifetimeStats struct {
+	Grants     int64
+	Rejections int64
+	Releases   int64
+}
+
+// countersKey returns the key of the hash holding the persistent counters of jobType
+func countersKey(jobType string) string {
+	return fmt.Sprintf("%s-counters", jobType)
+}
+
+// count increments a persistent counter if WithPersistentCounters is set
+// the lua paths of WithActiveSet update the counters inside their own scripts instead
+// the increment runs after the operation and is not atomic with it; a failed increment is logged,
+// the counters are statistics and must not fail the operation
+func (rl *RateLimiter) count(ctx context.Context, jobType, field string, n int) {
+	if !rl.persistentCounters || n == 0 {
+		return
+	}
+
+	if _, err := incrCounterScript.Run(ctx, rl.redisConnector, []string{countersKey(jobType)}, field, n); err != nil {
+		rl.logf("concurrency: incrementing the %s counter of %s by %d failed: %v", field, jobType, n, err)
+	}
+}
+
+// LifetimeStats returns the cumulative grants, rejections and releases of jobType
+// they are shared by every instance and survive restarts, see WithPersistentCounters
+func (rl *RateLimiter) LifetimeStats(ctx context.Context, jobType string) (LifetimeStats, error) {
+	reply, err := readCountersScript.Run(ctx, rl.reader(), []string{countersKey(jobType)},
+		counterGrants, counterRejections, counterReleases)
+	if err != nil {
+		return LifetimeStats{}, err
+	}
+	return parseCounters(reply)
+}
+
+// parseCounters converts the HMGET reply of the grants, rejections and releases fields
+func parseCounters(reply interface{}) (LifetimeStats, error) {
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != 3 {
+		return LifetimeStats{}, fmt.Errorf("unexpected script reply %v", reply)
+	}
+
+	var values [3]int64
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			// the counter was never incremented
+			continue
+		}
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return LifetimeStats{}, fmt.Errorf("%w: counter %q", ErrCorruptSlotValue, s)
+		}
+		values[i] = n
+	}
+
+	return LifetimeStats{
+		Grants:     values[0],
+		Rejections: values[1],
+		Releases:   values[2],
+	}, nil
+}
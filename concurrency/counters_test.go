@@ -0,0 +1,91 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestLifetimeStats(t *testing.T) {
+	modes := map[string][]concurrency.Option{
+		"default":    {concurrency.WithPersistentCounters()},
+		"active set": {concurrency.WithPersistentCounters(), concurrency.WithActiveSet()},
+	}
+	for name, opts := range modes {
+		t.Run(name, func(t *testing.T) {
+			rl, mr := newTestLimiter(t, opts...)
+			defer mr.Close()
+			ctx := context.Background()
+
+			for _, jobID := range []string{"a", "b", "c"} {
+				rl.AddJob("pool", 2, jobID, 0)
+			}
+			if _, err := rl.DeleteJob("pool", 2, "a"); err != nil {
+				t.Fatal(err)
+			}
+			// releasing a job which holds no slot is not counted
+			if _, err := rl.DeleteJob("pool", 2, "c"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := rl.AddJob("pool", 2, "d", 0); err != nil {
+				t.Fatal(err)
+			}
+
+			want := concurrency.LifetimeStats{Grants: 3, Rejections: 1, Releases: 1}
+			if stats, err := rl.LifetimeStats(ctx, "pool"); err != nil || stats != want {
+				t.Errorf("LifetimeStats returned %+v, %v, want %+v", stats, err, want)
+			}
+
+			// the counters live in redis, another instance reads the same values
+			other := concurrency.NewRateLimiter(newTestConnector(mr), testTTL)
+			if stats, err := other.LifetimeStats(ctx, "pool"); err != nil || stats != want {
+				t.Errorf("LifetimeStats of another instance returned %+v, %v, want %+v", stats, err, want)
+			}
+		})
+	}
+}
+
+func TestLifetimeStatsOptIn(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 1, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists("pool-counters") {
+		t.Error("counters were written without WithPersistentCounters")
+	}
+	if stats, err := rl.LifetimeStats(context.Background(), "pool"); err != nil || stats != (concurrency.LifetimeStats{}) {
+		t.Errorf("LifetimeStats returned %+v, %v, want zero counters", stats, err)
+	}
+}
+
+// failingCountersConnector fails every script on the counters hash
+type failingCountersConnector struct {
+	concurrency.RedisConnector
+}
+
+func (c failingCountersConnector) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	if len(keys) > 0 && strings.HasSuffix(keys[0], "-counters") {
+		return nil, errors.New("ERR counters unavailable")
+	}
+	return c.RedisConnector.EvalSha(ctx, sha, keys, args...)
+}
+
+func TestLifetimeStatsIncrementFailureLogged(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	logger := &testLogger{}
+	rl := concurrency.NewRateLimiter(failingCountersConnector{newTestConnector(mr)}, testTTL,
+		concurrency.WithPersistentCounters(), concurrency.WithLogger(logger))
+
+	if _, err := rl.AddJob("pool", 1, "job", 0); err != nil {
+		t.Fatalf("AddJob with failing counters: %v", err)
+	}
+	if lines := strings.Join(logger.Lines(), "\n"); !strings.Contains(lines, "incrementing the grants counter of pool by 1 failed") {
+		t.Errorf("logged %q, want the failed increment", lines)
+	}
+}
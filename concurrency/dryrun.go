@@ -0,0 +1,62 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// metricDryRunRejection counts the acquisitions WithDryRun granted but the limit would have rejected
+// labels: job_type and reason
+const metricDryRunRejection = "dry_run_rejections_total"
+
+// ErrDryRunUnsupported defines the error when an operation which cannot take its slots in the shadow pool
+// is called with WithDryRun
+var ErrDryRunUnsupported = errors.New("operation is not available with WithDryRun")
+
+// dryRunJobType returns the shadow jobType taking the slots of jobType in dry run
+func dryRunJobType(jobType string) string {
+	return fmt.Sprintf("%s-dryrun", jobType)
+}
+
+// dryRunAcquire takes a slot of the shadow pool of jobType and grants the job even if that fails
+// a rejection is logged and emitted as metricDryRunRejection, other failures are logged only
+func (rl *RateLimiter) dryRunAcquire(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) (string, string, int64, error) {
+	if jobID == "" {
+		var err error
+		if jobID, err = newJobID(); err != nil {
+			return "", "", 0, err
+		}
+	}
+	if err := rl.validateJobID(jobID); err != nil {
+		return "", "", 0, err
+	}
+
+	slotKey, _, token, err := rl.acquireSlot(ctx, dryRunJobType(jobType), limit, jobID, ttl)
+	if err == nil {
+		return slotKey, jobID, token, nil
+	}
+	rejected, ok := err.(*RejectedError)
+	if !ok {
+		rl.logf("concurrency: dry run acquisition of %s failed: %v", jobType, err)
+		return "", jobID, 0, nil
+	}
+
+	rl.logf("concurrency: dry run granted job %s of %s which would have been rejected (%s)", jobID, jobType, rejected.Reason)
+	rl.emitMetric(ctx, metricDryRunRejection, 1, map[string]string{
+		"job_type": jobType,
+		"reason":   rejected.Reason.String(),
+	})
+
+	return "", jobID, 0, nil
+}
+
+// rejectDryRun returns ErrDryRunUnsupported for operation if dry run is enabled
+func (rl *RateLimiter) rejectDryRun(operation string) error {
+	if !rl.dryRun {
+		return nil
+	}
+
+	return fmt.Errorf("%s: %w", operation, ErrDryRunUnsupported)
+}
@@ -0,0 +1,106 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestDryRunGrantsEveryAcquisition(t *testing.T) {
+	sink := &metricSink{}
+	logger := &testLogger{}
+	rl, mr := newTestLimiter(t, concurrency.WithDryRun(true), concurrency.WithMetricsHook(sink.hook),
+		concurrency.WithLogger(logger))
+	defer mr.Close()
+
+	for i := 0; i < 4; i++ {
+		jobID := fmt.Sprintf("job-%d", i)
+		got, err := rl.AddJob("pool", 2, jobID, 0)
+		if err != nil || got != jobID {
+			t.Fatalf("AddJob %s in dry run returned %q, %v", jobID, got, err)
+		}
+	}
+
+	// the real pool is untouched, the shadow pool carries the accounting
+	for _, slotKey := range []string{"pool-0", "pool-1"} {
+		if mr.Exists(slotKey) {
+			t.Errorf("dry run wrote the real slot %s", slotKey)
+		}
+	}
+	if n := occupied(t, rl, "pool-dryrun", 2); n != 2 {
+		t.Errorf("%d shadow slots occupied, want 2", n)
+	}
+
+	var rejections []string
+	for _, m := range sink.Metrics() {
+		if m.Name == "dry_run_rejections_total" {
+			rejections = append(rejections, m.Labels["job_type"]+"/"+m.Labels["reason"])
+		}
+	}
+	if fmt.Sprint(rejections) != "[pool/saturated pool/saturated]" {
+		t.Errorf("emitted the would-be rejections %v, want two of pool", rejections)
+	}
+	if len(logger.Lines()) != 2 {
+		t.Errorf("logged %q, want the two would-be rejections", logger.Lines())
+	}
+
+	// a released shadow slot is granted without a would-be rejection
+	if deleted, err := rl.DeleteJob("pool", 2, "job-0"); err != nil || !deleted {
+		t.Fatalf("DeleteJob in dry run returned %v, %v", deleted, err)
+	}
+	if _, err := rl.AddJob("pool", 2, "job-4", 0); err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for _, m := range sink.Metrics() {
+		if m.Name == "dry_run_rejections_total" {
+			count++
+		}
+	}
+	if count != 2 {
+		t.Errorf("%d would-be rejections after a slot was released, want still 2", count)
+	}
+}
+
+func TestDryRunUnsupported(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithDryRun(true))
+	defer mr.Close()
+	ctx := context.Background()
+
+	if _, err := rl.AddJobs(ctx, "pool", 2, []string{"a", "b"}, 0); !errors.Is(err, concurrency.ErrDryRunUnsupported) {
+		t.Errorf("AddJobs in dry run returned %v, want ErrDryRunUnsupported", err)
+	}
+	if err := rl.SwapOccupancy(ctx, "pool", 2, map[int]string{0: "job"}, 0); !errors.Is(err, concurrency.ErrDryRunUnsupported) {
+		t.Errorf("SwapOccupancy in dry run returned %v, want ErrDryRunUnsupported", err)
+	}
+	if n := occupied(t, rl, "pool", 2); n != 0 {
+		t.Errorf("%d real slots occupied", n)
+	}
+}
+
+func TestDryRunExtends(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithDryRun(true))
+	defer mr.Close()
+	ctx := context.Background()
+
+	_, token, err := rl.AddJobWithToken(ctx, "pool", 2, "job", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing, err := rl.ExtendAll(ctx, "pool", 2, []string{"job"}, time.Minute); err != nil || len(missing) != 0 {
+		t.Errorf("ExtendAll in dry run returned %v, %v, want the shadow slot extended", missing, err)
+	}
+	if ttl := mr.TTL("pool-dryrun-0"); ttl != time.Minute {
+		t.Errorf("ExtendAll left the shadow slot with ttl %s", ttl)
+	}
+	if err := rl.ExtendJobWithToken(ctx, "pool", 2, "job", token, 2*time.Minute); err != nil {
+		t.Errorf("ExtendJobWithToken in dry run returned %v", err)
+	}
+	if ttl := mr.TTL("pool-dryrun-0"); ttl != 2*time.Minute {
+		t.Errorf("ExtendJobWithToken left the shadow slot with ttl %s", ttl)
+	}
+}
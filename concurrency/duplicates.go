@@ -0,0 +1,47 @@
+package concurrency
+
+import (
+	"context"
+	"sort"
+)
+
+// DetectDuplicates returns the slot keys of every jobID which holds more than one slot of jobType
+// a jobID normally holds a single slot, a duplicate over-consumes the capacity of the pool
+func (rl *RateLimiter) DetectDuplicates(ctx context.Context, jobType string, limit int) (map[string][]string, error) {
+	slots, err := rl.listJobs(ctx, rl.reader(), jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return findDuplicates(slots), nil
+}
+
+// findDuplicates groups the slot keys of the jobIDs found in more than one slot, sorted by key
+func findDuplicates(slots map[string]string) map[string][]string {
+	byJob := map[string][]string{}
+	for k, jobID := range slots {
+		if jobID != "" {
+			byJob[jobID] = append(byJob[jobID], k)
+		}
+	}
+
+	duplicates := map[string][]string{}
+	for jobID, keys := range byJob {
+		if len(keys) > 1 {
+			sort.Strings(keys)
+			duplicates[jobID] = keys
+		}
+	}
+
+	return duplicates
+}
+
+// warnDuplicates logs the jobIDs holding more than one slot, see WithDuplicateWarnings
+func (rl *RateLimiter) warnDuplicates(jobType string, slots map[string]string) {
+	if !rl.duplicateWarnings {
+		return
+	}
+	for jobID, keys := range findDuplicates(slots) {
+		rl.logf("concurrency: job %s of %s holds %d slots: %v", jobID, jobType, len(keys), keys)
+	}
+}
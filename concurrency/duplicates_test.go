@@ -0,0 +1,53 @@
+package concurrency_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestDetectDuplicates(t *testing.T) {
+	logger := &testLogger{}
+	rl, mr := newTestLimiter(t, concurrency.WithDuplicateWarnings(), concurrency.WithLogger(logger))
+	defer mr.Close()
+
+	for _, jobID := range []string{"a", "b", "c"} {
+		if _, err := rl.AddJob("pool", 6, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	duplicates, err := rl.DetectDuplicates(context.Background(), "pool", 6)
+	if err != nil || len(duplicates) != 0 {
+		t.Fatalf("DetectDuplicates without duplicates returned %v, %v", duplicates, err)
+	}
+
+	// plant copies of the values of a and c in free slots
+	for from, to := range map[string]string{"pool-0": "pool-4", "pool-2": "pool-5"} {
+		value, err := mr.Get(from)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mr.Set(to, value)
+	}
+	duplicates, err = rl.DetectDuplicates(context.Background(), "pool", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "map[a:[pool-0 pool-4] c:[pool-2 pool-5]]"
+	if got := fmt.Sprint(duplicates); got != want {
+		t.Errorf("DetectDuplicates returned %s, want %s", got, want)
+	}
+
+	if _, err := rl.ListJobs("pool", 6); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Join(logger.Lines(), "\n")
+	for _, want := range []string{"job a of pool holds 2 slots", "job c of pool holds 2 slots"} {
+		if !strings.Contains(lines, want) {
+			t.Errorf("ListJobs logged %q, want %q", lines, want)
+		}
+	}
+}
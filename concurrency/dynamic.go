@@ -0,0 +1,97 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DynamicLimitFunc computes the current limit, e.g. from the node count of an autoscaled fleet
+type DynamicLimitFunc func(ctx context.Context) (int, error)
+
+// dynamicLimit caches the result of a DynamicLimitFunc, see WithDynamicLimit
+type dynamicLimit struct {
+	fn       DynamicLimitFunc
+	cacheFor time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	limit    int
+	at       time.Time
+	valid    bool
+	inflight *dynamicCall
+}
+
+// dynamicCall is a running call of the DynamicLimitFunc, done is closed once limit and err are set
+type dynamicCall struct {
+	done  chan struct{}
+	limit int
+	err   error
+}
+
+// resolve returns the cached limit while it is younger than cacheFor, otherwise it calls fn
+// fn runs without holding the lock, concurrent callers wait for the running call and share its result
+// a failing fn fails the operation, the previous value is not reused
+func (d *dynamicLimit) resolve(ctx context.Context) (int, error) {
+	d.mu.Lock()
+	if d.valid && d.now().Sub(d.at) < d.cacheFor {
+		limit := d.limit
+		d.mu.Unlock()
+		return limit, nil
+	}
+	if call := d.inflight; call != nil {
+		d.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.limit, call.err
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	call := &dynamicCall{done: make(chan struct{})}
+	d.inflight = call
+	d.mu.Unlock()
+
+	call.limit, call.err = d.fn(ctx)
+
+	d.mu.Lock()
+	if call.err == nil {
+		d.limit, d.at, d.valid = call.limit, d.now(), true
+	}
+	d.inflight = nil
+	d.mu.Unlock()
+	close(call.done)
+
+	return call.limit, call.err
+}
+
+// resolveLimit returns the limit of WithDynamicLimit
+func (rl *RateLimiter) resolveLimit(ctx context.Context) (int, error) {
+	if rl.dynamicLimit == nil {
+		return 0, errors.New("a dynamic limit requires WithDynamicLimit")
+	}
+
+	return rl.dynamicLimit.resolve(ctx)
+}
+
+// AddJobDynamic adds a job like AddJob with the limit computed by WithDynamicLimit
+func (rl *RateLimiter) AddJobDynamic(ctx context.Context, jobType, jobID string, ttl time.Duration) (string, error) {
+	limit, err := rl.resolveLimit(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return rl.addJob(ctx, jobType, limit, jobID, ttl)
+}
+
+// ListJobsDynamic lists the jobs like ListJobs with the limit computed by WithDynamicLimit
+// slots beyond a limit which shrank are not listed, they free themselves through their ttl
+func (rl *RateLimiter) ListJobsDynamic(ctx context.Context, jobType string) (map[string]string, error) {
+	limit, err := rl.resolveLimit(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return rl.listJobs(ctx, rl.reader(), jobType, limit)
+}
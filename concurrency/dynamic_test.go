@@ -0,0 +1,108 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// nodeCount is a fleet size read by a dynamic limit
+type nodeCount struct {
+	mu    sync.Mutex
+	nodes int
+	err   error
+	calls int
+}
+
+func (n *nodeCount) set(nodes int, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.nodes, n.err = nodes, err
+}
+
+func (n *nodeCount) limit(ctx context.Context) (int, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.calls++
+	return 2 * n.nodes, n.err
+}
+
+func (n *nodeCount) Calls() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls
+}
+
+func TestDynamicLimit(t *testing.T) {
+	clock := newFakeClock()
+	nodes := &nodeCount{nodes: 1}
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now),
+		concurrency.WithDynamicLimit(nodes.limit, 10*time.Second))
+	defer mr.Close()
+	ctx := context.Background()
+
+	for _, jobID := range []string{"a", "b"} {
+		if _, err := rl.AddJobDynamic(ctx, "pool", jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rl.AddJobDynamic(ctx, "pool", "c", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Fatalf("AddJobDynamic beyond a limit of 2 returned %v", err)
+	}
+
+	// the fleet grows, the cached limit holds until it is refreshed
+	nodes.set(2, nil)
+	if _, err := rl.AddJobDynamic(ctx, "pool", "c", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("AddJobDynamic with the cached limit returned %v", err)
+	}
+	if calls := nodes.Calls(); calls != 1 {
+		t.Errorf("the limit was computed %d times within the cache period, want once", calls)
+	}
+	clock.Advance(11 * time.Second)
+	for _, jobID := range []string{"c", "d"} {
+		if _, err := rl.AddJobDynamic(ctx, "pool", jobID, 0); err != nil {
+			t.Fatalf("AddJobDynamic %s after the fleet grew: %v", jobID, err)
+		}
+	}
+	if _, err := rl.AddJobDynamic(ctx, "pool", "e", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("AddJobDynamic beyond a limit of 4 returned %v", err)
+	}
+	if jobs, err := rl.ListJobsDynamic(ctx, "pool"); err != nil || len(jobs) != 4 {
+		t.Errorf("ListJobsDynamic returned %v, %v, want 4 slots", jobs, err)
+	}
+
+	// the fleet shrinks, slots beyond the limit are no longer listed
+	nodes.set(1, nil)
+	clock.Advance(11 * time.Second)
+	if jobs, err := rl.ListJobsDynamic(ctx, "pool"); err != nil || len(jobs) != 2 || jobs["pool-0"] != "a" || jobs["pool-1"] != "b" {
+		t.Errorf("ListJobsDynamic after the fleet shrank returned %v, %v", jobs, err)
+	}
+
+	// a failing limit fails the operation instead of reusing the previous value
+	lookupErr := errors.New("node count unavailable")
+	nodes.set(1, lookupErr)
+	clock.Advance(11 * time.Second)
+	if _, err := rl.AddJobDynamic(ctx, "pool", "f", 0); !errors.Is(err, lookupErr) {
+		t.Errorf("AddJobDynamic with a failing limit returned %v", err)
+	}
+	if _, err := rl.ListJobsDynamic(ctx, "pool"); !errors.Is(err, lookupErr) {
+		t.Errorf("ListJobsDynamic with a failing limit returned %v", err)
+	}
+	nodes.set(3, nil)
+	if _, err := rl.AddJobDynamic(ctx, "pool", "f", 0); err != nil {
+		t.Errorf("AddJobDynamic after the limit recovered: %v", err)
+	}
+}
+
+func TestDynamicLimitRequiresOption(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	if _, err := rl.AddJobDynamic(context.Background(), "pool", "job", 0); err == nil {
+		t.Error("AddJobDynamic without WithDynamicLimit succeeded")
+	}
+}
@@ -0,0 +1,113 @@
+package concurrency
+
+import (
+	"expvar"
+	"sync"
+)
+
+// expvarPublishMu serializes the check for a taken name with the publish of every limiter,
+// expvar.Publish panics on a name which got published in between
+var expvarPublishMu sync.Mutex
+
+// expvarStats aggregates the operations and utilization of every jobType seen by a RateLimiter
+// and publishes them as an expvar, so they show up under /debug/vars
+type expvarStats struct {
+	name string
+	logf func(format string, v ...interface{})
+
+	once  sync.Once
+	mu    sync.Mutex
+	pools map[string]*expvarPool
+}
+
+// expvarPool holds the stats of a jobType, operations counts the results of every operation
+// used and limit are the ones observed after the last acquisition or release
+type expvarPool struct {
+	Operations  map[string]map[string]int64 `json:"operations"`
+	Used        int                         `json:"used"`
+	Limit       int                         `json:"limit"`
+	Utilization float64                     `json:"utilization"`
+}
+
+// publish registers the stats under their name on the first update
+// a name already taken by another var is logged and the stats are not published
+func (s *expvarStats) publish() {
+	s.once.Do(func() {
+		expvarPublishMu.Lock()
+		defer expvarPublishMu.Unlock()
+		if expvar.Get(s.name) != nil {
+			s.logf("concurrency: expvar %s is already published, the limiter stats are not exported", s.name)
+			return
+		}
+		expvar.Publish(s.name, expvar.Func(s.snapshot))
+	})
+}
+
+// pool returns the stats of jobType, the caller holds mu
+func (s *expvarStats) pool(jobType string) *expvarPool {
+	p, ok := s.pools[jobType]
+	if !ok {
+		p = &expvarPool{Operations: map[string]map[string]int64{}}
+		s.pools[jobType] = p
+	}
+
+	return p
+}
+
+// record counts the result of an operation on jobType
+func (s *expvarStats) record(jobType, operation, result string) {
+	if s == nil {
+		return
+	}
+	s.publish()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.pool(jobType)
+	results, ok := p.Operations[operation]
+	if !ok {
+		results = map[string]int64{}
+		p.Operations[operation] = results
+	}
+	results[result]++
+}
+
+// observe records the utilization of jobType
+func (s *expvarStats) observe(jobType string, used, limit int) {
+	if s == nil || limit <= 0 {
+		return
+	}
+	if used < 0 {
+		used = 0
+	}
+	s.publish()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := s.pool(jobType)
+	p.Used = used
+	p.Limit = limit
+	p.Utilization = float64(used) / float64(limit)
+}
+
+// snapshot returns a copy of the stats of every jobType, it is the value of the published var
+func (s *expvarStats) snapshot() interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pools := make(map[string]expvarPool, len(s.pools))
+	for jobType, p := range s.pools {
+		copied := *p
+		copied.Operations = make(map[string]map[string]int64, len(p.Operations))
+		for operation, results := range p.Operations {
+			counts := make(map[string]int64, len(results))
+			for result, n := range results {
+				counts[result] = n
+			}
+			copied.Operations[operation] = counts
+		}
+		pools[jobType] = copied
+	}
+
+	return pools
+}
@@ -0,0 +1,72 @@
+package concurrency_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// expvarPool is the published stats of a jobType
+type expvarPool struct {
+	Operations  map[string]map[string]int64 `json:"operations"`
+	Used        int                         `json:"used"`
+	Limit       int                         `json:"limit"`
+	Utilization float64                     `json:"utilization"`
+}
+
+func TestExpvarStats(t *testing.T) {
+	// expvar names are global, a fresh one keeps repeated runs apart
+	name := fmt.Sprintf("concurrency_test_%d", time.Now().UnixNano())
+	rl, mr := newTestLimiter(t, concurrency.WithExpvar(name))
+	defer mr.Close()
+
+	if expvar.Get(name) != nil {
+		t.Fatal("the stats were published before the first operation")
+	}
+	for _, jobID := range []string{"a", "b", "c", "d", "e"} {
+		if _, err := rl.AddJob("pool", 4, jobID, 0); err != nil && jobID != "e" {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rl.DeleteJob("pool", 4, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	v := expvar.Get(name)
+	if v == nil {
+		t.Fatal("the stats were not published")
+	}
+	var pools map[string]expvarPool
+	if err := json.Unmarshal([]byte(v.String()), &pools); err != nil {
+		t.Fatalf("the published stats %s: %v", v.String(), err)
+	}
+	p, ok := pools["pool"]
+	if !ok {
+		t.Fatalf("the published stats %s miss the pool", v.String())
+	}
+	if got := fmt.Sprint(p.Operations); got != "map[add_job:map[no_slot:1 ok:4] delete_job:map[ok:1]]" {
+		t.Errorf("published the operations %s", got)
+	}
+	if p.Used != 3 || p.Limit != 4 || p.Utilization != 0.75 {
+		t.Errorf("published %d of %d used at %v, want 3 of 4 at 0.75", p.Used, p.Limit, p.Utilization)
+	}
+
+	// another limiter cannot take the name over
+	logger := &testLogger{}
+	other, mr2 := newTestLimiter(t, concurrency.WithExpvar(name), concurrency.WithLogger(logger))
+	defer mr2.Close()
+	if _, err := other.AddJob("other", 1, "job", 0); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(expvar.Get(name).String(), `"other"`) {
+		t.Error("the second limiter replaced the published stats")
+	}
+	if lines := strings.Join(logger.Lines(), "\n"); !strings.Contains(lines, "already published") {
+		t.Errorf("logged %q, want the taken name", lines)
+	}
+}
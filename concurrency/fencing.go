@@ -0,0 +1,160 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrStaleToken defines the error when a job holds its slot under another fencing token
+var ErrStaleToken = errors.New("stale fencing token")
+
+// luaFence defines the lua function stamping a slot value with the next fencing token of its jobType
+// key is the token counter of the jobType, it returns the value and the token and requires luaSlotFields
+var luaFence = `
+local function fence(value, key)
+	local token = redis.call('INCR', key)
+	local fields = splitslot(value)
+	fields[` + strconv.Itoa(slotFieldToken+1) + `] = tostring(token)
+	return joinslot(fields, #fields), token
+end
+`
+
+// setFencedScript writes a slot stamped with the next fencing token and returns the token
+// KEYS[1] is the slot key, KEYS[2] the token counter, ARGV[1] the value and ARGV[2] the ttl in milliseconds
+var setFencedScript = newScript(luaJobID + luaSlotFields + luaFence + `
+local value, token = fence(ARGV[1], KEYS[2])
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('SET', KEYS[1], value, 'PX', ttl)
+else
+	redis.call('SET', KEYS[1], value)
+end
+return token
+`)
+
+// fenceKey returns the key of the counter issuing the fencing tokens of jobType
+// it never expires, so the tokens of a jobType keep increasing across all of its slots
+func fenceKey(jobType string) string {
+	return fmt.Sprintf("%s-fence", jobType)
+}
+
+// toSlotTokens converts a script reply of slot key, token pairs
+func toSlotTokens(items []interface{}) ([]string, []int64, error) {
+	if len(items)%2 != 0 {
+		return nil, nil, fmt.Errorf("unexpected script reply %v", items)
+	}
+	keys := make([]string, 0, len(items)/2)
+	tokens := make([]int64, 0, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		key, ok := items[i].(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected script reply item %v", items[i])
+		}
+		token, err := toInt64(items[i+1])
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		tokens = append(tokens, token)
+	}
+
+	return keys, tokens, nil
+}
+
+// AddJobWithToken adds a job like AddJob and also returns the fencing token its slot was taken with
+// every acquisition of a jobType gets a larger token than the ones before, so a resource guarded
+// by the pool can reject the writes of a holder which lost its slot by comparing tokens
+func (rl *RateLimiter) AddJobWithToken(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) (string, int64, error) {
+	_, id, token, err := rl.acquire(ctx, jobType, limit, jobID, ttl)
+
+	return id, token, err
+}
+
+// extendTokenScript works like extendScript but only renews the slots whose fencing token matches
+// it returns the number of slots held by the job under another token followed by the renewed keys
+// KEYS are the slot keys, ARGV[1] the jobID, ARGV[2] the ttl in milliseconds, ARGV[3] the renewal time,
+// ARGV[4] the position of the renewal field, ARGV[5] the token and ARGV[6] the position of the token field
+var extendTokenScript = newScript(luaJobID + luaSlotFields + `
+local result = {0}
+local ttl = tonumber(ARGV[2])
+local field = tonumber(ARGV[4])
+local tokenField = tonumber(ARGV[6])
+for _, key in ipairs(KEYS) do
+	local v = redis.call('GET', key)
+	if jobid(v) == ARGV[1] then
+		local fields = splitslot(v)
+		if (tonumber(fields[tokenField]) or 0) ~= tonumber(ARGV[5]) then
+			result[1] = result[1] + 1
+		else
+			fields[field] = ARGV[3]
+			local value = joinslot(fields, field)
+			if ttl > 0 then
+				redis.call('SET', key, value, 'PX', ttl)
+			else
+				redis.call('SET', key, value)
+			end
+			table.insert(result, key)
+		end
+	end
+end
+return result
+`)
+
+// ExtendJobWithToken resets the ttl of the slot held by jobID like ExtendJob,
+// but only if the slot still carries the given fencing token, see AddJobWithToken and JobInfo.Token
+// a heartbeat of a holder which lost the slot and whose jobID took it again under a new token
+// then fails with ErrStaleToken instead of extending the new holder
+// it returns ErrJobNotFound if the job does not hold a slot anymore
+func (rl *RateLimiter) ExtendJobWithToken(ctx context.Context, jobType string, limit int, jobID string, token int64, ttl time.Duration) (err error) {
+	if rl.dryRun {
+		jobType = dryRunJobType(jobType)
+	}
+	start := time.Now()
+	defer func() {
+		rl.observeOperation(ctx, "extend_job_with_token", jobType, start, err)
+	}()
+
+	if err := rl.validateJobID(jobID); err != nil {
+		return err
+	}
+	ttl, err = rl.jobTTL(ttl)
+	if err != nil {
+		return err
+	}
+
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return err
+	}
+	reply, err := extendTokenScript.Run(ctx, rl.redisConnector, slotKeys,
+		jobID, ttlMilli(ttl), unixMilli(rl.now()), slotFieldLastRenewedAt+1, token, slotFieldToken+1)
+	if err != nil {
+		return err
+	}
+	items, ok := reply.([]interface{})
+	if !ok || len(items) == 0 {
+		return fmt.Errorf("unexpected script reply %v", reply)
+	}
+	stale, err := toInt64(items[0])
+	if err != nil {
+		return err
+	}
+	extended, err := toStrings(items[1:])
+	if err != nil {
+		return err
+	}
+	if len(extended) == 0 {
+		if stale > 0 {
+			return ErrStaleToken
+		}
+		return ErrJobNotFound
+	}
+	for _, k := range extended {
+		rl.audit(ctx, auditExtend, jobType, k, jobID, token)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestExtendJobWithToken(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	_, first, err := rl.AddJobWithToken(ctx, "pool", 2, "job", 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.ExtendJobWithToken(ctx, "pool", 2, "job", first, 30*time.Second); err != nil {
+		t.Fatalf("extending with the matching token returned %v", err)
+	}
+	if ttl := mr.TTL("pool-0"); ttl != 30*time.Second {
+		t.Errorf("pool-0 has ttl %v, want 30s", ttl)
+	}
+
+	// the job loses its slot and takes it again under a new token
+	if _, err := rl.DeleteJob("pool", 2, "job"); err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := rl.AddJobWithToken(ctx, "pool", 2, "job", 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second <= first {
+		t.Fatalf("the second acquisition got token %d, want more than %d", second, first)
+	}
+	if err := rl.ExtendJobWithToken(ctx, "pool", 2, "job", first, 30*time.Second); !errors.Is(err, concurrency.ErrStaleToken) {
+		t.Errorf("extending with the stale token returned %v, want ErrStaleToken", err)
+	}
+	if ttl := mr.TTL("pool-0"); ttl != 10*time.Second {
+		t.Errorf("the stale heartbeat changed the ttl to %v", ttl)
+	}
+
+	if err := rl.ExtendJobWithToken(ctx, "pool", 2, "absent", second, 0); !errors.Is(err, concurrency.ErrJobNotFound) {
+		t.Errorf("extending an absent job returned %v, want ErrJobNotFound", err)
+	}
+}
@@ -0,0 +1,118 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// fillSlotsScript writes as many values as fit into free slots, in order, and returns their keys and fencing tokens
+// KEYS[1] is the active set, KEYS[2] the counters hash, KEYS[3] the fencing token counter, KEYS[4..] the slot keys
+// ARGV[1] is the ttl in milliseconds, ARGV[2] 1 to track the slots in the active set,
+// ARGV[3] 1 to update the counters, ARGV[4..] the slot values
+var fillSlotsScript = newScript(luaJobID + luaSlotFields + luaFence + `
+local ttl = tonumber(ARGV[1])
+local placed = {}
+local arg = 4
+for i = 4, #KEYS do
+	if arg > #ARGV then
+		break
+	end
+	local v = redis.call('GET', KEYS[i])
+	if not v or v == '' then
+		local value, token = fence(ARGV[arg], KEYS[3])
+		if ttl > 0 then
+			redis.call('SET', KEYS[i], value, 'PX', ttl)
+		else
+			redis.call('SET', KEYS[i], value)
+		end
+		if ARGV[2] == '1' then
+			redis.call('SADD', KEYS[1], KEYS[i])
+		end
+		table.insert(placed, KEYS[i])
+		table.insert(placed, token)
+		arg = arg + 1
+	end
+end
+if ARGV[3] == '1' then
+	if #placed > 0 then
+		redis.call('HINCRBY', KEYS[2], 'grants', #placed / 2)
+	end
+	if #ARGV - arg + 1 > 0 then
+		redis.call('HINCRBY', KEYS[2], 'rejections', #ARGV - arg + 1)
+	end
+end
+return placed
+`)
+
+// FillSlots places as many of jobIDs as fit into free slots of jobType in a single script
+// and returns the slot key of every placed jobID; unlike AddJobs it does not fail when
+// not all jobIDs fit, the jobIDs are placed in the given order and the rest are left out
+// the jobIDs must not be empty, it is not available with WithTokenList
+func (rl *RateLimiter) FillSlots(ctx context.Context, jobType string, limit int, jobIDs []string, ttl time.Duration) (placed map[string]string, err error) {
+	start := time.Now()
+	defer func() {
+		rl.observeOperation(ctx, "fill_slots", jobType, start, err)
+		err = rejection(jobType, err)
+	}()
+
+	if err := rl.rejectDryRun("FillSlots"); err != nil {
+		return nil, err
+	}
+
+	if rl.tokenList {
+		return nil, errors.New("FillSlots is not available with WithTokenList")
+	}
+	for _, jobID := range jobIDs {
+		if err := rl.validateJobID(jobID); err != nil {
+			return nil, err
+		}
+	}
+	if limit == 0 {
+		return nil, ErrPoolDisabled
+	}
+	if err := rl.checkAdmission(ctx, jobType); err != nil {
+		return nil, err
+	}
+	if err := rl.checkSlotMetadata(ctx); err != nil {
+		return nil, err
+	}
+	ttl, err = rl.acquireTTL(ctx, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+	keys := append([]string{activeSetKey(jobType), countersKey(jobType), fenceKey(jobType)}, slotKeys...)
+	args := make([]interface{}, 0, len(jobIDs)+3)
+	args = append(args, ttlMilli(ttl), boolArg(rl.activeSet), boolArg(rl.persistentCounters))
+	now := rl.now()
+	for _, jobID := range jobIDs {
+		args = append(args, encodeSlotValue(rl.newSlot(ctx, jobID, now)))
+	}
+
+	reply, err := fillSlotsScript.Run(ctx, rl.redisConnector, keys, args...)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected script reply %v", reply)
+	}
+	granted, tokens, err := toSlotTokens(items)
+	if err != nil {
+		return nil, err
+	}
+
+	placed = make(map[string]string, len(granted))
+	for i, k := range granted {
+		placed[jobIDs[i]] = k
+		rl.acquired(ctx, jobType, k, jobIDs[i], tokens[i])
+	}
+
+	return placed, nil
+}
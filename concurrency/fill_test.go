@@ -0,0 +1,46 @@
+package concurrency_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestFillSlotsPlacesWhatFits(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	for _, jobID := range []string{"x", "y", "z"} {
+		if _, err := rl.AddJob("pool", 5, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rl.DeleteJob("pool", 5, "y"); err != nil {
+		t.Fatal(err)
+	}
+
+	placed, err := rl.FillSlots(ctx, "pool", 5, []string{"a", "b", "c", "d"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "map[a:pool-1 b:pool-3 c:pool-4]"; fmt.Sprint(placed) != want {
+		t.Errorf("FillSlots placed %v, want %s", placed, want)
+	}
+	jobs, err := rl.ListJobs("pool", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "map[pool-0:x pool-1:a pool-2:z pool-3:b pool-4:c]"; fmt.Sprint(jobs) != want {
+		t.Errorf("the pool holds %v, want %s", jobs, want)
+	}
+	if ttl := mr.TTL("pool-1"); ttl != testTTL {
+		t.Errorf("a placed slot has ttl %v, want the default %v", ttl, testTTL)
+	}
+
+	// a full pool places nothing and is not an error
+	placed, err = rl.FillSlots(ctx, "pool", 5, []string{"d"}, 0)
+	if err != nil || len(placed) != 0 {
+		t.Errorf("FillSlots on a full pool returned %v, %v", placed, err)
+	}
+}
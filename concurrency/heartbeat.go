@@ -0,0 +1,226 @@
+package concurrency
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// extendAllScript renews the slots of several jobs in one pass like extendScript
+// it returns the renewed slots as key, jobID, fencing token triples
+// KEYS are the slot keys, ARGV[1] the ttl in milliseconds, ARGV[2] the renewal time,
+// ARGV[3] the position of the renewal field, ARGV[4] the position of the token field and ARGV[5..] the jobIDs
+var extendAllScript = newScript(luaJobID + luaSlotFields + `
+local jobs = {}
+for i = 5, #ARGV do
+	jobs[ARGV[i]] = true
+end
+local extended = {}
+local ttl = tonumber(ARGV[1])
+local field = tonumber(ARGV[3])
+for _, key in ipairs(KEYS) do
+	local v = redis.call('GET', key)
+	local id = jobid(v)
+	if id and jobs[id] then
+		local fields = splitslot(v)
+		fields[field] = ARGV[2]
+		local value = joinslot(fields, field)
+		if ttl > 0 then
+			redis.call('SET', key, value, 'PX', ttl)
+		else
+			redis.call('SET', key, value)
+		end
+		table.insert(extended, key)
+		table.insert(extended, id)
+		table.insert(extended, tostring(tonumber(fields[tonumber(ARGV[4])]) or 0))
+	end
+end
+return extended
+`)
+
+// ExtendAll resets the ttl of the slots held by jobIDs in a single script, like ExtendJob for each of them
+// it returns the jobIDs which do not hold a slot anymore
+func (rl *RateLimiter) ExtendAll(ctx context.Context, jobType string, limit int, jobIDs []string, ttl time.Duration) (missing []string, err error) {
+	if rl.dryRun {
+		jobType = dryRunJobType(jobType)
+	}
+	start := time.Now()
+	defer func() {
+		rl.observeOperation(ctx, "extend_all", jobType, start, err)
+	}()
+
+	if len(jobIDs) == 0 {
+		return nil, nil
+	}
+	for _, jobID := range jobIDs {
+		if err := rl.validateJobID(jobID); err != nil {
+			return nil, err
+		}
+	}
+	ttl, err = rl.jobTTL(ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]interface{}, 0, len(jobIDs)+4)
+	args = append(args, ttlMilli(ttl), unixMilli(rl.now()), slotFieldLastRenewedAt+1, slotFieldToken+1)
+	for _, jobID := range jobIDs {
+		args = append(args, jobID)
+	}
+	reply, err := extendAllScript.Run(ctx, rl.redisConnector, slotKeys, args...)
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := toStrings(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	extended := map[string]bool{}
+	for i := 0; i+2 < len(pairs); i += 3 {
+		extended[pairs[i+1]] = true
+		token, _ := strconv.ParseInt(pairs[i+2], 10, 64)
+		rl.audit(ctx, auditExtend, jobType, pairs[i], pairs[i+1], token)
+	}
+	for _, jobID := range jobIDs {
+		if !extended[jobID] {
+			missing = append(missing, jobID)
+		}
+	}
+
+	return missing, nil
+}
+
+// heartbeatGroup are the leases renewed together by one ExtendAll call
+type heartbeatGroup struct {
+	jobType string
+	limit   int
+	ttl     time.Duration
+}
+
+// HeartbeatManager renews many leases from a single goroutine
+// on every tick the leases are grouped by jobType, limit and ttl and each group
+// is renewed with one ExtendAll call, instead of a goroutine and a call per lease
+// the interval should stay well below the shortest ttl, a third of it like StartLease does
+type HeartbeatManager struct {
+	rl       *RateLimiter
+	interval time.Duration
+
+	mu     sync.Mutex
+	leases map[heartbeatGroup]map[string]*Lease
+}
+
+// NewHeartbeatManager is the constructor of HeartbeatManager
+// the leases are only renewed while Run is running
+func NewHeartbeatManager(rl *RateLimiter, interval time.Duration) *HeartbeatManager {
+	return &HeartbeatManager{
+		rl:       rl,
+		interval: interval,
+		leases:   map[heartbeatGroup]map[string]*Lease{},
+	}
+}
+
+// StartLease registers the slot held by jobID for renewal, like RateLimiter.StartLease
+// Release unregisters the lease and frees the slot, Lost is closed if a renewal finds the slot gone
+func (m *HeartbeatManager) StartLease(jobType string, limit int, jobID string, ttl time.Duration) *Lease {
+	l := &Lease{
+		rl:      m.rl,
+		jobType: jobType,
+		limit:   limit,
+		jobID:   jobID,
+		ttl:     m.rl.leaseTTL(ttl),
+		lost:    make(chan struct{}),
+		hb:      m,
+	}
+
+	group := heartbeatGroup{jobType: jobType, limit: limit, ttl: l.ttl}
+	m.mu.Lock()
+	if m.leases[group] == nil {
+		m.leases[group] = map[string]*Lease{}
+	}
+	m.leases[group][jobID] = l
+	m.mu.Unlock()
+
+	return l
+}
+
+// unregister removes l, it returns false if l was not registered anymore, e.g. it was lost
+func (m *HeartbeatManager) unregister(l *Lease) bool {
+	group := heartbeatGroup{jobType: l.jobType, limit: l.limit, ttl: l.ttl}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.leases[group][l.jobID] != l {
+		return false
+	}
+	delete(m.leases[group], l.jobID)
+	if len(m.leases[group]) == 0 {
+		delete(m.leases, group)
+	}
+
+	return true
+}
+
+// Run renews the registered leases every interval until ctx is done
+func (m *HeartbeatManager) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		m.renew(ctx)
+	}
+}
+
+// renew extends every group once, leases whose slot is gone are unregistered and marked lost
+// other errors are retried on the next tick while the slots have ttl left
+func (m *HeartbeatManager) renew(ctx context.Context) {
+	m.mu.Lock()
+	groups := make(map[heartbeatGroup][]string, len(m.leases))
+	for group, leases := range m.leases {
+		if group.ttl <= 0 {
+			// the slots never expire, there is nothing to renew
+			continue
+		}
+		for jobID := range leases {
+			groups[group] = append(groups[group], jobID)
+		}
+	}
+	m.mu.Unlock()
+
+	for group, jobIDs := range groups {
+		// a renewal may take half an interval, a hung call is then retried on the next tick
+		renewCtx, cancel := context.WithTimeout(ctx, m.interval/2)
+		missing, err := m.rl.ExtendAll(renewCtx, group.jobType, group.limit, jobIDs, group.ttl)
+		cancel()
+		if err != nil {
+			continue
+		}
+		for _, jobID := range missing {
+			m.lose(group, jobID)
+		}
+	}
+}
+
+// lose unregisters the lease of jobID and notifies it
+func (m *HeartbeatManager) lose(group heartbeatGroup, jobID string) {
+	m.mu.Lock()
+	l := m.leases[group][jobID]
+	m.mu.Unlock()
+	if l == nil || !m.unregister(l) {
+		return
+	}
+
+	l.mu.Lock()
+	l.err = ErrLeaseLost
+	l.mu.Unlock()
+	close(l.lost)
+}
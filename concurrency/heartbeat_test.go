@@ -0,0 +1,78 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+	"github.com/y4h2/golang-concurrency-limit/concurrency/concurrencytest"
+)
+
+func TestHeartbeatManagerBatchesRenewals(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(newTestConnector(mr))
+	rl := concurrency.NewRateLimiter(conn, testTTL)
+	m := concurrency.NewHeartbeatManager(rl, 100*time.Millisecond)
+
+	// 50 leases in two pools
+	leases := map[string]*concurrency.Lease{}
+	for _, jobType := range []string{"a", "b"} {
+		for i := 0; i < 25; i++ {
+			jobID := fmt.Sprintf("%s-%d", jobType, i)
+			if _, err := rl.AddJob(jobType, 30, jobID, 10*time.Second); err != nil {
+				t.Fatal(err)
+			}
+			leases[jobID] = m.StartLease(jobType, 30, jobID, time.Minute)
+		}
+	}
+	if err := leases["a-1"].Release(); err != nil {
+		t.Fatal(err)
+	}
+	mr.Del("b-2")
+
+	before := len(conn.Trace())
+	ctx, cancel := context.WithTimeout(context.Background(), 350*time.Millisecond)
+	defer cancel()
+	if err := m.Run(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run returned %v", err)
+	}
+
+	// three ticks renew two groups each, a script load included
+	calls := len(conn.Trace()) - before
+	if calls < 2 || calls > 3*2+2 {
+		t.Errorf("renewing 50 leases over three ticks took %d calls, want one per group and tick", calls)
+	}
+	for jobID := range leases {
+		key, err := rl.FindJobSlot(context.Background(), jobID[:1], 30, jobID)
+		if jobID == "a-1" || jobID == "b-2" {
+			if !errors.Is(err, concurrency.ErrJobNotFound) {
+				t.Errorf("%s still holds %q (%v)", jobID, key, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl := mr.TTL(key); ttl != time.Minute {
+			t.Errorf("%s has ttl %v, want it renewed to 1m", jobID, ttl)
+		}
+	}
+
+	select {
+	case <-leases["b-2"].Lost():
+		if err := leases["b-2"].Err(); !errors.Is(err, concurrency.ErrLeaseLost) {
+			t.Errorf("the lost lease reported %v, want ErrLeaseLost", err)
+		}
+	default:
+		t.Error("the lease of the deleted slot was not marked lost")
+	}
+	select {
+	case <-leases["a-2"].Lost():
+		t.Error("a renewed lease was marked lost")
+	default:
+	}
+}
@@ -0,0 +1,99 @@
+package concurrency_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// testTTL is the default ttl of the limiters created by newTestLimiter
+const testTTL = time.Minute
+
+// newTestRedis starts an in-memory redis server, the caller closes it
+func newTestRedis(t testing.TB) *miniredis.Miniredis {
+	t.Helper()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("starting miniredis: %v", err)
+	}
+
+	return mr
+}
+
+// newTestConnector returns a connector to mr
+func newTestConnector(mr *miniredis.Miniredis) *concurrency.Redis {
+	return concurrency.NewRedis(&redis.Options{Addr: mr.Addr()})
+}
+
+// newTestLimiter returns a limiter with the default ttl testTTL backed by a new in-memory redis server
+// the caller closes the server
+func newTestLimiter(t testing.TB, opts ...concurrency.Option) (*concurrency.RateLimiter, *miniredis.Miniredis) {
+	t.Helper()
+	mr := newTestRedis(t)
+
+	return concurrency.NewRateLimiter(newTestConnector(mr), testTTL, opts...), mr
+}
+
+// fakeClock is a clock for WithClock which only moves when advanced
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// testLogger records the lines logged through WithLogger
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *testLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]string(nil), l.lines...)
+}
+
+// occupied returns the number of occupied slots of jobType
+func occupied(t testing.TB, rl *concurrency.RateLimiter, jobType string, limit int) int {
+	t.Helper()
+	jobs, err := rl.ListJobs(jobType, limit)
+	if err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+	n := 0
+	for _, jobID := range jobs {
+		if jobID != "" {
+			n++
+		}
+	}
+
+	return n
+}
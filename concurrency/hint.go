@@ -0,0 +1,122 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// acquireHintScript writes the value into the hinted slot if it is free, otherwise into the free slot with the lowest index
+// KEYS[1] is the active set, KEYS[2] the counters hash, KEYS[3] the fencing token counter, KEYS[4..] the slot keys
+// ARGV[1] is the value, ARGV[2] the ttl in milliseconds, ARGV[3] the position of the hinted slot in KEYS,
+// ARGV[4] 1 to track the slot in the active set, ARGV[5] 1 to update the counters
+// it returns the slot key and the fencing token, or false if every slot is taken
+var acquireHintScript = newScript(luaJobID + luaSlotFields + luaFence + `
+local function free(key)
+	local v = redis.call('GET', key)
+	return not v or v == ''
+end
+local key
+local hint = tonumber(ARGV[3])
+if free(KEYS[hint]) then
+	key = KEYS[hint]
+else
+	for i = 4, #KEYS do
+		if free(KEYS[i]) then
+			key = KEYS[i]
+			break
+		end
+	end
+end
+if not key then
+	if ARGV[5] == '1' then
+		redis.call('HINCRBY', KEYS[2], 'rejections', 1)
+	end
+	return false
+end
+local value, token = fence(ARGV[1], KEYS[3])
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('SET', key, value, 'PX', ttl)
+else
+	redis.call('SET', key, value)
+end
+if ARGV[4] == '1' then
+	redis.call('SADD', KEYS[1], key)
+end
+if ARGV[5] == '1' then
+	redis.call('HINCRBY', KEYS[2], 'grants', 1)
+end
+return {key, token}
+`)
+
+// AddJobHint takes the slot at hintIndex for jobID if it is free, otherwise the free slot with the lowest index,
+// in a single script, and returns the key of the slot it took, e.g. for a scheduler doing its own placement
+// it returns ErrNoSlot if every slot is taken; jobID is required since it is needed to release the slot
+// it is not available with WithTokenList
+func (rl *RateLimiter) AddJobHint(ctx context.Context, jobType string, limit int, jobID string, hintIndex int, ttl time.Duration) (slotKey string, err error) {
+	start := time.Now()
+	defer func() {
+		rl.readCache.invalidate(jobType)
+		rl.observeOperation(ctx, "add_job_hint", jobType, start, err)
+		err = rejection(jobType, err)
+	}()
+
+	if err := rl.rejectDryRun("AddJobHint"); err != nil {
+		return "", err
+	}
+
+	if rl.tokenList {
+		return "", errors.New("AddJobHint is not available with WithTokenList")
+	}
+	if err := rl.validateJobID(jobID); err != nil {
+		return "", err
+	}
+	if limit == 0 {
+		return "", ErrPoolDisabled
+	}
+	if hintIndex < 0 || hintIndex >= limit {
+		return "", fmt.Errorf("slot index %d out of range for limit %d", hintIndex, limit)
+	}
+	if !rl.attemptLimiter.allow(jobType) {
+		return "", ErrAttemptRateExceeded
+	}
+	if err := rl.checkAdmission(ctx, jobType); err != nil {
+		return "", err
+	}
+	if err := rl.checkSlotMetadata(ctx); err != nil {
+		return "", err
+	}
+	ttl, err = rl.acquireTTL(ctx, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return "", err
+	}
+	keys := append([]string{activeSetKey(jobType), countersKey(jobType), fenceKey(jobType)}, slotKeys...)
+	value := encodeSlotValue(rl.newSlot(ctx, jobID, rl.now()))
+	reply, err := acquireHintScript.Run(ctx, rl.redisConnector, keys,
+		value, ttlMilli(ttl), hintIndex+4, boolArg(rl.activeSet), boolArg(rl.persistentCounters))
+	if err != nil {
+		return "", err
+	}
+	// a nil reply means every slot is taken
+	items, ok := reply.([]interface{})
+	if !ok {
+		return "", ErrNoSlot
+	}
+	granted, tokens, err := toSlotTokens(items)
+	if err != nil {
+		return "", err
+	}
+	if len(granted) != 1 {
+		return "", fmt.Errorf("unexpected script reply %v", reply)
+	}
+	rl.acquired(ctx, jobType, granted[0], jobID, tokens[0])
+
+	return granted[0], nil
+}
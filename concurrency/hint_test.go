@@ -0,0 +1,55 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestAddJobHint(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	slotKey, err := rl.AddJobHint(ctx, "pool", 4, "a", 2, 0)
+	if err != nil || slotKey != "pool-2" {
+		t.Fatalf("AddJobHint with a free hint returned %q, %v, want pool-2", slotKey, err)
+	}
+	if ttl := mr.TTL("pool-2"); ttl != testTTL {
+		t.Errorf("the hinted slot has ttl %v, want %v", ttl, testTTL)
+	}
+
+	// the hint is taken, the lowest free slot is used instead
+	slotKey, err = rl.AddJobHint(ctx, "pool", 4, "b", 2, 0)
+	if err != nil || slotKey != "pool-0" {
+		t.Errorf("AddJobHint with a taken hint returned %q, %v, want pool-0", slotKey, err)
+	}
+	slotKey, err = rl.AddJobHint(ctx, "pool", 4, "c", 3, 0)
+	if err != nil || slotKey != "pool-3" {
+		t.Errorf("AddJobHint with a free hint returned %q, %v, want pool-3", slotKey, err)
+	}
+	if _, err := rl.AddJobHint(ctx, "pool", 4, "d", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.AddJobHint(ctx, "pool", 4, "e", 1, 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("AddJobHint into a full pool returned %v, want ErrNoSlot", err)
+	}
+
+	jobs, err := rl.ListJobs("pool", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for slotKey, jobID := range map[string]string{"pool-0": "b", "pool-1": "d", "pool-2": "a", "pool-3": "c"} {
+		if jobs[slotKey] != jobID {
+			t.Errorf("%s holds %q, want %s", slotKey, jobs[slotKey], jobID)
+		}
+	}
+
+	for _, index := range []int{-1, 4} {
+		if _, err := rl.AddJobHint(ctx, "pool", 4, "f", index, 0); err == nil || errors.Is(err, concurrency.ErrNoSlot) {
+			t.Errorf("AddJobHint with hint %d of 4 returned %v, want a range error", index, err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// acquireOrListScript writes the value into the first free slot and returns {key, fencing token}
+// if every slot is taken it returns {false, key, value, ...} with all holders instead
+// KEYS[1] is the active set, KEYS[2] the counters hash, KEYS[3] the fencing token counter, KEYS[4..] the slot keys
+// ARGV[1] is the value, ARGV[2] the ttl in milliseconds,
+// ARGV[3] 1 to track the slot in the active set, ARGV[4] 1 to update the counters
+var acquireOrListScript = newScript(luaJobID + luaSlotFields + luaFence + `
+local holders = {false}
+for i = 4, #KEYS do
+	local v = redis.call('GET', KEYS[i])
+	if not v or v == '' then
+		local value, token = fence(ARGV[1], KEYS[3])
+		local ttl = tonumber(ARGV[2])
+		if ttl > 0 then
+			redis.call('SET', KEYS[i], value, 'PX', ttl)
+		else
+			redis.call('SET', KEYS[i], value)
+		end
+		if ARGV[3] == '1' then
+			redis.call('SADD', KEYS[1], KEYS[i])
+		end
+		if ARGV[4] == '1' then
+			redis.call('HINCRBY', KEYS[2], 'grants', 1)
+		end
+		return {KEYS[i], token}
+	end
+	table.insert(holders, KEYS[i])
+	table.insert(holders, v)
+end
+if ARGV[4] == '1' then
+	redis.call('HINCRBY', KEYS[2], 'rejections', 1)
+end
+return holders
+`)
+
+// AcquireOrListHolders takes the free slot with the lowest index for jobID in a single script
+// and returns its key, if all slots are taken it returns ErrNoSlot together with the jobID of every slot,
+// saving the ListJobs call a caller would otherwise make after a rejection
+// a jobID is generated if the given one is empty, it is not available with WithTokenList
+func (rl *RateLimiter) AcquireOrListHolders(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) (slotKey string, holders map[string]string, err error) {
+	start := time.Now()
+	defer func() {
+		rl.observeOperation(ctx, "acquire_or_list_holders", jobType, start, err)
+		err = rejection(jobType, err)
+	}()
+
+	if err := rl.rejectDryRun("AcquireOrListHolders"); err != nil {
+		return "", nil, err
+	}
+
+	if rl.tokenList {
+		return "", nil, errors.New("AcquireOrListHolders is not available with WithTokenList")
+	}
+	if jobID == "" {
+		if jobID, err = newJobID(); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := rl.validateJobID(jobID); err != nil {
+		return "", nil, err
+	}
+	if limit == 0 {
+		return "", nil, ErrPoolDisabled
+	}
+	if !rl.attemptLimiter.allow(jobType) {
+		return "", nil, ErrAttemptRateExceeded
+	}
+	if err := rl.checkAdmission(ctx, jobType); err != nil {
+		return "", nil, err
+	}
+	if err := rl.checkSlotMetadata(ctx); err != nil {
+		return "", nil, err
+	}
+	ttl, err = rl.acquireTTL(ctx, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return "", nil, err
+	}
+	keys := append([]string{activeSetKey(jobType), countersKey(jobType), fenceKey(jobType)}, slotKeys...)
+	value := encodeSlotValue(rl.newSlot(ctx, jobID, rl.now()))
+	reply, err := acquireOrListScript.Run(ctx, rl.redisConnector, keys,
+		value, ttlMilli(ttl), boolArg(rl.activeSet), boolArg(rl.persistentCounters))
+	if err != nil {
+		return "", nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok || len(items) == 0 {
+		return "", nil, fmt.Errorf("unexpected script reply %v", reply)
+	}
+
+	if _, ok := items[0].(string); ok {
+		granted, tokens, err := toSlotTokens(items)
+		if err != nil || len(granted) != 1 {
+			return "", nil, fmt.Errorf("unexpected script reply %v", reply)
+		}
+		rl.acquired(ctx, jobType, granted[0], jobID, tokens[0])
+		return granted[0], nil, nil
+	}
+	pairs, err := toStrings(items[1:])
+	if err != nil {
+		return "", nil, err
+	}
+	holders = make(map[string]string, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		slot, err := rl.decodeSlot(pairs[i], pairs[i+1])
+		if err != nil {
+			return "", nil, err
+		}
+		holders[pairs[i]] = slot.JobID
+	}
+
+	return "", holders, ErrNoSlot
+}
@@ -0,0 +1,42 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+	"github.com/y4h2/golang-concurrency-limit/concurrency/concurrencytest"
+)
+
+func TestAcquireOrListHolders(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(newTestConnector(mr))
+	rl := concurrency.NewRateLimiter(conn, testTTL)
+	ctx := context.Background()
+
+	for i, jobID := range []string{"a", "b"} {
+		slotKey, holders, err := rl.AcquireOrListHolders(ctx, "pool", 2, jobID, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"pool-0", "pool-1"}[i]; slotKey != want || holders != nil {
+			t.Errorf("AcquireOrListHolders for %s returned %q, %v, want %s", jobID, slotKey, holders, want)
+		}
+	}
+
+	before := len(conn.Trace())
+	slotKey, holders, err := rl.AcquireOrListHolders(ctx, "pool", 2, "c", 0)
+	if !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Fatalf("AcquireOrListHolders on a full pool returned %v, want ErrNoSlot", err)
+	}
+	if slotKey != "" || len(holders) != 2 || holders["pool-0"] != "a" || holders["pool-1"] != "b" {
+		t.Errorf("AcquireOrListHolders on a full pool returned %q, %v, want the holders", slotKey, holders)
+	}
+	for _, call := range conn.Trace()[before:] {
+		if call.Method == "MGet" {
+			t.Error("the rejection read the slots a second time")
+		}
+	}
+}
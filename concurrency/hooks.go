@@ -0,0 +1,57 @@
+package concurrency
+
+import (
+	"context"
+	"log"
+)
+
+// Logger receives the warnings of the limiter, *log.Logger satisfies it
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// stdLogger logs through the standard log package
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, v ...interface{}) {
+	log.Printf(format, v...)
+}
+
+// logf logs through the configured logger, the standard log package by default
+func (rl *RateLimiter) logf(format string, v ...interface{}) {
+	if rl.logger == nil {
+		stdLogger{}.Printf(format, v...)
+		return
+	}
+	rl.logger.Printf(format, v...)
+}
+
+// acquired records that jobID took slotKey
+func (rl *RateLimiter) acquired(ctx context.Context, jobType, slotKey, jobID string, token int64) {
+	rl.audit(ctx, auditAcquire, jobType, slotKey, jobID, token)
+	rl.owned.add(ctx, slotKey, jobID)
+	rl.readCache.invalidate(jobType)
+	rl.runHook("acquire", rl.acquireHook, ctx, jobType, jobID, slotKey)
+}
+
+// released records that jobID freed slotKey
+func (rl *RateLimiter) released(ctx context.Context, jobType, slotKey, jobID string) {
+	rl.audit(ctx, auditRelease, jobType, slotKey, jobID, 0)
+	rl.owned.remove(ctx, slotKey, jobID)
+	rl.readCache.invalidate(jobType)
+	rl.runHook("release", rl.releaseHook, ctx, jobType, jobID, slotKey)
+}
+
+// runHook calls a user hook, a panic in the hook is logged instead of reaching the caller
+func (rl *RateLimiter) runHook(name string, hook func(ctx context.Context, jobType, jobID, slotKey string), ctx context.Context, jobType, jobID, slotKey string) {
+	if hook == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			rl.logf("concurrency: %s hook panicked for job %s in slot %s: %v", name, jobID, slotKey, r)
+		}
+	}()
+
+	hook(ctx, jobType, jobID, slotKey)
+}
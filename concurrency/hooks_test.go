@@ -0,0 +1,68 @@
+package concurrency_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+type hookCall struct {
+	jobType, jobID, slotKey string
+}
+
+func TestAcquireAndReleaseHooks(t *testing.T) {
+	var acquired, released []hookCall
+	rl, mr := newTestLimiter(t,
+		concurrency.WithAcquireHook(func(ctx context.Context, jobType, jobID, slotKey string) {
+			acquired = append(acquired, hookCall{jobType, jobID, slotKey})
+		}),
+		concurrency.WithReleaseHook(func(ctx context.Context, jobType, jobID, slotKey string) {
+			released = append(released, hookCall{jobType, jobID, slotKey})
+		}))
+	defer mr.Close()
+
+	for _, jobID := range []string{"a", "b"} {
+		if _, err := rl.AddJob("pool", 2, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a rejection and a release of a job without slot fire no hook
+	rl.AddJob("pool", 2, "c", 0)
+	if _, err := rl.DeleteJob("pool", 2, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.DeleteJob("pool", 2, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []hookCall{{"pool", "a", "pool-0"}, {"pool", "b", "pool-1"}}
+	if len(acquired) != 2 || acquired[0] != want[0] || acquired[1] != want[1] {
+		t.Errorf("the acquire hook got %v, want %v", acquired, want)
+	}
+	if len(released) != 1 || released[0] != want[1] {
+		t.Errorf("the release hook got %v, want %v", released, want[1:])
+	}
+}
+
+func TestHookPanicIsLogged(t *testing.T) {
+	logger := &testLogger{}
+	rl, mr := newTestLimiter(t,
+		concurrency.WithLogger(logger),
+		concurrency.WithAcquireHook(func(ctx context.Context, jobType, jobID, slotKey string) {
+			panic("gauge not registered")
+		}))
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 2, "a", 0); err != nil {
+		t.Fatalf("AddJob with a panicking hook returned %v", err)
+	}
+	if n := occupied(t, rl, "pool", 2); n != 1 {
+		t.Errorf("%d slots occupied, want the slot kept", n)
+	}
+	lines := logger.Lines()
+	if len(lines) != 1 || !strings.Contains(lines[0], "gauge not registered") {
+		t.Errorf("logged %q, want the panic", lines)
+	}
+}
@@ -0,0 +1,99 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+	"github.com/y4h2/golang-concurrency-limit/concurrency/concurrencytest"
+)
+
+// TestInvariantUnderRandomOperations runs random concurrent acquisitions, releases and renewals
+// in every acquisition mode and checks the pool invariant after every round
+func TestInvariantUnderRandomOperations(t *testing.T) {
+	modes := map[string][]concurrency.Option{
+		"default":    nil,
+		"active set": {concurrency.WithActiveSet()},
+		"job index":  {concurrency.WithJobIndex()},
+		"token list": {concurrency.WithTokenList()},
+		"lru free":   {concurrency.WithAcquirePolicy(concurrency.LRUFree)},
+		"random":     {concurrency.WithRandomProbe()},
+	}
+	const (
+		limit   = 4
+		workers = 6
+		rounds  = 10
+		steps   = 8
+	)
+
+	for name, opts := range modes {
+		t.Run(name, func(t *testing.T) {
+			rl, mr := newTestLimiter(t, opts...)
+			defer mr.Close()
+			ctx := context.Background()
+
+			for round := 0; round < rounds; round++ {
+				done := make(chan struct{})
+				checked := make(chan struct{})
+				go func() {
+					defer close(checked)
+					for {
+						concurrencytest.AssertInvariant(t, rl, "pool", limit)
+						select {
+						case <-done:
+							return
+						default:
+						}
+					}
+				}()
+
+				var wg sync.WaitGroup
+				for w := 0; w < workers; w++ {
+					wg.Add(1)
+					go func(w int) {
+						defer wg.Done()
+						random := rand.New(rand.NewSource(int64(round*workers + w)))
+						var held []string
+						for step := 0; step < steps; step++ {
+							switch op := random.Intn(4); {
+							case op < 2 || len(held) == 0:
+								jobID := fmt.Sprintf("job-%d-%d-%d", round, w, step)
+								if _, err := rl.AddJob("pool", limit, jobID, 0); err == nil {
+									held = append(held, jobID)
+								} else if !errors.Is(err, concurrency.ErrNoSlot) {
+									t.Errorf("AddJob: %v", err)
+								}
+							case op == 2:
+								i := random.Intn(len(held))
+								if _, err := rl.DeleteJob("pool", limit, held[i]); err != nil {
+									t.Errorf("DeleteJob: %v", err)
+								}
+								held = append(held[:i], held[i+1:]...)
+							default:
+								if err := rl.ExtendJob(ctx, "pool", limit, held[random.Intn(len(held))], 0); err != nil {
+									t.Errorf("ExtendJob: %v", err)
+								}
+							}
+						}
+						for _, jobID := range held {
+							if _, err := rl.DeleteJob("pool", limit, jobID); err != nil {
+								t.Errorf("DeleteJob: %v", err)
+							}
+						}
+					}(w)
+				}
+				wg.Wait()
+				close(done)
+				<-checked
+				concurrencytest.AssertInvariant(t, rl, "pool", limit)
+				if n := occupied(t, rl, "pool", limit); n != 0 {
+					t.Errorf("round %d left %d occupied slots after every job was deleted", round, n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidJobID defines the error when a jobID is rejected by the validator
+var ErrInvalidJobID = errors.New("invalid job id")
+
+// ErrIDGeneration defines the error when no random jobID could be generated, e.g. without entropy
+var ErrIDGeneration = errors.New("job id generation failed")
+
+// ErrJobIDTooLong defines the error when a jobID exceeds the max length
+var ErrJobIDTooLong = errors.New("job id too long")
+
+// DefaultMaxJobIDLength is the max jobID length in bytes unless WithMaxJobIDLength says otherwise
+// it leaves plenty of room for uuids and composite ids while bounding the size of a slot value
+const DefaultMaxJobIDLength = 256
+
+// ErrMetadataTooLarge defines the error when a metadata field exceeds the max metadata size
+// the returned error is a *MetadataTooLargeError naming the field
+var ErrMetadataTooLarge = errors.New("metadata too large")
+
+// DefaultMaxMetadataSize is the max size in bytes of the owner, the trace id and every pool label
+// unless WithMaxMetadataSize says otherwise
+const DefaultMaxMetadataSize = 256
+
+// MetadataTooLargeError defines the error when a metadata field is larger than the max metadata size
+// it matches ErrMetadataTooLarge with errors.Is
+type MetadataTooLargeError struct {
+	Field string
+	Size  int
+	Max   int
+}
+
+func (e *MetadataTooLargeError) Error() string {
+	return fmt.Sprintf("%v: %s has %d bytes, max %d", ErrMetadataTooLarge, e.Field, e.Size, e.Max)
+}
+
+// Unwrap returns ErrMetadataTooLarge
+func (e *MetadataTooLargeError) Unwrap() error {
+	return ErrMetadataTooLarge
+}
+
+// checkMetadataSize returns a *MetadataTooLargeError if value of field exceeds the max metadata size
+func (rl *RateLimiter) checkMetadataSize(field, value string) error {
+	maxSize := rl.maxMetadataSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxMetadataSize
+	}
+	if maxSize > 0 && len(value) > maxSize {
+		return &MetadataTooLargeError{Field: field, Size: len(value), Max: maxSize}
+	}
+
+	return nil
+}
+
+// checkSlotMetadata checks the owner and the trace id an acquisition under ctx would store in its slot
+func (rl *RateLimiter) checkSlotMetadata(ctx context.Context) error {
+	if err := rl.checkMetadataSize("owner", rl.ownerIdentity); err != nil {
+		return err
+	}
+	if rl.traceID == nil {
+		return nil
+	}
+
+	return rl.checkMetadataSize("trace id", rl.traceID(ctx))
+}
+
+// defaultJobIDValidator rejects empty jobIDs and control characters
+var defaultJobIDValidator = JobIDValidator("")
+
+// JobIDValidator returns a validator which rejects empty jobIDs,
+// control characters and every character contained in disallowed
+func JobIDValidator(disallowed string) func(string) error {
+	return func(jobID string) error {
+		if jobID == "" {
+			return errors.New("empty job id")
+		}
+		for _, r := range jobID {
+			if unicode.IsControl(r) {
+				return fmt.Errorf("control character %q in job id", r)
+			}
+			if strings.ContainsRune(disallowed, r) {
+				return fmt.Errorf("character %q is not allowed in job id", r)
+			}
+		}
+
+		return nil
+	}
+}
+
+// validateJobID runs the configured validator, the returned error wraps ErrInvalidJobID
+// a jobID longer than the max length fails with ErrJobIDTooLong
+// an empty jobID is always rejected since it would be indistinguishable from a free slot
+func (rl *RateLimiter) validateJobID(jobID string) error {
+	if jobID == "" {
+		return fmt.Errorf("%w: empty job id", ErrInvalidJobID)
+	}
+	maxLength := rl.maxJobIDLength
+	if maxLength == 0 {
+		maxLength = DefaultMaxJobIDLength
+	}
+	if maxLength > 0 && len(jobID) > maxLength {
+		return fmt.Errorf("%w: %d bytes, max %d", ErrJobIDTooLong, len(jobID), maxLength)
+	}
+
+	validator := rl.jobIDValidator
+	if validator == nil {
+		validator = defaultJobIDValidator
+	}
+	if err := validator(jobID); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJobID, err)
+	}
+
+	return nil
+}
+
+// SeededJobID returns the UUIDv5 jobID AddJobSeeded derives for jobType and seed
+func (rl *RateLimiter) SeededJobID(jobType, seed string) string {
+	return uuid.NewSHA1(rl.idNamespace, []byte(jobType+slotSeparator+seed)).String()
+}
+
+// AddJobSeeded adds a job like AddJob with a jobID derived from jobType and seed
+// and returns it, so a retried call for the same seed uses the same jobID, see WithDeterministicID
+// like AddJob it does not check whether the jobID already holds a slot
+func (rl *RateLimiter) AddJobSeeded(ctx context.Context, jobType string, limit int, seed string, ttl time.Duration) (string, error) {
+	return rl.addJob(ctx, jobType, limit, rl.SeededJobID(jobType, seed), ttl)
+}
+
+// newRandomUUID generates the random jobIDs, it is a variable so a failing generator can be stubbed
+var newRandomUUID = uuid.NewRandom
+
+// newJobID generates a random jobID, a failure to read entropy is returned as ErrIDGeneration
+// instead of the panic of uuid.NewString
+func newJobID() (string, error) {
+	id, err := newRandomUUID()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrIDGeneration, err)
+	}
+
+	return id.String(), nil
+}
@@ -0,0 +1,209 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestDefaultJobIDValidator(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	for _, jobID := range []string{"a", "job-1", "550e8400-e29b-41d4-a716-446655440000", "tenant/1:job"} {
+		if _, err := rl.AddJob("pool", 8, jobID, 0); err != nil {
+			t.Errorf("AddJob(%q): %v", jobID, err)
+		}
+		if ok, err := rl.DeleteJob("pool", 8, jobID); err != nil || !ok {
+			t.Errorf("DeleteJob(%q) returned %v, %v", jobID, ok, err)
+		}
+	}
+
+	// an empty jobID is replaced by a generated one before validation
+	id, err := rl.AddJob("pool", 8, "", 0)
+	if err != nil || id == "" {
+		t.Fatalf("AddJob without a jobID returned %q, %v", id, err)
+	}
+	if _, err := rl.DeleteJob("pool", 8, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.DeleteJob("pool", 8, ""); !errors.Is(err, concurrency.ErrInvalidJobID) {
+		t.Errorf("DeleteJob of an empty jobID returned %v, want ErrInvalidJobID", err)
+	}
+
+	for _, jobID := range []string{"job\n1", "job\x001", "job\x1e1"} {
+		if _, err := rl.AddJob("pool", 8, jobID, 0); !errors.Is(err, concurrency.ErrInvalidJobID) {
+			t.Errorf("AddJob(%q) returned %v, want ErrInvalidJobID", jobID, err)
+		}
+		if _, err := rl.DeleteJob("pool", 8, jobID); !errors.Is(err, concurrency.ErrInvalidJobID) {
+			t.Errorf("DeleteJob(%q) returned %v, want ErrInvalidJobID", jobID, err)
+		}
+	}
+	if n := occupied(t, rl, "pool", 8); n != 0 {
+		t.Errorf("%d slots occupied after rejected jobIDs", n)
+	}
+}
+
+func TestCustomJobIDValidator(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithJobIDValidator(concurrency.JobIDValidator("/ ")))
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 2, "job-1", 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, jobID := range []string{"tenant/1", "job 1", "job\t1"} {
+		if _, err := rl.AddJob("pool", 2, jobID, 0); !errors.Is(err, concurrency.ErrInvalidJobID) {
+			t.Errorf("AddJob(%q) returned %v, want ErrInvalidJobID", jobID, err)
+		}
+	}
+
+	rejected := errors.New("not a ticket number")
+	rl, mr = newTestLimiter(t, concurrency.WithJobIDValidator(func(jobID string) error {
+		if !strings.HasPrefix(jobID, "T-") {
+			return rejected
+		}
+		return nil
+	}))
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 2, "T-42", 0); err != nil {
+		t.Fatal(err)
+	}
+	_, err := rl.AddJob("pool", 2, "42", 0)
+	if !errors.Is(err, concurrency.ErrInvalidJobID) || !strings.Contains(err.Error(), rejected.Error()) {
+		t.Errorf("AddJob returned %v, want ErrInvalidJobID naming the validator error", err)
+	}
+}
+
+func TestMaxJobIDLength(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithMaxJobIDLength(8))
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 2, strings.Repeat("a", 8), 0); err != nil {
+		t.Errorf("AddJob at the max length: %v", err)
+	}
+	if _, err := rl.AddJob("pool", 2, strings.Repeat("a", 9), 0); !errors.Is(err, concurrency.ErrJobIDTooLong) {
+		t.Errorf("AddJob over the max length returned %v, want ErrJobIDTooLong", err)
+	}
+
+	rl, mr = newTestLimiter(t)
+	defer mr.Close()
+	jobID := strings.Repeat("a", concurrency.DefaultMaxJobIDLength+1)
+	if _, err := rl.AddJob("pool", 2, jobID, 0); !errors.Is(err, concurrency.ErrJobIDTooLong) {
+		t.Errorf("AddJob over the default max length returned %v, want ErrJobIDTooLong", err)
+	}
+	if n := occupied(t, rl, "pool", 2); n != 0 {
+		t.Errorf("%d slots occupied after a rejected jobID", n)
+	}
+}
+
+func TestMaxMetadataSize(t *testing.T) {
+	ctx := context.Background()
+	traceID := strings.Repeat("t", 16)
+	rl, mr := newTestLimiter(t,
+		concurrency.WithMaxMetadataSize(16),
+		concurrency.WithOwnerIdentity("worker-1"),
+		concurrency.WithTraceID(func(ctx context.Context) string { return traceID }))
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 2, "at-limit", 0); err != nil {
+		t.Errorf("AddJob with a trace id at the max size: %v", err)
+	}
+
+	traceID += "t"
+	_, err := rl.AddJob("pool", 2, "over-limit", 0)
+	var tooLarge *concurrency.MetadataTooLargeError
+	if !errors.As(err, &tooLarge) || !errors.Is(err, concurrency.ErrMetadataTooLarge) {
+		t.Fatalf("AddJob with an oversized trace id returned %v, want a *MetadataTooLargeError", err)
+	}
+	if tooLarge.Field != "trace id" || tooLarge.Size != 17 || tooLarge.Max != 16 {
+		t.Errorf("AddJob returned %+v, want the trace id named", tooLarge)
+	}
+	if n := occupied(t, rl, "pool", 2); n != 1 {
+		t.Errorf("%d slots occupied, want only the job at the limit", n)
+	}
+
+	if err := rl.SetPoolLabels(ctx, "pool", map[string]string{"team": strings.Repeat("x", 17)}); !errors.As(err, &tooLarge) {
+		t.Errorf("SetPoolLabels with an oversized value returned %v, want a *MetadataTooLargeError", err)
+	}
+	if labels, err := rl.GetPoolLabels(ctx, "pool"); err != nil || len(labels) != 0 {
+		t.Errorf("GetPoolLabels returned %v, %v, want nothing written", labels, err)
+	}
+
+	rl, mr = newTestLimiter(t, concurrency.WithOwnerIdentity(strings.Repeat("o", concurrency.DefaultMaxMetadataSize+1)))
+	defer mr.Close()
+	if _, err := rl.AddJob("pool", 2, "job", 0); !errors.Is(err, concurrency.ErrMetadataTooLarge) {
+		t.Errorf("AddJob with an owner over the default size returned %v, want ErrMetadataTooLarge", err)
+	}
+}
+
+func TestAddJobSeeded(t *testing.T) {
+	namespace := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	rl, mr := newTestLimiter(t, concurrency.WithDeterministicID(namespace))
+	defer mr.Close()
+	ctx := context.Background()
+
+	first, err := rl.AddJobSeeded(ctx, "pool", 4, "order-1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := uuid.Parse(first)
+	if err != nil || id.Version() != 5 {
+		t.Errorf("AddJobSeeded returned %q, want a UUIDv5", first)
+	}
+	again, err := rl.AddJobSeeded(ctx, "pool", 4, "order-1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != first {
+		t.Errorf("the same seed gave %q and %q", first, again)
+	}
+	other, err := rl.AddJobSeeded(ctx, "pool", 4, "order-2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == first {
+		t.Errorf("different seeds both gave %q", first)
+	}
+
+	// the namespace is part of the derivation
+	rl2, mr2 := newTestLimiter(t, concurrency.WithDeterministicID(uuid.New()))
+	defer mr2.Close()
+	if rl2.SeededJobID("pool", "order-1") == first {
+		t.Error("another namespace derived the same jobID")
+	}
+}
+
+// failingReader is an entropy source which cannot be read
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("no entropy")
+}
+
+func TestAddJobIDGenerationFails(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	uuid.SetRand(failingReader{})
+	defer uuid.SetRand(nil)
+
+	if _, err := rl.AddJob("pool", 2, "", 0); !errors.Is(err, concurrency.ErrIDGeneration) {
+		t.Errorf("AddJob without entropy returned %v, want ErrIDGeneration", err)
+	}
+	if _, _, err := rl.AddJobWithToken(context.Background(), "pool", 2, "", 0); !errors.Is(err, concurrency.ErrIDGeneration) {
+		t.Errorf("AddJobWithToken without entropy returned %v, want ErrIDGeneration", err)
+	}
+	if n := occupied(t, rl, "pool", 2); n != 0 {
+		t.Errorf("%d slots occupied after the failed generations", n)
+	}
+
+	// a given jobID needs no entropy
+	if _, err := rl.AddJob("pool", 2, "job", 0); err != nil {
+		t.Errorf("AddJob with a jobID: %v", err)
+	}
+}
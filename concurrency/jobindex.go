@@ -0,0 +1,235 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// acquireIndexedScript writes the value into the free slot with the lowest index and records its index in the job index
+// KEYS[1] is the job index, KEYS[2] the fencing token counter, KEYS[3..] the slot keys
+// ARGV[1] is the slot value, ARGV[2] the ttl in milliseconds and ARGV[3] the jobID
+// it returns the slot key, the number of slots occupied before and the fencing token, or false if no slot is free
+var acquireIndexedScript = newScript(luaJobID + luaSlotFields + luaFence + `
+local occupied = 0
+local free
+for i = 3, #KEYS do
+	local v = redis.call('GET', KEYS[i])
+	if v and v ~= '' then
+		occupied = occupied + 1
+	elseif not free then
+		free = i
+	end
+end
+if not free then
+	return false
+end
+local value, token = fence(ARGV[1], KEYS[2])
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('SET', KEYS[free], value, 'PX', ttl)
+else
+	redis.call('SET', KEYS[free], value)
+end
+redis.call('HSET', KEYS[1], ARGV[3], free - 3)
+local indexTTL = redis.call('PTTL', KEYS[1])
+if ttl <= 0 then
+	redis.call('PERSIST', KEYS[1])
+elseif indexTTL ~= -1 and indexTTL < ttl then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return {KEYS[free], occupied, token}
+`)
+
+// luaIndexedSlot defines the lua function looking up the slot of a job in the job index
+// the index holds the index of the slot among the slot keys, KEYS[1] is the job index and KEYS[2..] the slot keys
+// an entry whose slot is not among them or no longer holds the job is removed
+const luaIndexedSlot = `
+local function indexedslot(id)
+	local entry = redis.call('HGET', KEYS[1], id)
+	if not entry then
+		return nil
+	end
+	local slot = tonumber(entry)
+	local key = slot and slot >= 0 and KEYS[slot + 2]
+	local v = key and redis.call('GET', key)
+	if not v or jobid(v) ~= id then
+		redis.call('HDEL', KEYS[1], id)
+		return nil
+	end
+	return key, v
+end
+`
+
+// releaseIndexedScript deletes the slot of a job found through the job index
+// KEYS[1] is the job index, KEYS[2..] the slot keys and ARGV[1] the jobID
+// it returns the slot key and the number of slots still occupied, or false if the index has no slot
+var releaseIndexedScript = newScript(luaJobID + luaIndexedSlot + `
+local key = indexedslot(ARGV[1])
+if not key then
+	return false
+end
+redis.call('DEL', key)
+redis.call('HDEL', KEYS[1], ARGV[1])
+local occupied = 0
+for i = 2, #KEYS do
+	local v = redis.call('GET', KEYS[i])
+	if v and v ~= '' then
+		occupied = occupied + 1
+	end
+end
+return {key, occupied}
+`)
+
+// extendIndexedScript renews the slot of a job found through the job index like extendScript
+// KEYS[1] is the job index, KEYS[2..] the slot keys,
+// ARGV[1] the jobID, ARGV[2] the ttl in milliseconds, ARGV[3] the renewal time, ARGV[4] the position of the renewal field and ARGV[5] the position of the token field
+// it returns the slot key and its fencing token, or false if the index has no slot
+var extendIndexedScript = newScript(luaJobID + luaSlotFields + luaIndexedSlot + `
+local key, v = indexedslot(ARGV[1])
+if not key then
+	return false
+end
+local field = tonumber(ARGV[4])
+local fields = splitslot(v)
+fields[field] = ARGV[3]
+local value = joinslot(fields, field)
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('SET', key, value, 'PX', ttl)
+	local indexTTL = redis.call('PTTL', KEYS[1])
+	if indexTTL ~= -1 and indexTTL < ttl then
+		redis.call('PEXPIRE', KEYS[1], ttl)
+	end
+else
+	redis.call('SET', key, value)
+	redis.call('PERSIST', KEYS[1])
+end
+return {key, tonumber(fields[tonumber(ARGV[5])]) or 0}
+`)
+
+// findIndexedScript returns the slot of a job found through the job index, or false
+// KEYS[1] is the job index, KEYS[2..] the slot keys and ARGV[1] the jobID
+var findIndexedScript = newScript(luaJobID + luaIndexedSlot + `
+return indexedslot(ARGV[1]) or false
+`)
+
+// jobIndexKey returns the key of the hash mapping the jobIDs of jobType to the index of their slot
+func jobIndexKey(jobType string) string {
+	return fmt.Sprintf("%s-index", jobType)
+}
+
+// acquireIndexed takes the free slot with the lowest index and records it in the job index
+// it returns the slot key, the fencing token and the number of slots occupied before
+func (rl *RateLimiter) acquireIndexed(ctx context.Context, jobType string, limit int, jobID, value string, ttl time.Duration) (string, int64, int, error) {
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	keys := append([]string{jobIndexKey(jobType), fenceKey(jobType)}, slotKeys...)
+	reply, err := acquireIndexedScript.Run(ctx, rl.redisConnector, keys, value, ttlMilli(ttl), jobID)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	// a nil reply means every slot is taken
+	items, ok := reply.([]interface{})
+	if !ok {
+		return "", 0, 0, ErrNoSlot
+	}
+	if len(items) != 3 {
+		return "", 0, 0, fmt.Errorf("unexpected script reply %v", reply)
+	}
+	slotKey, ok := items[0].(string)
+	if !ok {
+		return "", 0, 0, fmt.Errorf("unexpected script reply %v", reply)
+	}
+	occupied, err := toInt64(items[1])
+	if err != nil {
+		return "", 0, 0, err
+	}
+	token, err := toInt64(items[2])
+
+	return slotKey, token, int(occupied), err
+}
+
+// indexedKeys returns the keys of a job index script for jobType, the job index followed by the slot keys
+func (rl *RateLimiter) indexedKeys(jobType string, limit int) ([]string, error) {
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]string{jobIndexKey(jobType)}, slotKeys...), nil
+}
+
+// releaseIndexed deletes the slot of jobID found through the job index
+// it returns the slot key, empty if the index has none, and the number of slots still occupied
+func (rl *RateLimiter) releaseIndexed(ctx context.Context, jobType string, limit int, jobID string) (string, int, error) {
+	keys, err := rl.indexedKeys(jobType, limit)
+	if err != nil {
+		return "", 0, err
+	}
+	reply, err := releaseIndexedScript.Run(ctx, rl.redisConnector, keys, jobID)
+	if err != nil {
+		return "", 0, err
+	}
+	// a nil reply means the index has no slot of the job
+	items, ok := reply.([]interface{})
+	if !ok {
+		return "", 0, nil
+	}
+	if len(items) != 2 {
+		return "", 0, fmt.Errorf("unexpected script reply %v", reply)
+	}
+	slotKey, ok := items[0].(string)
+	if !ok {
+		return "", 0, fmt.Errorf("unexpected script reply %v", reply)
+	}
+	occupied, err := toInt64(items[1])
+
+	return slotKey, int(occupied), err
+}
+
+// FindJobSlot returns the key of a slot held by jobID, or ErrJobNotFound
+// with WithJobIndex it is a single lookup, otherwise, or if the index has no entry, all slots are read
+// and the slot with the lowest index is returned, a job holding several is logged like in ListJobs
+func (rl *RateLimiter) FindJobSlot(ctx context.Context, jobType string, limit int, jobID string) (string, error) {
+	if err := rl.validateJobID(jobID); err != nil {
+		return "", err
+	}
+	if rl.jobIndex {
+		keys, err := rl.indexedKeys(jobType, limit)
+		if err != nil {
+			return "", err
+		}
+		reply, err := findIndexedScript.Run(ctx, rl.redisConnector, keys, jobID)
+		if err != nil {
+			return "", err
+		}
+		if slotKey, _ := reply.(string); slotKey != "" {
+			return slotKey, nil
+		}
+	}
+
+	slotKeys, slots, err := rl.listSlots(ctx, rl.reader(), jobType, limit)
+	if err != nil {
+		return "", err
+	}
+	held := map[string]string{}
+	slotKey := ""
+	for i, slot := range slots {
+		if slot.JobID != jobID {
+			continue
+		}
+		held[slotKeys[i]] = jobID
+		if slotKey == "" {
+			slotKey = slotKeys[i]
+		}
+	}
+	if slotKey == "" {
+		return "", ErrJobNotFound
+	}
+	rl.warnDuplicates(jobType, held)
+
+	return slotKey, nil
+}
@@ -0,0 +1,160 @@
+package concurrency_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+	"github.com/y4h2/golang-concurrency-limit/concurrency/concurrencytest"
+)
+
+// calledMethods returns the connector methods called in trace
+func calledMethods(trace concurrencytest.Trace) []string {
+	methods := make([]string, 0, len(trace))
+	for _, call := range trace {
+		methods = append(methods, call.Method)
+	}
+
+	return methods
+}
+
+func TestJobIndexLookups(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(newTestConnector(mr))
+	rl := concurrency.NewRateLimiter(conn, testTTL, concurrency.WithJobIndex())
+	ctx := context.Background()
+
+	for _, jobID := range []string{"a", "b", "c"} {
+		if _, err := rl.AddJob("pool", 8, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the index holds the index of the slot among the slot keys
+	if got := mr.HGet("pool-index", "b"); got != "1" {
+		t.Errorf("the index maps b to %q, want slot 1", got)
+	}
+
+	before := len(conn.Trace())
+	slotKey, err := rl.FindJobSlot(ctx, "pool", 8, "c")
+	if err != nil || slotKey != "pool-2" {
+		t.Errorf("FindJobSlot returned %q, %v, want pool-2", slotKey, err)
+	}
+	if err := rl.ExtendJob(ctx, "pool", 8, "b", 0); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := rl.DeleteJob("pool", 8, "a"); err != nil || !deleted {
+		t.Fatalf("DeleteJob returned %v, %v", deleted, err)
+	}
+	for _, method := range calledMethods(conn.Trace()[before:]) {
+		if method == "MGet" || method == "Get" {
+			t.Errorf("the indexed lookups read the slots with %s", method)
+		}
+	}
+	if mr.Exists("pool-0") || mr.HGet("pool-index", "a") != "" {
+		t.Error("DeleteJob left the slot or its index entry behind")
+	}
+
+	if _, err := rl.FindJobSlot(ctx, "pool", 8, "a"); !errors.Is(err, concurrency.ErrJobNotFound) {
+		t.Errorf("FindJobSlot of a released job returned %v", err)
+	}
+
+	// an entry pointing at a slot another job holds is dropped on lookup
+	mr.HSet("pool-index", "ghost", "1")
+	if _, err := rl.FindJobSlot(ctx, "pool", 8, "ghost"); !errors.Is(err, concurrency.ErrJobNotFound) {
+		t.Errorf("FindJobSlot through a stale entry returned %v", err)
+	}
+	if mr.HGet("pool-index", "ghost") != "" {
+		t.Error("the stale entry was kept")
+	}
+
+	// so is an entry beyond the slots of the limit or not naming a slot
+	for _, entry := range []string{"8", "-1", "pool-1"} {
+		mr.HSet("pool-index", "c", entry)
+		if _, err := rl.FindJobSlot(ctx, "pool", 8, "c"); err != nil {
+			t.Errorf("FindJobSlot through the entry %q returned %v", entry, err)
+		}
+		if mr.HGet("pool-index", "c") != "" {
+			t.Errorf("the entry %q was kept", entry)
+		}
+	}
+}
+
+func TestJobIndexConsistentAfterChurn(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithJobIndex())
+	defer mr.Close()
+
+	r := rand.New(rand.NewSource(1))
+	held := map[string]bool{}
+	for i := 0; i < 300; i++ {
+		jobID := fmt.Sprintf("job-%d", r.Intn(12))
+		if held[jobID] {
+			if deleted, err := rl.DeleteJob("pool", 6, jobID); err != nil || !deleted {
+				t.Fatalf("DeleteJob %s returned %v, %v", jobID, deleted, err)
+			}
+			delete(held, jobID)
+			continue
+		}
+		_, err := rl.AddJob("pool", 6, jobID, 0)
+		if errors.Is(err, concurrency.ErrNoSlot) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		held[jobID] = true
+	}
+
+	jobs, err := rl.ListJobs("pool", 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slots := map[string]string{}
+	for slotKey, jobID := range jobs {
+		if jobID != "" {
+			slots[jobID] = slotKey
+		}
+	}
+	index := map[string]string{}
+	if mr.Exists("pool-index") {
+		fields, err := mr.HKeys("pool-index")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, jobID := range fields {
+			index[jobID] = "pool-" + mr.HGet("pool-index", jobID)
+		}
+	}
+	if fmt.Sprint(index) != fmt.Sprint(slots) || len(slots) != len(held) {
+		t.Errorf("after the churn the index is %v, the slots are %v and %d jobs are held", index, slots, len(held))
+	}
+}
+
+func TestJobIndexDeleteObservesUtilization(t *testing.T) {
+	name := fmt.Sprintf("concurrency_test_%d", time.Now().UnixNano())
+	rl, mr := newTestLimiter(t, concurrency.WithJobIndex(), concurrency.WithExpvar(name))
+	defer mr.Close()
+
+	for _, jobID := range []string{"a", "b", "c"} {
+		if _, err := rl.AddJob("pool", 4, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if deleted, err := rl.DeleteJob("pool", 4, "b"); err != nil || !deleted {
+		t.Fatalf("DeleteJob returned %v, %v", deleted, err)
+	}
+
+	var pools map[string]expvarPool
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &pools); err != nil {
+		t.Fatal(err)
+	}
+	if p := pools["pool"]; p.Used != 2 || p.Limit != 4 {
+		t.Errorf("published %d of %d used after DeleteJob, want 2 of 4", p.Used, p.Limit)
+	}
+}
@@ -0,0 +1,228 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TTL sentinels returned by the connector's PTTL, matching redis
+const (
+	TTLNoExpiry time.Duration = -1
+	TTLMissing  time.Duration = -2
+)
+
+// JobInfo describes an occupied slot
+type JobInfo struct {
+	SlotKey string `json:"slot_key"`
+	JobID   string `json:"job_id"`
+	// TTL is the remaining ttl of the slot, TTLNoExpiry if it never expires
+	TTL time.Duration `json:"ttl"`
+	// AcquiredAt is when the job took the slot, it is kept by ExtendJob
+	AcquiredAt time.Time `json:"acquired_at"`
+	// LastRenewedAt is when ExtendJob last renewed the slot, zero if it never did
+	LastRenewedAt time.Time `json:"last_renewed_at"`
+	// Token is the fencing token the slot was taken with, zero for slots written before tokens were issued
+	Token int64 `json:"token,omitempty"`
+	// Owner identifies the process which took the slot, empty unless WithOwnerIdentity is set
+	Owner string `json:"owner,omitempty"`
+	// TraceID is the trace the slot was taken in, empty unless WithTraceID is set
+	TraceID string `json:"trace_id,omitempty"`
+	// ExpectedDuration is how long the holder declared to need the slot, see AddJobExpecting
+	ExpectedDuration time.Duration `json:"expected_duration,omitempty"`
+	// Err is set instead of the other fields if the slot could not be read, see WithPartialReads
+	Err error `json:"-"`
+
+	listedAt time.Time
+}
+
+// Age returns how long the job had held the slot when it was listed
+// it is zero if the slot was written without an acquisition timestamp
+func (j JobInfo) Age() time.Duration {
+	if j.AcquiredAt.IsZero() {
+		return 0
+	}
+
+	return j.listedAt.Sub(j.AcquiredAt)
+}
+
+// listWithTTLScript returns the value and the ttl in milliseconds of every occupied slot
+// as key, value, ttl triples, reading both in one atomic pass
+// KEYS are the slot keys
+var listWithTTLScript = newScript(`
+local result = {}
+for _, key in ipairs(KEYS) do
+	local v = redis.call('GET', key)
+	if v and v ~= '' then
+		table.insert(result, key)
+		table.insert(result, v)
+		table.insert(result, redis.call('PTTL', key))
+	end
+end
+return result
+`)
+
+// ListJobsWithTTL returns the occupied slots of jobType in index order with their ttl and timestamps
+// the values and the ttls are read atomically by a lua script; if the backend fails to run it,
+// or with WithPartialReads, they are read with two calls and a slot released in between is left out
+// with WithPartialReads an unreadable slot is returned with only SlotKey and Err set
+func (rl *RateLimiter) ListJobsWithTTL(ctx context.Context, jobType string, limit int) ([]JobInfo, error) {
+	if !rl.partialReads {
+		infos, err := rl.listJobsWithTTLScript(ctx, jobType, limit)
+		if err == nil || ctx.Err() != nil || errors.Is(err, ErrInvalidLimit) || errors.Is(err, ErrLimitTooLarge) {
+			return infos, err
+		}
+		rl.logf("concurrency: listing %s with a script failed, falling back to separate reads: %v", jobType, err)
+	}
+
+	return rl.listJobsWithTTLPipeline(ctx, jobType, limit)
+}
+
+// ExpiringSoon returns the occupied slots of jobType whose remaining ttl is below within,
+// e.g. for a supervisor renewing the slots at risk in bulk with ExtendAll
+// slots without expiry and, with WithPartialReads, unreadable slots are never returned
+func (rl *RateLimiter) ExpiringSoon(ctx context.Context, jobType string, limit int, within time.Duration) ([]JobInfo, error) {
+	infos, err := rl.ListJobsWithTTL(ctx, jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiring []JobInfo
+	for _, info := range infos {
+		if info.Err == nil && info.TTL != TTLNoExpiry && info.TTL < within {
+			expiring = append(expiring, info)
+		}
+	}
+
+	return expiring, nil
+}
+
+// listJobsWithTTLScript reads the occupied slots and their ttls with listWithTTLScript
+func (rl *RateLimiter) listJobsWithTTLScript(ctx context.Context, jobType string, limit int) ([]JobInfo, error) {
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := listWithTTLScript.Run(ctx, rl.reader(), slotKeys)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok || len(items)%3 != 0 {
+		return nil, fmt.Errorf("unexpected script reply %v", reply)
+	}
+
+	now := rl.now()
+	var infos []JobInfo
+	for i := 0; i < len(items); i += 3 {
+		pair, err := toStrings(items[i : i+2])
+		if err != nil {
+			return nil, err
+		}
+		ms, err := toInt64(items[i+2])
+		if err != nil {
+			return nil, err
+		}
+		if time.Duration(ms) == TTLMissing {
+			continue
+		}
+		slot, err := rl.decodeSlot(pair[0], pair[1])
+		if err != nil {
+			return nil, err
+		}
+		ttl := time.Duration(ms)
+		if ttl != TTLNoExpiry {
+			ttl *= time.Millisecond
+		}
+		infos = append(infos, newJobInfo(pair[0], slot, ttl, now))
+	}
+
+	return infos, nil
+}
+
+// listJobsWithTTLPipeline reads the occupied slots and then their ttls with two calls
+func (rl *RateLimiter) listJobsWithTTLPipeline(ctx context.Context, jobType string, limit int) ([]JobInfo, error) {
+	conn := rl.reader()
+	keys, slots, readErrs, err := rl.listSlotsPartial(ctx, conn, jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var occupied []string
+	for i, slot := range slots {
+		if slot.JobID != "" {
+			occupied = append(occupied, keys[i])
+		}
+	}
+	var ttls []time.Duration
+	var ttlErrs []error
+	if len(occupied) > 0 {
+		ttls, ttlErrs, err = rl.pttlPartial(ctx, conn, occupied)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := rl.now()
+	var infos []JobInfo
+	next := 0
+	for i, slot := range slots {
+		if readErrs[i] != nil {
+			infos = append(infos, JobInfo{SlotKey: keys[i], Err: readErrs[i]})
+			continue
+		}
+		if slot.JobID == "" {
+			continue
+		}
+		ttl, ttlErr := ttls[next], ttlErrs[next]
+		next++
+		if ttlErr != nil {
+			infos = append(infos, JobInfo{SlotKey: keys[i], Err: ttlErr})
+			continue
+		}
+		if ttl == TTLMissing {
+			continue
+		}
+		infos = append(infos, newJobInfo(keys[i], slot, ttl, now))
+	}
+
+	return infos, nil
+}
+
+// newJobInfo describes the occupied slot slotKey listed at now
+func newJobInfo(slotKey string, slot SlotValue, ttl time.Duration, now time.Time) JobInfo {
+	return JobInfo{
+		SlotKey:          slotKey,
+		JobID:            slot.JobID,
+		TTL:              ttl,
+		AcquiredAt:       slot.AcquiredAt,
+		LastRenewedAt:    slot.LastRenewedAt,
+		Token:            slot.Token,
+		Owner:            slot.Owner,
+		TraceID:          slot.TraceID,
+		ExpectedDuration: slot.ExpectedDuration,
+		listedAt:         now,
+	}
+}
+
+// StateDump is a snapshot of the occupied slots of a jobType
+type StateDump struct {
+	JobType string    `json:"job_type"`
+	Limit   int       `json:"limit"`
+	Jobs    []JobInfo `json:"jobs"`
+}
+
+// DumpState returns the occupied slots of jobType as a StateDump, e.g. to serve it as json
+func (rl *RateLimiter) DumpState(ctx context.Context, jobType string, limit int) (StateDump, error) {
+	jobs, err := rl.ListJobsWithTTL(ctx, jobType, limit)
+	if err != nil {
+		return StateDump{}, err
+	}
+
+	return StateDump{
+		JobType: jobType,
+		Limit:   limit,
+		Jobs:    jobs,
+	}, nil
+}
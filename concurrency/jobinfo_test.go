@@ -0,0 +1,279 @@
+package concurrency_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestListJobsWithTTLAges(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now))
+	defer mr.Close()
+	ctx := context.Background()
+
+	start := clock.Now()
+	if _, err := rl.AddJob("pool", 3, "first", 0); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(10 * time.Minute)
+	if _, err := rl.AddJob("pool", 3, "second", 0); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(5 * time.Minute)
+	renewed := clock.Now()
+	if err := rl.ExtendJob(ctx, "pool", 3, "first", 0); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+
+	infos, err := rl.ListJobsWithTTL(ctx, "pool", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("ListJobsWithTTL returned %+v, want two jobs", infos)
+	}
+
+	first, second := infos[0], infos[1]
+	if first.JobID != "first" || second.JobID != "second" {
+		t.Fatalf("ListJobsWithTTL returned %s and %s, want them in index order", first.JobID, second.JobID)
+	}
+	// the renewal keeps the acquisition time
+	if !first.AcquiredAt.Equal(start) || !first.LastRenewedAt.Equal(renewed) {
+		t.Errorf("first acquired at %v renewed at %v, want %v and %v", first.AcquiredAt, first.LastRenewedAt, start, renewed)
+	}
+	if age := first.Age(); age != 16*time.Minute {
+		t.Errorf("first has age %v, want 16m", age)
+	}
+	if !second.LastRenewedAt.IsZero() {
+		t.Errorf("second was renewed at %v, want never", second.LastRenewedAt)
+	}
+	if age := second.Age(); age != 6*time.Minute {
+		t.Errorf("second has age %v, want 6m", age)
+	}
+	if first.TTL != testTTL || second.TTL != testTTL {
+		t.Errorf("the slots have ttls %v and %v, want %v", first.TTL, second.TTL, testTTL)
+	}
+}
+
+func TestJobInfoAgeWithoutTimestamp(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	// a bare jobID was written before acquisition timestamps were stored
+	mr.Set("pool-0", "legacy")
+	infos, err := rl.ListJobsWithTTL(context.Background(), "pool", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].JobID != "legacy" || infos[0].Age() != 0 || infos[0].TTL != concurrency.TTLNoExpiry {
+		t.Errorf("ListJobsWithTTL returned %+v, want legacy without age or expiry", infos)
+	}
+}
+
+func TestOwnerIdentity(t *testing.T) {
+	ctx := context.Background()
+	rl, mr := newTestLimiter(t, concurrency.WithOwnerIdentity("worker-1\n"))
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 2, "job", 0); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := rl.ListJobsWithTTL(ctx, "pool", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Owner != "worker-1" {
+		t.Errorf("ListJobsWithTTL returned %+v, want owner worker-1 without the control character", infos)
+	}
+
+	dump, err := rl.DumpState(ctx, "pool", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded concurrency.StateDump
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Jobs) != 1 || decoded.Jobs[0].Owner != "worker-1" || decoded.Jobs[0].JobID != "job" {
+		t.Errorf("the dump round-tripped to %+v", decoded)
+	}
+
+	// the default identity is the hostname and pid
+	rl, mr = newTestLimiter(t, concurrency.WithOwnerIdentity(""))
+	defer mr.Close()
+	if _, err := rl.AddJob("pool", 2, "job", 0); err != nil {
+		t.Fatal(err)
+	}
+	host, _ := os.Hostname()
+	want := fmt.Sprintf("%s:%d", host, os.Getpid())
+	if infos, err := rl.ListJobsWithTTL(ctx, "pool", 2); err != nil || len(infos) != 1 || infos[0].Owner != want {
+		t.Errorf("ListJobsWithTTL returned %+v, %v, want owner %s", infos, err, want)
+	}
+
+	// without the option no owner is stored
+	rl, mr = newTestLimiter(t)
+	defer mr.Close()
+	if _, err := rl.AddJob("pool", 2, "job", 0); err != nil {
+		t.Fatal(err)
+	}
+	if infos, err := rl.ListJobsWithTTL(ctx, "pool", 2); err != nil || len(infos) != 1 || infos[0].Owner != "" {
+		t.Errorf("ListJobsWithTTL returned %+v, %v, want no owner", infos, err)
+	}
+}
+
+func TestListJobsWithTTLCoherentUnderWrites(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	// the writer keeps swapping a short lived and a long lived job in the same slot
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			jobID, ttl := "short", 10*time.Second
+			if i%2 == 1 {
+				jobID, ttl = "long", time.Hour
+			}
+			if _, err := rl.AddJob("pool", 1, jobID, ttl); err != nil {
+				t.Errorf("AddJob: %v", err)
+				return
+			}
+			if _, err := rl.DeleteJob("pool", 1, jobID); err != nil {
+				t.Errorf("DeleteJob: %v", err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		infos, err := rl.ListJobsWithTTL(ctx, "pool", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, info := range infos {
+			if (info.JobID == "short") != (info.TTL <= 10*time.Second) {
+				t.Fatalf("job %s was listed with the ttl %v of the other job", info.JobID, info.TTL)
+			}
+		}
+	}
+	close(done)
+	<-stopped
+}
+
+// noEvalConnector is a backend without scripting
+type noEvalConnector struct {
+	concurrency.RedisConnector
+}
+
+func (c noEvalConnector) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	return nil, errors.New("ERR unknown command 'eval'")
+}
+
+func (c noEvalConnector) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	return nil, errors.New("ERR unknown command 'evalsha'")
+}
+
+func TestListJobsWithTTLWithoutEval(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	logger := &testLogger{}
+	rl := concurrency.NewRateLimiter(noEvalConnector{newTestConnector(mr)}, testTTL, concurrency.WithLogger(logger))
+
+	mr.Set("pool-1", "job")
+	mr.SetTTL("pool-1", 30*time.Second)
+	infos, err := rl.ListJobsWithTTL(context.Background(), "pool", 2)
+	if err != nil {
+		t.Fatalf("ListJobsWithTTL without eval: %v", err)
+	}
+	if len(infos) != 1 || infos[0].SlotKey != "pool-1" || infos[0].JobID != "job" || infos[0].TTL != 30*time.Second {
+		t.Errorf("ListJobsWithTTL returned %+v, want job in pool-1 with ttl 30s", infos)
+	}
+	if len(logger.Lines()) == 0 {
+		t.Error("the fallback to separate reads was not logged")
+	}
+}
+
+// traceKey is the context key of the trace id in the tests
+type traceKey struct{}
+
+func TestTraceIDStoredWithSlot(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithTraceID(func(ctx context.Context) string {
+		traceID, _ := ctx.Value(traceKey{}).(string)
+		return traceID
+	}))
+	defer mr.Close()
+
+	traced := context.WithValue(context.Background(), traceKey{}, "4bf92f3577b34da6a3ce929d0e0e4736")
+	if _, _, err := rl.AddJobWithToken(traced, "pool", 2, "traced", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := rl.AddJobWithToken(context.Background(), "pool", 2, "untraced", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := rl.DumpState(context.Background(), "pool", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	traceIDs := map[string]string{}
+	for _, info := range dump.Jobs {
+		traceIDs[info.JobID] = info.TraceID
+	}
+	if want := "map[traced:4bf92f3577b34da6a3ce929d0e0e4736 untraced:]"; fmt.Sprint(traceIDs) != want {
+		t.Errorf("DumpState listed trace ids %v, want %s", traceIDs, want)
+	}
+	out, err := json.Marshal(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`) {
+		t.Errorf("the dump %s does not carry the trace id", out)
+	}
+}
+
+func TestExpiringSoon(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	for jobID, ttl := range map[string]time.Duration{"soon": 5 * time.Second, "edge": 10 * time.Second, "later": time.Hour, "forever": -1} {
+		if _, err := rl.AddJob("pool", 5, jobID, ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	infos, err := rl.ExpiringSoon(ctx, "pool", 5, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].JobID != "soon" || infos[0].TTL != 5*time.Second {
+		t.Errorf("ExpiringSoon returned %+v, want only soon with 5s left", infos)
+	}
+
+	// renewing the reported slots takes them off the list
+	if _, err := rl.ExtendAll(ctx, "pool", 5, []string{"soon"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if infos, err := rl.ExpiringSoon(ctx, "pool", 5, 10*time.Second); err != nil || len(infos) != 0 {
+		t.Errorf("ExpiringSoon after the renewal returned %+v, %v", infos, err)
+	}
+}
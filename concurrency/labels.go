@@ -0,0 +1,128 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+)
+
+// labelledPoolsKey is the set of the jobTypes carrying labels, it keeps FindPoolsByLabel
+// independent of a key scan, which the connector does not offer
+const labelledPoolsKey = "labelled-pools"
+
+// setLabelsScript replaces the labels of a jobType and registers it as labelled, or unregisters it without labels
+// KEYS[1] is the labels hash, KEYS[2] the labelled pools set, ARGV[1] the jobType, ARGV[2..] label, value pairs
+var setLabelsScript = newScript(`
+redis.call('DEL', KEYS[1])
+if #ARGV < 3 then
+	redis.call('SREM', KEYS[2], ARGV[1])
+	return 0
+end
+for i = 2, #ARGV, 2 do
+	redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+redis.call('SADD', KEYS[2], ARGV[1])
+return 1
+`)
+
+// getLabelsScript returns the labels hash as label, value pairs
+// KEYS[1] is the labels hash
+var getLabelsScript = newScript(`
+return redis.call('HGETALL', KEYS[1])
+`)
+
+// labelledPoolsScript returns the labelled jobTypes
+// KEYS[1] is the labelled pools set
+var labelledPoolsScript = newScript(`
+return redis.call('SMEMBERS', KEYS[1])
+`)
+
+// labelValuesScript returns the value of label ARGV[1] in every labels hash of KEYS, empty if it is not set
+var labelValuesScript = newScript(`
+local values = {}
+for i, key in ipairs(KEYS) do
+	values[i] = redis.call('HGET', key, ARGV[1]) or ''
+end
+return values
+`)
+
+// labelsKey returns the key of the hash holding the labels of jobType
+func labelsKey(jobType string) string {
+	return fmt.Sprintf("%s-labels", jobType)
+}
+
+// SetPoolLabels replaces the labels of jobType, e.g. team, service or environment, so pools can be
+// found by FindPoolsByLabel; empty labels remove the jobType from the inventory
+// a label whose key or value exceeds the max metadata size fails with a *MetadataTooLargeError
+func (rl *RateLimiter) SetPoolLabels(ctx context.Context, jobType string, labels map[string]string) error {
+	args := make([]interface{}, 0, 2*len(labels)+1)
+	args = append(args, jobType)
+	for k, v := range labels {
+		if err := rl.checkMetadataSize("label key", k); err != nil {
+			return err
+		}
+		if err := rl.checkMetadataSize("label "+k, v); err != nil {
+			return err
+		}
+		args = append(args, k, v)
+	}
+	_, err := setLabelsScript.Run(ctx, rl.redisConnector, []string{labelsKey(jobType), labelledPoolsKey}, args...)
+
+	return err
+}
+
+// GetPoolLabels returns the labels of jobType, empty if it has none
+func (rl *RateLimiter) GetPoolLabels(ctx context.Context, jobType string) (map[string]string, error) {
+	reply, err := getLabelsScript.Run(ctx, rl.reader(), []string{labelsKey(jobType)})
+	if err != nil {
+		return nil, err
+	}
+	pairs, err := toStrings(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		labels[pairs[i]] = pairs[i+1]
+	}
+
+	return labels, nil
+}
+
+// FindPoolsByLabel returns the jobTypes whose label key is value, in no particular order
+// the labelled jobTypes are read first and their labels in a second script naming every labels hash
+func (rl *RateLimiter) FindPoolsByLabel(ctx context.Context, key, value string) ([]string, error) {
+	reply, err := labelledPoolsScript.Run(ctx, rl.reader(), []string{labelledPoolsKey})
+	if err != nil {
+		return nil, err
+	}
+	jobTypes, err := toStrings(reply)
+	if err != nil || len(jobTypes) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, len(jobTypes))
+	for i, jobType := range jobTypes {
+		keys[i] = labelsKey(jobType)
+	}
+	reply, err = labelValuesScript.Run(ctx, rl.reader(), keys, key)
+	if err != nil {
+		return nil, err
+	}
+	values, err := toStrings(reply)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReplyLength("label values", len(keys), len(values)); err != nil {
+		return nil, err
+	}
+
+	var found []string
+	for i, v := range values {
+		if v == value {
+			found = append(found, jobTypes[i])
+		}
+	}
+
+	return found, nil
+}
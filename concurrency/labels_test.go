@@ -0,0 +1,78 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestPoolLabels(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	pools := map[string]map[string]string{
+		"billing":    {"team": "payments", "env": "prod"},
+		"refunds":    {"team": "payments", "env": "staging"},
+		"thumbnails": {"team": "media", "env": "prod"},
+	}
+	for jobType, labels := range pools {
+		if err := rl.SetPoolLabels(ctx, jobType, labels); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	labels, err := rl.GetPoolLabels(ctx, "refunds")
+	if err != nil || fmt.Sprint(labels) != "map[env:staging team:payments]" {
+		t.Errorf("GetPoolLabels returned %v, %v", labels, err)
+	}
+	if labels, err := rl.GetPoolLabels(ctx, "unlabelled"); err != nil || len(labels) != 0 {
+		t.Errorf("GetPoolLabels of a pool without labels returned %v, %v", labels, err)
+	}
+
+	find := func(key, value string) string {
+		t.Helper()
+		found, err := rl.FindPoolsByLabel(ctx, key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(found)
+		return fmt.Sprint(found)
+	}
+	if got := find("team", "payments"); got != "[billing refunds]" {
+		t.Errorf("FindPoolsByLabel team=payments returned %s", got)
+	}
+	if got := find("env", "prod"); got != "[billing thumbnails]" {
+		t.Errorf("FindPoolsByLabel env=prod returned %s", got)
+	}
+	if got := find("team", "search"); got != "[]" {
+		t.Errorf("FindPoolsByLabel team=search returned %s", got)
+	}
+
+	// setting labels replaces them, no labels take the pool out of the inventory
+	if err := rl.SetPoolLabels(ctx, "refunds", map[string]string{"team": "ledger"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.SetPoolLabels(ctx, "thumbnails", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := find("team", "payments"); got != "[billing]" {
+		t.Errorf("FindPoolsByLabel team=payments after the relabelling returned %s", got)
+	}
+	if got := find("env", "prod"); got != "[billing]" {
+		t.Errorf("FindPoolsByLabel env=prod after the relabelling returned %s", got)
+	}
+	if labels, err := rl.GetPoolLabels(ctx, "refunds"); err != nil || fmt.Sprint(labels) != "map[team:ledger]" {
+		t.Errorf("GetPoolLabels after the relabelling returned %v, %v", labels, err)
+	}
+
+	err = rl.SetPoolLabels(ctx, "billing", map[string]string{"owner": strings.Repeat("x", concurrency.DefaultMaxMetadataSize+1)})
+	if !errors.Is(err, concurrency.ErrMetadataTooLarge) {
+		t.Errorf("SetPoolLabels with an oversized value returned %v, want ErrMetadataTooLarge", err)
+	}
+}
@@ -0,0 +1,182 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrLeaseLost defines the error when a lease could not be renewed before its slot expired
+var ErrLeaseLost = errors.New("lease lost")
+
+// leaseReleaseTimeout bounds the release of a slot when its lease ends,
+// so a hung redis call does not block Release or leak the renewal goroutine
+const leaseReleaseTimeout = 5 * time.Second
+
+// Lease keeps the slot of a job alive by renewing its ttl in the background
+type Lease struct {
+	rl      *RateLimiter
+	jobType string
+	limit   int
+	jobID   string
+	ttl     time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	lost   chan struct{}
+
+	// hb is set for leases renewed by a HeartbeatManager instead of their own goroutine
+	hb          *HeartbeatManager
+	releaseOnce sync.Once
+
+	mu         sync.Mutex
+	err        error
+	releaseErr error
+}
+
+// StartLease renews the slot held by jobID every third of ttl
+// renewal stops and the slot is released when Release is called or ctx is done
+func (rl *RateLimiter) StartLease(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) *Lease {
+	ttl = rl.leaseTTL(ttl)
+	ctx, cancel := context.WithCancel(ctx)
+	l := &Lease{
+		rl:      rl,
+		jobType: jobType,
+		limit:   limit,
+		jobID:   jobID,
+		ttl:     ttl,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+	go l.run(ctx)
+
+	return l
+}
+
+// leaseTTL applies the default and the max ttl to the ttl a lease renews with
+func (rl *RateLimiter) leaseTTL(ttl time.Duration) time.Duration {
+	if ttl == 0 {
+		ttl = rl.defaultTTL
+	}
+	if capped, err := rl.jobTTL(ttl); err == nil {
+		ttl = capped
+	}
+
+	return ttl
+}
+
+// JobID returns the jobID holding the slot
+func (l *Lease) JobID() string {
+	return l.jobID
+}
+
+// Lost is closed when the slot could not be renewed anymore
+func (l *Lease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Err returns ErrLeaseLost after the lease was lost
+func (l *Lease) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
+}
+
+// Release stops the renewal and frees the slot
+func (l *Lease) Release() error {
+	if l.hb != nil {
+		l.releaseOnce.Do(func() {
+			// a lost lease was unregistered already and has no slot to free
+			if l.hb.unregister(l) {
+				l.release()
+			}
+		})
+	} else {
+		l.cancel()
+		<-l.done
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.releaseErr
+}
+
+func (l *Lease) run(ctx context.Context) {
+	defer close(l.done)
+
+	if l.ttl/3 <= 0 {
+		// the slot never expires, there is nothing to renew
+		<-ctx.Done()
+		l.release()
+		return
+	}
+	interval := l.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			l.release()
+			return
+		case <-ticker.C:
+		}
+
+		// a renewal may take half an interval, a hung call is then retried on the next tick
+		renewCtx, cancel := context.WithTimeout(ctx, interval/2)
+		err := l.rl.ExtendJob(renewCtx, l.jobType, l.limit, l.jobID, l.ttl)
+		cancel()
+		if err == ErrJobNotFound {
+			l.mu.Lock()
+			l.err = ErrLeaseLost
+			l.mu.Unlock()
+			close(l.lost)
+			return
+		}
+		// other errors are retried on the next tick while the slot has ttl left
+	}
+}
+
+// release frees the slot, the caller's context may already be done
+func (l *Lease) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), leaseReleaseTimeout)
+	defer cancel()
+	_, err := l.rl.deleteJob(ctx, l.jobType, l.limit, l.jobID)
+	l.mu.Lock()
+	l.releaseErr = err
+	l.mu.Unlock()
+}
+
+// WithSlot waits up to maxWait for a slot, runs fn while holding it and releases it afterwards
+// the slot is renewed by a lease while fn runs, the context passed to fn is cancelled if the lease is lost
+// fn is not run if no slot is acquired, ErrTimeout is returned in that case
+func (rl *RateLimiter) WithSlot(ctx context.Context, jobType string, limit int, jobID string, ttl, maxWait time.Duration, fn func(ctx context.Context) error) error {
+	id, err := rl.AcquireWait(ctx, jobType, limit, jobID, ttl, maxWait)
+	if err != nil {
+		return err
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	lease := rl.StartLease(runCtx, jobType, limit, id, ttl)
+	go func() {
+		select {
+		case <-lease.Lost():
+			cancel()
+		case <-runCtx.Done():
+		}
+	}()
+
+	err = fn(runCtx)
+	if releaseErr := lease.Release(); err == nil {
+		err = releaseErr
+	}
+	if err == nil {
+		err = lease.Err()
+	}
+
+	return err
+}
@@ -0,0 +1,181 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestWithSlotRenewsAndReleases(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	const ttl = 150 * time.Millisecond
+
+	ran := false
+	err := rl.WithSlot(context.Background(), "pool", 1, "job", ttl, time.Second, func(ctx context.Context) error {
+		ran = true
+		if n := occupied(t, rl, "pool", 1); n != 1 {
+			t.Errorf("%d slots occupied while fn runs, want 1", n)
+		}
+		// leave the slot nearly expired, the lease has to renew it
+		mr.FastForward(ttl - 10*time.Millisecond)
+		time.Sleep(ttl)
+		if !mr.Exists("pool-0") {
+			t.Fatal("the slot expired while fn was running")
+		}
+		if left := mr.TTL("pool-0"); left <= ttl/2 {
+			t.Errorf("the slot has %v left, want it renewed to about %v", left, ttl)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Fatal("fn was not run")
+	}
+	if n := occupied(t, rl, "pool", 1); n != 0 {
+		t.Errorf("%d slots occupied after WithSlot returned", n)
+	}
+}
+
+func TestWithSlotReturnsFnError(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	failed := errors.New("job failed")
+	err := rl.WithSlot(context.Background(), "pool", 1, "job", testTTL, time.Second, func(ctx context.Context) error {
+		return failed
+	})
+	if err != failed {
+		t.Errorf("WithSlot returned %v, want the error of fn", err)
+	}
+	if n := occupied(t, rl, "pool", 1); n != 0 {
+		t.Errorf("%d slots occupied after fn failed", n)
+	}
+}
+
+func TestWithSlotTimeout(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 1, "holder", 0); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err := rl.WithSlot(context.Background(), "pool", 1, "job", testTTL, 50*time.Millisecond, func(ctx context.Context) error {
+		t.Error("fn ran without a slot")
+		return nil
+	})
+	if !errors.Is(err, concurrency.ErrTimeout) {
+		t.Errorf("WithSlot returned %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("WithSlot gave up after %v, want it to wait the max wait", elapsed)
+	}
+}
+
+func TestWithSlotCancelledMidRun(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	result := make(chan error, 1)
+	go func() {
+		result <- rl.WithSlot(ctx, "pool", 1, "job", testTTL, time.Second, func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+
+	<-started
+	cancel()
+	select {
+	case err := <-result:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("WithSlot returned %v, want context.Canceled", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fn was not cancelled")
+	}
+	if n := occupied(t, rl, "pool", 1); n != 0 {
+		t.Errorf("%d slots occupied after the cancellation", n)
+	}
+}
+
+// hangingConnector lets script calls hang until their context is done while hanging is set
+type hangingConnector struct {
+	concurrency.RedisConnector
+	hanging int32
+	hung    chan struct{}
+}
+
+func (c *hangingConnector) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	if atomic.LoadInt32(&c.hanging) == 1 {
+		select {
+		case c.hung <- struct{}{}:
+		default:
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return c.RedisConnector.EvalSha(ctx, sha, keys, args...)
+}
+
+func TestLeaseStopsPromptlyOnCancel(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := &hangingConnector{RedisConnector: newTestConnector(mr), hung: make(chan struct{}, 1)}
+	rl := concurrency.NewRateLimiter(conn, testTTL)
+	if err := rl.LoadScripts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.AddJob("pool", 1, "job", 0); err != nil {
+		t.Fatal(err)
+	}
+	goroutines := runtime.NumGoroutine()
+
+	const ttl = 300 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	lease := rl.StartLease(ctx, "pool", 1, "job", ttl)
+
+	// a hung renewal is given up after half the renewal interval and retried on the next tick
+	atomic.StoreInt32(&conn.hanging, 1)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-conn.hung:
+		case <-time.After(time.Second):
+			t.Fatal("the lease did not retry after a hung renewal")
+		}
+	}
+
+	// cancelling ends the hung renewal, the slot is released and the goroutine exits
+	<-conn.hung
+	atomic.StoreInt32(&conn.hanging, 0)
+	start := time.Now()
+	cancel()
+	if err := lease.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > ttl/3 {
+		t.Errorf("the lease took %v to stop, want it within a renewal interval", elapsed)
+	}
+	if n := occupied(t, rl, "pool", 1); n != 0 {
+		t.Errorf("%d slots occupied after the lease was cancelled", n)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > goroutines && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("%d goroutines left after the lease ended, want %d", n, goroutines)
+	}
+}
@@ -0,0 +1,22 @@
+package concurrency
+
+import (
+	"context"
+	"time"
+)
+
+// Limiter is the slot API of RateLimiter, callers can depend on it to replace the limiter in their tests
+// NewRateLimiter still returns the struct, the options and the less common methods are only available on it
+type Limiter interface {
+	AddJob(jobType string, limit int, jobID string, ttl time.Duration) (string, error)
+	ListJobs(jobType string, limit int) (map[string]string, error)
+	DeleteJob(jobType string, limit int, jobID string) (bool, error)
+	ExtendJob(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) error
+	CanAcquire(ctx context.Context, jobType string, limit int) (bool, error)
+	FreeSlots(ctx context.Context, jobType string, limit int) ([]string, error)
+	AcquireWait(ctx context.Context, jobType string, limit int, jobID string, ttl, maxWait time.Duration) (string, error)
+	WithSlot(ctx context.Context, jobType string, limit int, jobID string, ttl, maxWait time.Duration, fn func(ctx context.Context) error) error
+	Close(ctx context.Context) error
+}
+
+var _ Limiter = (*RateLimiter)(nil)
@@ -0,0 +1,52 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// runJob is downstream code depending on the Limiter interface
+func runJob(l concurrency.Limiter, jobID string) error {
+	if _, err := l.AddJob("pool", 2, jobID, 0); err != nil {
+		return err
+	}
+	_, err := l.DeleteJob("pool", 2, jobID)
+
+	return err
+}
+
+// rejectingLimiter is a stand-in for the limiter rejecting every job
+type rejectingLimiter struct {
+	concurrency.Limiter
+}
+
+func (rejectingLimiter) AddJob(jobType string, limit int, jobID string, ttl time.Duration) (string, error) {
+	return "", concurrency.ErrNoSlot
+}
+
+func TestRateLimiterIsLimiter(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	var l concurrency.Limiter = rl
+	if _, err := l.AddJob("pool", 2, "held", 0); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := l.ListJobs("pool", 2); err != nil || jobs["pool-0"] != "held" {
+		t.Errorf("ListJobs through the interface returned %v, %v", jobs, err)
+	}
+	if ok, err := l.CanAcquire(context.Background(), "pool", 2); err != nil || !ok {
+		t.Errorf("CanAcquire through the interface returned %v, %v", ok, err)
+	}
+	if err := runJob(l, "job"); err != nil {
+		t.Errorf("runJob with the limiter: %v", err)
+	}
+
+	if err := runJob(rejectingLimiter{}, "job"); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("runJob with the stand-in returned %v, want ErrNoSlot", err)
+	}
+}
@@ -0,0 +1,57 @@
+package concurrency
+
+import (
+	"context"
+	"time"
+)
+
+// Metric is a single measurement emitted to the metrics hook
+type Metric struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// metricOperationDuration is the duration of an operation in seconds
+// labels: job_type, operation and result (ok, no_slot or error)
+const metricOperationDuration = "operation_duration_seconds"
+
+// observeOperation emits the duration and result of an operation started at start
+func (rl *RateLimiter) observeOperation(ctx context.Context, operation, jobType string, start time.Time, err error) {
+	result := "ok"
+	switch {
+	case err == ErrNoSlot:
+		result = "no_slot"
+	case err != nil:
+		result = "error"
+	}
+	rl.expvarStats.record(jobType, operation, result)
+	if rl.metricsHook == nil {
+		return
+	}
+
+	rl.emitMetric(ctx, metricOperationDuration, time.Since(start).Seconds(), map[string]string{
+		"job_type":  jobType,
+		"operation": operation,
+		"result":    result,
+	})
+}
+
+// emitMetric sends a metric to the hook, merging the labels extracted from ctx
+// the given labels take precedence over the extracted ones
+func (rl *RateLimiter) emitMetric(ctx context.Context, name string, value float64, labels map[string]string) {
+	if rl.metricsHook == nil {
+		return
+	}
+
+	merged := map[string]string{}
+	if rl.metricLabels != nil {
+		for k, v := range rl.metricLabels(ctx) {
+			merged[k] = v
+		}
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	rl.metricsHook(Metric{Name: name, Labels: merged, Value: value})
+}
@@ -0,0 +1,58 @@
+package concurrency_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+type regionKey struct{}
+
+// metricSink collects the metrics emitted to the metrics hook
+type metricSink struct {
+	mu      sync.Mutex
+	metrics []concurrency.Metric
+}
+
+func (s *metricSink) hook(m concurrency.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, m)
+}
+
+func (s *metricSink) Metrics() []concurrency.Metric {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]concurrency.Metric(nil), s.metrics...)
+}
+
+func TestMetricLabelsFromContext(t *testing.T) {
+	sink := &metricSink{}
+	rl, mr := newTestLimiter(t,
+		concurrency.WithMetricsHook(sink.hook),
+		concurrency.WithMetricLabels(func(ctx context.Context) map[string]string {
+			region, _ := ctx.Value(regionKey{}).(string)
+			return map[string]string{"region": region, "job_type": "overwritten"}
+		}))
+	defer mr.Close()
+
+	ctx := context.WithValue(context.Background(), regionKey{}, "eu-west")
+	if _, err := rl.AcquireWait(ctx, "pool", 1, "job", 0, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := sink.Metrics()
+	if len(metrics) == 0 {
+		t.Fatal("no metric was emitted")
+	}
+	m := metrics[0]
+	if m.Labels["region"] != "eu-west" {
+		t.Errorf("metric %s has labels %v, want region eu-west", m.Name, m.Labels)
+	}
+	if m.Labels["job_type"] != "pool" || m.Labels["operation"] != "add_job" || m.Labels["result"] != "ok" {
+		t.Errorf("metric %s has labels %v, want the built-in labels kept", m.Name, m.Labels)
+	}
+}
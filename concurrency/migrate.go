@@ -0,0 +1,69 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// migrateScript moves a slot value with its remaining ttl to a new key
+// a missing old key or an already existing new key is left alone
+// KEYS[1] is the old key, KEYS[2] the new key
+var migrateScript = newScript(`
+local v = redis.call('GET', KEYS[1])
+if not v or redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl > 0 then
+	redis.call('SET', KEYS[2], v, 'PX', ttl)
+else
+	redis.call('SET', KEYS[2], v)
+end
+redis.call('DEL', KEYS[1])
+return 1
+`)
+
+// migrationKey returns the key of slot index i under prefix and sep
+// prefix "" and sep "-" is the key generated by GenJobKeys, a prefix is applied like AddJobIn
+func migrationKey(prefix, sep, jobType string, i int) string {
+	return fmt.Sprintf("%s%s%d", prefixedJobType(prefix, jobType), sep, i)
+}
+
+// MigrateKeys moves every occupied slot of jobType from the keys formed by fromPrefix and fromSep
+// to the keys formed by toPrefix and toSep, keeping the value and the remaining ttl
+// every slot is moved atomically on its own, a slot whose new key is already taken stays in place
+// only the slot keys are moved, the active set, counters and token list are not
+// on redis cluster the old and new key of a slot have to hash to the same cluster slot
+func (rl *RateLimiter) MigrateKeys(ctx context.Context, jobType string, limit int, fromPrefix, fromSep, toPrefix, toSep string) (migrated int, err error) {
+	start := time.Now()
+	defer func() {
+		rl.readCache.invalidate(jobType)
+		rl.observeOperation(ctx, "migrate_keys", jobType, start, err)
+	}()
+
+	if err := rl.checkLimit(limit); err != nil {
+		return 0, err
+	}
+	if fromPrefix == toPrefix && fromSep == toSep {
+		return 0, nil
+	}
+
+	for i := 0; i < limit; i++ {
+		keys := []string{
+			migrationKey(fromPrefix, fromSep, jobType, i),
+			migrationKey(toPrefix, toSep, jobType, i),
+		}
+		reply, err := migrateScript.Run(ctx, rl.redisConnector, keys)
+		if err != nil {
+			return migrated, err
+		}
+		n, err := toInt64(reply)
+		if err != nil {
+			return migrated, err
+		}
+		migrated += int(n)
+	}
+
+	return migrated, nil
+}
@@ -0,0 +1,56 @@
+package concurrency_test
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMigrateKeys(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	// slots written by a configuration with prefix old and separator _
+	mr.Set("old:pool_0", "a")
+	mr.SetTTL("old:pool_0", 30*time.Second)
+	mr.Set("old:pool_2", "c")
+	// a new key which is taken already keeps its value and the old slot stays in place
+	mr.Set("old:pool_3", "d")
+	mr.Set("pool-3", "other")
+
+	migrated, err := rl.MigrateKeys(ctx, "pool", 4, "old", "_", "", "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migrated != 2 {
+		t.Errorf("MigrateKeys migrated %d slots, want 2", migrated)
+	}
+
+	jobs, err := rl.ListJobs("pool", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs["pool-0"] != "a" || jobs["pool-1"] != "" || jobs["pool-2"] != "c" || jobs["pool-3"] != "other" {
+		t.Errorf("ListJobs returned %v after the migration", jobs)
+	}
+	if ttl := mr.TTL("pool-0"); ttl != 30*time.Second {
+		t.Errorf("pool-0 has ttl %v, want the remaining 30s", ttl)
+	}
+	if ttl := mr.TTL("pool-2"); ttl != 0 {
+		t.Errorf("pool-2 has ttl %v, want no expiry like the old key", ttl)
+	}
+	for _, key := range []string{"old:pool_0", "old:pool_2"} {
+		if mr.Exists(key) {
+			t.Errorf("the old key %s was not removed", key)
+		}
+	}
+	if value, _ := mr.Get("old:pool_3"); value != "d" {
+		t.Errorf("the old key old:pool_3 holds %q, want it left in place", value)
+	}
+
+	// migrating again finds nothing to move
+	if migrated, err := rl.MigrateKeys(ctx, "pool", 4, "old", "_", "", "-"); err != nil || migrated != 0 {
+		t.Errorf("a second MigrateKeys returned %d, %v", migrated, err)
+	}
+}
@@ -0,0 +1,130 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// MultiBackendLimiter spreads the slots of a logical pool over several independent redis backends
+// every backend owns an equal share of the limit and acquisitions go to the backends round-robin,
+// falling over to the next backend when one is full or failing
+// the limit only holds per backend: a job is rejected while another backend may still have room,
+// and an unreachable backend takes its share of the capacity with it instead of failing the pool
+type MultiBackendLimiter struct {
+	backends []*RateLimiter
+	next     uint32
+}
+
+// NewMultiBackendLimiter is the constructor of MultiBackendLimiter
+// a RateLimiter is built for every connector with defaultTTL and opts
+func NewMultiBackendLimiter(connectors []RedisConnector, defaultTTL time.Duration, opts ...Option) *MultiBackendLimiter {
+	m := &MultiBackendLimiter{}
+	for _, conn := range connectors {
+		m.backends = append(m.backends, NewRateLimiter(conn, defaultTTL, opts...))
+	}
+
+	return m
+}
+
+// share returns the part of limit owned by backend i, the remainder goes to the first backends
+func (m *MultiBackendLimiter) share(i, limit int) int {
+	n := len(m.backends)
+	share := limit / n
+	if i < limit%n {
+		share++
+	}
+
+	return share
+}
+
+// AddJob adds a job to the next backend with a free slot, starting round-robin
+// it returns a *RejectedError matching ErrNoSlot if every reachable backend is full, or the last error if none is reachable
+// a jobID is generated if the given one is empty
+func (m *MultiBackendLimiter) AddJob(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) (string, error) {
+	if len(m.backends) == 0 || limit == 0 {
+		return "", rejection(jobType, ErrPoolDisabled)
+	}
+
+	start := int(atomic.AddUint32(&m.next, 1))
+	var lastErr error
+	full := false
+	for j := 0; j < len(m.backends); j++ {
+		i := (start + j) % len(m.backends)
+		share := m.share(i, limit)
+		if share == 0 {
+			continue
+		}
+		id, err := m.backends[i].addJob(ctx, jobType, share, jobID, ttl)
+		if err == nil {
+			return id, nil
+		}
+		if errors.Is(err, ErrNoSlot) {
+			full = true
+			continue
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+		m.backends[i].logf("concurrency: backend %d failed to add job to %s: %v", i, jobType, err)
+		lastErr = err
+	}
+	if full || lastErr == nil {
+		return "", rejection(jobType, ErrNoSlot)
+	}
+
+	return "", lastErr
+}
+
+// DeleteJob deletes a job from every backend, the backends are tried even if one fails
+// it reports whether any backend released a slot and returns the last error
+func (m *MultiBackendLimiter) DeleteJob(ctx context.Context, jobType string, limit int, jobID string) (bool, error) {
+	released := false
+	var lastErr error
+	for i, rl := range m.backends {
+		ok, err := rl.deleteJob(ctx, jobType, m.share(i, limit), jobID)
+		if err != nil {
+			lastErr = err
+		}
+		released = released || ok
+	}
+
+	return released, lastErr
+}
+
+// ListJobs merges the slots of all backends, every slot key is prefixed with "<backend index>:"
+// unreachable backends are logged and left out, an error is only returned if no backend is reachable
+func (m *MultiBackendLimiter) ListJobs(ctx context.Context, jobType string, limit int) (map[string]string, error) {
+	result := map[string]string{}
+	var lastErr error
+	reached := 0
+	for i, rl := range m.backends {
+		slots, err := rl.listJobs(ctx, rl.reader(), jobType, m.share(i, limit))
+		if err != nil {
+			rl.logf("concurrency: backend %d failed to list %s: %v", i, jobType, err)
+			lastErr = err
+			continue
+		}
+		reached++
+		for k, v := range slots {
+			result[fmt.Sprintf("%d:%s", i, k)] = v
+		}
+	}
+	if reached == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+
+	return result, nil
+}
+
+// CountActiveJobs returns the number of occupied slots over all reachable backends, see ListJobs
+func (m *MultiBackendLimiter) CountActiveJobs(ctx context.Context, jobType string, limit int) (int, error) {
+	slots, err := m.ListJobs(ctx, jobType, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return countActive(slots), nil
+}
@@ -0,0 +1,91 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestMultiBackendLimiter(t *testing.T) {
+	var servers []*miniredis.Miniredis
+	var connectors []concurrency.RedisConnector
+	for i := 0; i < 3; i++ {
+		mr := newTestRedis(t)
+		defer mr.Close()
+		servers = append(servers, mr)
+		connectors = append(connectors, newTestConnector(mr))
+	}
+	m := concurrency.NewMultiBackendLimiter(connectors, testTTL, concurrency.WithLogger(&testLogger{}))
+	ctx := context.Background()
+
+	// the total capacity is the limit, split 3, 2 and 2
+	const limit = 7
+	for i := 0; i < limit; i++ {
+		if _, err := m.AddJob(ctx, "pool", limit, fmt.Sprint("job-", i), 0); err != nil {
+			t.Fatalf("AddJob %d: %v", i, err)
+		}
+	}
+	if _, err := m.AddJob(ctx, "pool", limit, "extra", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("AddJob beyond the limit returned %v, want ErrNoSlot", err)
+	}
+	for i, want := range []int{3, 2, 2} {
+		n := 0
+		for _, key := range servers[i].Keys() {
+			if strings.HasPrefix(key, "pool-") && key != "pool-fence" {
+				n++
+			}
+		}
+		if n != want {
+			t.Errorf("backend %d holds %d slots, want %d", i, n, want)
+		}
+	}
+
+	jobs, err := m.ListJobs(ctx, "pool", limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for key, jobID := range jobs {
+		if !strings.Contains(key, ":pool-") {
+			t.Errorf("ListJobs returned slot key %q without a backend prefix", key)
+		}
+		seen[jobID] = true
+	}
+	if len(jobs) != limit || len(seen) != limit {
+		t.Errorf("ListJobs returned %v, want the %d jobs of all backends", jobs, limit)
+	}
+	if n, err := m.CountActiveJobs(ctx, "pool", limit); err != nil || n != limit {
+		t.Errorf("CountActiveJobs returned %d, %v, want %d", n, err, limit)
+	}
+
+	if ok, err := m.DeleteJob(ctx, "pool", limit, "job-0"); err != nil || !ok {
+		t.Errorf("DeleteJob returned %v, %v", ok, err)
+	}
+	if n, err := m.CountActiveJobs(ctx, "pool", limit); err != nil || n != limit-1 {
+		t.Errorf("CountActiveJobs after a delete returned %d, %v, want %d", n, err, limit-1)
+	}
+
+	// an unreachable backend takes its share of the capacity with it
+	servers[0].Close()
+	for i := 0; ; i++ {
+		_, err := m.AddJob(ctx, "pool", limit, fmt.Sprint("refill-", i), 0)
+		if errors.Is(err, concurrency.ErrNoSlot) {
+			break
+		}
+		if err != nil || i == limit {
+			t.Fatalf("AddJob with one backend down returned %v after %d jobs", err, i)
+		}
+	}
+	n, err := m.CountActiveJobs(ctx, "pool", limit)
+	if err != nil {
+		t.Fatalf("CountActiveJobs with one backend down: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("CountActiveJobs with one backend down returned %d, want the 4 slots of the others", n)
+	}
+}
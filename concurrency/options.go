@@ -0,0 +1,463 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Option configures a RateLimiter
+type Option func(*RateLimiter)
+
+// WithUtilizationCallback registers fn to be called when an operation leaves
+// the utilization of a jobType at or above threshold (a fraction of limit)
+// fn is only called when the threshold is crossed, not on every operation above it,
+// and runs on its own goroutine so it never blocks the caller
+func WithUtilizationCallback(threshold float64, fn func(jobType string, used, limit int)) Option {
+	return func(rl *RateLimiter) {
+		rl.utilization = newUtilizationWatcher(threshold, fn)
+	}
+}
+
+// WithReadReplica serves read-only operations such as ListJobs from conn
+// while every write still goes to the primary connector
+// Replication is asynchronous, so reads from the replica can lag behind the primary
+// and may miss recently added jobs or still show released ones
+// Acquisition always reads the slots from the primary, a stale view there
+// could hand out a slot which is already taken
+func WithReadReplica(conn RedisConnector) Option {
+	return func(rl *RateLimiter) {
+		rl.readReplica = conn
+	}
+}
+
+// WithJobIDValidator replaces the validator applied to jobIDs in AddJob and DeleteJob
+// a jobID rejected by fn fails the operation with ErrInvalidJobID
+// the default validator is JobIDValidator("")
+func WithJobIDValidator(fn func(string) error) Option {
+	return func(rl *RateLimiter) {
+		rl.jobIDValidator = fn
+	}
+}
+
+// WithClock replaces time.Now as the source of acquisition timestamps
+func WithClock(now func() time.Time) Option {
+	return func(rl *RateLimiter) {
+		rl.clock = now
+	}
+}
+
+// WithActiveSet additionally tracks the occupied slots of each jobType in a redis set
+// so ListActiveJobs only reads the active slots instead of the whole range
+// AddJob, AddJobs and DeleteJob then run as lua scripts keeping the set and the slots in sync,
+// which costs an extra SADD or SREM per write
+// slots expiring through their ttl stay in the set until the next release or listing prunes them
+func WithActiveSet() Option {
+	return func(rl *RateLimiter) {
+		rl.activeSet = true
+	}
+}
+
+// WithMetricsHook registers fn to receive the metrics of every operation
+// fn is called synchronously and should not block
+func WithMetricsHook(fn func(Metric)) Option {
+	return func(rl *RateLimiter) {
+		rl.metricsHook = fn
+	}
+}
+
+// WithMetricLabels adds the labels returned by fn for the context of an operation to its metrics
+// the built-in labels such as job_type are never overwritten
+// every distinct label value creates a new series in most metrics backends,
+// so only extract low cardinality values like region or tier, never ids
+func WithMetricLabels(fn func(ctx context.Context) map[string]string) Option {
+	return func(rl *RateLimiter) {
+		rl.metricLabels = fn
+	}
+}
+
+// WithAuditStream appends an entry for every acquire, extend and release to the redis stream streamKey
+// each entry holds job_type, slot, job_id, action, timestamp (unix milliseconds) and the fencing token
+// the stream is trimmed to about 100000 entries unless WithAuditMaxLen says otherwise
+func WithAuditStream(streamKey string) Option {
+	return func(rl *RateLimiter) {
+		rl.auditStream = streamKey
+		if rl.auditMaxLen == 0 {
+			rl.auditMaxLen = defaultAuditMaxLen
+		}
+	}
+}
+
+// WithAuditMaxLen caps the audit stream to about n entries, older entries are trimmed
+func WithAuditMaxLen(n int64) Option {
+	return func(rl *RateLimiter) {
+		rl.auditMaxLen = n
+	}
+}
+
+// WithCircuitBreaker fails operations fast with ErrBackendUnavailable once the primary connector
+// returned failures consecutive errors, instead of letting every call wait for its own timeout
+// after cooldown a single probe call is let through, its success closes the breaker again
+// the breaker state is emitted as the circuit_breaker_state metric
+func WithCircuitBreaker(failures int, cooldown time.Duration) Option {
+	return func(rl *RateLimiter) {
+		rl.breaker = &circuitBreaker{
+			failures: failures,
+			cooldown: cooldown,
+		}
+	}
+}
+
+// WithMaxJobIDLength rejects jobIDs longer than n bytes with ErrJobIDTooLong before anything is written
+// the default is DefaultMaxJobIDLength, a negative n disables the check
+func WithMaxJobIDLength(n int) Option {
+	return func(rl *RateLimiter) {
+		rl.maxJobIDLength = n
+	}
+}
+
+// WithMaxMetadataSize rejects acquisitions whose owner or trace id, and pool labels whose key or value,
+// is longer than n bytes with a *MetadataTooLargeError before anything is written
+// the default is DefaultMaxMetadataSize, a negative n disables the check
+func WithMaxMetadataSize(n int) Option {
+	return func(rl *RateLimiter) {
+		rl.maxMetadataSize = n
+	}
+}
+
+// WithRandomProbe makes AddJob try the free slots in random order instead of lowest index first
+// it spreads concurrent writers over different slots, at the cost of a nondeterministic placement
+func WithRandomProbe() Option {
+	return func(rl *RateLimiter) {
+		rl.randomProbe = true
+	}
+}
+
+// WithPersistentCounters keeps cumulative grant, rejection and release counters per jobType in redis,
+// readable by any instance through LifetimeStats
+// the scripted paths, e.g. WithActiveSet, AddJobs and AddJobHint, update the counters inside their scripts,
+// the default paths with an extra HINCRBY after the operation, which is best effort: it is not atomic with
+// the operation, so a crash or a failed increment in between leaves the counters short, a failure is only logged
+func WithPersistentCounters() Option {
+	return func(rl *RateLimiter) {
+		rl.persistentCounters = true
+	}
+}
+
+// WithTokenList keeps the free slots of each jobType as tokens in a redis list
+// AddJob pops a token, DeleteJob pushes it back and AcquireSlot blocks on the list with BLPOP
+// the invariant is tokens + occupied slots == limit, a holder which crashes or whose slot
+// expires through its ttl never returns its token, so Reconcile has to run periodically
+// to give such tokens back; WithActiveSet is ignored in this mode
+func WithTokenList() Option {
+	return func(rl *RateLimiter) {
+		rl.tokenList = true
+	}
+}
+
+// WithLogger replaces the standard log package as the destination of the limiter's warnings
+func WithLogger(logger Logger) Option {
+	return func(rl *RateLimiter) {
+		rl.logger = logger
+	}
+}
+
+// WithAcquireHook calls fn after every slot a job successfully took
+// fn runs synchronously on the caller's goroutine, so it should be quick and hand slow work off;
+// a panic in fn is recovered and logged
+func WithAcquireHook(fn func(ctx context.Context, jobType, jobID, slotKey string)) Option {
+	return func(rl *RateLimiter) {
+		rl.acquireHook = fn
+	}
+}
+
+// WithReleaseHook calls fn after every slot a job successfully released
+// it runs like the hook of WithAcquireHook
+func WithReleaseHook(fn func(ctx context.Context, jobType, jobID, slotKey string)) Option {
+	return func(rl *RateLimiter) {
+		rl.releaseHook = fn
+	}
+}
+
+// WithMaxLimit rejects limits above n with ErrLimitTooLarge instead of generating that many slot keys
+// the default is DefaultMaxLimit, a negative n disables the check
+func WithMaxLimit(n int) Option {
+	return func(rl *RateLimiter) {
+		rl.maxLimit = n
+	}
+}
+
+// WithAttemptRateLimit lets at most perSecond AddJob attempts per jobType reach redis
+// within any one second window, further attempts fail fast with ErrAttemptRateExceeded
+// the window is kept in process memory, so the rate applies per limiter instance
+func WithAttemptRateLimit(perSecond int) Option {
+	return func(rl *RateLimiter) {
+		if perSecond > 0 {
+			rl.attemptLimiter = newAttemptLimiter(perSecond)
+		}
+	}
+}
+
+// WithPartialReads lets ListJobs and ListJobsWithTTL tolerate slots which cannot be read,
+// e.g. while a node of a redis cluster is down, instead of failing as a whole
+// if the batched read fails every slot is read on its own; ListJobsWithTTL reports an unreadable
+// slot with JobInfo.Err and ListJobs leaves it out, so the result may miss occupied slots
+// and must not be used to decide that a pool has room
+// acquiring and releasing are not affected and still fail on any read error
+func WithPartialReads() Option {
+	return func(rl *RateLimiter) {
+		rl.partialReads = true
+	}
+}
+
+// WithOwnerIdentity stores identity in every slot taken by this limiter, it is returned
+// as JobInfo.Owner to trace a stuck slot back to its process
+// an empty identity defaults to the hostname and pid, control characters are dropped
+// slots carry no owner without this option to keep their values small, see WithMaxMetadataSize
+func WithOwnerIdentity(identity string) Option {
+	return func(rl *RateLimiter) {
+		if identity == "" {
+			identity = defaultOwnerIdentity()
+		}
+		rl.ownerIdentity = strings.Map(dropControl, identity)
+	}
+}
+
+// dropControl drops control characters, which would corrupt a slot value, in strings.Map
+func dropControl(r rune) rune {
+	if unicode.IsControl(r) {
+		return -1
+	}
+
+	return r
+}
+
+// defaultOwnerIdentity returns "hostname:pid" of the current process
+func defaultOwnerIdentity() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// WithRetryBudget retries idempotent redis calls which failed with a backend error, at most twice per call,
+// drawing every retry from a budget of retries per interval shared by all calls of the limiter
+// once the budget is spent calls fail on their first error until it refills, so an outage does not
+// turn into a retry storm; lua scripts and other non idempotent calls are never retried
+func WithRetryBudget(retries int, interval time.Duration) Option {
+	return func(rl *RateLimiter) {
+		if retries > 0 && interval > 0 {
+			rl.retryBudget = newRetryBudget(retries, interval)
+		}
+	}
+}
+
+// WithDelBatchSize splits deletes of many slots into Del calls of at most n keys,
+// so a single huge Del does not stall redis; the default is 500
+func WithDelBatchSize(n int) Option {
+	return func(rl *RateLimiter) {
+		rl.delBatchSize = n
+	}
+}
+
+// WithDeterministicID sets the namespace of the UUIDv5 jobIDs derived by AddJobSeeded
+// limiters sharing jobTypes should use the same namespace, the default is uuid.Nil
+func WithDeterministicID(namespace uuid.UUID) Option {
+	return func(rl *RateLimiter) {
+		rl.idNamespace = namespace
+	}
+}
+
+// WithMaxTTL caps the ttl of AddJob, ExtendJob and the other calls writing a slot at d,
+// so a single caller cannot hold a slot indefinitely; a larger ttl, or no expiry at all,
+// is clamped to d with a warning, see WithStrictMaxTTL to reject it instead
+func WithMaxTTL(d time.Duration) Option {
+	return func(rl *RateLimiter) {
+		rl.maxTTL = d
+	}
+}
+
+// WithStrictMaxTTL rejects a ttl above the max ttl of WithMaxTTL with ErrTTLTooLarge instead of clamping it
+func WithStrictMaxTTL() Option {
+	return func(rl *RateLimiter) {
+		rl.strictMaxTTL = true
+	}
+}
+
+// WithOwnedTracking keeps the slots taken through this limiter in memory, so WaitIdle
+// can block until all of them are released or expired
+func WithOwnedTracking() Option {
+	return func(rl *RateLimiter) {
+		rl.owned = newOwnedSlots()
+	}
+}
+
+// WithAcquirePolicy selects which free slot AddJob takes, the default is LowestIndex
+// LRUFree spreads the jobs evenly over the slots by taking the slot free the longest,
+// it stores a free time per slot in a sorted set and picks the slot in a lua script;
+// it is ignored with WithActiveSet and WithTokenList
+func WithAcquirePolicy(policy AcquirePolicy) Option {
+	return func(rl *RateLimiter) {
+		rl.acquirePolicy = policy
+	}
+}
+
+// WithDuplicateWarnings logs a warning whenever ListJobs finds a jobID holding more than one slot,
+// see DetectDuplicates
+func WithDuplicateWarnings() Option {
+	return func(rl *RateLimiter) {
+		rl.duplicateWarnings = true
+	}
+}
+
+// WithTraceID stores the trace id returned by fn for the context of an acquisition in the slot,
+// it is returned as JobInfo.TraceID to correlate a held slot with its distributed trace
+// fn typically reads the span context of the tracing library, e.g. for opentelemetry
+// trace.SpanContextFromContext(ctx).TraceID().String(); control characters are dropped
+// and a trace id above the max metadata size fails the acquisition, see WithMaxMetadataSize
+func WithTraceID(fn func(ctx context.Context) string) Option {
+	return func(rl *RateLimiter) {
+		rl.traceID = func(ctx context.Context) string {
+			return strings.Map(dropControl, fn(ctx))
+		}
+	}
+}
+
+// WithTTLBoundedByContext cuts the ttl of a newly acquired slot to the time left until the deadline
+// of the caller's context, so the slot frees itself once the caller's work cannot proceed anymore
+// renewals are not bounded: ExtendJob and a Lease started on the slot keep extending it by the full ttl,
+// a Lease releases the slot when its own context is done instead
+func WithTTLBoundedByContext(bounded bool) Option {
+	return func(rl *RateLimiter) {
+		rl.ttlBoundedByContext = bounded
+	}
+}
+
+// WithReadCache serves ListJobs from an in-process cache for ttl after it was read from redis
+// AddJob, DeleteJob and every other acquisition or release of this limiter drop the cache of the jobType,
+// but changes made by other processes or by expiring slots stay invisible until the cached result is ttl old
+// keep ttl short, e.g. a second, it is meant for dashboards and pre-checks polling far more often than slots change
+func WithReadCache(ttl time.Duration) Option {
+	return func(rl *RateLimiter) {
+		if ttl > 0 {
+			rl.readCache = newReadCache(ttl)
+		}
+	}
+}
+
+// WithShutdownGrace sets how long HandleSignals waits for the held slots to be released
+// before it releases them itself, 30 seconds by default
+func WithShutdownGrace(grace time.Duration) Option {
+	return func(rl *RateLimiter) {
+		rl.shutdownGrace = grace
+	}
+}
+
+// WithReadTimeout bounds every redis call of the read-only operations, like ListJobs or ListJobsWithTTL,
+// by timeout unless the caller's context already carries a deadline, which is never extended
+// the calls of a read-only operation go to the read replica if one is configured
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(rl *RateLimiter) {
+		rl.readTimeout = timeout
+	}
+}
+
+// WithWriteTimeout bounds every redis call of the operations on the primary, like AddJob or DeleteJob,
+// by timeout unless the caller's context already carries a deadline, which is never extended
+// every retry of WithRetryBudget gets its own timeout, the blocking wait of AcquireSlot is not bounded
+func WithWriteTimeout(timeout time.Duration) Option {
+	return func(rl *RateLimiter) {
+		rl.writeTimeout = timeout
+	}
+}
+
+// WithMaxHoldTime lets ReapOverdue and RunReaper release every slot acquired longer than maxHold ago,
+// regardless of its ttl, to protect the pool from holders which keep extending forever
+func WithMaxHoldTime(maxHold time.Duration) Option {
+	return func(rl *RateLimiter) {
+		rl.maxHoldTime = maxHold
+	}
+}
+
+// WithSlotContention counts per slot index how often an acquisition found the slot taken, see SlotContention
+// it costs an extra script call per contended acquisition and only covers the default acquisition path,
+// the scripts of WithTokenList, WithActiveSet and the LRUFree policy pick a free slot directly
+func WithSlotContention() Option {
+	return func(rl *RateLimiter) {
+		rl.slotContention = true
+	}
+}
+
+// WithJobIndex keeps a hash mapping every jobID to the index of its slot, written in the same script as the slot,
+// so DeleteJob, ExtendJob and FindJobSlot look the slot up instead of reading all of them
+// it makes every acquisition a script reading the slots and writing the index, and is ignored with
+// WithTokenList, WithActiveSet and the LRUFree policy; a job is expected to hold a single slot,
+// lookups missing the index, e.g. for slots taken by AddJobs, fall back to reading all slots
+func WithJobIndex() Option {
+	return func(rl *RateLimiter) {
+		rl.jobIndex = true
+	}
+}
+
+// WithPause makes every acquisition check the pause flag set by Pause, which costs an extra read per acquisition
+// without it Pause and Resume still set the flag, e.g. from an admin process, but the limiter ignores it
+func WithPause() Option {
+	return func(rl *RateLimiter) {
+		rl.pausable = true
+	}
+}
+
+// WithDryRun grants every acquisition while logging and emitting the dry_run_rejections_total metric
+// for every one the limit would have rejected, e.g. to size the limits from real traffic before enforcing them
+// the slots are taken in a shadow pool "<jobType>-dryrun" instead, so the real pools are not affected;
+// AddJob, AcquireWait, DeleteJob, ClearJobs, ExtendJob, ExtendAll and ExtendJobWithToken work on the shadow pool,
+// operations which cannot grant every acquisition that way, AddJobs, FillSlots, AddJobHint, AcquireOrListHolders,
+// SwapOccupancy, AcquireSlot, CounterLimiter.AddJob and BorrowingGroup.Acquire, return ErrDryRunUnsupported,
+// reads still see the real pools
+func WithDryRun(dryRun bool) Option {
+	return func(rl *RateLimiter) {
+		rl.dryRun = dryRun
+	}
+}
+
+// WithDynamicLimit computes the limit of AddJobDynamic and ListJobsDynamic with fn at call time
+// instead of taking it from the caller, e.g. 5 per node from a node count kept in redis
+// the result is reused for cacheFor to keep fn off the hot path, an error of fn fails the operation
+func WithDynamicLimit(fn DynamicLimitFunc, cacheFor time.Duration) Option {
+	return func(rl *RateLimiter) {
+		rl.dynamicLimit = &dynamicLimit{fn: fn, cacheFor: cacheFor}
+	}
+}
+
+// WithExpvar publishes the stats of every jobType used with the limiter as the expvar name,
+// the count of each operation by result and the utilization after the last acquisition or release
+// the var is registered on the first operation, if name is already taken the stats are not published
+// the stats only cover the operations of this process
+func WithExpvar(name string) Option {
+	return func(rl *RateLimiter) {
+		rl.expvarStats = &expvarStats{name: name, pools: map[string]*expvarPool{}}
+	}
+}
+
+// WithOwnedPersistence enables WithOwnedTracking and mirrors the owned slots into a redis hash
+// keyed by instanceID, so a restarted instance can release the slots its crashed predecessor
+// left behind through RecoverOwned instead of waiting for their ttl
+// instanceID must be stable across restarts and unique among the running instances
+// the hash expires after ttl without changes, so ttl should exceed the longest slot ttl;
+// every acquisition and release costs an additional redis write
+func WithOwnedPersistence(instanceID string, ttl time.Duration) Option {
+	return func(rl *RateLimiter) {
+		if rl.owned == nil {
+			rl.owned = newOwnedSlots()
+		}
+		rl.ownedInstance = instanceID
+		rl.ownedTTL = ttl
+	}
+}
@@ -0,0 +1,44 @@
+package concurrency
+
+import (
+	"context"
+	"time"
+)
+
+// OrphanReport describes a slot held longer than expected
+type OrphanReport struct {
+	SlotKey    string
+	JobID      string
+	AcquiredAt time.Time
+	Age        time.Duration
+}
+
+// DetectOrphans reports the slots held longer than maxAge
+// it only reads the slots, releasing the reported jobs is left to the caller
+// slots written without an acquisition timestamp are never reported
+func (rl *RateLimiter) DetectOrphans(ctx context.Context, jobType string, limit int, maxAge time.Duration) ([]OrphanReport, error) {
+	keys, slots, err := rl.listSlots(ctx, rl.reader(), jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	now := rl.now()
+	var reports []OrphanReport
+	for i, slot := range slots {
+		if slot.JobID == "" || slot.AcquiredAt.IsZero() {
+			continue
+		}
+		age := now.Sub(slot.AcquiredAt)
+		if age <= maxAge {
+			continue
+		}
+		reports = append(reports, OrphanReport{
+			SlotKey:    keys[i],
+			JobID:      slot.JobID,
+			AcquiredAt: slot.AcquiredAt,
+			Age:        age,
+		})
+	}
+
+	return reports, nil
+}
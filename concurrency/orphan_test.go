@@ -0,0 +1,57 @@
+package concurrency_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestDetectOrphansReportsOnlyAgedSlots(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now))
+	defer mr.Close()
+	ctx := context.Background()
+
+	for _, jobID := range []string{"old-1", "old-2"} {
+		if _, err := rl.AddJob("pool", 4, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	acquired := clock.Now()
+	clock.Advance(time.Hour)
+	if _, err := rl.AddJob("pool", 4, "fresh", 0); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+
+	keysBefore := len(mr.Keys())
+	reports, err := rl.DetectOrphans(ctx, "pool", 4, 30*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("DetectOrphans returned %+v, want the two old jobs", reports)
+	}
+	for _, report := range reports {
+		if report.JobID != "old-1" && report.JobID != "old-2" {
+			t.Errorf("DetectOrphans reported %s", report.JobID)
+		}
+		if !report.AcquiredAt.Equal(acquired) {
+			t.Errorf("%s acquired at %v, want %v", report.JobID, report.AcquiredAt, acquired)
+		}
+		if report.Age != time.Hour+time.Minute {
+			t.Errorf("%s has age %v, want 1h1m", report.JobID, report.Age)
+		}
+	}
+
+	// detection only reads
+	if n := occupied(t, rl, "pool", 4); n != 3 || len(mr.Keys()) != keysBefore {
+		t.Errorf("DetectOrphans changed the pool, %d slots occupied", n)
+	}
+
+	if reports, err := rl.DetectOrphans(ctx, "pool", 4, 2*time.Hour); err != nil || len(reports) != 0 {
+		t.Errorf("DetectOrphans with a larger max age returned %+v, %v", reports, err)
+	}
+}
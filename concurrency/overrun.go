@@ -0,0 +1,60 @@
+package concurrency
+
+import (
+	"context"
+	"time"
+)
+
+// expectedDurationKey is the context key of the declared duration of an acquisition
+type expectedDurationKey struct{}
+
+// ContextWithExpectedDuration declares how long the slot acquired with the returned context is needed,
+// it is stored in the slot by every acquisition taking a context and reported by OverrunningJobs
+func ContextWithExpectedDuration(ctx context.Context, expected time.Duration) context.Context {
+	return context.WithValue(ctx, expectedDurationKey{}, expected)
+}
+
+// AddJobExpecting adds a job like AddJob and stores that it expects to hold the slot for expected
+func (rl *RateLimiter) AddJobExpecting(ctx context.Context, jobType string, limit int, jobID string, ttl, expected time.Duration) (string, error) {
+	return rl.addJob(ContextWithExpectedDuration(ctx, expected), jobType, limit, jobID, ttl)
+}
+
+// OverrunReport describes a slot held longer than its holder declared
+type OverrunReport struct {
+	SlotKey          string
+	JobID            string
+	AcquiredAt       time.Time
+	ExpectedDuration time.Duration
+	// Overrun is how much longer than expected the slot has been held
+	Overrun time.Duration
+}
+
+// OverrunningJobs reports the slots held longer than the duration declared on their acquisition
+// slots without a declared duration or an acquisition timestamp are never reported
+func (rl *RateLimiter) OverrunningJobs(ctx context.Context, jobType string, limit int) ([]OverrunReport, error) {
+	keys, slots, err := rl.listSlots(ctx, rl.reader(), jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	now := rl.now()
+	var reports []OverrunReport
+	for i, slot := range slots {
+		if slot.JobID == "" || slot.AcquiredAt.IsZero() || slot.ExpectedDuration <= 0 {
+			continue
+		}
+		overrun := now.Sub(slot.AcquiredAt) - slot.ExpectedDuration
+		if overrun <= 0 {
+			continue
+		}
+		reports = append(reports, OverrunReport{
+			SlotKey:          keys[i],
+			JobID:            slot.JobID,
+			AcquiredAt:       slot.AcquiredAt,
+			ExpectedDuration: slot.ExpectedDuration,
+			Overrun:          overrun,
+		})
+	}
+
+	return reports, nil
+}
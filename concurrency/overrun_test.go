@@ -0,0 +1,51 @@
+package concurrency_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestOverrunningJobs(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now))
+	defer mr.Close()
+	ctx := context.Background()
+
+	start := clock.Now()
+	if _, err := rl.AddJobExpecting(ctx, "pool", 4, "short", 0, 10*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.AddJobExpecting(ctx, "pool", 4, "long", 0, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := rl.AddJobWithToken(concurrency.ContextWithExpectedDuration(ctx, 20*time.Second), "pool", 4, "declared", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.AddJob("pool", 4, "undeclared", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := rl.OverrunningJobs(ctx, "pool", 4)
+	if err != nil || len(reports) != 0 {
+		t.Fatalf("OverrunningJobs right after the acquisitions returned %+v, %v", reports, err)
+	}
+
+	clock.Advance(25 * time.Second)
+	reports, err = rl.OverrunningJobs(ctx, "pool", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	overruns := map[string]time.Duration{}
+	for _, r := range reports {
+		overruns[r.JobID] = r.Overrun
+		if !r.AcquiredAt.Equal(start) {
+			t.Errorf("%s was acquired at %v, want %v", r.JobID, r.AcquiredAt, start)
+		}
+	}
+	if len(overruns) != 2 || overruns["short"] != 15*time.Second || overruns["declared"] != 5*time.Second {
+		t.Errorf("OverrunningJobs returned %+v, want short by 15s and declared by 5s", reports)
+	}
+}
@@ -0,0 +1,183 @@
+package concurrency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ownedCheckInterval is how often WaitIdle checks redis for owned slots which expired
+const ownedCheckInterval = time.Second
+
+// ownedSlots is the in-memory set of the slots taken through this limiter, keyed by slot key
+// persist, if set, is called outside the lock after a slot was added (held) or removed
+type ownedSlots struct {
+	mu      sync.Mutex
+	slots   map[string]string
+	changed chan struct{}
+	persist func(ctx context.Context, slotKey, jobID string, held bool)
+}
+
+func newOwnedSlots() *ownedSlots {
+	return &ownedSlots{
+		slots:   map[string]string{},
+		changed: make(chan struct{}),
+	}
+}
+
+// add records that jobID holds slotKey
+func (o *ownedSlots) add(ctx context.Context, slotKey, jobID string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	o.slots[slotKey] = jobID
+	o.notify()
+	o.mu.Unlock()
+
+	o.persisted(ctx, slotKey, jobID, true)
+}
+
+// remove forgets slotKey if it is still held by jobID
+func (o *ownedSlots) remove(ctx context.Context, slotKey, jobID string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	owned := o.slots[slotKey] == jobID
+	if owned {
+		delete(o.slots, slotKey)
+		o.notify()
+	}
+	o.mu.Unlock()
+
+	if owned {
+		o.persisted(ctx, slotKey, jobID, false)
+	}
+}
+
+// reassign moves slotKey from oldJobID to newJobID if it is owned by oldJobID
+func (o *ownedSlots) reassign(ctx context.Context, slotKey, oldJobID, newJobID string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	owned := o.slots[slotKey] == oldJobID
+	if owned {
+		o.slots[slotKey] = newJobID
+	}
+	o.mu.Unlock()
+
+	if owned {
+		o.persisted(ctx, slotKey, newJobID, true)
+	}
+}
+
+// slotMove is a slot of jobID moved from one key to another
+type slotMove struct {
+	from, to, jobID string
+}
+
+// move records that the owned slots among moves moved to their new keys
+// the moves are applied together, so a job moving into a key another job leaves is not lost
+func (o *ownedSlots) move(ctx context.Context, moves []slotMove) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	var owned []slotMove
+	for _, m := range moves {
+		if o.slots[m.from] == m.jobID {
+			owned = append(owned, m)
+			delete(o.slots, m.from)
+		}
+	}
+	for _, m := range owned {
+		o.slots[m.to] = m.jobID
+	}
+	o.mu.Unlock()
+
+	for _, m := range owned {
+		o.persisted(ctx, m.from, m.jobID, false)
+	}
+	for _, m := range owned {
+		o.persisted(ctx, m.to, m.jobID, true)
+	}
+}
+
+// persisted hands a change to persist if it is set
+func (o *ownedSlots) persisted(ctx context.Context, slotKey, jobID string, held bool) {
+	if o.persist != nil {
+		o.persist(ctx, slotKey, jobID, held)
+	}
+}
+
+// notify wakes up every waiter, the caller holds mu
+func (o *ownedSlots) notify() {
+	close(o.changed)
+	o.changed = make(chan struct{})
+}
+
+// snapshot returns a copy of the owned slots and a channel closed on their next change
+func (o *ownedSlots) snapshot() (map[string]string, <-chan struct{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	slots := make(map[string]string, len(o.slots))
+	for k, v := range o.slots {
+		slots[k] = v
+	}
+
+	return slots, o.changed
+}
+
+// WaitIdle blocks until this limiter holds no slot anymore or ctx is done,
+// e.g. to let a worker finish its jobs before it shuts down
+// a slot counts as held from its acquisition until it is released through this limiter
+// or redis no longer holds it for the same jobID, e.g. because its ttl expired
+// it requires WithOwnedTracking and returns immediately without it
+func (rl *RateLimiter) WaitIdle(ctx context.Context) error {
+	if rl.owned == nil {
+		return nil
+	}
+
+	ticker := time.NewTicker(ownedCheckInterval)
+	defer ticker.Stop()
+	for {
+		slots, changed := rl.owned.snapshot()
+		if len(slots) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-ticker.C:
+			rl.pruneOwned(ctx, slots)
+		}
+	}
+}
+
+// pruneOwned forgets the owned slots which redis no longer holds for their jobID
+func (rl *RateLimiter) pruneOwned(ctx context.Context, slots map[string]string) {
+	keys := make([]string, 0, len(slots))
+	for k := range slots {
+		keys = append(keys, k)
+	}
+	values, err := rl.redisConnector.MGet(ctx, keys)
+	if err == nil {
+		err = checkReplyLength("MGet", len(keys), len(values))
+	}
+	if err != nil {
+		rl.logf("concurrency: checking owned slots failed: %v", err)
+		return
+	}
+
+	for i, value := range values {
+		slot, err := rl.decodeSlot(keys[i], value)
+		if err != nil || slot.JobID != slots[keys[i]] {
+			rl.owned.remove(ctx, keys[i], slots[keys[i]])
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestWaitIdleAfterReleases(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithOwnedTracking())
+	defer mr.Close()
+
+	jobIDs := []string{"a", "b", "c"}
+	for _, jobID := range jobIDs {
+		if _, err := rl.AddJob("pool", 4, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var released int32
+	for i, jobID := range jobIDs {
+		jobID := jobID
+		time.AfterFunc(time.Duration(i+1)*50*time.Millisecond, func() {
+			if _, err := rl.DeleteJob("pool", 4, jobID); err != nil {
+				t.Errorf("DeleteJob: %v", err)
+			}
+			atomic.AddInt32(&released, 1)
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := rl.WaitIdle(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&released); n != int32(len(jobIDs)) {
+		t.Errorf("WaitIdle returned after %d of %d releases", n, len(jobIDs))
+	}
+}
+
+func TestWaitIdleAfterExpiry(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithOwnedTracking())
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 2, "job", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := rl.WaitIdle(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitIdle with a held slot returned %v, want the deadline", err)
+	}
+
+	mr.FastForward(time.Second)
+	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := rl.WaitIdle(ctx); err != nil {
+		t.Errorf("WaitIdle after the slot expired returned %v", err)
+	}
+}
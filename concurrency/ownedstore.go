@@ -0,0 +1,111 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ownedPersistTimeout bounds the write mirroring a change of the owned slots into redis
+const ownedPersistTimeout = time.Second
+
+// persistOwnedScript records or forgets an owned slot in the owned hash of an instance
+// KEYS[1] is the owned hash, ARGV[1] the slot key, ARGV[2] the jobID,
+// ARGV[3] 1 to record and 0 to forget the slot, ARGV[4] the ttl of the hash in milliseconds
+// a slot is only forgotten if it is still recorded for the jobID
+var persistOwnedScript = newScript(`
+if ARGV[3] == '1' then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+elseif redis.call('HGET', KEYS[1], ARGV[1]) == ARGV[2] then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+end
+if tonumber(ARGV[4]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+end
+return 1
+`)
+
+// readOwnedScript returns the owned hash as slot key, jobID pairs
+var readOwnedScript = newScript(`
+return redis.call('HGETALL', KEYS[1])
+`)
+
+// forgetOwnedScript removes the given slot keys from the owned hash if they are still recorded for their jobID
+// ARGV are slot key, jobID pairs
+var forgetOwnedScript = newScript(`
+for i = 1, #ARGV, 2 do
+	if redis.call('HGET', KEYS[1], ARGV[i]) == ARGV[i + 1] then
+		redis.call('HDEL', KEYS[1], ARGV[i])
+	end
+end
+return 1
+`)
+
+// ownedKey returns the key of the owned hash of instanceID
+func ownedKey(instanceID string) string {
+	return fmt.Sprintf("owned-%s", instanceID)
+}
+
+// persistOwned mirrors a change of the owned slots into the owned hash of the instance
+// the write runs under ctx of the operation, bounded by ownedPersistTimeout so a hung redis call
+// does not stall it, a failed write is logged, the in-memory set stays authoritative for the running instance
+func (rl *RateLimiter) persistOwned(ctx context.Context, slotKey, jobID string, held bool) {
+	ctx, cancel := context.WithTimeout(ctx, ownedPersistTimeout)
+	defer cancel()
+	_, err := persistOwnedScript.Run(ctx, rl.redisConnector, []string{ownedKey(rl.ownedInstance)},
+		slotKey, jobID, boolArg(held), ttlMilli(rl.ownedTTL))
+	if err != nil {
+		rl.logf("concurrency: persisting owned slot %s of job %s failed: %v", slotKey, jobID, err)
+	}
+}
+
+// RecoverOwned releases the slots a previous run of this instance recorded through WithOwnedPersistence
+// and did not release, e.g. because it crashed; call it on startup with the same instance ID
+// the slots are released like DeleteJob releases them, ones which expired or were taken by another job
+// in the meantime are left alone and slots held by the current run are kept
+// it returns the number of released slots
+func (rl *RateLimiter) RecoverOwned(ctx context.Context) (released int, err error) {
+	if rl.ownedInstance == "" {
+		return 0, errors.New("RecoverOwned requires WithOwnedPersistence")
+	}
+
+	key := ownedKey(rl.ownedInstance)
+	reply, err := readOwnedScript.Run(ctx, rl.redisConnector, []string{key})
+	if err != nil {
+		return 0, err
+	}
+	pairs, err := toStrings(reply)
+	if err != nil {
+		return 0, err
+	}
+
+	current, _ := rl.owned.snapshot()
+	var forget []interface{}
+	var lastErr error
+	for i := 0; i+1 < len(pairs); i += 2 {
+		slotKey, jobID := pairs[i], pairs[i+1]
+		if current[slotKey] == jobID {
+			continue
+		}
+		ok, err := rl.releaseHeld(ctx, slotKey, jobID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		forget = append(forget, slotKey, jobID)
+		if !ok {
+			continue
+		}
+		rl.logf("concurrency: released slot %s of job %s left over by a previous run of instance %s", slotKey, jobID, rl.ownedInstance)
+		released++
+	}
+
+	if len(forget) > 0 {
+		if _, err := forgetOwnedScript.Run(ctx, rl.redisConnector, []string{key}, forget...); err != nil {
+			lastErr = err
+		}
+	}
+
+	return released, lastErr
+}
@@ -0,0 +1,79 @@
+package concurrency_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestRecoverOwnedAfterRestart(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	crashed := concurrency.NewRateLimiter(newTestConnector(mr), testTTL, concurrency.WithOwnedPersistence("worker-1", time.Hour))
+	for _, jobID := range []string{"a", "b", "c"} {
+		if _, err := crashed.AddJob("pool", 4, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := crashed.DeleteJob("pool", 4, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if got := mr.HGet("owned-worker-1", "pool-0") + mr.HGet("owned-worker-1", "pool-1") + mr.HGet("owned-worker-1", "pool-2"); got != "ab" {
+		t.Errorf("the owned hash records %q, want the held jobs a and b", got)
+	}
+	if ttl := mr.TTL("owned-worker-1"); ttl != time.Hour {
+		t.Errorf("the owned hash has ttl %v, want 1h", ttl)
+	}
+
+	// b expires while the instance is down and another instance takes its slot
+	mr.Del("pool-1")
+	other := concurrency.NewRateLimiter(newTestConnector(mr), testTTL)
+	if _, err := other.AddJob("pool", 4, "other", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := &testLogger{}
+	restarted := concurrency.NewRateLimiter(newTestConnector(mr), testTTL,
+		concurrency.WithOwnedPersistence("worker-1", time.Hour), concurrency.WithLogger(logger))
+	if _, err := restarted.AddJob("pool", 4, "d", 0); err != nil {
+		t.Fatal(err)
+	}
+	released, err := restarted.RecoverOwned(ctx)
+	if err != nil || released != 1 {
+		t.Fatalf("RecoverOwned returned %d, %v, want the slot of a released", released, err)
+	}
+	jobs, err := restarted.ListJobs("pool", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for slotKey, jobID := range map[string]string{"pool-0": "", "pool-1": "other", "pool-2": "d"} {
+		if jobs[slotKey] != jobID {
+			t.Errorf("%s holds %q after the recovery, want %q", slotKey, jobs[slotKey], jobID)
+		}
+	}
+	if fields, err := mr.HKeys("owned-worker-1"); err != nil || strings.Join(fields, ",") != "pool-2" {
+		t.Errorf("the owned hash keeps %v, %v, want only the slot of the current run", fields, err)
+	}
+	if lines := strings.Join(logger.Lines(), "\n"); !strings.Contains(lines, "released slot pool-0 of job a left over by a previous run") {
+		t.Errorf("logged %q, want the recovered slot", lines)
+	}
+
+	if released, err := restarted.RecoverOwned(ctx); err != nil || released != 0 {
+		t.Errorf("a second RecoverOwned returned %d, %v", released, err)
+	}
+	if _, err := restarted.DeleteJob("pool", 4, "d"); err != nil {
+		t.Fatal(err)
+	}
+	if mr.HGet("owned-worker-1", "pool-2") != "" {
+		t.Error("the released slot is still recorded")
+	}
+
+	if _, err := other.RecoverOwned(ctx); err == nil {
+		t.Error("RecoverOwned without WithOwnedPersistence succeeded")
+	}
+}
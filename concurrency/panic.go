@@ -0,0 +1,145 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrConnectorPanic defines the error when a RedisConnector panicked, it wraps the recovered value
+var ErrConnectorPanic = errors.New("connector panic")
+
+// rollbackScript deletes the keys which hold jobID, used to undo a write whose outcome is unknown
+// KEYS are the slot keys, ARGV[1] the jobID
+var rollbackScript = newScript(luaJobID + `
+local deleted = 0
+for _, key in ipairs(KEYS) do
+	if jobid(redis.call('GET', key)) == ARGV[1] then
+		redis.call('DEL', key)
+		deleted = deleted + 1
+	end
+end
+return deleted
+`)
+
+// recoverConnector turns a panic of the connector into an ErrConnectorPanic returned through err
+func recoverConnector(method string, err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("%w in %s: %v", ErrConnectorPanic, method, r)
+	}
+}
+
+// rollback deletes the slots among keys which hold jobID after a write failed with an unknown outcome
+// slots taken by other jobs in the meantime are left alone
+func (rl *RateLimiter) rollback(ctx context.Context, jobID string, keys ...string) {
+	if _, err := rollbackScript.Run(ctx, rl.redisConnector, keys, jobID); err != nil {
+		rl.logf("concurrency: rollback of job %s failed: %v", jobID, err)
+	}
+}
+
+// safeConnector recovers every panic of conn and returns it as ErrConnectorPanic
+// so a faulty connector fails an operation like a backend error instead of crashing it half way
+// it also fails every call with ctx.Err() once ctx is done, without reaching conn
+type safeConnector struct {
+	conn RedisConnector
+}
+
+func (c *safeConnector) MGet(ctx context.Context, keys []string) (_ []string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer recoverConnector("MGet", &err)
+
+	return c.conn.MGet(ctx, keys)
+}
+
+func (c *safeConnector) Get(ctx context.Context, key string) (_ string, err error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	defer recoverConnector("Get", &err)
+
+	return c.conn.Get(ctx, key)
+}
+
+func (c *safeConnector) Del(ctx context.Context, keys ...string) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer recoverConnector("Del", &err)
+
+	return c.conn.Del(ctx, keys...)
+}
+
+func (c *safeConnector) Set(ctx context.Context, key string, value string, ttl time.Duration) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer recoverConnector("Set", &err)
+
+	return c.conn.Set(ctx, key, value, ttl)
+}
+
+func (c *safeConnector) PTTL(ctx context.Context, keys []string) (_ []time.Duration, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer recoverConnector("PTTL", &err)
+
+	return c.conn.PTTL(ctx, keys)
+}
+
+func (c *safeConnector) BLPop(ctx context.Context, timeout time.Duration, keys ...string) (_ []string, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer recoverConnector("BLPop", &err)
+
+	return c.conn.BLPop(ctx, timeout, keys...)
+}
+
+func (c *safeConnector) RPush(ctx context.Context, key string, values ...string) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer recoverConnector("RPush", &err)
+
+	return c.conn.RPush(ctx, key, values...)
+}
+
+func (c *safeConnector) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer recoverConnector("XAdd", &err)
+
+	return c.conn.XAdd(ctx, stream, maxLen, values)
+}
+
+func (c *safeConnector) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (_ interface{}, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer recoverConnector("Eval", &err)
+
+	return c.conn.Eval(ctx, script, keys, args...)
+}
+
+func (c *safeConnector) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (_ interface{}, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer recoverConnector("EvalSha", &err)
+
+	return c.conn.EvalSha(ctx, sha, keys, args...)
+}
+
+func (c *safeConnector) ScriptLoad(ctx context.Context, script string) (_ string, err error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	defer recoverConnector("ScriptLoad", &err)
+
+	return c.conn.ScriptLoad(ctx, script)
+}
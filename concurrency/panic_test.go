@@ -0,0 +1,118 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+	"github.com/y4h2/golang-concurrency-limit/concurrency/concurrencytest"
+)
+
+// panickingConnector panics once in the given method, after the call reached redis if late is set
+type panickingConnector struct {
+	concurrency.RedisConnector
+	method   string
+	late     bool
+	panicked int32
+}
+
+func (c *panickingConnector) maybePanic(method string) {
+	if method == c.method && atomic.CompareAndSwapInt32(&c.panicked, 0, 1) {
+		panic("nil map in " + method)
+	}
+}
+
+func (c *panickingConnector) MGet(ctx context.Context, keys []string) ([]string, error) {
+	c.maybePanic("MGet")
+	return c.RedisConnector.MGet(ctx, keys)
+}
+
+func (c *panickingConnector) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	if !c.late {
+		c.maybePanic("EvalSha")
+	}
+	reply, err := c.RedisConnector.EvalSha(ctx, sha, keys, args...)
+	if c.late {
+		c.maybePanic("EvalSha")
+	}
+	return reply, err
+}
+
+func TestConnectorPanicIsReturned(t *testing.T) {
+	for _, conn := range []*panickingConnector{
+		{method: "MGet"},
+		{method: "EvalSha"},
+		// the slot was written before the panic, it has to be rolled back
+		{method: "EvalSha", late: true},
+	} {
+		mr := newTestRedis(t)
+		conn.RedisConnector = newTestConnector(mr)
+		rl := concurrency.NewRateLimiter(conn, testTTL)
+		// load the scripts so the acquisition does not start with a NOSCRIPT reply
+		if err := rl.LoadScripts(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := rl.AddJob("pool", 2, "job", 0)
+		if !errors.Is(err, concurrency.ErrConnectorPanic) || !strings.Contains(err.Error(), "nil map in "+conn.method) {
+			t.Errorf("AddJob with a connector panicking in %s (late %v) returned %v, want ErrConnectorPanic",
+				conn.method, conn.late, err)
+		}
+		if n := occupied(t, rl, "pool", 2); n != 0 {
+			t.Errorf("%d slots leaked by a connector panicking in %s (late %v)", n, conn.method, conn.late)
+		}
+		mr.Close()
+	}
+}
+
+func TestDoneContextFailsFast(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(newTestConnector(mr))
+	rl := concurrency.NewRateLimiter(conn, testTTL, concurrency.WithCircuitBreaker(1, time.Minute))
+	if _, err := rl.AddJob("pool", 2, "held", 0); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	before := len(conn.Trace())
+	calls := map[string]func() error{
+		"AddJobs": func() error {
+			_, err := rl.AddJobs(ctx, "pool", 2, []string{"a"}, 0)
+			return err
+		},
+		"ExtendJob": func() error {
+			return rl.ExtendJob(ctx, "pool", 2, "held", 0)
+		},
+		"CanAcquire": func() error {
+			_, err := rl.CanAcquire(ctx, "pool", 2)
+			return err
+		},
+		"FindJobSlot": func() error {
+			_, err := rl.FindJobSlot(ctx, "pool", 2, "held")
+			return err
+		},
+		"ListJobsWithTTL": func() error {
+			_, err := rl.ListJobsWithTTL(ctx, "pool", 2)
+			return err
+		},
+	}
+	for name, call := range calls {
+		if err := call(); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s with a cancelled context returned %v, want context.Canceled", name, err)
+		}
+	}
+	if trace := conn.Trace()[before:]; len(trace) != 0 {
+		t.Errorf("the cancelled calls reached the connector: %v", trace)
+	}
+
+	// the cancelled calls did not open the breaker
+	if _, err := rl.AddJob("pool", 2, "b", 0); err != nil {
+		t.Errorf("AddJob after the cancelled calls returned %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// listSlotsPartial reads the slots of jobType like listSlots, but if the batched read fails
+// it reads every slot on its own, so one unreachable node only costs the slots it serves
+// errs holds the read error of every slot, a slot with an error is reported as free
+func (rl *RateLimiter) listSlotsPartial(ctx context.Context, conn RedisConnector, jobType string, limit int) ([]string, []SlotValue, []error, error) {
+	keys, slots, err := rl.listSlots(ctx, conn, jobType, limit)
+	if err == nil || !rl.partialReads {
+		return keys, slots, make([]error, len(slots)), err
+	}
+
+	keys, err = rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	slots = make([]SlotValue, len(keys))
+	errs := make([]error, len(keys))
+	failed := 0
+	for i, key := range keys {
+		value, err := conn.Get(ctx, key)
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			errs[i] = fmt.Errorf("slot %s: %w", key, err)
+			failed++
+			continue
+		}
+		if slots[i], err = rl.decodeSlot(key, value); err != nil {
+			errs[i] = err
+			failed++
+		}
+	}
+	if failed == len(keys) && failed > 0 {
+		return nil, nil, nil, errs[0]
+	}
+
+	return keys, slots, errs, nil
+}
+
+// pttlPartial reads the ttls of keys like PTTL, falling back to one call per key if the batch fails
+func (rl *RateLimiter) pttlPartial(ctx context.Context, conn RedisConnector, keys []string) ([]time.Duration, []error, error) {
+	ttls, err := conn.PTTL(ctx, keys)
+	if err == nil {
+		err = checkReplyLength("PTTL", len(keys), len(ttls))
+	}
+	if err == nil || !rl.partialReads {
+		return ttls, make([]error, len(keys)), err
+	}
+
+	ttls = make([]time.Duration, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		ttl, err := conn.PTTL(ctx, []string{key})
+		if err == nil {
+			err = checkReplyLength("PTTL", 1, len(ttl))
+		}
+		if err != nil {
+			errs[i] = fmt.Errorf("slot %s: %w", key, err)
+			continue
+		}
+		ttls[i] = ttl[0]
+	}
+
+	return ttls, errs, nil
+}
@@ -0,0 +1,107 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// errNodeDown is returned for the keys served by the failed node of clusterConnector
+var errNodeDown = errors.New("CLUSTERDOWN node down")
+
+// clusterConnector fails every read touching one of the down keys, like a cluster with a failed node
+type clusterConnector struct {
+	concurrency.RedisConnector
+	down map[string]bool
+}
+
+func (c *clusterConnector) anyDown(keys []string) bool {
+	for _, key := range keys {
+		if c.down[key] {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *clusterConnector) MGet(ctx context.Context, keys []string) ([]string, error) {
+	if c.anyDown(keys) {
+		return nil, errNodeDown
+	}
+	return c.RedisConnector.MGet(ctx, keys)
+}
+
+func (c *clusterConnector) Get(ctx context.Context, key string) (string, error) {
+	if c.down[key] {
+		return "", errNodeDown
+	}
+	return c.RedisConnector.Get(ctx, key)
+}
+
+func (c *clusterConnector) PTTL(ctx context.Context, keys []string) ([]time.Duration, error) {
+	if c.anyDown(keys) {
+		return nil, errNodeDown
+	}
+	return c.RedisConnector.PTTL(ctx, keys)
+}
+
+func TestPartialReads(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	writer := concurrency.NewRateLimiter(newTestConnector(mr), testTTL)
+	for _, jobID := range []string{"a", "b", "c"} {
+		if _, err := writer.AddJob("pool", 4, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conn := &clusterConnector{RedisConnector: newTestConnector(mr), down: map[string]bool{"pool-1": true}}
+	ctx := context.Background()
+
+	rl := concurrency.NewRateLimiter(conn, testTTL)
+	if _, err := rl.ListJobs("pool", 4); !errors.Is(err, errNodeDown) {
+		t.Errorf("ListJobs without partial reads returned %v, want the node error", err)
+	}
+
+	rl = concurrency.NewRateLimiter(conn, testTTL, concurrency.WithPartialReads())
+	jobs, err := rl.ListJobs("pool", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 || jobs["pool-0"] != "a" || jobs["pool-2"] != "c" || jobs["pool-3"] != "" {
+		t.Errorf("ListJobs returned %v, want the readable slots", jobs)
+	}
+	if _, ok := jobs["pool-1"]; ok {
+		t.Error("ListJobs returned the unreadable slot")
+	}
+
+	infos, err := rl.ListJobsWithTTL(ctx, "pool", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 {
+		t.Fatalf("ListJobsWithTTL returned %+v, want two jobs and the unreadable slot", infos)
+	}
+	for _, info := range infos {
+		switch info.SlotKey {
+		case "pool-1":
+			if !errors.Is(info.Err, errNodeDown) || info.JobID != "" {
+				t.Errorf("the unreadable slot is %+v, want only its error", info)
+			}
+		case "pool-0", "pool-2":
+			if info.Err != nil || info.JobID == "" || info.TTL != testTTL {
+				t.Errorf("the readable slot is %+v", info)
+			}
+		default:
+			t.Errorf("ListJobsWithTTL returned %+v", info)
+		}
+	}
+
+	// every slot unreadable still fails
+	conn.down = map[string]bool{"pool-0": true, "pool-1": true, "pool-2": true, "pool-3": true}
+	if _, err := rl.ListJobs("pool", 4); !errors.Is(err, errNodeDown) {
+		t.Errorf("ListJobs with every slot unreadable returned %v, want the node error", err)
+	}
+}
@@ -0,0 +1,67 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// PausedError defines the error when a jobType is paused by Pause
+type PausedError struct {
+	Reason string
+	Since  time.Time
+}
+
+func (e *PausedError) Error() string {
+	return fmt.Sprintf("job type paused since %s: %s", e.Since.Format(time.RFC3339), e.Reason)
+}
+
+// pauseKey returns the key of the pause flag of jobType
+func pauseKey(jobType string) string {
+	return fmt.Sprintf("%s-paused", jobType)
+}
+
+// Pause stops every acquisition of jobType until Resume is called, in every process created WithPause
+// acquisitions fail with a *PausedError carrying reason, jobs holding a slot are not affected
+// pausing an already paused jobType replaces the reason and the time
+func (rl *RateLimiter) Pause(ctx context.Context, jobType, reason string) error {
+	value := strconv.FormatInt(unixMilli(rl.now()), 10) + slotSeparator + reason
+
+	return rl.redisConnector.Set(ctx, pauseKey(jobType), value, 0)
+}
+
+// Resume lets acquisitions of jobType succeed again after Pause
+func (rl *RateLimiter) Resume(ctx context.Context, jobType string) error {
+	return rl.redisConnector.Del(ctx, pauseKey(jobType))
+}
+
+// checkPaused returns a *PausedError if jobType is paused, it is a no-op without WithPause
+func (rl *RateLimiter) checkPaused(ctx context.Context, jobType string) error {
+	if !rl.pausable {
+		return nil
+	}
+
+	value, err := rl.redisConnector.Get(ctx, pauseKey(jobType))
+	if errors.Is(err, redis.Nil) || (err == nil && value == "") {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	parts := strings.SplitN(value, slotSeparator, 2)
+	paused := &PausedError{}
+	if ms, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
+		paused.Since = fromUnixMilli(ms)
+	}
+	if len(parts) == 2 {
+		paused.Reason = parts[1]
+	}
+
+	return paused
+}
@@ -0,0 +1,76 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+	"github.com/y4h2/golang-concurrency-limit/concurrency/concurrencytest"
+)
+
+func TestPauseAndResume(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now), concurrency.WithPause())
+	defer mr.Close()
+	ctx := context.Background()
+
+	if _, err := rl.AddJob("pool", 2, "running", 0); err != nil {
+		t.Fatal(err)
+	}
+	paused := clock.Now()
+	if err := rl.Pause(ctx, "pool", "incident 42: payment provider down"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+
+	// every instance sees the pause
+	other := concurrency.NewRateLimiter(newTestConnector(mr), testTTL, concurrency.WithPause())
+	for _, limiter := range []*concurrency.RateLimiter{rl, other} {
+		_, err := limiter.AddJob("pool", 2, "new", 0)
+		var pausedErr *concurrency.PausedError
+		if !errors.As(err, &pausedErr) {
+			t.Fatalf("AddJob while paused returned %v, want a *PausedError", err)
+		}
+		if pausedErr.Reason != "incident 42: payment provider down" || !pausedErr.Since.Equal(paused) {
+			t.Errorf("AddJob while paused returned %+v", pausedErr)
+		}
+	}
+	// holders are not affected
+	if ok, err := rl.DeleteJob("pool", 2, "running"); err != nil || !ok {
+		t.Errorf("DeleteJob while paused returned %v, %v", ok, err)
+	}
+	// other jobTypes are not affected
+	if _, err := rl.AddJob("other", 2, "new", 0); err != nil {
+		t.Errorf("AddJob of another jobType returned %v", err)
+	}
+
+	if err := rl.Resume(ctx, "pool"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.AddJob("pool", 2, "new", 0); err != nil {
+		t.Errorf("AddJob after Resume returned %v", err)
+	}
+}
+
+func TestPauseIgnoredWithoutWithPause(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(newTestConnector(mr))
+	rl := concurrency.NewRateLimiter(conn, testTTL)
+	ctx := context.Background()
+
+	if err := rl.Pause(ctx, "pool", "maintenance"); err != nil {
+		t.Fatal(err)
+	}
+	before := len(conn.Trace())
+	if _, err := rl.AddJob("pool", 2, "new", 0); err != nil {
+		t.Errorf("AddJob without WithPause returned %v", err)
+	}
+	for _, call := range conn.Trace()[before:] {
+		if call.Method == "Get" {
+			t.Errorf("AddJob without WithPause read the pause flag: %v", call)
+		}
+	}
+}
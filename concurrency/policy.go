@@ -0,0 +1,115 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AcquirePolicy selects which free slot AddJob takes
+type AcquirePolicy int
+
+const (
+	// LowestIndex takes the free slot with the lowest index, or a random one with WithRandomProbe
+	LowestIndex AcquirePolicy = iota
+	// LRUFree takes the slot which has been free the longest, see WithAcquirePolicy
+	LRUFree
+)
+
+// acquireLRUScript writes the value into the free slot with the oldest free time
+// and stamps it with the current time, slots never used count as freed at time zero
+// it returns {key, occupied before, fencing token} or {false, occupied}
+// KEYS[1] is the free time sorted set, KEYS[2] the counters hash, KEYS[3] the fencing token counter, KEYS[4..] the slot keys
+// ARGV[1] is the value, ARGV[2] the ttl in milliseconds, ARGV[3] the current time, ARGV[4] 1 to update the counters
+var acquireLRUScript = newScript(luaJobID + luaSlotFields + luaFence + `
+local best, bestScore
+local occupied = 0
+for i = 4, #KEYS do
+	local v = redis.call('GET', KEYS[i])
+	if not v or v == '' then
+		local score = tonumber(redis.call('ZSCORE', KEYS[1], KEYS[i]) or '0')
+		if not best or score < bestScore then
+			best, bestScore = KEYS[i], score
+		end
+	else
+		occupied = occupied + 1
+	end
+end
+if not best then
+	if ARGV[4] == '1' then
+		redis.call('HINCRBY', KEYS[2], 'rejections', 1)
+	end
+	return {false, occupied}
+end
+local value, token = fence(ARGV[1], KEYS[3])
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('SET', best, value, 'PX', ttl)
+else
+	redis.call('SET', best, value)
+end
+redis.call('ZADD', KEYS[1], ARGV[3], best)
+if ARGV[4] == '1' then
+	redis.call('HINCRBY', KEYS[2], 'grants', 1)
+end
+return {best, occupied, token}
+`)
+
+// markFreedScript stamps the free time of the given slots
+// KEYS[1] is the free time sorted set, KEYS[2..] the freed slot keys, ARGV[1] the current time
+var markFreedScript = newScript(`
+for i = 2, #KEYS do
+	redis.call('ZADD', KEYS[1], ARGV[1], KEYS[i])
+end
+return #KEYS - 1
+`)
+
+// freedKey returns the key of the sorted set holding the free time of every slot of jobType
+func freedKey(jobType string) string {
+	return fmt.Sprintf("%s-freed", jobType)
+}
+
+// acquireLRU takes the slot of jobType which has been free the longest for value
+// it returns the slot key, the fencing token and the number of slots occupied before
+func (rl *RateLimiter) acquireLRU(ctx context.Context, jobType string, limit int, value string, ttl time.Duration) (string, int64, int, error) {
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	keys := append([]string{freedKey(jobType), countersKey(jobType), fenceKey(jobType)}, slotKeys...)
+	reply, err := acquireLRUScript.Run(ctx, rl.redisConnector, keys,
+		value, ttlMilli(ttl), unixMilli(rl.now()), boolArg(rl.persistentCounters))
+	if err != nil {
+		return "", 0, 0, err
+	}
+	items, ok := reply.([]interface{})
+	if !ok || len(items) < 2 {
+		return "", 0, 0, fmt.Errorf("unexpected script reply %v", reply)
+	}
+	occupied, err := toInt64(items[1])
+	if err != nil {
+		return "", 0, 0, err
+	}
+	slotKey, ok := items[0].(string)
+	if !ok {
+		return "", 0, int(occupied), ErrNoSlot
+	}
+	if len(items) != 3 {
+		return "", 0, 0, fmt.Errorf("unexpected script reply %v", reply)
+	}
+	token, err := toInt64(items[2])
+
+	return slotKey, token, int(occupied), err
+}
+
+// markFreed stamps the free time of slots released through the limiter for LRUFree
+// a slot which expires keeps the time it was acquired at
+func (rl *RateLimiter) markFreed(ctx context.Context, jobType string, slotKeys []string) {
+	if rl.acquirePolicy != LRUFree || len(slotKeys) == 0 {
+		return
+	}
+	keys := append([]string{freedKey(jobType)}, slotKeys...)
+	if _, err := markFreedScript.Run(ctx, rl.redisConnector, keys, unixMilli(rl.now())); err != nil {
+		rl.logf("concurrency: stamping freed slots of %s failed: %v", jobType, err)
+	}
+}
@@ -0,0 +1,44 @@
+package concurrency_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestLRUFreeTakesOldestFreedSlot(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now), concurrency.WithAcquirePolicy(concurrency.LRUFree))
+	defer mr.Close()
+	ctx := context.Background()
+
+	for _, jobID := range []string{"a", "b", "c", "d"} {
+		clock.Advance(time.Second)
+		if _, err := rl.AddJob("pool", 5, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the never used slot counts as the oldest freed one
+	if key, err := rl.FindJobSlot(ctx, "pool", 5, "d"); err != nil || key != "pool-3" {
+		t.Fatalf("d took %q (%v), want pool-3", key, err)
+	}
+
+	for _, jobID := range []string{"c", "a", "d"} {
+		clock.Advance(time.Second)
+		if _, err := rl.DeleteJob("pool", 5, jobID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []string{"pool-4", "pool-2", "pool-0", "pool-3"} {
+		clock.Advance(time.Second)
+		jobID := "new-" + want
+		if _, err := rl.AddJob("pool", 5, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+		if key, err := rl.FindJobSlot(ctx, "pool", 5, jobID); err != nil || key != want {
+			t.Errorf("the acquisition took %q (%v), want the oldest freed slot %s", key, err, want)
+		}
+	}
+}
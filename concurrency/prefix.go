@@ -0,0 +1,34 @@
+package concurrency
+
+import (
+	"context"
+	"time"
+)
+
+// prefixedJobType returns the jobType namespaced by prefix
+// every key of a jobType is derived from it, so slots, active set, counters and tokens
+// of the same jobType under different prefixes never overlap
+func prefixedJobType(prefix, jobType string) string {
+	if prefix == "" {
+		return jobType
+	}
+
+	return prefix + ":" + jobType
+}
+
+// AddJobIn adds a job to jobType in the namespace of prefix, see AddJob
+// an empty prefix is the same as AddJob
+func (rl *RateLimiter) AddJobIn(ctx context.Context, prefix, jobType string, limit int, jobID string, ttl time.Duration) (string, error) {
+	return rl.addJob(ctx, prefixedJobType(prefix, jobType), limit, jobID, ttl)
+}
+
+// ListJobsIn lists the jobs of jobType in the namespace of prefix, see ListJobs
+// the slot keys of the result contain the prefix
+func (rl *RateLimiter) ListJobsIn(ctx context.Context, prefix, jobType string, limit int) (map[string]string, error) {
+	return rl.listJobs(ctx, rl.reader(), prefixedJobType(prefix, jobType), limit)
+}
+
+// DeleteJobIn deletes a job of jobType in the namespace of prefix, see DeleteJob
+func (rl *RateLimiter) DeleteJobIn(ctx context.Context, prefix, jobType string, limit int, jobID string) (bool, error) {
+	return rl.deleteJob(ctx, prefixedJobType(prefix, jobType), limit, jobID)
+}
@@ -0,0 +1,44 @@
+package concurrency_test
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPerCallPrefixesAreIsolated(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	// the same jobID fills a pool of one in every namespace
+	for _, prefix := range []string{"a", "b", ""} {
+		if _, err := rl.AddJobIn(ctx, prefix, "pool", 1, "job", 0); err != nil {
+			t.Fatalf("AddJobIn %q: %v", prefix, err)
+		}
+	}
+	if _, err := rl.AddJobIn(ctx, "a", "pool", 1, "other", 0); err == nil {
+		t.Error("AddJobIn got a slot of the full pool of prefix a")
+	}
+
+	jobs, err := rl.ListJobsIn(ctx, "a", "pool", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs["a:pool-0"] != "job" {
+		t.Errorf("ListJobsIn a returned %v", jobs)
+	}
+
+	if ok, err := rl.DeleteJobIn(ctx, "a", "pool", 1, "job"); err != nil || !ok {
+		t.Fatalf("DeleteJobIn a returned %v, %v", ok, err)
+	}
+	if jobs, err := rl.ListJobsIn(ctx, "a", "pool", 1); err != nil || jobs["a:pool-0"] != "" {
+		t.Errorf("ListJobsIn a returned %v, %v after the delete", jobs, err)
+	}
+	if jobs, err := rl.ListJobsIn(ctx, "b", "pool", 1); err != nil || jobs["b:pool-0"] != "job" {
+		t.Errorf("ListJobsIn b returned %v, %v, want the job kept", jobs, err)
+	}
+	// an empty prefix is the pool of AddJob
+	if jobs, err := rl.ListJobs("pool", 1); err != nil || jobs["pool-0"] != "job" {
+		t.Errorf("ListJobs returned %v, %v, want the job kept", jobs, err)
+	}
+}
@@ -0,0 +1,178 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrQueueFull defines the error when the wait queue of a jobType is full
+var ErrQueueFull = errors.New("queue is full")
+
+// ErrDroppedFromQueue defines the error when a waiter lost its place in the wait queue,
+// e.g. because it missed its heartbeats for too long and was pruned as stale
+var ErrDroppedFromQueue = errors.New("dropped from queue")
+
+const defaultPollInterval = 100 * time.Millisecond
+
+// queueStaleIntervals is the number of missed polls after which a waiter is dropped from the queue
+const queueStaleIntervals = 10
+
+// enqueueScript appends a ticket to the queue unless the queue already holds max tickets
+// KEYS[1] is the queue list, KEYS[2] the heartbeat sorted set
+// ARGV[1] ticket, ARGV[2] max (0 means unbounded), ARGV[3] now, ARGV[4] stale before, ARGV[5] key ttl
+var enqueueScript = newScript(`
+local stale = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', '(' .. ARGV[4])
+for _, t in ipairs(stale) do
+	redis.call('LREM', KEYS[1], 0, t)
+	redis.call('ZREM', KEYS[2], t)
+end
+local max = tonumber(ARGV[2])
+if max > 0 and redis.call('LLEN', KEYS[1]) >= max then
+	return 0
+end
+redis.call('RPUSH', KEYS[1], ARGV[1])
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+redis.call('PEXPIRE', KEYS[2], ARGV[5])
+return 1
+`)
+
+// headScript refreshes the heartbeat of a ticket and reports whether it is the head of the queue
+// it returns 1 for the head, 0 for a waiting ticket and -1 if the ticket was dropped
+// KEYS and ARGV are the same as enqueueScript without the max
+var headScript = newScript(`
+if not redis.call('ZSCORE', KEYS[2], ARGV[1]) then
+	return -1
+end
+redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+local stale = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', '(' .. ARGV[3])
+for _, t in ipairs(stale) do
+	redis.call('LREM', KEYS[1], 0, t)
+	redis.call('ZREM', KEYS[2], t)
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+redis.call('PEXPIRE', KEYS[2], ARGV[4])
+if redis.call('LINDEX', KEYS[1], 0) == ARGV[1] then
+	return 1
+end
+return 0
+`)
+
+// dequeueScript removes a ticket from the queue
+var dequeueScript = newScript(`
+redis.call('LREM', KEYS[1], 0, ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+return 1
+`)
+
+// QueuedLimiter grants the slots of a RateLimiter in FIFO order
+// waiting callers are kept in a redis list per jobType, so the order holds across processes
+type QueuedLimiter struct {
+	rl           *RateLimiter
+	pollInterval time.Duration
+	maxQueue     int
+}
+
+// QueueOption configures a QueuedLimiter
+type QueueOption func(*QueuedLimiter)
+
+// WithPollInterval sets how often a waiting caller checks its position and the slots
+func WithPollInterval(d time.Duration) QueueOption {
+	return func(q *QueuedLimiter) {
+		q.pollInterval = d
+	}
+}
+
+// WithMaxQueue bounds the number of waiting callers per jobType
+// once n callers are waiting, AcquireFIFO returns ErrQueueFull immediately
+func WithMaxQueue(n int) QueueOption {
+	return func(q *QueuedLimiter) {
+		q.maxQueue = n
+	}
+}
+
+// NewQueuedLimiter is the constructor of QueuedLimiter
+func NewQueuedLimiter(rl *RateLimiter, opts ...QueueOption) *QueuedLimiter {
+	q := &QueuedLimiter{
+		rl:           rl,
+		pollInterval: defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	return q
+}
+
+// queueKeys returns the queue list key and the heartbeat key of jobType
+func (q *QueuedLimiter) queueKeys(jobType string) []string {
+	return []string{
+		fmt.Sprintf("%s-queue", jobType),
+		fmt.Sprintf("%s-queue-heartbeat", jobType),
+	}
+}
+
+// AcquireFIFO waits in line until a slot is available and takes it
+// callers are served in arrival order, a caller only tries to take a slot once it is the head of the queue
+// it returns ErrQueueFull without waiting if the queue is bounded and full,
+// and ErrDroppedFromQueue if the caller was pruned from the queue while waiting
+// the heartbeats use the limiter's clock, see WithClock
+func (q *QueuedLimiter) AcquireFIFO(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) (string, error) {
+	conn := q.rl.redisConnector
+	keys := q.queueKeys(jobType)
+	staleAfter := queueStaleIntervals * q.pollInterval
+	ticket, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+
+	now := q.rl.now()
+	reply, err := enqueueScript.Run(ctx, conn, keys,
+		ticket, q.maxQueue, unixMilli(now), unixMilli(now.Add(-staleAfter)), staleAfter.Milliseconds())
+	if err != nil {
+		return "", err
+	}
+	if n, err := toInt64(reply); err != nil {
+		return "", err
+	} else if n == 0 {
+		return "", ErrQueueFull
+	}
+	defer dequeueScript.Run(context.Background(), conn, keys, ticket)
+
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+	for {
+		now := q.rl.now()
+		reply, err := headScript.Run(ctx, conn, keys,
+			ticket, unixMilli(now), unixMilli(now.Add(-staleAfter)), staleAfter.Milliseconds())
+		if err != nil {
+			return "", err
+		}
+		position, err := toInt64(reply)
+		if err != nil {
+			return "", err
+		}
+		if position < 0 {
+			return "", ErrDroppedFromQueue
+		}
+		if position == 1 {
+			id, err := q.rl.addJob(ctx, jobType, limit, jobID, ttl)
+			if !errors.Is(err, ErrNoSlot) {
+				return id, err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// unixMilli returns t as milliseconds since the unix epoch
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
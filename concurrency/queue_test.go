@@ -0,0 +1,103 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// waitQueued waits until the queue of jobType holds n tickets and returns them
+func waitQueued(t *testing.T, mr *miniredis.Miniredis, jobType string, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if tickets, _ := mr.List(jobType + "-queue"); len(tickets) == n {
+			return tickets
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("the queue of %s never held %d tickets", jobType, n)
+	return nil
+}
+
+func TestAcquireFIFORejectsWhenQueueFull(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now))
+	defer mr.Close()
+	q := concurrency.NewQueuedLimiter(rl, concurrency.WithMaxQueue(1), concurrency.WithPollInterval(10*time.Millisecond))
+
+	if _, err := rl.AddJob("pool", 1, "holder", 0); err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		id  string
+		err error
+	}
+	waiter := make(chan result, 1)
+	go func() {
+		id, err := q.AcquireFIFO(context.Background(), "pool", 1, "waiter", 0)
+		waiter <- result{id, err}
+	}()
+	tickets := waitQueued(t, mr, "pool", 1)
+
+	// the heartbeat is stamped with the limiter clock
+	score, err := mr.ZScore("pool-queue-heartbeat", tickets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := float64(clock.Now().UnixNano() / int64(time.Millisecond)); score != want {
+		t.Errorf("heartbeat %v, want the fake clock %v", score, want)
+	}
+
+	start := time.Now()
+	_, err = q.AcquireFIFO(context.Background(), "pool", 1, "rejected", 0)
+	if !errors.Is(err, concurrency.ErrQueueFull) {
+		t.Fatalf("AcquireFIFO on a full queue returned %v, want ErrQueueFull", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the rejection took %v, want it immediately", elapsed)
+	}
+
+	if _, err := rl.DeleteJob("pool", 1, "holder"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-waiter:
+		if r.err != nil || r.id != "waiter" {
+			t.Errorf("the waiter got %q, %v", r.id, r.err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the waiter did not get the freed slot")
+	}
+}
+
+func TestAcquireFIFODroppedFromQueue(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	q := concurrency.NewQueuedLimiter(rl, concurrency.WithPollInterval(10*time.Millisecond))
+
+	if _, err := rl.AddJob("pool", 1, "holder", 0); err != nil {
+		t.Fatal(err)
+	}
+	waiter := make(chan error, 1)
+	go func() {
+		_, err := q.AcquireFIFO(context.Background(), "pool", 1, "waiter", 0)
+		waiter <- err
+	}()
+	tickets := waitQueued(t, mr, "pool", 1)
+
+	// pruning the heartbeat is what happens to a waiter considered stale
+	mr.ZRem("pool-queue-heartbeat", tickets[0])
+	select {
+	case err := <-waiter:
+		if !errors.Is(err, concurrency.ErrDroppedFromQueue) {
+			t.Errorf("AcquireFIFO returned %v, want ErrDroppedFromQueue", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the dropped waiter kept waiting")
+	}
+}
@@ -0,0 +1,85 @@
+package concurrency
+
+import (
+	"sync"
+	"time"
+)
+
+// readCache keeps ListJobs results in process for a short ttl, see WithReadCache
+type readCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu          sync.Mutex
+	entries     map[string]map[int]cachedJobs
+	generations map[string]uint64
+}
+
+type cachedJobs struct {
+	jobs map[string]string
+	at   time.Time
+}
+
+func newReadCache(ttl time.Duration) *readCache {
+	return &readCache{
+		ttl:         ttl,
+		entries:     map[string]map[int]cachedJobs{},
+		generations: map[string]uint64{},
+	}
+}
+
+// get returns a copy of the cached jobs of jobType if they are younger than the ttl,
+// otherwise the generation to pass to put once the jobs were read
+func (c *readCache) get(jobType string, limit int) (map[string]string, uint64, bool) {
+	if c == nil {
+		return nil, 0, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[jobType][limit]
+	if !ok || c.now().Sub(entry.at) >= c.ttl {
+		return nil, c.generations[jobType], false
+	}
+
+	return copyJobs(entry.jobs), 0, true
+}
+
+// put caches jobs unless jobType was invalidated since generation was returned by get,
+// so a read racing with a local write never caches the state from before the write
+func (c *readCache) put(jobType string, limit int, generation uint64, jobs map[string]string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations[jobType] != generation {
+		return
+	}
+	if c.entries[jobType] == nil {
+		c.entries[jobType] = map[int]cachedJobs{}
+	}
+	c.entries[jobType][limit] = cachedJobs{jobs: copyJobs(jobs), at: c.now()}
+}
+
+// invalidate drops the cached jobs of jobType
+func (c *readCache) invalidate(jobType string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, jobType)
+	c.generations[jobType]++
+}
+
+func copyJobs(jobs map[string]string) map[string]string {
+	result := make(map[string]string, len(jobs))
+	for k, v := range jobs {
+		result[k] = v
+	}
+
+	return result
+}
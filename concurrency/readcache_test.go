@@ -0,0 +1,92 @@
+package concurrency_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+	"github.com/y4h2/golang-concurrency-limit/concurrency/concurrencytest"
+)
+
+func TestReadCache(t *testing.T) {
+	clock := newFakeClock()
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(newTestConnector(mr))
+	rl := concurrency.NewRateLimiter(conn, testTTL, concurrency.WithClock(clock.Now), concurrency.WithReadCache(time.Second))
+
+	if _, err := rl.AddJob("pool", 2, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	listJobs := func() (string, int) {
+		t.Helper()
+		before := len(conn.Trace())
+		jobs, err := rl.ListJobs("pool", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprint(jobs), len(conn.Trace()) - before
+	}
+
+	if jobs, calls := listJobs(); jobs != "map[pool-0:a pool-1:]" || calls != 1 {
+		t.Fatalf("the first ListJobs returned %s with %d calls", jobs, calls)
+	}
+	if jobs, calls := listJobs(); jobs != "map[pool-0:a pool-1:]" || calls != 0 {
+		t.Errorf("a cached ListJobs returned %s with %d calls, want none", jobs, calls)
+	}
+
+	// a change by another instance is only seen once the cache expires
+	mr.Set("pool-1", "other")
+	if jobs, _ := listJobs(); jobs != "map[pool-0:a pool-1:]" {
+		t.Errorf("ListJobs within the cache ttl returned %s, want the cached jobs", jobs)
+	}
+	clock.Advance(time.Second)
+	if jobs, calls := listJobs(); jobs != "map[pool-0:a pool-1:other]" || calls != 1 {
+		t.Errorf("ListJobs after the cache ttl returned %s with %d calls", jobs, calls)
+	}
+
+	// a local write invalidates the cache at once
+	if _, err := rl.DeleteJob("pool", 2, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, calls := listJobs(); jobs != "map[pool-0: pool-1:other]" || calls != 1 {
+		t.Errorf("ListJobs after DeleteJob returned %s with %d calls", jobs, calls)
+	}
+	if _, err := rl.AddJob("pool", 2, "b", 0); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, calls := listJobs(); jobs != "map[pool-0:b pool-1:other]" || calls != 1 {
+		t.Errorf("ListJobs after AddJob returned %s with %d calls", jobs, calls)
+	}
+}
+
+func TestReadCacheInvalidatedByMoves(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now), concurrency.WithReadCache(time.Minute))
+	defer mr.Close()
+	ctx := context.Background()
+
+	if _, err := rl.AddJob("pool", 2, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := rl.ListJobs("pool", 2); err != nil || fmt.Sprint(jobs) != "map[pool-0:a pool-1:]" {
+		t.Fatalf("ListJobs returned %v, %v", jobs, err)
+	}
+
+	if err := rl.ReassignJob(ctx, "pool", 2, "a", "b", 0); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := rl.ListJobs("pool", 2); err != nil || fmt.Sprint(jobs) != "map[pool-0:b pool-1:]" {
+		t.Errorf("ListJobs after ReassignJob returned %v, %v", jobs, err)
+	}
+
+	// the slot moves away from the keys ListJobs reads
+	if _, err := rl.MigrateKeys(ctx, "pool", 2, "", "-", "", ":"); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, err := rl.ListJobs("pool", 2); err != nil || fmt.Sprint(jobs) != "map[pool-0: pool-1:]" {
+		t.Errorf("ListJobs after MigrateKeys returned %v, %v", jobs, err)
+	}
+}
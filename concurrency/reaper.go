@@ -0,0 +1,88 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// reapScript releases the slots acquired before a cutoff like luaReleaseSlot
+// KEYS[5..] are the slot keys, ARGV[5] the cutoff in unix milliseconds and ARGV[6] the position of the acquisition field
+// slots without an acquisition timestamp are kept, it returns the reaped slots as key, jobID pairs
+var reapScript = newScript(luaJobID + luaSlotFields + luaReleaseSlot + `
+local reaped = {}
+local field = tonumber(ARGV[6])
+for i = 5, #KEYS do
+	local key = KEYS[i]
+	local v = redis.call('GET', key)
+	if v and v ~= '' and slotbody(v) then
+		local acquired = tonumber(splitslot(v)[field])
+		if acquired and acquired > 0 and acquired < tonumber(ARGV[5]) then
+			releaseslot(key, jobid(v), i - 5)
+			table.insert(reaped, key)
+			table.insert(reaped, jobid(v))
+		end
+	end
+end
+return reaped
+`)
+
+// ReapOverdue releases the slots of jobType held longer than WithMaxHoldTime allows,
+// however often their holders extended them, and logs every reclaimed slot
+// it returns the number of released slots, slots without an acquisition timestamp are kept
+// the slots are released like DeleteJob releases them
+func (rl *RateLimiter) ReapOverdue(ctx context.Context, jobType string, limit int) (reaped int, err error) {
+	start := time.Now()
+	defer func() {
+		rl.readCache.invalidate(jobType)
+		rl.observeOperation(ctx, "reap_overdue", jobType, start, err)
+	}()
+
+	if rl.maxHoldTime <= 0 {
+		return 0, errors.New("ReapOverdue requires WithMaxHoldTime")
+	}
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := rl.now().Add(-rl.maxHoldTime)
+	reply, err := reapScript.Run(ctx, rl.redisConnector, releaseKeys(jobType, slotKeys...),
+		rl.releaseArgs(unixMilli(cutoff), slotFieldAcquiredAt+1)...)
+	if err != nil {
+		return 0, err
+	}
+	pairs, err := toStrings(reply)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		rl.logf("concurrency: reclaimed slot %s held by job %s beyond the max hold time of %s", pairs[i], pairs[i+1], rl.maxHoldTime)
+		rl.released(ctx, jobType, pairs[i], pairs[i+1])
+	}
+	reaped = len(pairs) / 2
+	rl.count(ctx, jobType, counterReleases, reaped)
+
+	return reaped, nil
+}
+
+// RunReaper calls ReapOverdue for jobType every interval until ctx is done
+// failures are logged and retried on the next tick, no reaper runs unless it is started
+func (rl *RateLimiter) RunReaper(ctx context.Context, jobType string, limit int, interval time.Duration) error {
+	if rl.maxHoldTime <= 0 {
+		return errors.New("RunReaper requires WithMaxHoldTime")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if _, err := rl.ReapOverdue(ctx, jobType, limit); err != nil && ctx.Err() == nil {
+			rl.logf("concurrency: reaping %s failed: %v", jobType, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestReaperReclaimsOverdueSlots(t *testing.T) {
+	clock := newFakeClock()
+	logger := &testLogger{}
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now), concurrency.WithLogger(logger),
+		concurrency.WithMaxHoldTime(time.Minute))
+	defer mr.Close()
+	ctx := context.Background()
+
+	if _, err := rl.AddJob("pool", 3, "old", 0); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(30 * time.Second)
+	if _, err := rl.AddJob("pool", 3, "new", 0); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(31 * time.Second)
+	// extending does not save a slot from the reaper
+	if err := rl.ExtendJob(ctx, "pool", 3, "old", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- rl.RunReaper(runCtx, "pool", 3, 10*time.Millisecond)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := rl.FindJobSlot(ctx, "pool", 3, "old"); errors.Is(err, concurrency.ErrJobNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the reaper did not reclaim the overdue slot")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("RunReaper returned %v", err)
+	}
+
+	if _, err := rl.FindJobSlot(ctx, "pool", 3, "new"); err != nil {
+		t.Errorf("the reaper reclaimed a slot within the max hold time: %v", err)
+	}
+	if lines := strings.Join(logger.Lines(), "\n"); !strings.Contains(lines, "reclaimed slot pool-0 held by job old") {
+		t.Errorf("logged %q, want the reclaimed slot", lines)
+	}
+
+	rl, mr2 := newTestLimiter(t)
+	defer mr2.Close()
+	if _, err := rl.ReapOverdue(ctx, "pool", 3); err == nil {
+		t.Error("ReapOverdue without a max hold time succeeded")
+	}
+}
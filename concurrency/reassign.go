@@ -0,0 +1,81 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// reassignScript replaces the jobID of the first slot held by a job, keeping the other fields of the slot value
+// the slot is stamped with a new fencing token since it has a new holder
+// KEYS[1] is the fencing token counter, KEYS[2..] the slot keys,
+// ARGV[1] the old jobID, ARGV[2] the new jobID, ARGV[3] the ttl in milliseconds, not positive for no expiry
+// it returns the slot key and the fencing token, or false if the old jobID holds no slot
+var reassignScript = newScript(luaJobID + luaSlotFields + luaFence + `
+for i = 2, #KEYS do
+	local key = KEYS[i]
+	local v = redis.call('GET', key)
+	if jobid(v) == ARGV[1] then
+		local fields = splitslot(v)
+		fields[1] = ARGV[2]
+		local value, token = fence(joinslot(fields, 2), KEYS[1])
+		local ttl = tonumber(ARGV[3])
+		if ttl > 0 then
+			redis.call('SET', key, value, 'PX', ttl)
+		else
+			redis.call('SET', key, value)
+		end
+		return {key, token}
+	end
+end
+return false
+`)
+
+// ReassignJob hands the slot held by oldJobID over to newJobID without releasing it
+// so no other job can take the slot in between
+// the slot gets ttl like a new acquisition, zero means the default ttl of the limiter and WithMaxTTL applies
+// it returns ErrJobNotFound if oldJobID does not hold a slot
+func (rl *RateLimiter) ReassignJob(ctx context.Context, jobType string, limit int, oldJobID, newJobID string, ttl time.Duration) (err error) {
+	start := time.Now()
+	defer func() {
+		rl.readCache.invalidate(jobType)
+		rl.observeOperation(ctx, "reassign_job", jobType, start, err)
+	}()
+
+	if err := rl.validateJobID(oldJobID); err != nil {
+		return err
+	}
+	if err := rl.validateJobID(newJobID); err != nil {
+		return err
+	}
+	ttl, err = rl.jobTTL(ttl)
+	if err != nil {
+		return err
+	}
+
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return err
+	}
+	keys := append([]string{fenceKey(jobType)}, slotKeys...)
+	reply, err := reassignScript.Run(ctx, rl.redisConnector, keys, oldJobID, newJobID, ttlMilli(ttl))
+	if err != nil {
+		return err
+	}
+	// a nil reply means no slot is held by oldJobID
+	items, ok := reply.([]interface{})
+	if !ok {
+		return ErrJobNotFound
+	}
+	granted, tokens, err := toSlotTokens(items)
+	if err != nil {
+		return err
+	}
+	if len(granted) != 1 {
+		return fmt.Errorf("unexpected script reply %v", reply)
+	}
+	rl.audit(ctx, auditReassign, jobType, granted[0], newJobID, tokens[0])
+	rl.owned.reassign(ctx, granted[0], oldJobID, newJobID)
+
+	return nil
+}
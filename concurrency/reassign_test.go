@@ -0,0 +1,73 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestReassignJob(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	_, token, err := rl.AddJobWithToken(ctx, "pool", 2, "old", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.AddJob("pool", 2, "other", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rl.ReassignJob(ctx, "pool", 2, "old", "new", 0); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := rl.ListJobs("pool", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs["pool-0"] != "new" || jobs["pool-1"] != "other" {
+		t.Errorf("ListJobs returned %v, want new in the slot of old", jobs)
+	}
+	if n := occupied(t, rl, "pool", 2); n != 2 {
+		t.Errorf("%d slots occupied after the reassignment, want 2", n)
+	}
+	// a zero ttl is the default ttl of the limiter
+	if ttl := mr.TTL("pool-0"); ttl != testTTL {
+		t.Errorf("the reassigned slot has ttl %v, want %v", ttl, testTTL)
+	}
+	raw, _ := mr.Get("pool-0")
+	if v, err := concurrency.ParseSlotValue(raw); err != nil || v.Token <= token {
+		t.Errorf("the reassigned slot has token %d (%v), want it larger than %d", v.Token, err, token)
+	}
+
+	if ok, err := rl.DeleteJob("pool", 2, "old"); err != nil || ok {
+		t.Errorf("DeleteJob of the old jobID returned %v, %v", ok, err)
+	}
+	if ok, err := rl.DeleteJob("pool", 2, "new"); err != nil || !ok {
+		t.Errorf("DeleteJob of the new jobID returned %v, %v", ok, err)
+	}
+}
+
+func TestReassignJobNotFound(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	if _, err := rl.AddJob("pool", 2, "other", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.ReassignJob(ctx, "pool", 2, "missing", "new", 0); !errors.Is(err, concurrency.ErrJobNotFound) {
+		t.Errorf("ReassignJob returned %v, want ErrJobNotFound", err)
+	}
+	jobs, err := rl.ListJobs("pool", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs["pool-0"] != "other" || jobs["pool-1"] != "" {
+		t.Errorf("ListJobs returned %v, want the pool unchanged", jobs)
+	}
+}
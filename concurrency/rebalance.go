@@ -0,0 +1,78 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// rebalanceScript spreads the occupied slots evenly over all indexes, keeping their order and ttls
+// the n-th of k occupied slots moves to index floor(n * #KEYS / k)
+// KEYS are the slot keys, it returns the moves as from, to, jobID triples
+var rebalanceScript = newScript(luaJobID + `
+local jobs = {}
+for i, key in ipairs(KEYS) do
+	local v = redis.call('GET', key)
+	if v and v ~= '' then
+		table.insert(jobs, {index = i, value = v, ttl = redis.call('PTTL', key)})
+	end
+end
+local moves = {}
+for n, job in ipairs(jobs) do
+	job.target = math.floor((n - 1) * #KEYS / #jobs) + 1
+	if job.target ~= job.index then
+		redis.call('DEL', KEYS[job.index])
+	end
+end
+for _, job in ipairs(jobs) do
+	if job.target ~= job.index then
+		local key = KEYS[job.target]
+		if job.ttl > 0 then
+			redis.call('SET', key, job.value, 'PX', job.ttl)
+		else
+			redis.call('SET', key, job.value)
+		end
+		table.insert(moves, KEYS[job.index])
+		table.insert(moves, key)
+		table.insert(moves, jobid(job.value))
+	end
+end
+return moves
+`)
+
+// Rebalance spreads the occupied slots of jobType evenly over all slot indexes in one script,
+// e.g. after churn left the jobs clustered in the low indexes
+// every job keeps its value and remaining ttl, it returns how many jobs moved to another slot
+// it is a maintenance operation which blocks redis while it rewrites the slots, and is not
+// available with WithTokenList or WithActiveSet whose bookkeeping refers to the slot keys
+func (rl *RateLimiter) Rebalance(ctx context.Context, jobType string, limit int) (moved int, err error) {
+	start := time.Now()
+	defer func() {
+		rl.readCache.invalidate(jobType)
+		rl.observeOperation(ctx, "rebalance", jobType, start, err)
+	}()
+
+	if rl.tokenList || rl.activeSet {
+		return 0, errors.New("Rebalance is not available with WithTokenList or WithActiveSet")
+	}
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return 0, err
+	}
+	reply, err := rebalanceScript.Run(ctx, rl.redisConnector, slotKeys)
+	if err != nil {
+		return 0, err
+	}
+	moves, err := toStrings(reply)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := make([]slotMove, 0, len(moves)/3)
+	for i := 0; i+2 < len(moves); i += 3 {
+		applied = append(applied, slotMove{from: moves[i], to: moves[i+1], jobID: moves[i+2]})
+	}
+	rl.owned.move(ctx, applied)
+
+	return len(applied), nil
+}
@@ -0,0 +1,69 @@
+package concurrency_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestRebalance(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithOwnedTracking())
+	defer mr.Close()
+	ctx := context.Background()
+
+	ttls := map[string]time.Duration{"a": 10 * time.Second, "b": 20 * time.Second, "c": 30 * time.Second, "d": -1}
+	for _, jobID := range []string{"a", "b", "c", "d"} {
+		if _, err := rl.AddJob("pool", 8, jobID, ttls[jobID]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	moved, err := rl.Rebalance(ctx, "pool", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved != 3 {
+		t.Errorf("Rebalance moved %d jobs, want 3", moved)
+	}
+	jobs, err := rl.ListJobsByIndex(ctx, "pool", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]string{0: "a", 2: "b", 4: "c", 6: "d"}
+	for i := 0; i < 8; i++ {
+		if jobs[i] != want[i] {
+			t.Fatalf("the pool holds %v after Rebalance, want %v", jobs, want)
+		}
+	}
+	for index, jobID := range want {
+		wantTTL := ttls[jobID]
+		if wantTTL < 0 {
+			wantTTL = 0
+		}
+		if ttl := mr.TTL(fmt.Sprintf("pool-%d", index)); ttl != wantTTL {
+			t.Errorf("%s has ttl %v after the move, want %v", jobID, ttl, wantTTL)
+		}
+	}
+
+	// a balanced pool stays as it is
+	if moved, err := rl.Rebalance(ctx, "pool", 8); err != nil || moved != 0 {
+		t.Errorf("a second Rebalance returned %d, %v, want nothing moved", moved, err)
+	}
+
+	// the moved slots are still released through the limiter
+	if err := rl.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := occupied(t, rl, "pool", 8); n != 0 {
+		t.Errorf("%d slots occupied after Close, want the moved ones released too", n)
+	}
+
+	rl, mr2 := newTestLimiter(t, concurrency.WithActiveSet())
+	defer mr2.Close()
+	if _, err := rl.Rebalance(ctx, "pool", 8); err == nil {
+		t.Error("Rebalance with an active set succeeded")
+	}
+}
@@ -0,0 +1,112 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// RegionalLimiter bounds a jobType across regions running separate redis clusters
+// acquisitions go to the authority, the limiter of one designated region, so while it is
+// reachable the limit holds globally; if it does not answer within the timeout the job is
+// admitted against a soft limit on the local cluster instead, a share of the global limit
+// this favours availability: during a partition every region admits up to its soft limit on top
+// of what the authority granted, so the global limit is exceeded until the authority is back,
+// and jobs admitted locally are not known to the authority
+type RegionalLimiter struct {
+	authority  *RateLimiter
+	local      *RateLimiter
+	timeout    time.Duration
+	localShare float64
+}
+
+// NewRegionalLimiter is the constructor of RegionalLimiter
+// timeout bounds every call to the authority, localShare is the part of the limit a region
+// admits on its own while the authority is unreachable, e.g. 1/3 for three regions
+func NewRegionalLimiter(authority, local *RateLimiter, timeout time.Duration, localShare float64) *RegionalLimiter {
+	return &RegionalLimiter{
+		authority:  authority,
+		local:      local,
+		timeout:    timeout,
+		localShare: localShare,
+	}
+}
+
+// softLimit returns the local share of limit, at least one slot of a non-zero limit
+func (r *RegionalLimiter) softLimit(limit int) int {
+	soft := int(float64(limit) * r.localShare)
+	if soft < 1 && limit > 0 {
+		soft = 1
+	}
+
+	return soft
+}
+
+// unreachable reports whether err means the authority could not be asked, rather than that it refused
+// only network errors, timeouts and an open circuit breaker count, every other error is the authority's answer
+func unreachable(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrBackendUnavailable)
+}
+
+// AddJob asks the authority for a slot of jobType and falls back to the local soft limit if it is unreachable
+// local reports whether the job was admitted locally, a rejection by the authority is returned as is
+func (r *RegionalLimiter) AddJob(ctx context.Context, jobType string, limit int, jobID string, ttl time.Duration) (id string, local bool, err error) {
+	if jobID == "" {
+		if jobID, err = newJobID(); err != nil {
+			return "", false, err
+		}
+	}
+
+	authorityCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	id, err = r.authority.addJob(authorityCtx, jobType, limit, jobID, ttl)
+	cancel()
+	if err == nil || !unreachable(err) || ctx.Err() != nil {
+		return id, false, err
+	}
+
+	r.local.logf("concurrency: authority unreachable for %s, admitting against the local soft limit: %v", jobType, err)
+	id, err = r.local.addJob(ctx, jobType, r.softLimit(limit), jobID, ttl)
+
+	return id, true, err
+}
+
+// DeleteJob releases jobID on the authority and on the local cluster, since it may hold a slot on either
+// it reports whether any slot was released, an unreachable authority is returned after the local release
+func (r *RegionalLimiter) DeleteJob(ctx context.Context, jobType string, limit int, jobID string) (bool, error) {
+	authorityCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	released, authorityErr := r.authority.deleteJob(authorityCtx, jobType, limit, jobID)
+	cancel()
+
+	releasedLocally, err := r.local.deleteJob(ctx, jobType, r.softLimit(limit), jobID)
+	if err == nil {
+		err = authorityErr
+	}
+
+	return released || releasedLocally, err
+}
+
+// ListJobs lists the slots of jobType the local cluster admitted against the soft limit
+// it never leaves the region, so dashboards and admin tools do not add to the load of the authority,
+// use ListJobsConsistent for the slots granted by the authority
+func (r *RegionalLimiter) ListJobs(ctx context.Context, jobType string, limit int) (map[string]string, error) {
+	return r.local.listJobs(ctx, r.local.reader(), jobType, r.softLimit(limit))
+}
+
+// ListJobsConsistent lists the slots of jobType on the authority, or on the local cluster if the authority is unreachable
+// the local listing only shows the jobs admitted against the soft limit
+func (r *RegionalLimiter) ListJobsConsistent(ctx context.Context, jobType string, limit int) (slots map[string]string, local bool, err error) {
+	authorityCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	slots, err = r.authority.listJobs(authorityCtx, r.authority.reader(), jobType, limit)
+	cancel()
+	if err == nil || !unreachable(err) || ctx.Err() != nil {
+		return slots, false, err
+	}
+
+	slots, err = r.ListJobs(ctx, jobType, limit)
+
+	return slots, true, err
+}
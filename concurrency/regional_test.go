@@ -0,0 +1,101 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestRegionalLimiter(t *testing.T) {
+	authorityRedis := newTestRedis(t)
+	defer authorityRedis.Close()
+	westRedis, eastRedis := newTestRedis(t), newTestRedis(t)
+	defer westRedis.Close()
+	defer eastRedis.Close()
+	logger := &testLogger{}
+
+	quiet := concurrency.WithLogger(&testLogger{})
+	authority := concurrency.NewRateLimiter(newTestConnector(authorityRedis), testTTL, quiet)
+	west := concurrency.NewRegionalLimiter(authority,
+		concurrency.NewRateLimiter(newTestConnector(westRedis), testTTL, concurrency.WithLogger(logger)), 200*time.Millisecond, 0.5)
+	east := concurrency.NewRegionalLimiter(authority,
+		concurrency.NewRateLimiter(newTestConnector(eastRedis), testTTL, quiet), 200*time.Millisecond, 0.5)
+	ctx := context.Background()
+
+	// while the authority is reachable the limit holds across the regions
+	for i, region := range []*concurrency.RegionalLimiter{west, west, west, east} {
+		if _, local, err := region.AddJob(ctx, "pool", 4, fmt.Sprintf("job-%d", i), 0); err != nil || local {
+			t.Fatalf("AddJob %d returned local %v, %v", i, local, err)
+		}
+	}
+	if _, local, err := east.AddJob(ctx, "pool", 4, "job-4", 0); !errors.Is(err, concurrency.ErrNoSlot) || local {
+		t.Errorf("AddJob beyond the global limit returned local %v, %v, want the rejection of the authority", local, err)
+	}
+	if len(westRedis.Keys()) != 0 || len(eastRedis.Keys()) != 0 {
+		t.Errorf("the local clusters hold %v and %v while the authority is reachable", westRedis.Keys(), eastRedis.Keys())
+	}
+	if slots, local, err := west.ListJobsConsistent(ctx, "pool", 4); err != nil || local || len(slots) != 4 {
+		t.Errorf("ListJobsConsistent returned %v, local %v, %v, want the 4 slots of the authority", slots, local, err)
+	}
+	// the default listing stays in the region
+	if slots, err := west.ListJobs(ctx, "pool", 4); err != nil || fmt.Sprint(slots) != "map[pool-0: pool-1:]" {
+		t.Errorf("ListJobs returned %v, %v, want the empty local slots", slots, err)
+	}
+
+	// without the authority every region admits up to its soft limit
+	authorityRedis.Close()
+	for _, jobID := range []string{"west-0", "west-1"} {
+		if _, local, err := west.AddJob(ctx, "pool", 4, jobID, 0); err != nil || !local {
+			t.Fatalf("AddJob %s without the authority returned local %v, %v", jobID, local, err)
+		}
+	}
+	if _, _, err := west.AddJob(ctx, "pool", 4, "west-2", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("AddJob beyond the soft limit returned %v, want ErrNoSlot", err)
+	}
+	if _, local, err := east.AddJob(ctx, "pool", 4, "east-0", 0); err != nil || !local {
+		t.Errorf("AddJob in the other region returned local %v, %v", local, err)
+	}
+	if slots, local, err := west.ListJobsConsistent(ctx, "pool", 4); err != nil || !local || fmt.Sprint(slots) != "map[pool-0:west-0 pool-1:west-1]" {
+		t.Errorf("ListJobsConsistent without the authority returned %v, local %v, %v", slots, local, err)
+	}
+	if slots, err := west.ListJobs(ctx, "pool", 4); err != nil || fmt.Sprint(slots) != "map[pool-0:west-0 pool-1:west-1]" {
+		t.Errorf("ListJobs without the authority returned %v, %v", slots, err)
+	}
+	if lines := strings.Join(logger.Lines(), "\n"); !strings.Contains(lines, "authority unreachable for pool") {
+		t.Errorf("logged %q, want the fallback", lines)
+	}
+
+	if released, err := west.DeleteJob(ctx, "pool", 4, "west-0"); !released || err == nil {
+		t.Errorf("DeleteJob without the authority returned %v, %v, want the local release and the authority error", released, err)
+	}
+}
+
+func TestRegionalLimiterAuthorityTimeout(t *testing.T) {
+	authorityRedis, localRedis := newTestRedis(t), newTestRedis(t)
+	defer authorityRedis.Close()
+	defer localRedis.Close()
+
+	conn := &hangingConnector{RedisConnector: newTestConnector(authorityRedis), hung: make(chan struct{}, 1)}
+	atomic.StoreInt32(&conn.hanging, 1)
+	quiet := concurrency.WithLogger(&testLogger{})
+	regional := concurrency.NewRegionalLimiter(concurrency.NewRateLimiter(conn, testTTL, quiet),
+		concurrency.NewRateLimiter(newTestConnector(localRedis), testTTL, quiet), 50*time.Millisecond, 0.25)
+
+	start := time.Now()
+	_, local, err := regional.AddJob(context.Background(), "pool", 8, "job", 0)
+	if err != nil || !local {
+		t.Fatalf("AddJob with a hanging authority returned local %v, %v", local, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("the fallback took %v, want about the authority timeout", elapsed)
+	}
+	if !localRedis.Exists("pool-0") {
+		t.Error("the job was not admitted on the local cluster")
+	}
+}
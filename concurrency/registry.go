@@ -0,0 +1,86 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrUnknownPolicy defines the error when no policy is registered under a name
+var ErrUnknownPolicy = errors.New("unknown policy")
+
+// Policy bundles the parameters of a pool, so call sites only refer to it by name
+type Policy struct {
+	JobType string
+	Limit   int
+	// TTL is the ttl of the slots, zero means the default ttl of the limiter
+	TTL time.Duration
+}
+
+// policyRegistry holds the registered policies by name
+type policyRegistry struct {
+	mu       sync.RWMutex
+	policies map[string]Policy
+}
+
+// RegisterPolicy registers p under name, replacing a policy registered before
+// the limit is validated like GenJobKeys does
+func (rl *RateLimiter) RegisterPolicy(name string, p Policy) error {
+	if err := rl.checkLimit(p.Limit); err != nil {
+		return err
+	}
+
+	rl.policies.mu.Lock()
+	defer rl.policies.mu.Unlock()
+	if rl.policies.policies == nil {
+		rl.policies.policies = map[string]Policy{}
+	}
+	rl.policies.policies[name] = p
+
+	return nil
+}
+
+// policy returns the policy registered under name
+func (rl *RateLimiter) policy(name string) (Policy, error) {
+	rl.policies.mu.RLock()
+	defer rl.policies.mu.RUnlock()
+
+	p, ok := rl.policies.policies[name]
+	if !ok {
+		return Policy{}, fmt.Errorf("%w: %q", ErrUnknownPolicy, name)
+	}
+
+	return p, nil
+}
+
+// AcquireByPolicy adds a job like AddJob with the jobType, limit and ttl of the policy registered under name
+func (rl *RateLimiter) AcquireByPolicy(ctx context.Context, name, jobID string) (string, error) {
+	p, err := rl.policy(name)
+	if err != nil {
+		return "", err
+	}
+
+	return rl.addJob(ctx, p.JobType, p.Limit, jobID, p.TTL)
+}
+
+// ReleaseByPolicy deletes a job like DeleteJob from the pool of the policy registered under name
+func (rl *RateLimiter) ReleaseByPolicy(ctx context.Context, name, jobID string) (bool, error) {
+	p, err := rl.policy(name)
+	if err != nil {
+		return false, err
+	}
+
+	return rl.deleteJob(ctx, p.JobType, p.Limit, jobID)
+}
+
+// ListByPolicy lists the jobs like ListJobs of the pool of the policy registered under name
+func (rl *RateLimiter) ListByPolicy(ctx context.Context, name string) (map[string]string, error) {
+	p, err := rl.policy(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return rl.listJobs(ctx, rl.reader(), p.JobType, p.Limit)
+}
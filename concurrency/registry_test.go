@@ -0,0 +1,66 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestAcquireByPolicy(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	if err := rl.RegisterPolicy("exports", concurrency.Policy{JobType: "export", Limit: 2, TTL: 30 * time.Second}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.RegisterPolicy("imports", concurrency.Policy{JobType: "import", Limit: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.RegisterPolicy("broken", concurrency.Policy{JobType: "broken", Limit: -1}); !errors.Is(err, concurrency.ErrInvalidLimit) {
+		t.Errorf("registering a negative limit returned %v, want ErrInvalidLimit", err)
+	}
+
+	for _, jobID := range []string{"a", "b"} {
+		if _, err := rl.AcquireByPolicy(ctx, "exports", jobID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rl.AcquireByPolicy(ctx, "exports", "c"); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("acquiring beyond the registered limit returned %v, want ErrNoSlot", err)
+	}
+	if ttl := mr.TTL("export-0"); ttl != 30*time.Second {
+		t.Errorf("export-0 has ttl %v, want the registered 30s", ttl)
+	}
+	if _, err := rl.AcquireByPolicy(ctx, "imports", "i"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("import-0"); ttl != testTTL {
+		t.Errorf("import-0 has ttl %v, want the default %v", ttl, testTTL)
+	}
+
+	if ok, err := rl.ReleaseByPolicy(ctx, "exports", "a"); err != nil || !ok {
+		t.Errorf("ReleaseByPolicy returned %v, %v", ok, err)
+	}
+	jobs, err := rl.ListByPolicy(ctx, "exports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "map[export-0: export-1:b]"; fmt.Sprint(jobs) != want {
+		t.Errorf("ListByPolicy returned %v, want %s", jobs, want)
+	}
+
+	if _, err := rl.AcquireByPolicy(ctx, "unknown", "a"); !errors.Is(err, concurrency.ErrUnknownPolicy) {
+		t.Errorf("AcquireByPolicy of an unknown policy returned %v, want ErrUnknownPolicy", err)
+	}
+	if _, err := rl.ReleaseByPolicy(ctx, "unknown", "a"); !errors.Is(err, concurrency.ErrUnknownPolicy) {
+		t.Errorf("ReleaseByPolicy of an unknown policy returned %v, want ErrUnknownPolicy", err)
+	}
+	if _, err := rl.ListByPolicy(ctx, "unknown"); !errors.Is(err, concurrency.ErrUnknownPolicy) {
+		t.Errorf("ListByPolicy of an unknown policy returned %v, want ErrUnknownPolicy", err)
+	}
+}
@@ -0,0 +1,82 @@
+package concurrency
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RejectReason tells why an acquisition was rejected
+type RejectReason int
+
+const (
+	// RejectSaturated means every slot is taken, the error matches ErrNoSlot
+	RejectSaturated RejectReason = iota + 1
+	// RejectDisabled means the limit is zero, the error matches ErrPoolDisabled
+	RejectDisabled
+	// RejectAttemptRate means WithAttemptRateLimit was exceeded, the error matches ErrAttemptRateExceeded
+	RejectAttemptRate
+	// RejectPaused means the jobType is paused, the error wraps a *PausedError
+	RejectPaused
+	// RejectDraining means this limiter drains for shutdown, the error matches ErrDraining
+	RejectDraining
+)
+
+func (r RejectReason) String() string {
+	switch r {
+	case RejectSaturated:
+		return "saturated"
+	case RejectDisabled:
+		return "disabled"
+	case RejectAttemptRate:
+		return "attempt rate"
+	case RejectPaused:
+		return "paused"
+	case RejectDraining:
+		return "draining"
+	default:
+		return fmt.Sprintf("RejectReason(%d)", int(r))
+	}
+}
+
+// RejectedError defines the error when an acquisition is rejected by a guard of the pool
+// it wraps the guard error, so errors.Is(err, ErrNoSlot) still holds for a saturated pool
+// and errors.As finds a *PausedError, while Reason lets callers branch without knowing every guard
+type RejectedError struct {
+	Reason  RejectReason
+	JobType string
+	Err     error
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("acquisition of %s rejected (%s): %v", e.JobType, e.Reason, e.Err)
+}
+
+// Unwrap returns the guard error
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// rejection wraps the guard errors of an acquisition into a *RejectedError, other errors are returned as is
+func rejection(jobType string, err error) error {
+	var reason RejectReason
+	var paused *PausedError
+	var rejected *RejectedError
+	switch {
+	case errors.As(err, &rejected):
+		return err
+	case err == ErrNoSlot:
+		reason = RejectSaturated
+	case err == ErrPoolDisabled:
+		reason = RejectDisabled
+	case err == ErrAttemptRateExceeded:
+		reason = RejectAttemptRate
+	case errors.As(err, &paused):
+		reason = RejectPaused
+	case err == ErrDraining:
+		reason = RejectDraining
+	default:
+		return err
+	}
+
+	return &RejectedError{Reason: reason, JobType: jobType, Err: err}
+}
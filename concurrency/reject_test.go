@@ -0,0 +1,98 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestRejectReasons(t *testing.T) {
+	ctx := context.Background()
+	for _, tt := range []struct {
+		reason concurrency.RejectReason
+		err    error
+		opts   []concurrency.Option
+		limit  int
+		setup  func(t *testing.T, rl *concurrency.RateLimiter)
+	}{
+		{
+			reason: concurrency.RejectSaturated,
+			err:    concurrency.ErrNoSlot,
+			limit:  1,
+			setup: func(t *testing.T, rl *concurrency.RateLimiter) {
+				if _, err := rl.AddJob("pool", 1, "holder", 0); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			reason: concurrency.RejectDisabled,
+			err:    concurrency.ErrPoolDisabled,
+			limit:  0,
+		},
+		{
+			reason: concurrency.RejectAttemptRate,
+			err:    concurrency.ErrAttemptRateExceeded,
+			opts:   []concurrency.Option{concurrency.WithClock(newFakeClock().Now), concurrency.WithAttemptRateLimit(1)},
+			limit:  2,
+			setup: func(t *testing.T, rl *concurrency.RateLimiter) {
+				if _, err := rl.AddJob("pool", 2, "first", 0); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			reason: concurrency.RejectPaused,
+			opts:   []concurrency.Option{concurrency.WithPause()},
+			limit:  2,
+			setup: func(t *testing.T, rl *concurrency.RateLimiter) {
+				if err := rl.Pause(ctx, "pool", "maintenance"); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			reason: concurrency.RejectDraining,
+			err:    concurrency.ErrDraining,
+			limit:  2,
+			setup: func(t *testing.T, rl *concurrency.RateLimiter) {
+				rl.SetDraining(true)
+			},
+		},
+	} {
+		t.Run(tt.reason.String(), func(t *testing.T) {
+			rl, mr := newTestLimiter(t, tt.opts...)
+			defer mr.Close()
+			if tt.setup != nil {
+				tt.setup(t, rl)
+			}
+
+			_, err := rl.AddJob("pool", tt.limit, "job", 0)
+			var rejected *concurrency.RejectedError
+			if !errors.As(err, &rejected) {
+				t.Fatalf("AddJob returned %v, want a *RejectedError", err)
+			}
+			if rejected.Reason != tt.reason || rejected.JobType != "pool" {
+				t.Errorf("AddJob was rejected for %s of %s, want %s of pool", rejected.Reason, rejected.JobType, tt.reason)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("AddJob returned %v, want it to match %v", err, tt.err)
+			}
+			var paused *concurrency.PausedError
+			if tt.reason == concurrency.RejectPaused && !errors.As(err, &paused) {
+				t.Errorf("AddJob returned %v, want it to wrap a *PausedError", err)
+			}
+		})
+	}
+
+	// a failing backend is not a rejection
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	mr.SetError("ERR backend down")
+	var rejected *concurrency.RejectedError
+	if _, err := rl.AddJob("pool", 2, "job", 0); err == nil || errors.As(err, &rejected) {
+		t.Errorf("AddJob on a failing backend returned %v, want a plain error", err)
+	}
+}
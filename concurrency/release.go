@@ -0,0 +1,132 @@
+package concurrency
+
+import (
+	"context"
+	"time"
+)
+
+// luaReleaseSlot defines the lua function deleting a slot the way DeleteJob does for the acquisition mode:
+// the token is pushed back with WithTokenList, the slot leaves the active set with WithActiveSet
+// and the job index with WithJobIndex, and its free time is stamped for LRUFree, it requires luaJobID
+// KEYS[1] is the token list, KEYS[2] the active set, KEYS[3] the job index and KEYS[4] the freed set,
+// ARGV[1..3] are 1 for a token list, an active set and a job index, ARGV[4] the free time or empty
+// slot is the index of key among the slot keys of the jobType, it is matched against the job index
+const luaReleaseSlot = `
+local function releaseslot(key, id, slot)
+	redis.call('DEL', key)
+	if ARGV[1] == '1' then
+		redis.call('RPUSH', KEYS[1], key)
+	end
+	if ARGV[2] == '1' then
+		redis.call('SREM', KEYS[2], key)
+	end
+	if ARGV[3] == '1' and redis.call('HGET', KEYS[3], id) == tostring(slot) then
+		redis.call('HDEL', KEYS[3], id)
+	end
+	if ARGV[4] ~= '' then
+		redis.call('ZADD', KEYS[4], ARGV[4], key)
+	end
+end
+`
+
+// releaseHeldScript releases a slot like luaReleaseSlot if it still holds the job
+// KEYS[5] is the slot key, ARGV[5] the jobID and ARGV[6] the index of the slot
+// it returns 1 if the slot was released, 0 otherwise
+var releaseHeldScript = newScript(luaJobID + luaReleaseSlot + `
+if jobid(redis.call('GET', KEYS[5])) ~= ARGV[5] then
+	return 0
+end
+releaseslot(KEYS[5], ARGV[5], ARGV[6])
+return 1
+`)
+
+// releaseKeys returns the first keys of a script using luaReleaseSlot for jobType
+func releaseKeys(jobType string, slotKeys ...string) []string {
+	listKey, _ := tokenKeys(jobType)
+	keys := make([]string, 0, 4+len(slotKeys))
+	keys = append(keys, listKey, activeSetKey(jobType), jobIndexKey(jobType), freedKey(jobType))
+
+	return append(keys, slotKeys...)
+}
+
+// releaseArgs returns the first arguments of a script using luaReleaseSlot
+func (rl *RateLimiter) releaseArgs(args ...interface{}) []interface{} {
+	var freedAt interface{} = ""
+	if rl.acquirePolicy == LRUFree {
+		freedAt = unixMilli(rl.now())
+	}
+	released := make([]interface{}, 0, 4+len(args))
+	released = append(released, boolArg(rl.tokenList), boolArg(rl.activeSet), boolArg(rl.jobIndex), freedAt)
+
+	return append(released, args...)
+}
+
+// releaseHeld releases slotKey if it still holds jobID, with the bookkeeping of DeleteJob
+// it reports whether the slot was released, one which expired or was taken by another job is left alone
+func (rl *RateLimiter) releaseHeld(ctx context.Context, slotKey, jobID string) (bool, error) {
+	jobType := slotJobType(slotKey)
+	index, _ := slotIndex(jobType, slotKey)
+	reply, err := releaseHeldScript.Run(ctx, rl.redisConnector, releaseKeys(jobType, slotKey), rl.releaseArgs(jobID, index)...)
+	if err != nil {
+		return false, err
+	}
+	if released, _ := toInt64(reply); released == 0 {
+		return false, nil
+	}
+	rl.released(ctx, jobType, slotKey, jobID)
+	rl.count(ctx, jobType, counterReleases, 1)
+
+	return true, nil
+}
+
+// releaseAllScript releases every occupied slot among KEYS[5..] like luaReleaseSlot
+// it returns the released slots as key, jobID pairs
+var releaseAllScript = newScript(luaJobID + luaReleaseSlot + `
+local released = {}
+for i = 5, #KEYS do
+	local v = redis.call('GET', KEYS[i])
+	if v and v ~= '' then
+		local id = jobid(v)
+		releaseslot(KEYS[i], id, i - 5)
+		table.insert(released, KEYS[i])
+		table.insert(released, id)
+	end
+end
+return released
+`)
+
+// ClearJobs releases every slot of jobType in one script with the bookkeeping of DeleteJob,
+// e.g. to reset a pool stuck with crashed holders, and returns the number of released slots
+// the slots are read on the primary, so neither a read replica nor the read cache can leave jobs behind
+func (rl *RateLimiter) ClearJobs(ctx context.Context, jobType string, limit int) (released int, err error) {
+	if rl.dryRun {
+		jobType = dryRunJobType(jobType)
+	}
+	start := time.Now()
+	defer func() {
+		rl.readCache.invalidate(jobType)
+		rl.observeOperation(ctx, "clear_jobs", jobType, start, err)
+	}()
+
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil || len(slotKeys) == 0 {
+		return 0, err
+	}
+	reply, err := releaseAllScript.Run(ctx, rl.redisConnector, releaseKeys(jobType, slotKeys...), rl.releaseArgs()...)
+	if err != nil {
+		return 0, err
+	}
+	pairs, err := toStrings(reply)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		rl.released(ctx, jobType, pairs[i], pairs[i+1])
+	}
+	released = len(pairs) / 2
+	rl.count(ctx, jobType, counterReleases, released)
+	rl.observeUtilization(jobType, 0, limit)
+
+	return released, nil
+}
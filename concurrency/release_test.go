@@ -0,0 +1,65 @@
+package concurrency_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+	"github.com/y4h2/golang-concurrency-limit/concurrency/concurrencytest"
+)
+
+func TestClearJobs(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(newTestConnector(mr))
+	var mu sync.Mutex
+	var releasedJobs []string
+	rl := concurrency.NewRateLimiter(conn, testTTL, concurrency.WithJobIndex(),
+		concurrency.WithReleaseHook(func(ctx context.Context, jobType, jobID, slotKey string) {
+			mu.Lock()
+			defer mu.Unlock()
+			releasedJobs = append(releasedJobs, jobID)
+		}))
+	ctx := context.Background()
+
+	for _, jobID := range []string{"a", "b", "c"} {
+		if _, err := rl.AddJob("pool", 5, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rl.AddJob("other", 1, "d", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	before := len(conn.Trace())
+	released, err := rl.ClearJobs(ctx, "pool", 5)
+	if err != nil || released != 3 {
+		t.Fatalf("ClearJobs returned %d, %v, want 3", released, err)
+	}
+	// the first run loads the script, no slot is read or released one by one
+	if got, scripts := calledMethods(conn.Trace()[before:]), scriptCalls(conn.Trace()[before:]); len(got) != len(scripts) {
+		t.Errorf("ClearJobs called %v, want only the script", got)
+	}
+	if n := occupied(t, rl, "pool", 5); n != 0 {
+		t.Errorf("%d slots occupied after ClearJobs", n)
+	}
+	if mr.Exists("pool-index") {
+		t.Error("ClearJobs left the job index behind")
+	}
+	if n := occupied(t, rl, "other", 1); n != 1 {
+		t.Error("ClearJobs released a slot of another jobType")
+	}
+	mu.Lock()
+	sort.Strings(releasedJobs)
+	if fmt.Sprint(releasedJobs) != "[a b c]" {
+		t.Errorf("the release hook saw %v, want every cleared job", releasedJobs)
+	}
+	mu.Unlock()
+
+	if released, err := rl.ClearJobs(ctx, "pool", 5); err != nil || released != 0 {
+		t.Errorf("ClearJobs of an empty pool returned %d, %v", released, err)
+	}
+}
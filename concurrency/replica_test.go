@@ -0,0 +1,38 @@
+package concurrency_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestReadReplicaServesReadsAndPrimaryWrites(t *testing.T) {
+	primary := newTestRedis(t)
+	defer primary.Close()
+	replica := newTestRedis(t)
+	defer replica.Close()
+	rl := concurrency.NewRateLimiter(newTestConnector(primary), testTTL,
+		concurrency.WithReadReplica(newTestConnector(replica)))
+
+	// a job only the replica knows must not keep the acquisition from taking its slot
+	replica.Set("pool-0", "ghost")
+	if _, err := rl.AddJob("pool", 2, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	value, err := primary.Get("pool-0")
+	if err != nil || !strings.Contains(value, "a") {
+		t.Errorf("the primary holds %q in pool-0 (%v), want job a", value, err)
+	}
+	if value, _ := replica.Get("pool-0"); value != "ghost" {
+		t.Errorf("the write reached the replica: %q", value)
+	}
+
+	jobs, err := rl.ListJobs("pool", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs["pool-0"] != "ghost" || jobs["pool-1"] != "" {
+		t.Errorf("ListJobs returned %v, want the replica view", jobs)
+	}
+}
@@ -0,0 +1,132 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// retryAttempts is the number of times a failed call is retried while the budget allows
+const retryAttempts = 2
+
+// retryBudget is a token bucket of retries shared by all calls of a limiter
+// so a broad outage exhausts it quickly and calls fail fast instead of multiplying the load
+type retryBudget struct {
+	capacity float64
+	interval time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRetryBudget(retries int, interval time.Duration) *retryBudget {
+	return &retryBudget{
+		capacity: float64(retries),
+		interval: interval,
+		tokens:   float64(retries),
+	}
+}
+
+// take reports whether a retry may be made and draws it from the budget
+// the budget refills evenly, capacity retries per interval
+func (b *retryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens += b.capacity * float64(now.Sub(b.last)) / float64(b.interval)
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// retry runs call and retries a backend failure up to retryAttempts times with backoff
+// as long as the budget has retries left and ctx is not done
+func (b *retryBudget) retry(ctx context.Context, call func() error) error {
+	err := call()
+	wait := newBackoff(minPollBackoff, maxPollBackoff)
+	for attempt := 0; attempt < retryAttempts && isRetryable(err) && ctx.Err() == nil; attempt++ {
+		if !b.take() {
+			return err
+		}
+		if sleep(ctx, wait.Next()) != nil {
+			return err
+		}
+		err = call()
+	}
+
+	return err
+}
+
+// isRetryable reports whether err is a transient backend failure worth another try
+// a panicking connector is assumed to panic again
+func isRetryable(err error) bool {
+	return isBackendFailure(err) && !errors.Is(err, ErrConnectorPanic)
+}
+
+// retryConnector retries the idempotent calls of conn within a retry budget
+// scripts, pushes, pops and stream appends are not idempotent and are never retried
+type retryConnector struct {
+	RedisConnector
+	budget *retryBudget
+}
+
+func (c *retryConnector) MGet(ctx context.Context, keys []string) (values []string, err error) {
+	err = c.budget.retry(ctx, func() error {
+		values, err = c.RedisConnector.MGet(ctx, keys)
+		return err
+	})
+
+	return values, err
+}
+
+func (c *retryConnector) Get(ctx context.Context, key string) (value string, err error) {
+	err = c.budget.retry(ctx, func() error {
+		value, err = c.RedisConnector.Get(ctx, key)
+		return err
+	})
+
+	return value, err
+}
+
+func (c *retryConnector) Del(ctx context.Context, keys ...string) error {
+	return c.budget.retry(ctx, func() error {
+		return c.RedisConnector.Del(ctx, keys...)
+	})
+}
+
+func (c *retryConnector) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return c.budget.retry(ctx, func() error {
+		return c.RedisConnector.Set(ctx, key, value, ttl)
+	})
+}
+
+func (c *retryConnector) PTTL(ctx context.Context, keys []string) (ttls []time.Duration, err error) {
+	err = c.budget.retry(ctx, func() error {
+		ttls, err = c.RedisConnector.PTTL(ctx, keys)
+		return err
+	})
+
+	return ttls, err
+}
+
+func (c *retryConnector) ScriptLoad(ctx context.Context, script string) (sha string, err error) {
+	err = c.budget.retry(ctx, func() error {
+		sha, err = c.RedisConnector.ScriptLoad(ctx, script)
+		return err
+	})
+
+	return sha, err
+}
@@ -0,0 +1,53 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// failingMGetConnector fails every MGet and counts the calls
+type failingMGetConnector struct {
+	concurrency.RedisConnector
+	calls int32
+}
+
+func (c *failingMGetConnector) MGet(ctx context.Context, keys []string) ([]string, error) {
+	atomic.AddInt32(&c.calls, 1)
+	return nil, errors.New("ERR connection reset")
+}
+
+func TestRetryBudget(t *testing.T) {
+	clock := newFakeClock()
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := &failingMGetConnector{RedisConnector: newTestConnector(mr)}
+	rl := concurrency.NewRateLimiter(conn, testTTL,
+		concurrency.WithClock(clock.Now),
+		concurrency.WithRetryBudget(3, time.Minute))
+
+	// every call is retried twice while the budget of three retries lasts
+	for i, want := range []int32{3, 2, 1, 1} {
+		atomic.StoreInt32(&conn.calls, 0)
+		if _, err := rl.ListJobs("pool", 2); err == nil {
+			t.Fatal("ListJobs succeeded on a failing backend")
+		}
+		if calls := atomic.LoadInt32(&conn.calls); calls != want {
+			t.Errorf("call %d reached the backend %d times, want %d", i, calls, want)
+		}
+	}
+
+	// the budget refills over the interval
+	clock.Advance(time.Minute)
+	atomic.StoreInt32(&conn.calls, 0)
+	if _, err := rl.ListJobs("pool", 2); err == nil {
+		t.Fatal("ListJobs succeeded on a failing backend")
+	}
+	if calls := atomic.LoadInt32(&conn.calls); calls != 3 {
+		t.Errorf("the call after the refill reached the backend %d times, want 3", calls)
+	}
+}
@@ -0,0 +1,108 @@
+package concurrency
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// scripts holds every script of the package so they can be preloaded
+var scripts struct {
+	sync.Mutex
+	all []*script
+}
+
+// script is a lua script executed atomically by redis
+// it is run with EVALSHA so the body is only sent when redis does not know it yet
+type script struct {
+	src  string
+	hash string
+}
+
+func newScript(src string) *script {
+	sum := sha1.Sum([]byte(src))
+	s := &script{src: src, hash: hex.EncodeToString(sum[:])}
+
+	scripts.Lock()
+	scripts.all = append(scripts.all, s)
+	scripts.Unlock()
+
+	return s
+}
+
+// Run executes the script through conn
+// if redis lost the script, e.g. after a restart or failover, it is loaded again and the call retried
+func (s *script) Run(ctx context.Context, conn RedisConnector, keys []string, args ...interface{}) (interface{}, error) {
+	reply, err := conn.EvalSha(ctx, s.hash, keys, args...)
+	if !isNoScript(err) {
+		return reply, err
+	}
+
+	if _, err := conn.ScriptLoad(ctx, s.src); err != nil {
+		return conn.Eval(ctx, s.src, keys, args...)
+	}
+
+	return conn.EvalSha(ctx, s.hash, keys, args...)
+}
+
+// isNoScript reports whether err is the NOSCRIPT error of an unknown sha
+func isNoScript(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT")
+}
+
+// LoadScripts loads every lua script of the package into redis
+// it is optional, scripts are loaded on first use otherwise
+func (rl *RateLimiter) LoadScripts(ctx context.Context) error {
+	scripts.Lock()
+	all := append([]*script(nil), scripts.all...)
+	scripts.Unlock()
+
+	for _, s := range all {
+		if _, err := rl.redisConnector.ScriptLoad(ctx, s.src); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// toInt64 converts an integer reply of a script
+func toInt64(reply interface{}) (int64, error) {
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected script reply %v", reply)
+	}
+
+	return n, nil
+}
+
+// toStrings converts an array reply of a script
+func toStrings(reply interface{}) ([]string, error) {
+	items, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected script reply %v", reply)
+	}
+
+	result := make([]string, len(items))
+	for i, item := range items {
+		s, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected script reply item %v", item)
+		}
+		result[i] = s
+	}
+
+	return result, nil
+}
+
+// boolArg encodes a flag as a script argument
+func boolArg(b bool) string {
+	if b {
+		return "1"
+	}
+
+	return "0"
+}
@@ -0,0 +1,89 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+	"github.com/y4h2/golang-concurrency-limit/concurrency/concurrencytest"
+)
+
+// scriptCalls returns the script methods called in trace
+func scriptCalls(trace concurrencytest.Trace) []string {
+	var methods []string
+	for _, call := range trace {
+		switch call.Method {
+		case "Eval", "EvalSha", "ScriptLoad":
+			methods = append(methods, call.Method)
+		}
+	}
+
+	return methods
+}
+
+func TestScriptReloadedAfterNoScript(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	redisConn := newTestConnector(mr)
+	conn := concurrencytest.NewRecordingConnector(redisConn)
+	rl := concurrency.NewRateLimiter(conn, testTTL)
+	ctx := context.Background()
+
+	if err := rl.LoadScripts(ctx); err != nil {
+		t.Fatal(err)
+	}
+	before := len(conn.Trace())
+	if _, err := rl.AddJob("pool", 2, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := scriptCalls(conn.Trace()[before:]); fmt.Sprint(got) != "[EvalSha]" {
+		t.Errorf("AddJob with loaded scripts called %v, want a single EvalSha", got)
+	}
+
+	// redis forgets its scripts on a restart or a failover
+	if err := redisConn.Client.ScriptFlush(ctx).Err(); err != nil {
+		t.Fatal(err)
+	}
+	before = len(conn.Trace())
+	if _, err := rl.AddJob("pool", 2, "b", 0); err != nil {
+		t.Fatalf("AddJob after the scripts were flushed: %v", err)
+	}
+	if got := scriptCalls(conn.Trace()[before:]); fmt.Sprint(got) != "[EvalSha ScriptLoad EvalSha]" {
+		t.Errorf("AddJob after the scripts were flushed called %v, want the script reloaded and retried", got)
+	}
+	if n := occupied(t, rl, "pool", 2); n != 2 {
+		t.Errorf("%d slots occupied, want 2", n)
+	}
+}
+
+// noScriptConnector never knows a script by its sha and cannot load scripts
+type noScriptConnector struct {
+	concurrency.RedisConnector
+}
+
+func (c noScriptConnector) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	return nil, errors.New("NOSCRIPT No matching script. Please use EVAL.")
+}
+
+func (c noScriptConnector) ScriptLoad(ctx context.Context, script string) (string, error) {
+	return "", errors.New("ERR unknown command 'script'")
+}
+
+func TestScriptFallsBackToEval(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	conn := concurrencytest.NewRecordingConnector(noScriptConnector{newTestConnector(mr)})
+	rl := concurrency.NewRateLimiter(conn, testTTL)
+
+	if _, err := rl.AddJob("pool", 2, "a", 0); err != nil {
+		t.Fatalf("AddJob without script loading: %v", err)
+	}
+	if got := scriptCalls(conn.Trace()); fmt.Sprint(got) != "[EvalSha ScriptLoad Eval]" {
+		t.Errorf("AddJob called %v, want the script sent with Eval", got)
+	}
+	if n := occupied(t, rl, "pool", 2); n != 1 {
+		t.Errorf("%d slots occupied, want 1", n)
+	}
+}
@@ -0,0 +1,138 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ErrDraining defines the error when a job is added to a limiter which drains for shutdown
+var ErrDraining = errors.New("limiter draining")
+
+// defaultShutdownGrace is how long HandleSignals waits for the owned slots to be released
+const defaultShutdownGrace = 30 * time.Second
+
+// SetDraining makes every acquisition through this limiter fail with ErrDraining while draining is true
+// unlike Pause it only affects this process, jobs holding a slot are not affected
+func (rl *RateLimiter) SetDraining(draining bool) {
+	var v int32
+	if draining {
+		v = 1
+	}
+	atomic.StoreInt32(&rl.draining, v)
+}
+
+// Draining reports whether the limiter drains, see SetDraining
+func (rl *RateLimiter) Draining() bool {
+	return atomic.LoadInt32(&rl.draining) == 1
+}
+
+// checkAdmission returns ErrDraining while this limiter drains, or a *PausedError if jobType is paused
+func (rl *RateLimiter) checkAdmission(ctx context.Context, jobType string) error {
+	if rl.Draining() {
+		return ErrDraining
+	}
+
+	return rl.checkPaused(ctx, jobType)
+}
+
+// Close drains the limiter and releases every slot still held through it
+// the slots are released like DeleteJob releases them, ones which expired or were taken by another job
+// in the meantime are left alone
+// it requires WithOwnedTracking to know the held slots, without it Close only drains
+func (rl *RateLimiter) Close(ctx context.Context) error {
+	rl.SetDraining(true)
+	if rl.owned == nil {
+		return nil
+	}
+
+	slots, _ := rl.owned.snapshot()
+	var lastErr error
+	for slotKey, jobID := range slots {
+		released, err := rl.releaseHeld(ctx, slotKey, jobID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !released {
+			rl.owned.remove(ctx, slotKey, jobID)
+		}
+	}
+
+	return lastErr
+}
+
+// slotJobType returns the jobType of a slot key generated by GenJobKeys
+func slotJobType(slotKey string) string {
+	if i := strings.LastIndex(slotKey, "-"); i >= 0 {
+		return slotKey[:i]
+	}
+
+	return slotKey
+}
+
+// defaultShutdownSignals are the signals handled by HandleSignals when none are given
+var defaultShutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// HandleSignals shuts the limiter down gracefully once one of sig is received:
+// it drains the limiter, waits up to the grace period of WithShutdownGrace for the owned slots
+// to be released through WaitIdle and releases the remaining ones through Close
+// the signals are no longer delivered to the default handler, so the application still
+// has to stop itself, e.g. by cancelling ctx or watching for the same signals
+// without sig it handles os.Interrupt and syscall.SIGTERM, never every signal like signal.Notify
+// stop unregisters the handler and waits for a shutdown in progress, ctx being done has the same effect
+func (rl *RateLimiter) HandleSignals(ctx context.Context, sig ...os.Signal) (stop func()) {
+	if len(sig) == 0 {
+		sig = defaultShutdownSignals
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, sig...)
+	stopped := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer signal.Stop(signals)
+		select {
+		case <-ctx.Done():
+		case <-stopped:
+		case <-signals:
+			rl.shutdown()
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(stopped)
+		})
+		<-done
+	}
+}
+
+// shutdown drains, waits for the owned slots and releases what is left
+func (rl *RateLimiter) shutdown() {
+	rl.SetDraining(true)
+
+	grace := rl.shutdownGrace
+	if grace <= 0 {
+		grace = defaultShutdownGrace
+	}
+	waitCtx, cancel := context.WithTimeout(context.Background(), grace)
+	err := rl.WaitIdle(waitCtx)
+	cancel()
+	if err == nil {
+		return
+	}
+
+	closeCtx, cancel := context.WithTimeout(context.Background(), leaseReleaseTimeout)
+	defer cancel()
+	if err := rl.Close(closeCtx); err != nil {
+		rl.logf("concurrency: releasing the owned slots on shutdown failed: %v", err)
+	}
+}
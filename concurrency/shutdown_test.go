@@ -0,0 +1,126 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestCloseReleasesOwnedSlots(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithOwnedTracking())
+	defer mr.Close()
+	ctx := context.Background()
+
+	for _, jobID := range []string{"a", "b", "c"} {
+		if _, err := rl.AddJob("pool", 4, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// c lost its slot to another instance's job, which Close must leave alone
+	mr.Set("pool-2", "other")
+	other := concurrency.NewRateLimiter(newTestConnector(mr), testTTL)
+	if _, err := other.AddJob("pool", 4, "d", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rl.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !rl.Draining() {
+		t.Error("Close did not drain the limiter")
+	}
+	jobs, err := other.ListJobs("pool", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs["pool-0"] != "" || jobs["pool-1"] != "" || jobs["pool-2"] != "other" || jobs["pool-3"] != "d" {
+		t.Errorf("the pool holds %v after Close, want only the jobs of others", jobs)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := rl.WaitIdle(waitCtx); err != nil {
+		t.Errorf("WaitIdle after Close returned %v", err)
+	}
+	if _, err := rl.AddJob("pool", 4, "e", 0); !errors.Is(err, concurrency.ErrDraining) {
+		t.Errorf("AddJob after Close returned %v, want ErrDraining", err)
+	}
+}
+
+func TestHandleSignals(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithOwnedTracking(), concurrency.WithShutdownGrace(200*time.Millisecond))
+	defer mr.Close()
+
+	for _, jobID := range []string{"quick", "stuck"} {
+		if _, err := rl.AddJob("pool", 2, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stop := rl.HandleSignals(context.Background(), os.Interrupt)
+	defer stop()
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Skipf("cannot signal the test process: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !rl.Draining() {
+		if time.Now().After(deadline) {
+			t.Fatal("the signal did not drain the limiter")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// one job finishes within the grace period, the other is released by the shutdown
+	if _, err := rl.DeleteJob("pool", 2, "quick"); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	if n := occupied(t, rl, "pool", 2); n != 0 {
+		t.Errorf("%d slots occupied after the shutdown", n)
+	}
+}
+
+func TestHandleSignalsDefault(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	// another signal is left alone, it reaches the handler of the application
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	stop := rl.HandleSignals(context.Background())
+	defer stop()
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		t.Skipf("cannot signal the test process: %v", err)
+	}
+	<-hangup
+	time.Sleep(20 * time.Millisecond)
+	if rl.Draining() {
+		t.Fatal("SIGHUP drained the limiter")
+	}
+
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		t.Skipf("cannot signal the test process: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !rl.Draining() {
+		if time.Now().After(deadline) {
+			t.Fatal("SIGTERM did not drain the limiter")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
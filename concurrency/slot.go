@@ -0,0 +1,327 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slotSeparator separates the fields of a stored slot value
+// the default jobID validator rejects control characters, so it never appears inside a jobID
+const slotSeparator = "\x1f"
+
+// slotVersionMarker starts a versioned slot value, "<marker><version><sep><fields>"
+// values written before versioning start directly with the jobID and are read as version 0
+const slotVersionMarker = "\x1e"
+
+// slotValueVersion is the version of the slot values written by this package
+// a reader fails with ErrUnsupportedValueVersion on any newer version
+const slotValueVersion = "1"
+
+// luaJobID defines the lua functions extracting the fields part and the jobID from a stored slot value
+// the jobID of a value with an unknown version is the raw value, which never equals a valid jobID
+const luaJobID = `
+local function slotbody(v)
+	if string.byte(v, 1) ~= 30 then
+		return v
+	end
+	local i = string.find(v, '\31', 1, true)
+	if not i or string.sub(v, 2, i - 1) ~= '` + slotValueVersion + `' then
+		return nil
+	end
+	return string.sub(v, i + 1)
+end
+local function jobid(v)
+	if not v then
+		return false
+	end
+	local body = slotbody(v)
+	if not body then
+		return v
+	end
+	local i = string.find(body, '\31', 1, true)
+	if i then
+		return string.sub(body, 1, i - 1)
+	end
+	return body
+end
+`
+
+// luaSlotFields defines the lua functions splitting a stored slot value into its fields
+// and joining them again as a value of the current version, it requires luaJobID
+const luaSlotFields = `
+local function splitslot(v)
+	local fields = {}
+	for field in string.gmatch(slotbody(v) .. '\31', '([^\31]*)\31') do
+		table.insert(fields, field)
+	end
+	return fields
+end
+local function joinslot(fields, n)
+	for i = 1, n do
+		if fields[i] == nil then
+			fields[i] = ''
+		end
+	end
+	return '\030` + slotValueVersion + `\031' .. table.concat(fields, '\31')
+end
+`
+
+// ErrCorruptSlotValue defines the error when a stored slot value cannot be parsed
+var ErrCorruptSlotValue = errors.New("corrupt slot value")
+
+// ErrConnectorContract defines the error when a connector returns a reply which breaks the RedisConnector contract
+var ErrConnectorContract = errors.New("connector contract violated")
+
+// ErrUnsupportedValueVersion defines the error when a slot value was written by a newer version
+var ErrUnsupportedValueVersion = errors.New("unsupported slot value version")
+
+// SlotValue is the decoded value of a slot
+// an empty JobID means the slot is free
+// it is stored as "\x1e<version>\x1f" followed by its fields joined by "\x1f" in the order
+// of the slotField constants, integers and times in unix milliseconds as decimals, zero values empty;
+// the lua scripts parse the same format, so every feature goes through encodeSlotValue and decodeSlotValue
+type SlotValue struct {
+	JobID         string
+	AcquiredAt    time.Time
+	Token         int64
+	RefCount      int64
+	LastRenewedAt time.Time
+	Owner         string
+	TraceID       string
+	// ExpectedDuration is how long the holder declared to need the slot, zero if it did not
+	ExpectedDuration time.Duration
+}
+
+// positions of the fields in a stored slot value, new fields are only ever appended
+// owner and trace id are strings, the other fields are integers
+const (
+	slotFieldJobID = iota
+	slotFieldAcquiredAt
+	slotFieldToken
+	slotFieldRefCount
+	slotFieldLastRenewedAt
+	slotFieldOwner
+	slotFieldTraceID
+	slotFieldExpectedDuration
+	slotFieldCount
+)
+
+// encodeSlotValue formats v as the version marker and version followed by its fields
+// joined by the separator, starting with the jobID
+// times are in unix milliseconds, zero values are written as empty fields
+// and trailing empty fields after acquiredAt are omitted
+func encodeSlotValue(v SlotValue) string {
+	fields := make([]string, slotFieldCount)
+	fields[slotFieldJobID] = v.JobID
+	fields[slotFieldAcquiredAt] = formatMilli(v.AcquiredAt)
+	fields[slotFieldToken] = formatInt(v.Token)
+	fields[slotFieldRefCount] = formatInt(v.RefCount)
+	fields[slotFieldLastRenewedAt] = formatMilli(v.LastRenewedAt)
+	fields[slotFieldOwner] = v.Owner
+	fields[slotFieldTraceID] = v.TraceID
+	fields[slotFieldExpectedDuration] = formatInt(int64(v.ExpectedDuration / time.Millisecond))
+
+	n := len(fields)
+	for n > slotFieldAcquiredAt+1 && fields[n-1] == "" {
+		n--
+	}
+
+	return slotVersionMarker + slotValueVersion + slotSeparator + strings.Join(fields[:n], slotSeparator)
+}
+
+// decodeSlotValue parses a stored slot value
+// an unversioned value is read with the same fields, a value without separator
+// is a bare jobID written before timestamps were stored
+// a newer version fails with ErrUnsupportedValueVersion
+// and a field which is not a valid integer with ErrCorruptSlotValue
+func decodeSlotValue(raw string) (SlotValue, error) {
+	body, err := slotValueBody(raw)
+	if err != nil {
+		return SlotValue{}, err
+	}
+
+	fields := strings.Split(body, slotSeparator)
+	if len(fields) > slotFieldCount {
+		// fields appended by a newer release of the same version are not known yet
+		fields = fields[:slotFieldCount]
+	}
+
+	var ints [slotFieldCount]int64
+	for i := slotFieldJobID + 1; i < len(fields); i++ {
+		if fields[i] == "" || i == slotFieldOwner || i == slotFieldTraceID {
+			continue
+		}
+		n, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return SlotValue{}, fmt.Errorf("%w: %q", ErrCorruptSlotValue, fields[i])
+		}
+		ints[i] = n
+	}
+
+	v := SlotValue{
+		JobID:    fields[slotFieldJobID],
+		Token:    ints[slotFieldToken],
+		RefCount: ints[slotFieldRefCount],
+	}
+	if len(fields) > slotFieldOwner {
+		v.Owner = fields[slotFieldOwner]
+	}
+	if len(fields) > slotFieldTraceID {
+		v.TraceID = fields[slotFieldTraceID]
+	}
+	v.ExpectedDuration = time.Duration(ints[slotFieldExpectedDuration]) * time.Millisecond
+	if ints[slotFieldAcquiredAt] != 0 {
+		v.AcquiredAt = fromUnixMilli(ints[slotFieldAcquiredAt])
+	}
+	if ints[slotFieldLastRenewedAt] != 0 {
+		v.LastRenewedAt = fromUnixMilli(ints[slotFieldLastRenewedAt])
+	}
+
+	return v, nil
+}
+
+// ParseSlotValue decodes a raw slot value read from redis, e.g. by an external tool
+// a bare string without version marker is a jobID written by an older release
+func ParseSlotValue(raw string) (SlotValue, error) {
+	return decodeSlotValue(raw)
+}
+
+// slotValueBody strips the version prefix of a stored slot value and returns its fields part
+func slotValueBody(raw string) (string, error) {
+	if !strings.HasPrefix(raw, slotVersionMarker) {
+		return raw, nil
+	}
+
+	i := strings.Index(raw, slotSeparator)
+	if i < 0 {
+		return "", fmt.Errorf("%w: missing version separator", ErrCorruptSlotValue)
+	}
+	version := raw[len(slotVersionMarker):i]
+	if version != slotValueVersion {
+		if _, err := strconv.Atoi(version); err != nil {
+			return "", fmt.Errorf("%w: version %q", ErrCorruptSlotValue, version)
+		}
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedValueVersion, version)
+	}
+
+	return raw[i+1:], nil
+}
+
+// formatMilli formats t in unix milliseconds, a zero time is empty
+func formatMilli(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return strconv.FormatInt(unixMilli(t), 10)
+}
+
+// formatInt formats n, zero is empty
+func formatInt(n int64) string {
+	if n == 0 {
+		return ""
+	}
+
+	return strconv.FormatInt(n, 10)
+}
+
+// ttlMilli returns ttl in milliseconds for a PX expiry, rounding a positive ttl below
+// one millisecond up to one, since the scripts treat zero as no expiry at all
+func ttlMilli(ttl time.Duration) int64 {
+	if ttl > 0 && ttl < time.Millisecond {
+		return 1
+	}
+
+	return ttl.Milliseconds()
+}
+
+// fromUnixMilli returns the local time of milliseconds since the unix epoch
+func fromUnixMilli(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// listSlots reads and decodes all slots of jobType through conn in index order
+func (rl *RateLimiter) listSlots(ctx context.Context, conn RedisConnector, jobType string, limit int) ([]string, []SlotValue, error) {
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	// a disabled pool has no slots, and MGet without keys is an error
+	if len(slotKeys) == 0 {
+		return slotKeys, nil, nil
+	}
+	values, err := conn.MGet(ctx, slotKeys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkReplyLength("MGet", len(slotKeys), len(values)); err != nil {
+		return nil, nil, err
+	}
+
+	slots := make([]SlotValue, len(values))
+	for i, value := range values {
+		slot, err := rl.decodeSlot(slotKeys[i], value)
+		if err != nil {
+			return nil, nil, err
+		}
+		slots[i] = slot
+	}
+
+	return slotKeys, slots, nil
+}
+
+// checkReplyLength fails with ErrConnectorContract unless a connector returned one value per key
+func checkReplyLength(method string, keys, values int) error {
+	if keys != values {
+		return fmt.Errorf("%w: %s returned %d values for %d keys", ErrConnectorContract, method, values, keys)
+	}
+
+	return nil
+}
+
+// decodeSlot decodes the value of slotKey, only a missing key is a free slot
+// a value of a newer version is logged and read as occupied by its raw value,
+// which never matches a valid jobID, so the slot is neither taken nor released
+// while old and new versions run side by side; so is a value without jobID
+func (rl *RateLimiter) decodeSlot(slotKey, raw string) (SlotValue, error) {
+	slot, err := decodeSlotValue(raw)
+	if errors.Is(err, ErrUnsupportedValueVersion) {
+		rl.logf("concurrency: slot %s: %v", slotKey, err)
+		return SlotValue{JobID: raw}, nil
+	}
+	if err != nil {
+		return SlotValue{}, fmt.Errorf("slot %s: %w", slotKey, err)
+	}
+	if raw != "" && slot.JobID == "" {
+		rl.logf("concurrency: slot %s: value without job id", slotKey)
+		return SlotValue{JobID: raw}, nil
+	}
+
+	return slot, nil
+}
+
+// newSlot returns the value of a slot taken by jobID at the given time
+func (rl *RateLimiter) newSlot(ctx context.Context, jobID string, at time.Time) SlotValue {
+	v := SlotValue{JobID: jobID, AcquiredAt: at, Owner: rl.ownerIdentity}
+	if rl.traceID != nil {
+		v.TraceID = rl.traceID(ctx)
+	}
+	if expected, ok := ctx.Value(expectedDurationKey{}).(time.Duration); ok {
+		v.ExpectedDuration = expected
+	}
+
+	return v
+}
+
+// now returns the current time of the configured clock
+func (rl *RateLimiter) now() time.Time {
+	if rl.clock != nil {
+		return rl.clock()
+	}
+
+	return time.Now()
+}
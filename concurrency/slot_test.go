@@ -0,0 +1,279 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestParseSlotValue(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		raw  string
+		want concurrency.SlotValue
+		err  error
+	}{
+		{name: "bare jobID", raw: "job", want: concurrency.SlotValue{JobID: "job"}},
+		{name: "unversioned", raw: "job\x1f1614600000000\x1f7", want: concurrency.SlotValue{
+			JobID: "job", AcquiredAt: time.Unix(1614600000, 0), Token: 7,
+		}},
+		{name: "versioned", raw: "\x1e1\x1fjob\x1f1614600000000\x1f7\x1f2", want: concurrency.SlotValue{
+			JobID: "job", AcquiredAt: time.Unix(1614600000, 0), Token: 7, RefCount: 2,
+		}},
+		{name: "malformed token", raw: "\x1e1\x1fjob\x1f1614600000000\x1fseven", err: concurrency.ErrCorruptSlotValue},
+		{name: "malformed timestamp", raw: "job\x1fyesterday", err: concurrency.ErrCorruptSlotValue},
+		{name: "overflowing refcount", raw: "job\x1f\x1f\x1f99999999999999999999", err: concurrency.ErrCorruptSlotValue},
+		{name: "missing version separator", raw: "\x1e1job", err: concurrency.ErrCorruptSlotValue},
+		{name: "malformed version", raw: "\x1ev1\x1fjob", err: concurrency.ErrCorruptSlotValue},
+		{name: "newer version", raw: "\x1e2\x1fjob", err: concurrency.ErrUnsupportedValueVersion},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := concurrency.ParseSlotValue(tt.raw)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("ParseSlotValue returned %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.JobID != tt.want.JobID || !got.AcquiredAt.Equal(tt.want.AcquiredAt) ||
+				got.Token != tt.want.Token || got.RefCount != tt.want.RefCount {
+				t.Errorf("ParseSlotValue returned %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCorruptStoredSlotValue(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 2, "job", 0); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := mr.Get("pool-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := concurrency.ParseSlotValue(raw); err != nil || v.JobID != "job" {
+		t.Fatalf("ParseSlotValue of a stored value returned %+v, %v", v, err)
+	}
+
+	mr.Set("pool-1", "other\x1fnot-a-time")
+	if _, err := rl.ListJobs("pool", 2); !errors.Is(err, concurrency.ErrCorruptSlotValue) {
+		t.Errorf("ListJobs returned %v, want ErrCorruptSlotValue", err)
+	}
+	if _, err := rl.DetectOrphans(context.Background(), "pool", 2, time.Minute); !errors.Is(err, concurrency.ErrCorruptSlotValue) {
+		t.Errorf("DetectOrphans returned %v, want ErrCorruptSlotValue", err)
+	}
+}
+
+func TestSlotValueVersions(t *testing.T) {
+	logger := &testLogger{}
+	rl, mr := newTestLimiter(t, concurrency.WithLogger(logger))
+	defer mr.Close()
+	ctx := context.Background()
+
+	// a value of a newer version is logged and kept occupied, it is never taken, freed or misread
+	newer := "\x1e2\x1fnewer\x1fsomething"
+	mr.Set("pool-0", newer)
+	if jobs, err := rl.ListJobs("pool", 2); err != nil || jobs["pool-0"] != newer {
+		t.Errorf("ListJobs returned %q, %v, want the raw newer value", jobs, err)
+	}
+	if lines := logger.Lines(); len(lines) == 0 || !strings.Contains(lines[0], concurrency.ErrUnsupportedValueVersion.Error()) {
+		t.Errorf("logged %q, want the unsupported version", lines)
+	}
+	if _, err := rl.AddJob("pool", 2, "job", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.AddJob("pool", 2, "other", 0); err == nil {
+		t.Error("AddJob took the slot holding a newer value")
+	}
+	if ok, err := rl.DeleteJob("pool", 2, "newer"); err != nil || ok {
+		t.Errorf("DeleteJob of the job in the newer value returned %v, %v", ok, err)
+	}
+	if raw, _ := mr.Get("pool-0"); raw != newer {
+		t.Errorf("the newer value was changed to %q", raw)
+	}
+
+	// a value written before versioning is read and rewritten as the current version
+	mr.Del("pool-0")
+	mr.Set("pool-0", "legacy\x1f1614600000000")
+	jobs, err := rl.ListJobs("pool", 2)
+	if err != nil || jobs["pool-0"] != "legacy" {
+		t.Fatalf("ListJobs returned %v, %v, want the legacy job", jobs, err)
+	}
+	if err := rl.ExtendJob(ctx, "pool", 2, "legacy", 0); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := mr.Get("pool-0")
+	v, err := concurrency.ParseSlotValue(raw)
+	if err != nil || v.JobID != "legacy" || v.AcquiredAt.IsZero() || v.LastRenewedAt.IsZero() {
+		t.Errorf("the renewed legacy slot reads %+v, %v", v, err)
+	}
+	if !strings.HasPrefix(raw, "\x1e1\x1f") {
+		t.Errorf("the renewed legacy slot holds %q, want the current version", raw)
+	}
+	if ok, err := rl.DeleteJob("pool", 2, "legacy"); err != nil || !ok {
+		t.Errorf("DeleteJob of the legacy job returned %v, %v", ok, err)
+	}
+}
+
+func TestMissingKeyIsTheOnlyFreeSlot(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithLogger(&testLogger{}))
+	defer mr.Close()
+
+	// a missing key is free
+	jobs, err := rl.ListJobs("pool", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 || jobs["pool-0"] != "" || jobs["pool-1"] != "" || jobs["pool-2"] != "" {
+		t.Errorf("ListJobs of an empty pool returned %v, want three free slots", jobs)
+	}
+
+	// values without a jobID are occupied, never free
+	mr.Set("pool-0", "\x1e1\x1f\x1f1614600000000")
+	mr.Set("pool-1", "\x1f\x1f7")
+	jobs, err = rl.ListJobs("pool", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs["pool-0"] == "" || jobs["pool-1"] == "" || jobs["pool-2"] != "" {
+		t.Errorf("ListJobs returned %q, want the values without jobID occupied", jobs)
+	}
+	if _, err := rl.AddJob("pool", 3, "job", 0); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := rl.FindJobSlot(context.Background(), "pool", 3, "job"); err != nil || key != "pool-2" {
+		t.Errorf("AddJob took %q (%v), want the missing key pool-2", key, err)
+	}
+	if _, err := rl.AddJob("pool", 3, "other", 0); err == nil {
+		t.Error("AddJob took a slot holding a value without jobID")
+	}
+}
+
+// shortReplyConnector drops the last value of every reply of method, MGet or PTTL
+type shortReplyConnector struct {
+	concurrency.RedisConnector
+	method string
+}
+
+func (c shortReplyConnector) MGet(ctx context.Context, keys []string) ([]string, error) {
+	values, err := c.RedisConnector.MGet(ctx, keys)
+	if c.method == "MGet" && len(values) > 0 {
+		values = values[:len(values)-1]
+	}
+	return values, err
+}
+
+func (c shortReplyConnector) PTTL(ctx context.Context, keys []string) ([]time.Duration, error) {
+	ttls, err := c.RedisConnector.PTTL(ctx, keys)
+	if c.method == "PTTL" && len(ttls) > 0 {
+		ttls = ttls[:len(ttls)-1]
+	}
+	return ttls, err
+}
+
+func TestShortConnectorReply(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	rl := concurrency.NewRateLimiter(shortReplyConnector{newTestConnector(mr), "MGet"}, testTTL)
+	ctx := context.Background()
+	mr.Set("pool-0", "a")
+	mr.Set("pool-1", "b")
+
+	if _, err := rl.ListJobs("pool", 3); !errors.Is(err, concurrency.ErrConnectorContract) {
+		t.Errorf("ListJobs returned %v, want ErrConnectorContract", err)
+	}
+	if _, err := rl.FreeSlots(ctx, "pool", 3); !errors.Is(err, concurrency.ErrConnectorContract) {
+		t.Errorf("FreeSlots returned %v, want ErrConnectorContract", err)
+	}
+	entries, errs := rl.StreamJobs(ctx, "pool", 3, 2)
+	for range entries {
+	}
+	if err := <-errs; !errors.Is(err, concurrency.ErrConnectorContract) {
+		t.Errorf("StreamJobs returned %v, want ErrConnectorContract", err)
+	}
+
+	// the ttls are read with PTTL when the backend cannot run scripts
+	rl = concurrency.NewRateLimiter(shortReplyConnector{noEvalConnector{newTestConnector(mr)}, "PTTL"}, testTTL,
+		concurrency.WithLogger(&testLogger{}))
+	if _, err := rl.ListJobsWithTTL(ctx, "pool", 3); !errors.Is(err, concurrency.ErrConnectorContract) {
+		t.Errorf("ListJobsWithTTL returned %v, want ErrConnectorContract", err)
+	}
+}
+
+func TestSlotValueRoundTrip(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now), concurrency.WithOwnerIdentity("worker-1"),
+		concurrency.WithTraceID(func(ctx context.Context) string { return "trace-1" }))
+	defer mr.Close()
+	ctx := concurrency.ContextWithExpectedDuration(context.Background(), 90*time.Second)
+
+	_, token, err := rl.AddJobWithToken(ctx, "pool", 3, "full", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second)
+	if err := rl.ExtendJob(ctx, "pool", 3, "full", 0); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := mr.Get("pool-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := concurrency.ParseSlotValue(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := concurrency.SlotValue{
+		JobID:            "full",
+		AcquiredAt:       clock.Now().Add(-time.Second),
+		Token:            token,
+		LastRenewedAt:    clock.Now(),
+		Owner:            "worker-1",
+		TraceID:          "trace-1",
+		ExpectedDuration: 90 * time.Second,
+	}
+	if got.JobID != want.JobID || !got.AcquiredAt.Equal(want.AcquiredAt) || got.Token != want.Token ||
+		!got.LastRenewedAt.Equal(want.LastRenewedAt) || got.Owner != want.Owner || got.TraceID != want.TraceID ||
+		got.ExpectedDuration != want.ExpectedDuration || got.RefCount != 0 {
+		t.Errorf("the stored value parsed as %+v, want %+v", got, want)
+	}
+
+	// a minimal value only carries the jobID, its acquisition time and its token
+	plain, mr2 := newTestLimiter(t, concurrency.WithClock(clock.Now))
+	defer mr2.Close()
+	if _, err := plain.AddJob("pool", 3, "minimal", 0); err != nil {
+		t.Fatal(err)
+	}
+	raw, err = mr2.Get("pool-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = concurrency.ParseSlotValue(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.JobID != "minimal" || !got.AcquiredAt.Equal(clock.Now()) || got.Owner != "" || got.TraceID != "" ||
+		got.ExpectedDuration != 0 || !got.LastRenewedAt.IsZero() {
+		t.Errorf("the minimal value parsed as %+v", got)
+	}
+
+	// a bare jobID written by an older release is still listed and released
+	mr2.Set("pool-1", "legacy")
+	jobs, err := plain.ListJobs("pool", 3)
+	if err != nil || jobs["pool-1"] != "legacy" {
+		t.Errorf("ListJobs returned %v, %v, want the legacy job in pool-1", jobs, err)
+	}
+	if ok, err := plain.DeleteJob("pool", 3, "legacy"); err != nil || !ok {
+		t.Errorf("DeleteJob of the legacy job returned %v, %v", ok, err)
+	}
+}
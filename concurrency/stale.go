@@ -0,0 +1,74 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// releaseIfStaleScript releases a slot like luaReleaseSlot if it was neither acquired nor renewed since a cutoff
+// KEYS[5] is the slot key, ARGV[5] the cutoff in unix milliseconds,
+// ARGV[6] and ARGV[7] the positions of the acquisition and renewal fields and ARGV[8] the index of the slot
+// slots without an acquisition timestamp are kept, it returns the jobID of the released slot or false
+var releaseIfStaleScript = newScript(luaJobID + luaSlotFields + luaReleaseSlot + `
+local v = redis.call('GET', KEYS[5])
+if not v or v == '' or not slotbody(v) then
+	return false
+end
+local fields = splitslot(v)
+local acquired = tonumber(fields[tonumber(ARGV[6])])
+if not acquired or acquired <= 0 then
+	return false
+end
+local renewed = tonumber(fields[tonumber(ARGV[7])])
+if renewed and renewed > acquired then
+	acquired = renewed
+end
+if acquired >= tonumber(ARGV[5]) then
+	return false
+end
+local id = jobid(v)
+releaseslot(KEYS[5], id, ARGV[8])
+return id
+`)
+
+// ReleaseIfStale releases slotKey of jobType if it was last acquired or renewed more than maxAge ago
+// the check and the delete run as one script, so a holder renewing its slot meanwhile is not clobbered
+// it reports whether the slot was released, a free slot or one without an acquisition timestamp is kept
+// the slot is released like DeleteJob releases it
+func (rl *RateLimiter) ReleaseIfStale(ctx context.Context, jobType string, limit int, slotKey string, maxAge time.Duration) (released bool, err error) {
+	start := time.Now()
+	defer func() {
+		rl.observeOperation(ctx, "release_if_stale", jobType, start, err)
+	}()
+
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return false, err
+	}
+	index := -1
+	for i, key := range slotKeys {
+		if key == slotKey {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return false, fmt.Errorf("%s is not a slot of %s", slotKey, jobType)
+	}
+
+	cutoff := rl.now().Add(-maxAge)
+	reply, err := releaseIfStaleScript.Run(ctx, rl.redisConnector, releaseKeys(jobType, slotKey),
+		rl.releaseArgs(unixMilli(cutoff), slotFieldAcquiredAt+1, slotFieldLastRenewedAt+1, index)...)
+	if err != nil {
+		return false, err
+	}
+	jobID, ok := reply.(string)
+	if !ok {
+		return false, nil
+	}
+	rl.released(ctx, jobType, slotKey, jobID)
+	rl.count(ctx, jobType, counterReleases, 1)
+
+	return true, nil
+}
@@ -0,0 +1,67 @@
+package concurrency_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestReleaseIfStale(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now))
+	defer mr.Close()
+	ctx := context.Background()
+
+	for _, jobID := range []string{"stale", "renewed"} {
+		if _, err := rl.AddJob("pool", 5, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.Advance(9 * time.Minute)
+	if _, err := rl.AddJob("pool", 5, "fresh", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.ExtendJob(ctx, "pool", 5, "renewed", 0); err != nil {
+		t.Fatal(err)
+	}
+	// a bare jobID was written before acquisition timestamps were stored
+	mr.Set("pool-4", "legacy")
+	clock.Advance(time.Minute)
+
+	for _, tt := range []struct {
+		slotKey  string
+		released bool
+	}{
+		{"pool-0", true},
+		{"pool-1", false},
+		{"pool-2", false},
+		{"pool-3", false},
+		{"pool-4", false},
+	} {
+		released, err := rl.ReleaseIfStale(ctx, "pool", 5, tt.slotKey, 5*time.Minute)
+		if err != nil || released != tt.released {
+			t.Errorf("ReleaseIfStale %s returned %v, %v, want %v", tt.slotKey, released, err, tt.released)
+		}
+	}
+	jobs, err := rl.ListJobs("pool", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for slotKey, jobID := range map[string]string{"pool-0": "", "pool-1": "renewed", "pool-2": "fresh", "pool-4": "legacy"} {
+		if jobs[slotKey] != jobID {
+			t.Errorf("%s holds %q, want %q", slotKey, jobs[slotKey], jobID)
+		}
+	}
+
+	// once the renewal is old enough the slot goes as well
+	clock.Advance(5 * time.Minute)
+	if released, err := rl.ReleaseIfStale(ctx, "pool", 5, "pool-1", 5*time.Minute); err != nil || !released {
+		t.Errorf("ReleaseIfStale of an old renewal returned %v, %v", released, err)
+	}
+
+	if _, err := rl.ReleaseIfStale(ctx, "pool", 5, "other-0", time.Minute); err == nil {
+		t.Error("ReleaseIfStale of a slot of another jobType succeeded")
+	}
+}
@@ -0,0 +1,79 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+)
+
+// readStateScript reads the slots together with the auxiliary state of a jobType
+// KEYS[1] is the counters hash, KEYS[2] the token list, KEYS[3..] the slot keys
+var readStateScript = newScript(`
+local values = {}
+for i = 3, #KEYS do
+	values[i - 2] = redis.call('GET', KEYS[i]) or ''
+end
+local counters = redis.call('HMGET', KEYS[1], 'grants', 'rejections', 'releases')
+return {values, counters, redis.call('LLEN', KEYS[2])}
+`)
+
+// ConsistentState is the state of a jobType captured at a single point in time
+type ConsistentState struct {
+	// Jobs maps every slot key to its jobID, empty for a free slot, like ListJobs
+	Jobs map[string]string
+	// Counters are the persistent counters, zero unless WithPersistentCounters is set
+	Counters LifetimeStats
+	// FreeTokens is the length of the token list, zero unless WithTokenList is set
+	FreeTokens int64
+}
+
+// ReadConsistentState reads the slots, the persistent counters and the token list of jobType
+// in a single lua script, so all parts reflect the same moment
+// unlike ListJobs it always runs on the primary and blocks redis while it reads every slot,
+// so prefer ListJobs when a coherent view of the auxiliary state is not needed
+func (rl *RateLimiter) ReadConsistentState(ctx context.Context, jobType string, limit int) (ConsistentState, error) {
+	listKey, _ := tokenKeys(jobType)
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return ConsistentState{}, err
+	}
+	keys := append([]string{countersKey(jobType), listKey}, slotKeys...)
+	reply, err := readStateScript.Run(ctx, rl.redisConnector, keys)
+	if err != nil {
+		return ConsistentState{}, err
+	}
+
+	parts, ok := reply.([]interface{})
+	if !ok || len(parts) != 3 {
+		return ConsistentState{}, fmt.Errorf("unexpected script reply %v", reply)
+	}
+	values, err := toStrings(parts[0])
+	if err != nil {
+		return ConsistentState{}, err
+	}
+	if len(values) != len(slotKeys) {
+		return ConsistentState{}, fmt.Errorf("unexpected script reply %v", reply)
+	}
+	counters, err := parseCounters(parts[1])
+	if err != nil {
+		return ConsistentState{}, err
+	}
+	tokens, err := toInt64(parts[2])
+	if err != nil {
+		return ConsistentState{}, err
+	}
+
+	state := ConsistentState{
+		Jobs:       make(map[string]string, len(slotKeys)),
+		Counters:   counters,
+		FreeTokens: tokens,
+	}
+	for i, value := range values {
+		slot, err := rl.decodeSlot(slotKeys[i], value)
+		if err != nil {
+			return ConsistentState{}, err
+		}
+		state.Jobs[slotKeys[i]] = slot.JobID
+	}
+
+	return state, nil
+}
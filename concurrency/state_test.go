@@ -0,0 +1,101 @@
+package concurrency_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// churn adds and deletes jobs of jobType from several goroutines until stop is closed
+func churn(t *testing.T, rl *concurrency.RateLimiter, jobType string, limit int, stop <-chan struct{}) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				jobID := fmt.Sprintf("job-%d-%d", w, i)
+				if _, err := rl.AddJob(jobType, limit, jobID, 0); err == nil {
+					if _, err := rl.DeleteJob(jobType, limit, jobID); err != nil {
+						t.Errorf("DeleteJob: %v", err)
+					}
+				}
+			}
+		}(w)
+	}
+
+	return &wg
+}
+
+// countJobs returns the number of occupied slots in jobs
+func countJobs(jobs map[string]string) int64 {
+	var n int64
+	for _, jobID := range jobs {
+		if jobID != "" {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestReadConsistentStateUnderContention(t *testing.T) {
+	const limit = 3
+	ctx := context.Background()
+
+	t.Run("token list", func(t *testing.T) {
+		rl, mr := newTestLimiter(t, concurrency.WithTokenList())
+		defer mr.Close()
+		// the token list is filled by the first acquisition
+		if _, err := rl.AddJob("pool", limit, "init", 0); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := rl.DeleteJob("pool", limit, "init"); err != nil {
+			t.Fatal(err)
+		}
+
+		stop := make(chan struct{})
+		wg := churn(t, rl, "pool", limit, stop)
+		defer wg.Wait()
+		defer close(stop)
+		for i := 0; i < 200; i++ {
+			state, err := rl.ReadConsistentState(ctx, "pool", limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// a slot and its token are swapped in one script
+			if occupied := countJobs(state.Jobs); occupied+state.FreeTokens != limit {
+				t.Fatalf("read %d occupied slots and %d free tokens at once, want them to add up to %d",
+					occupied, state.FreeTokens, limit)
+			}
+		}
+	})
+
+	t.Run("active set counters", func(t *testing.T) {
+		rl, mr := newTestLimiter(t, concurrency.WithActiveSet(), concurrency.WithPersistentCounters())
+		defer mr.Close()
+
+		stop := make(chan struct{})
+		wg := churn(t, rl, "pool", limit, stop)
+		defer wg.Wait()
+		defer close(stop)
+		for i := 0; i < 200; i++ {
+			state, err := rl.ReadConsistentState(ctx, "pool", limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the counters are updated by the scripts writing the slots
+			if occupied := countJobs(state.Jobs); state.Counters.Grants-state.Counters.Releases != occupied {
+				t.Fatalf("read %d occupied slots with counters %+v at once", occupied, state.Counters)
+			}
+		}
+	})
+}
@@ -0,0 +1,71 @@
+package concurrency
+
+import "context"
+
+// defaultStreamPageSize is the page size of StreamJobs for a non-positive pageSize
+const defaultStreamPageSize = 1000
+
+// SlotEntry is a slot emitted by StreamJobs, JobID is empty for a free slot
+type SlotEntry struct {
+	Key   string
+	Index int
+	JobID string
+}
+
+// StreamJobs reads the slots of jobType page by page and emits them in index order,
+// so a pool with a huge limit is never held in memory at once
+// the entries channel is closed when all slots were emitted, ctx is done or a read failed;
+// the error, if any, is sent on the error channel before it is closed
+// pages are read one after another, so the stream is not a snapshot of a single moment
+func (rl *RateLimiter) StreamJobs(ctx context.Context, jobType string, limit, pageSize int) (<-chan SlotEntry, <-chan error) {
+	if pageSize <= 0 {
+		pageSize = defaultStreamPageSize
+	}
+	entries := make(chan SlotEntry, pageSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(entries)
+
+		if err := rl.checkLimit(limit); err != nil {
+			errs <- err
+			return
+		}
+		conn := rl.reader()
+		for start := 0; start < limit; start += pageSize {
+			end := start + pageSize
+			if end > limit {
+				end = limit
+			}
+			keys := make([]string, 0, end-start)
+			for i := start; i < end; i++ {
+				keys = append(keys, slotKey(jobType, i))
+			}
+			values, err := conn.MGet(ctx, keys)
+			if err == nil {
+				err = checkReplyLength("MGet", len(keys), len(values))
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			for i, value := range values {
+				slot, err := rl.decodeSlot(keys[i], value)
+				if err != nil {
+					errs <- err
+					return
+				}
+				select {
+				case entries <- SlotEntry{Key: keys[i], Index: start + i, JobID: slot.JobID}:
+				case <-ctx.Done():
+					errs <- ctx.Err()
+					return
+				}
+			}
+		}
+	}()
+
+	return entries, errs
+}
@@ -0,0 +1,66 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStreamJobsInOrder(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	for _, jobID := range []string{"a", "b", "c", "d"} {
+		if _, err := rl.AddJob("pool", 7, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rl.DeleteJob("pool", 7, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, errs := rl.StreamJobs(context.Background(), "pool", 7, 3)
+	want := []string{"a", "", "c", "d", "", "", ""}
+	index := 0
+	for entry := range entries {
+		if index >= len(want) {
+			t.Fatalf("StreamJobs emitted an extra entry %+v", entry)
+		}
+		if entry.Index != index || entry.Key != fmt.Sprintf("pool-%d", index) || entry.JobID != want[index] {
+			t.Errorf("entry %d is %+v, want job %q", index, entry, want[index])
+		}
+		index++
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if index != len(want) {
+		t.Errorf("StreamJobs emitted %d entries, want %d", index, len(want))
+	}
+}
+
+func TestStreamJobsCancelled(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const limit = 1000
+	entries, errs := rl.StreamJobs(ctx, "pool", limit, 2)
+	for i := 0; i < 3; i++ {
+		<-entries
+	}
+	cancel()
+
+	n := 3
+	for range entries {
+		n++
+	}
+	if n >= limit {
+		t.Errorf("StreamJobs emitted all %d entries after the cancel", n)
+	}
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("StreamJobs reported %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,121 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// swapScript replaces the value of every slot, an empty value clears the slot, a new value is stamped with a fencing token
+// KEYS[1] is the fencing token counter, KEYS[2..] the slot keys, ARGV[1] the ttl in milliseconds
+// and ARGV[i] the new value of KEYS[i]
+// it returns the previous holders as key, jobID pairs and the written slots as key, fencing token pairs
+var swapScript = newScript(luaJobID + luaSlotFields + luaFence + `
+local ttl = tonumber(ARGV[1])
+local previous = {}
+local written = {}
+for i = 2, #KEYS do
+	local key = KEYS[i]
+	local old = redis.call('GET', key)
+	if old and old ~= '' then
+		table.insert(previous, key)
+		table.insert(previous, jobid(old))
+	end
+	if ARGV[i] == '' then
+		redis.call('DEL', key)
+	else
+		local value, token = fence(ARGV[i], KEYS[1])
+		if ttl > 0 then
+			redis.call('SET', key, value, 'PX', ttl)
+		else
+			redis.call('SET', key, value)
+		end
+		table.insert(written, key)
+		table.insert(written, token)
+	end
+end
+return {previous, written}
+`)
+
+// SwapOccupancy replaces all jobs of jobType with newJobs, mapping slot indexes to jobIDs, in one script
+// slots missing from newJobs are cleared, so readers see either the old or the new jobs but never a mix,
+// e.g. to point a pool at a new worker generation
+// it is not available with WithTokenList or WithActiveSet whose bookkeeping is not swapped
+func (rl *RateLimiter) SwapOccupancy(ctx context.Context, jobType string, limit int, newJobs map[int]string, ttl time.Duration) (err error) {
+	start := time.Now()
+	defer func() {
+		rl.readCache.invalidate(jobType)
+		rl.observeOperation(ctx, "swap_occupancy", jobType, start, err)
+	}()
+
+	if err := rl.rejectDryRun("SwapOccupancy"); err != nil {
+		return err
+	}
+
+	if rl.tokenList || rl.activeSet {
+		return errors.New("SwapOccupancy is not available with WithTokenList or WithActiveSet")
+	}
+	for index, jobID := range newJobs {
+		if index < 0 || index >= limit {
+			return fmt.Errorf("slot index %d out of range for limit %d", index, limit)
+		}
+		if err := rl.validateJobID(jobID); err != nil {
+			return err
+		}
+	}
+	if len(newJobs) > 0 {
+		if err := rl.checkSlotMetadata(ctx); err != nil {
+			return err
+		}
+		if ttl, err = rl.acquireTTL(ctx, ttl); err != nil {
+			return err
+		}
+	}
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return err
+	}
+
+	now := rl.now()
+	args := make([]interface{}, 0, len(slotKeys)+1)
+	args = append(args, ttlMilli(ttl))
+	for i := range slotKeys {
+		value := ""
+		if jobID, ok := newJobs[i]; ok {
+			value = encodeSlotValue(rl.newSlot(ctx, jobID, now))
+		}
+		args = append(args, value)
+	}
+	keys := append([]string{fenceKey(jobType)}, slotKeys...)
+	reply, err := swapScript.Run(ctx, rl.redisConnector, keys, args...)
+	if err != nil {
+		return err
+	}
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != 2 {
+		return fmt.Errorf("unexpected script reply %v", reply)
+	}
+	previous, err := toStrings(items[0])
+	if err != nil {
+		return err
+	}
+	written, ok := items[1].([]interface{})
+	if !ok {
+		return fmt.Errorf("unexpected script reply %v", reply)
+	}
+	writtenKeys, tokens, err := toSlotTokens(written)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i+1 < len(previous); i += 2 {
+		rl.released(ctx, jobType, previous[i], previous[i+1])
+	}
+	for i, k := range writtenKeys {
+		index, _ := slotIndex(jobType, k)
+		rl.acquired(ctx, jobType, k, newJobs[index], tokens[i])
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package concurrency_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// activeJobs returns the occupied slots of jobType as slot key, jobID pairs
+func activeJobs(t *testing.T, rl *concurrency.RateLimiter, jobType string, limit int) map[string]string {
+	t.Helper()
+	jobs, err := rl.ListJobs(jobType, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := map[string]string{}
+	for slotKey, jobID := range jobs {
+		if jobID != "" {
+			active[slotKey] = jobID
+		}
+	}
+
+	return active
+}
+
+func TestSwapOccupancy(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	for _, jobID := range []string{"old-0", "old-1", "old-2"} {
+		if _, err := rl.AddJob("pool", 4, jobID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rl.SwapOccupancy(ctx, "pool", 4, map[int]string{1: "new-1", 3: "new-3"}, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(activeJobs(t, rl, "pool", 4)); got != "map[pool-1:new-1 pool-3:new-3]" {
+		t.Errorf("the pool holds %s after the swap, want exactly the new jobs", got)
+	}
+	if ttl := mr.TTL("pool-3"); ttl != testTTL {
+		t.Errorf("a swapped in slot has ttl %v, want %v", ttl, testTTL)
+	}
+
+	// an empty mapping clears the pool
+	if err := rl.SwapOccupancy(ctx, "pool", 4, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := occupied(t, rl, "pool", 4); n != 0 {
+		t.Errorf("%d slots occupied after swapping in no jobs", n)
+	}
+
+	for _, index := range []int{-1, 4} {
+		if err := rl.SwapOccupancy(ctx, "pool", 4, map[int]string{index: "job"}, 0); err == nil {
+			t.Errorf("swapping a job into slot %d of 4 succeeded", index)
+		}
+	}
+}
+
+func TestSwapOccupancyAtomic(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	generations := []map[int]string{
+		{0: "blue-0", 1: "blue-1", 2: "blue-2"},
+		{1: "green-1", 3: "green-3"},
+	}
+	if err := rl.SwapOccupancy(ctx, "pool", 4, generations[0], 0); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 1; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := rl.SwapOccupancy(ctx, "pool", 4, generations[i%2], 0); err != nil {
+				t.Errorf("SwapOccupancy: %v", err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		active := activeJobs(t, rl, "pool", 4)
+		blue, green := 0, 0
+		for _, jobID := range active {
+			if strings.HasPrefix(jobID, "blue") {
+				blue++
+			} else {
+				green++
+			}
+		}
+		if !(blue == 3 && green == 0) && !(blue == 0 && green == 2) {
+			t.Fatalf("a read during the swaps saw %v, want one whole generation", active)
+		}
+	}
+	close(done)
+	<-stopped
+}
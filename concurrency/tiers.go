@@ -0,0 +1,49 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TierSpec names a pool tried by AcquireTiered
+type TierSpec struct {
+	JobType string
+	Limit   int
+}
+
+// AcquireTiered tries the tiers in order, e.g. a preferred pool followed by an overflow pool,
+// and returns the index of the first tier granting a slot together with the slot key
+// every tier is tried like AddJob, a tier rejecting the job is skipped and the rejection
+// of the last tier is returned if none grants a slot, matching ErrNoSlot if they are all full
+// other errors stop at the failing tier; jobID is required, free the slot with ReleaseTiered
+func (rl *RateLimiter) AcquireTiered(ctx context.Context, tiers []TierSpec, jobID string, ttl time.Duration) (tier int, slotKey string, err error) {
+	if len(tiers) == 0 {
+		return -1, "", errors.New("AcquireTiered requires at least one tier")
+	}
+	if err := rl.validateJobID(jobID); err != nil {
+		return -1, "", err
+	}
+
+	for i, spec := range tiers {
+		slotKey, _, _, err = rl.acquire(ctx, spec.JobType, spec.Limit, jobID, ttl)
+		if err == nil {
+			return i, slotKey, nil
+		}
+		var rejected *RejectedError
+		if !errors.As(err, &rejected) {
+			return -1, "", err
+		}
+	}
+
+	return -1, "", err
+}
+
+// ReleaseTiered deletes jobID from the tier returned by AcquireTiered
+func (rl *RateLimiter) ReleaseTiered(ctx context.Context, tiers []TierSpec, tier int, jobID string) (bool, error) {
+	if tier < 0 || tier >= len(tiers) {
+		return false, errors.New("tier out of range")
+	}
+
+	return rl.deleteJob(ctx, tiers[tier].JobType, tiers[tier].Limit, jobID)
+}
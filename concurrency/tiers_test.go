@@ -0,0 +1,45 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestAcquireTiered(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+	tiers := []concurrency.TierSpec{{JobType: "primary", Limit: 1}, {JobType: "overflow", Limit: 1}}
+
+	tier, key, err := rl.AcquireTiered(ctx, tiers, "a", 0)
+	if err != nil || tier != 0 || key != "primary-0" {
+		t.Fatalf("the first AcquireTiered returned %d, %q, %v, want the primary tier", tier, key, err)
+	}
+	tier, key, err = rl.AcquireTiered(ctx, tiers, "b", 0)
+	if err != nil || tier != 1 || key != "overflow-0" {
+		t.Fatalf("AcquireTiered with a full primary returned %d, %q, %v, want the overflow tier", tier, key, err)
+	}
+	tier, _, err = rl.AcquireTiered(ctx, tiers, "c", 0)
+	if !errors.Is(err, concurrency.ErrNoSlot) || tier != -1 {
+		t.Errorf("AcquireTiered with every tier full returned %d, %v, want ErrNoSlot", tier, err)
+	}
+
+	if ok, err := rl.ReleaseTiered(ctx, tiers, 1, "b"); err != nil || !ok {
+		t.Errorf("ReleaseTiered returned %v, %v", ok, err)
+	}
+	if ok, err := rl.ReleaseTiered(ctx, tiers, 0, "b"); err != nil || ok {
+		t.Errorf("ReleaseTiered from the wrong tier returned %v, %v, want a no-op", ok, err)
+	}
+	if n := occupied(t, rl, "primary", 1); n != 1 {
+		t.Errorf("%d primary slots occupied, want a kept", n)
+	}
+	if n := occupied(t, rl, "overflow", 1); n != 0 {
+		t.Errorf("%d overflow slots occupied after the release", n)
+	}
+	if _, err := rl.ReleaseTiered(ctx, tiers, 2, "b"); err == nil {
+		t.Error("ReleaseTiered of a tier out of range succeeded")
+	}
+}
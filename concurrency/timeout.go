@@ -0,0 +1,97 @@
+package concurrency
+
+import (
+	"context"
+	"time"
+)
+
+// timeoutConnector gives every call without a deadline of its own a deadline of timeout
+// a deadline set by the caller is kept as is, so it is never extended
+// BLPop is passed through since it is already bounded by its own timeout
+type timeoutConnector struct {
+	conn    RedisConnector
+	timeout time.Duration
+}
+
+// withTimeout returns ctx bounded by the timeout if it has no deadline yet
+func (c *timeoutConnector) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+func (c *timeoutConnector) MGet(ctx context.Context, keys []string) ([]string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	return c.conn.MGet(ctx, keys)
+}
+
+func (c *timeoutConnector) Get(ctx context.Context, key string) (string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	return c.conn.Get(ctx, key)
+}
+
+func (c *timeoutConnector) Del(ctx context.Context, keys ...string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	return c.conn.Del(ctx, keys...)
+}
+
+func (c *timeoutConnector) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	return c.conn.Set(ctx, key, value, ttl)
+}
+
+func (c *timeoutConnector) PTTL(ctx context.Context, keys []string) ([]time.Duration, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	return c.conn.PTTL(ctx, keys)
+}
+
+func (c *timeoutConnector) BLPop(ctx context.Context, timeout time.Duration, keys ...string) ([]string, error) {
+	return c.conn.BLPop(ctx, timeout, keys...)
+}
+
+func (c *timeoutConnector) RPush(ctx context.Context, key string, values ...string) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	return c.conn.RPush(ctx, key, values...)
+}
+
+func (c *timeoutConnector) XAdd(ctx context.Context, stream string, maxLen int64, values map[string]interface{}) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	return c.conn.XAdd(ctx, stream, maxLen, values)
+}
+
+func (c *timeoutConnector) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	return c.conn.Eval(ctx, script, keys, args...)
+}
+
+func (c *timeoutConnector) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) (interface{}, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	return c.conn.EvalSha(ctx, sha, keys, args...)
+}
+
+func (c *timeoutConnector) ScriptLoad(ctx context.Context, script string) (string, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	return c.conn.ScriptLoad(ctx, script)
+}
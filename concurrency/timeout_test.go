@@ -0,0 +1,66 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// slowMGetConnector blocks every MGet until its context is done
+type slowMGetConnector struct {
+	concurrency.RedisConnector
+}
+
+func (c slowMGetConnector) MGet(ctx context.Context, keys []string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestReadAndWriteTimeouts(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	rl := concurrency.NewRateLimiter(slowMGetConnector{newTestConnector(mr)}, testTTL,
+		concurrency.WithReadTimeout(100*time.Millisecond), concurrency.WithWriteTimeout(500*time.Millisecond))
+
+	timed := func(name string, fn func() error, min, max time.Duration) {
+		t.Helper()
+		start := time.Now()
+		err := fn()
+		elapsed := time.Since(start)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s returned %v, want context.DeadlineExceeded", name, err)
+		}
+		if elapsed < min || elapsed > max {
+			t.Errorf("%s timed out after %v, want between %v and %v", name, elapsed, min, max)
+		}
+	}
+
+	// the read goes to the primary with the read budget
+	timed("ListJobs", func() error {
+		_, err := rl.ListJobs("pool", 2)
+		return err
+	}, 100*time.Millisecond, 350*time.Millisecond)
+
+	// the acquisition reads the slots with the write budget
+	timed("AddJob", func() error {
+		_, err := rl.AddJob("pool", 2, "job", 0)
+		return err
+	}, 500*time.Millisecond, 1200*time.Millisecond)
+
+	// a deadline of the caller is kept, shorter or longer
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	timed("a read with a shorter deadline", func() error {
+		_, err := rl.CanAcquire(short, "pool", 2)
+		return err
+	}, 20*time.Millisecond, 90*time.Millisecond)
+	long, cancelLong := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancelLong()
+	timed("a read with a longer deadline", func() error {
+		_, err := rl.CanAcquire(long, "pool", 2)
+		return err
+	}, 250*time.Millisecond, 500*time.Millisecond)
+}
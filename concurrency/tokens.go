@@ -0,0 +1,279 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// maxBlockingPop bounds a single BLPOP so a cancelled context is noticed in time
+const maxBlockingPop = time.Second
+
+// initTokensScript fills the token list with the free slots of a jobType once
+// KEYS[1] is the token list, KEYS[2] the init marker, KEYS[3..] the slot keys
+var initTokensScript = newScript(`
+if redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+local pushed = 0
+for i = 3, #KEYS do
+	local v = redis.call('GET', KEYS[i])
+	if not v or v == '' then
+		redis.call('RPUSH', KEYS[1], KEYS[i])
+		pushed = pushed + 1
+	end
+end
+redis.call('SET', KEYS[2], 1)
+return pushed
+`)
+
+// takeTokenScript pops a token without blocking and writes the slot it names stamped with the next fencing token
+// KEYS[1] is the token list, KEYS[2] the fencing token counter, ARGV[1] the slot value and ARGV[2] the ttl in milliseconds
+// it returns the slot key and the fencing token, or false if the list is empty
+var takeTokenScript = newScript(luaJobID + luaSlotFields + luaFence + `
+local key = redis.call('LPOP', KEYS[1])
+if not key then
+	return false
+end
+local value, token = fence(ARGV[1], KEYS[2])
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+	redis.call('SET', key, value, 'PX', ttl)
+else
+	redis.call('SET', key, value)
+end
+return {key, token}
+`)
+
+// returnTokensScript deletes the slots of a job and pushes their tokens back
+// KEYS[1] is the token list, KEYS[2..] the slot keys, ARGV[1] the jobID
+var returnTokensScript = newScript(luaJobID + `
+local released = {}
+for i = 2, #KEYS do
+	if jobid(redis.call('GET', KEYS[i])) == ARGV[1] then
+		redis.call('DEL', KEYS[i])
+		redis.call('RPUSH', KEYS[1], KEYS[i])
+		table.insert(released, KEYS[i])
+	end
+end
+return released
+`)
+
+// reconcileTokensScript rebuilds the token list from the free slots if they diverged
+// tokens of occupied or unknown slots and duplicates are removed, missing tokens of free slots added
+// KEYS[1] is the token list, KEYS[2] the init marker, KEYS[3..] the slot keys
+var reconcileTokensScript = newScript(`
+local listed = {}
+for _, t in ipairs(redis.call('LRANGE', KEYS[1], 0, -1)) do
+	listed[t] = (listed[t] or 0) + 1
+end
+local free = {}
+for i = 3, #KEYS do
+	local v = redis.call('GET', KEYS[i])
+	if not v or v == '' then
+		free[KEYS[i]] = true
+	end
+end
+local repaired = 0
+for t, n in pairs(listed) do
+	if free[t] then
+		repaired = repaired + n - 1
+	else
+		repaired = repaired + n
+	end
+end
+for k in pairs(free) do
+	if not listed[k] then
+		repaired = repaired + 1
+	end
+end
+if repaired > 0 then
+	redis.call('DEL', KEYS[1])
+	for i = 3, #KEYS do
+		if free[KEYS[i]] then
+			redis.call('RPUSH', KEYS[1], KEYS[i])
+		end
+	end
+end
+redis.call('SET', KEYS[2], 1)
+return repaired
+`)
+
+// tokenKeys returns the token list key and the init marker key of jobType
+func tokenKeys(jobType string) (string, string) {
+	return fmt.Sprintf("%s-tokens", jobType), fmt.Sprintf("%s-tokens-init", jobType)
+}
+
+// tokenState remembers the jobTypes whose token list was initialized by this process
+type tokenState struct {
+	mu          sync.Mutex
+	initialized map[string]bool
+}
+
+// initTokens makes sure the token list of jobType was filled
+func (rl *RateLimiter) initTokens(ctx context.Context, jobType string, limit int) error {
+	rl.tokens.mu.Lock()
+	done := rl.tokens.initialized[jobType]
+	rl.tokens.mu.Unlock()
+	if done {
+		return nil
+	}
+
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return err
+	}
+	listKey, markerKey := tokenKeys(jobType)
+	keys := append([]string{listKey, markerKey}, slotKeys...)
+	if _, err := initTokensScript.Run(ctx, rl.redisConnector, keys); err != nil {
+		return err
+	}
+
+	rl.tokens.mu.Lock()
+	if rl.tokens.initialized == nil {
+		rl.tokens.initialized = map[string]bool{}
+	}
+	rl.tokens.initialized[jobType] = true
+	rl.tokens.mu.Unlock()
+
+	return nil
+}
+
+// takeToken pops a token without blocking and writes value into its slot
+// it returns the slot key and the fencing token, or ErrNoSlot if no token is left
+func (rl *RateLimiter) takeToken(ctx context.Context, jobType string, limit int, value string, ttl time.Duration) (string, int64, error) {
+	if err := rl.initTokens(ctx, jobType, limit); err != nil {
+		return "", 0, err
+	}
+
+	listKey, _ := tokenKeys(jobType)
+	reply, err := takeTokenScript.Run(ctx, rl.redisConnector, []string{listKey, fenceKey(jobType)}, value, ttlMilli(ttl))
+	if err != nil {
+		return "", 0, err
+	}
+	// a nil reply means the token list is empty
+	items, ok := reply.([]interface{})
+	if !ok {
+		return "", 0, ErrNoSlot
+	}
+	slotKeys, tokens, err := toSlotTokens(items)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(slotKeys) != 1 {
+		return "", 0, fmt.Errorf("unexpected script reply %v", reply)
+	}
+
+	return slotKeys[0], tokens[0], nil
+}
+
+// returnTokens deletes the slots of jobID and pushes their tokens back
+func (rl *RateLimiter) returnTokens(ctx context.Context, jobType string, limit int, jobID string) ([]string, error) {
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return nil, err
+	}
+	listKey, _ := tokenKeys(jobType)
+	keys := append([]string{listKey}, slotKeys...)
+	reply, err := returnTokensScript.Run(ctx, rl.redisConnector, keys, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return toStrings(reply)
+}
+
+// AcquireSlot adds a job like AddJob but waits up to timeout for a slot to become free
+// it requires WithTokenList, the wait is a BLPOP on the token list, so the caller
+// is woken up by redis as soon as DeleteJob returns a token instead of polling
+// it returns ErrTimeout if no token was returned in time
+func (rl *RateLimiter) AcquireSlot(ctx context.Context, jobType string, limit int, jobID string, ttl, timeout time.Duration) (string, error) {
+	if err := rl.rejectDryRun("AcquireSlot"); err != nil {
+		return "", err
+	}
+
+	if !rl.tokenList {
+		return "", errors.New("AcquireSlot requires WithTokenList")
+	}
+	if jobID == "" {
+		var err error
+		if jobID, err = newJobID(); err != nil {
+			return "", err
+		}
+	}
+	id, err := rl.addJob(ctx, jobType, limit, jobID, ttl)
+	if !errors.Is(err, ErrNoSlot) {
+		return id, err
+	}
+
+	ttl, err = rl.acquireTTL(ctx, ttl)
+	if err != nil {
+		return "", err
+	}
+	listKey, _ := tokenKeys(jobType)
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return "", ErrTimeout
+		}
+		if remaining > maxBlockingPop {
+			remaining = maxBlockingPop
+		}
+
+		popped, err := rl.redisConnector.BLPop(ctx, remaining, listKey)
+		if err != nil {
+			return "", err
+		}
+		if len(popped) == 2 {
+			return rl.fillToken(ctx, jobType, popped[1], jobID, ttl)
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+	}
+}
+
+// fillToken writes the slot named by a popped token
+// the token is pushed back if the write fails, so the slot is not lost
+func (rl *RateLimiter) fillToken(ctx context.Context, jobType, slotKey, jobID string, ttl time.Duration) (string, error) {
+	value := encodeSlotValue(rl.newSlot(ctx, jobID, rl.now()))
+	reply, err := setFencedScript.Run(ctx, rl.redisConnector, []string{slotKey, fenceKey(jobType)}, value, ttlMilli(ttl))
+	if err != nil {
+		listKey, _ := tokenKeys(jobType)
+		rl.redisConnector.RPush(context.Background(), listKey, slotKey)
+		return "", err
+	}
+	token, err := toInt64(reply)
+	if err != nil {
+		return "", err
+	}
+	rl.acquired(ctx, jobType, slotKey, jobID, token)
+	rl.count(ctx, jobType, counterGrants, 1)
+
+	return jobID, nil
+}
+
+// Reconcile repairs the token list of jobType so it holds exactly one token per free slot
+// tokens get lost when a holder crashes or its slot expires through its ttl, and a crash
+// between popping a token and writing the slot loses one too; Reconcile gives them back
+// it returns how many tokens were added or removed, and is safe to run periodically
+// since the whole check and repair runs as one script
+func (rl *RateLimiter) Reconcile(ctx context.Context, jobType string, limit int) (int, error) {
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return 0, err
+	}
+	listKey, markerKey := tokenKeys(jobType)
+	keys := append([]string{listKey, markerKey}, slotKeys...)
+	reply, err := reconcileTokensScript.Run(ctx, rl.redisConnector, keys)
+	if err != nil {
+		return 0, err
+	}
+	repaired, err := toInt64(reply)
+
+	return int(repaired), err
+}
@@ -0,0 +1,136 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+// tokenCount returns the number of tokens in the token list of jobType
+func tokenCount(mr *miniredis.Miniredis, jobType string) int {
+	tokens, _ := mr.List(jobType + "-tokens")
+	return len(tokens)
+}
+
+func TestAcquireSlotWakesOnReturnedToken(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithTokenList())
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 1, "holder", 0); err != nil {
+		t.Fatal(err)
+	}
+	type result struct {
+		id  string
+		err error
+		at  time.Time
+	}
+	waiter := make(chan result, 1)
+	go func() {
+		id, err := rl.AcquireSlot(context.Background(), "pool", 1, "waiter", 0, 5*time.Second)
+		waiter <- result{id, err, time.Now()}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	released := time.Now()
+	if _, err := rl.DeleteJob("pool", 1, "holder"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-waiter:
+		if r.err != nil || r.id != "waiter" {
+			t.Fatalf("AcquireSlot returned %q, %v", r.id, r.err)
+		}
+		if woke := r.at.Sub(released); woke > 500*time.Millisecond {
+			t.Errorf("the waiter woke %v after the token was returned, want it promptly", woke)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the waiter did not get the returned token")
+	}
+
+	if n, tokens := occupied(t, rl, "pool", 1), tokenCount(mr, "pool"); n+tokens != 1 {
+		t.Errorf("%d slots occupied and %d tokens left, want them to add up to the limit", n, tokens)
+	}
+}
+
+func TestAcquireSlotTimeout(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithTokenList())
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 1, "holder", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.AcquireSlot(context.Background(), "pool", 1, "waiter", 0, time.Second); !errors.Is(err, concurrency.ErrTimeout) {
+		t.Errorf("AcquireSlot returned %v, want ErrTimeout", err)
+	}
+}
+
+// assertTokensMatchFreeSlots fails t unless the token list holds exactly the free slots of jobType
+func assertTokensMatchFreeSlots(t *testing.T, rl *concurrency.RateLimiter, mr *miniredis.Miniredis, jobType string, limit int) {
+	t.Helper()
+	jobs, err := rl.ListJobs(jobType, limit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var free []string
+	for key, jobID := range jobs {
+		if jobID == "" {
+			free = append(free, key)
+		}
+	}
+	tokens, _ := mr.List(jobType + "-tokens")
+	sort.Strings(free)
+	sort.Strings(tokens)
+	if fmt.Sprint(tokens) != fmt.Sprint(free) {
+		t.Errorf("the token list holds %v, the free slots are %v", tokens, free)
+	}
+}
+
+func TestReconcileRepairsDrift(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithTokenList())
+	defer mr.Close()
+	ctx := context.Background()
+
+	if _, err := rl.AddJob("pool", 4, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	assertTokensMatchFreeSlots(t, rl, mr, "pool", 4)
+
+	// a token popped by a process which crashed before writing its slot
+	if _, err := mr.Lpop("pool-tokens"); err != nil {
+		t.Fatal(err)
+	}
+	repaired, err := rl.Reconcile(ctx, "pool", 4)
+	if err != nil || repaired != 1 {
+		t.Errorf("Reconcile of a missing token returned %d, %v, want 1", repaired, err)
+	}
+	assertTokensMatchFreeSlots(t, rl, mr, "pool", 4)
+
+	// a token of an occupied slot and a duplicated one
+	mr.Push("pool-tokens", "pool-0", "pool-1")
+	repaired, err = rl.Reconcile(ctx, "pool", 4)
+	if err != nil || repaired != 2 {
+		t.Errorf("Reconcile of surplus tokens returned %d, %v, want 2", repaired, err)
+	}
+	assertTokensMatchFreeSlots(t, rl, mr, "pool", 4)
+
+	// a holder whose slot expired without returning its token
+	if _, err := rl.AddJob("pool", 4, "crashed", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(2 * time.Second)
+	repaired, err = rl.Reconcile(ctx, "pool", 4)
+	if err != nil || repaired != 1 {
+		t.Errorf("Reconcile of an expired slot returned %d, %v, want 1", repaired, err)
+	}
+	assertTokensMatchFreeSlots(t, rl, mr, "pool", 4)
+
+	if repaired, err := rl.Reconcile(ctx, "pool", 4); err != nil || repaired != 0 {
+		t.Errorf("Reconcile without drift returned %d, %v, want 0", repaired, err)
+	}
+}
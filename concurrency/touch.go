@@ -0,0 +1,49 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// touchScript adds ARGV[1] milliseconds to the remaining ttl of every occupied slot
+// slots without a ttl never expire and are left alone
+// KEYS are the slot keys, it returns the number of touched slots
+var touchScript = newScript(`
+local extra = tonumber(ARGV[1])
+local touched = 0
+for _, key in ipairs(KEYS) do
+	local ttl = redis.call('PTTL', key)
+	if ttl > 0 then
+		redis.call('PEXPIRE', key, ttl + extra)
+		touched = touched + 1
+	end
+end
+return touched
+`)
+
+// TouchAll adds extra to the remaining ttl of every occupied slot of jobType in one script,
+// e.g. before a maintenance window which may delay the completion of the running jobs
+// unlike ExtendJob it does not need to know the jobIDs and bumps every slot relatively
+// free slots and slots without a ttl are not touched, the result is not capped by WithMaxTTL
+func (rl *RateLimiter) TouchAll(ctx context.Context, jobType string, limit int, extra time.Duration) (touched int, err error) {
+	start := time.Now()
+	defer func() {
+		rl.observeOperation(ctx, "touch_all", jobType, start, err)
+	}()
+
+	if extra <= 0 {
+		return 0, errors.New("TouchAll requires a positive extra ttl")
+	}
+	slotKeys, err := rl.GenJobKeys(jobType, limit)
+	if err != nil {
+		return 0, err
+	}
+	reply, err := touchScript.Run(ctx, rl.redisConnector, slotKeys, ttlMilli(extra))
+	if err != nil {
+		return 0, err
+	}
+	n, err := toInt64(reply)
+
+	return int(n), err
+}
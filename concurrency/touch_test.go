@@ -0,0 +1,49 @@
+package concurrency_test
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTouchAll(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	for jobID, ttl := range map[string]time.Duration{"a": 10 * time.Second, "b": time.Minute, "forever": -1} {
+		if _, err := rl.AddJob("pool", 5, jobID, ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := map[string]time.Duration{}
+	for _, key := range []string{"pool-0", "pool-1", "pool-2"} {
+		before[key] = mr.TTL(key)
+	}
+
+	touched, err := rl.TouchAll(ctx, "pool", 5, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if touched != 2 {
+		t.Errorf("TouchAll touched %d slots, want the 2 with a ttl", touched)
+	}
+	for key, ttl := range before {
+		want := ttl + 5*time.Minute
+		if ttl == 0 {
+			want = 0
+		}
+		if got := mr.TTL(key); got != want {
+			t.Errorf("%s has ttl %v, want %v", key, got, want)
+		}
+	}
+	for _, key := range []string{"pool-3", "pool-4"} {
+		if mr.Exists(key) {
+			t.Errorf("TouchAll created the free slot %s", key)
+		}
+	}
+
+	if _, err := rl.TouchAll(ctx, "pool", 5, 0); err == nil {
+		t.Error("TouchAll without extra ttl succeeded")
+	}
+}
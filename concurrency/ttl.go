@@ -0,0 +1,76 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTTLTooLarge defines the error when a ttl exceeds the max ttl and WithStrictMaxTTL is set
+var ErrTTLTooLarge = errors.New("ttl too large")
+
+// ErrNoTTLConfigured defines the error when a job is added with zero ttl and the limiter has no default ttl
+var ErrNoTTLConfigured = errors.New("no ttl configured")
+
+// ErrDeadlinePassed defines the error when a job is added with a deadline in the past
+var ErrDeadlinePassed = errors.New("deadline passed")
+
+// jobTTL returns the ttl a slot is written with for the requested ttl
+// zero means the default ttl, ErrNoTTLConfigured is returned if there is none,
+// so a forgotten ttl never leaves a slot without expiry; a negative ttl explicitly means no expiry
+// a ttl above the max ttl, or no expiry at all, is clamped to the max ttl with a warning
+// or rejected with ErrTTLTooLarge, see WithMaxTTL
+func (rl *RateLimiter) jobTTL(ttl time.Duration) (time.Duration, error) {
+	if ttl == 0 {
+		ttl = rl.defaultTTL
+	}
+	if ttl == 0 {
+		return 0, ErrNoTTLConfigured
+	}
+	if rl.maxTTL <= 0 || (ttl > 0 && ttl <= rl.maxTTL) {
+		return ttl, nil
+	}
+
+	if rl.strictMaxTTL {
+		return 0, fmt.Errorf("%w: %v, max %v", ErrTTLTooLarge, ttl, rl.maxTTL)
+	}
+	rl.logf("concurrency: ttl %v clamped to the max ttl %v", ttl, rl.maxTTL)
+
+	return rl.maxTTL, nil
+}
+
+// AddJobUntil adds a job like AddJob whose slot expires at deadline instead of after a ttl
+// the ttl is computed with the limiter's clock, see WithClock
+// it returns ErrDeadlinePassed if deadline is not in the future
+func (rl *RateLimiter) AddJobUntil(ctx context.Context, jobType string, limit int, jobID string, deadline time.Time) (string, error) {
+	ttl := deadline.Sub(rl.now())
+	if ttl <= 0 {
+		return "", fmt.Errorf("%w: %v ago", ErrDeadlinePassed, -ttl)
+	}
+
+	return rl.addJob(ctx, jobType, limit, jobID, ttl)
+}
+
+// acquireTTL returns the ttl a newly acquired slot is written with, like jobTTL
+// with WithTTLBoundedByContext it is cut to the time left until the deadline of ctx
+func (rl *RateLimiter) acquireTTL(ctx context.Context, ttl time.Duration) (time.Duration, error) {
+	ttl, err := rl.jobTTL(ttl)
+	if err != nil || !rl.ttlBoundedByContext {
+		return ttl, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ttl, nil
+	}
+
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return 0, context.DeadlineExceeded
+	}
+	if ttl < 0 || ttl > remaining {
+		ttl = remaining
+	}
+
+	return ttl, nil
+}
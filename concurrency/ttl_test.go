@@ -0,0 +1,168 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestMaxTTLClamps(t *testing.T) {
+	logger := &testLogger{}
+	rl, mr := newTestLimiter(t, concurrency.WithMaxTTL(time.Minute), concurrency.WithLogger(logger))
+	defer mr.Close()
+	ctx := context.Background()
+
+	for jobID, ttl := range map[string]time.Duration{"long": time.Hour, "forever": -1, "short": 30 * time.Second} {
+		if _, err := rl.AddJob("pool", 4, jobID, ttl); err != nil {
+			t.Fatalf("AddJob(%s, %v): %v", jobID, ttl, err)
+		}
+	}
+	for _, jobID := range []string{"long", "forever", "short"} {
+		key, err := rl.FindJobSlot(ctx, "pool", 4, jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := time.Minute
+		if jobID == "short" {
+			want = 30 * time.Second
+		}
+		if ttl := mr.TTL(key); ttl != want {
+			t.Errorf("%s has ttl %v, want %v", jobID, ttl, want)
+		}
+	}
+	if lines := logger.Lines(); len(lines) != 2 {
+		t.Errorf("logged %q, want a warning for each clamped ttl", lines)
+	}
+
+	if err := rl.ExtendJob(ctx, "pool", 4, "short", 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := rl.FindJobSlot(ctx, "pool", 4, "short")
+	if ttl := mr.TTL(key); ttl != time.Minute {
+		t.Errorf("ExtendJob set ttl %v, want it clamped to 1m", ttl)
+	}
+}
+
+func TestStrictMaxTTLRejects(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithMaxTTL(time.Minute), concurrency.WithStrictMaxTTL())
+	defer mr.Close()
+	ctx := context.Background()
+
+	for _, ttl := range []time.Duration{time.Hour, -1} {
+		if _, err := rl.AddJob("pool", 2, "job", ttl); !errors.Is(err, concurrency.ErrTTLTooLarge) {
+			t.Errorf("AddJob with ttl %v returned %v, want ErrTTLTooLarge", ttl, err)
+		}
+	}
+	if n := occupied(t, rl, "pool", 2); n != 0 {
+		t.Fatalf("%d slots occupied after the rejections", n)
+	}
+
+	if _, err := rl.AddJob("pool", 2, "job", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.ExtendJob(ctx, "pool", 2, "job", time.Hour); !errors.Is(err, concurrency.ErrTTLTooLarge) {
+		t.Errorf("ExtendJob with ttl 1h returned %v, want ErrTTLTooLarge", err)
+	}
+	if ttl := mr.TTL("pool-0"); ttl != time.Minute {
+		t.Errorf("the rejected ExtendJob changed the ttl to %v", ttl)
+	}
+}
+
+func TestAddJobUntil(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now))
+	defer mr.Close()
+	ctx := context.Background()
+
+	if _, err := rl.AddJobUntil(ctx, "pool", 2, "job", clock.Now().Add(90*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("pool-0"); ttl != 90*time.Second {
+		t.Errorf("pool-0 has ttl %v, want the 90s left until the deadline", ttl)
+	}
+	mr.FastForward(90 * time.Second)
+	if n := occupied(t, rl, "pool", 2); n != 0 {
+		t.Errorf("%d slots occupied after the deadline", n)
+	}
+
+	for _, deadline := range []time.Time{clock.Now(), clock.Now().Add(-time.Second)} {
+		if _, err := rl.AddJobUntil(ctx, "pool", 2, "late", deadline); !errors.Is(err, concurrency.ErrDeadlinePassed) {
+			t.Errorf("AddJobUntil with a passed deadline returned %v, want ErrDeadlinePassed", err)
+		}
+	}
+	if n := occupied(t, rl, "pool", 2); n != 0 {
+		t.Errorf("%d slots occupied after the rejections", n)
+	}
+}
+
+func TestNoTTLConfigured(t *testing.T) {
+	mr := newTestRedis(t)
+	defer mr.Close()
+	rl := concurrency.NewRateLimiter(newTestConnector(mr), 0)
+	ctx := context.Background()
+
+	if _, err := rl.AddJob("pool", 2, "job", 0); !errors.Is(err, concurrency.ErrNoTTLConfigured) {
+		t.Errorf("AddJob with a zero ttl returned %v, want ErrNoTTLConfigured", err)
+	}
+	if n := occupied(t, rl, "pool", 2); n != 0 {
+		t.Fatalf("%d slots occupied after the rejection", n)
+	}
+
+	// an explicit ttl or no expiry still work
+	if _, err := rl.AddJob("pool", 2, "job", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := rl.ExtendJob(ctx, "pool", 2, "job", 0); !errors.Is(err, concurrency.ErrNoTTLConfigured) {
+		t.Errorf("ExtendJob with a zero ttl returned %v, want ErrNoTTLConfigured", err)
+	}
+	if ttl := mr.TTL("pool-0"); ttl != time.Minute {
+		t.Errorf("pool-0 has ttl %v, want 1m", ttl)
+	}
+	if _, err := rl.AddJob("pool", 2, "forever", -1); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("pool-1"); ttl != 0 {
+		t.Errorf("pool-1 has ttl %v, want no expiry", ttl)
+	}
+}
+
+func TestTTLBoundedByContext(t *testing.T) {
+	rl, mr := newTestLimiter(t, concurrency.WithTTLBoundedByContext(true))
+	defer mr.Close()
+	short, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	long, cancelLong := context.WithTimeout(context.Background(), time.Hour)
+	defer cancelLong()
+
+	for _, tt := range []struct {
+		ctx      context.Context
+		ttl      time.Duration
+		min, max time.Duration
+	}{
+		{ctx: short, ttl: time.Minute, min: 9 * time.Second, max: 10 * time.Second},
+		{ctx: short, ttl: -1, min: 9 * time.Second, max: 10 * time.Second},
+		{ctx: long, ttl: time.Minute, min: time.Minute, max: time.Minute},
+		{ctx: context.Background(), ttl: time.Minute, min: time.Minute, max: time.Minute},
+	} {
+		mr.FlushAll()
+		if _, _, err := rl.AddJobWithToken(tt.ctx, "pool", 1, "job", tt.ttl); err != nil {
+			t.Fatal(err)
+		}
+		if ttl := mr.TTL("pool-0"); ttl < tt.min || ttl > tt.max {
+			t.Errorf("ttl %v was stored as %v, want between %v and %v", tt.ttl, ttl, tt.min, tt.max)
+		}
+	}
+
+	// without the option the deadline is ignored
+	rl, mr2 := newTestLimiter(t)
+	defer mr2.Close()
+	if _, _, err := rl.AddJobWithToken(short, "pool", 1, "job", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr2.TTL("pool-0"); ttl != time.Minute {
+		t.Errorf("ttl was stored as %v without the option, want 1m", ttl)
+	}
+}
@@ -0,0 +1,47 @@
+package concurrency
+
+import "sync"
+
+// utilizationWatcher tracks which jobTypes are above the utilization threshold
+// so the callback only fires on the transition from below to above
+type utilizationWatcher struct {
+	threshold float64
+	fn        func(jobType string, used, limit int)
+
+	mu    sync.Mutex
+	above map[string]bool
+}
+
+func newUtilizationWatcher(threshold float64, fn func(jobType string, used, limit int)) *utilizationWatcher {
+	return &utilizationWatcher{
+		threshold: threshold,
+		fn:        fn,
+		above:     map[string]bool{},
+	}
+}
+
+// observe records the utilization after an operation and fires the callback on a crossing
+func (w *utilizationWatcher) observe(jobType string, used, limit int) {
+	if w == nil || w.fn == nil || limit <= 0 {
+		return
+	}
+	if used < 0 {
+		used = 0
+	}
+
+	above := float64(used)/float64(limit) >= w.threshold
+	w.mu.Lock()
+	wasAbove := w.above[jobType]
+	w.above[jobType] = above
+	w.mu.Unlock()
+
+	if above && !wasAbove {
+		go w.fn(jobType, used, limit)
+	}
+}
+
+// observeUtilization records the utilization after an operation for the callback and the expvar stats
+func (rl *RateLimiter) observeUtilization(jobType string, used, limit int) {
+	rl.utilization.observe(jobType, used, limit)
+	rl.expvarStats.observe(jobType, used, limit)
+}
@@ -0,0 +1,66 @@
+package concurrency_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestUtilizationCallbackFiresOnCrossing(t *testing.T) {
+	type call struct {
+		jobType     string
+		used, limit int
+	}
+	calls := make(chan call, 10)
+	rl, mr := newTestLimiter(t, concurrency.WithUtilizationCallback(1, func(jobType string, used, limit int) {
+		calls <- call{jobType, used, limit}
+	}))
+	defer mr.Close()
+
+	expectCall := func(want call) {
+		t.Helper()
+		select {
+		case got := <-calls:
+			if got != want {
+				t.Errorf("callback got %+v, want %+v", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("callback did not fire for %+v", want)
+		}
+	}
+	expectNoCall := func() {
+		t.Helper()
+		select {
+		case got := <-calls:
+			t.Errorf("unexpected callback %+v", got)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	if _, err := rl.AddJob("pool", 2, "a", 0); err != nil {
+		t.Fatal(err)
+	}
+	expectNoCall()
+
+	if _, err := rl.AddJob("pool", 2, "b", 0); err != nil {
+		t.Fatal(err)
+	}
+	expectCall(call{"pool", 2, 2})
+
+	// staying above the threshold does not fire again
+	if _, err := rl.AddJob("pool", 2, "c", 0); err == nil {
+		t.Fatal("a third job got a slot of a full pool")
+	}
+	expectNoCall()
+
+	if _, err := rl.DeleteJob("pool", 2, "a"); err != nil {
+		t.Fatal(err)
+	}
+	expectNoCall()
+
+	if _, err := rl.AddJob("pool", 2, "d", 0); err != nil {
+		t.Fatal(err)
+	}
+	expectCall(call{"pool", 2, 2})
+}
@@ -0,0 +1,139 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTimeout defines the error when no slot becomes free within the wait time
+var ErrTimeout = errors.New("timeout waiting for a slot")
+
+const (
+	minPollBackoff = 10 * time.Millisecond
+	maxPollBackoff = time.Second
+)
+
+// backoff is an exponential poll interval between min and max
+type backoff struct {
+	min, max time.Duration
+	next     time.Duration
+}
+
+func newBackoff(min, max time.Duration) *backoff {
+	return &backoff{min: min, max: max, next: min}
+}
+
+// Next returns the interval to wait and doubles the following one
+func (b *backoff) Next() time.Duration {
+	d := b.next
+	b.next *= 2
+	if b.next > b.max {
+		b.next = b.max
+	}
+
+	return d
+}
+
+// Reset starts again from the min interval
+func (b *backoff) Reset() {
+	b.next = b.min
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// AcquireWait adds a job like AddJob but waits up to maxWait for a slot to become free
+// it polls the slots with an exponential backoff and returns ErrTimeout once maxWait has passed
+func (rl *RateLimiter) AcquireWait(ctx context.Context, jobType string, limit int, jobID string, ttl, maxWait time.Duration) (string, error) {
+	deadline := time.Now().Add(maxWait)
+	b := newBackoff(minPollBackoff, maxPollBackoff)
+	for {
+		id, err := rl.addJob(ctx, jobType, limit, jobID, ttl)
+		if !errors.Is(err, ErrNoSlot) {
+			return id, err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return "", ErrTimeout
+		}
+		wait := b.Next()
+		if wait > remaining {
+			wait = remaining
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return "", err
+		}
+	}
+}
+
+// AcquireSoft adds a job like AddJob but retries once within softDeadline if all slots are taken
+// the retry waits half of softDeadline, leaving the other half to the retry itself
+// a full pool is not an error: granted is false with a nil error, so the caller can take
+// its slow path right away; other rejections and failures are returned as errors
+// jobID is required since it is needed to release the slot
+func (rl *RateLimiter) AcquireSoft(ctx context.Context, jobType string, limit int, jobID string, ttl, softDeadline time.Duration) (granted bool, slotKey string, err error) {
+	if err := rl.validateJobID(jobID); err != nil {
+		return false, "", err
+	}
+	deadline := time.Now().Add(softDeadline)
+	for retried := false; ; retried = true {
+		slotKey, _, _, err = rl.acquire(ctx, jobType, limit, jobID, ttl)
+		if err == nil {
+			return true, slotKey, nil
+		}
+		if !errors.Is(err, ErrNoSlot) {
+			return false, "", err
+		}
+
+		remaining := time.Until(deadline)
+		if retried || remaining <= 0 {
+			return false, "", nil
+		}
+		if err := sleep(ctx, remaining/2); err != nil {
+			return false, "", err
+		}
+	}
+}
+
+// WaitUntilBelow blocks until less than thresholdFraction of the slots of jobType are occupied
+// the slots are polled starting every poll and backing off up to a second while the pool stays busy
+// it returns ctx.Err() if ctx is done first, and ErrInvalidLimit right away for a limit below one,
+// whose pool never drops below any threshold
+func (rl *RateLimiter) WaitUntilBelow(ctx context.Context, jobType string, limit int, thresholdFraction float64, poll time.Duration) error {
+	if limit <= 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidLimit, limit)
+	}
+	if poll <= 0 {
+		poll = minPollBackoff
+	}
+	max := maxPollBackoff
+	if poll > max {
+		max = poll
+	}
+	b := newBackoff(poll, max)
+	for {
+		_, slots, err := rl.listSlots(ctx, rl.reader(), jobType, limit)
+		if err != nil {
+			return err
+		}
+		if float64(countOccupied(slots))/float64(limit) < thresholdFraction {
+			return nil
+		}
+
+		if err := sleep(ctx, b.Next()); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestWaitUntilBelowAfterSlotsFreed(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	for i := 0; i < 4; i++ {
+		if _, err := rl.AddJob("pool", 4, fmt.Sprintf("job-%d", i), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waiter := make(chan error, 1)
+	go func() {
+		waiter <- rl.WaitUntilBelow(context.Background(), "pool", 4, 0.5, 10*time.Millisecond)
+	}()
+
+	// three or two of four slots are not below half
+	for _, jobID := range []string{"job-0", "job-1"} {
+		if _, err := rl.DeleteJob("pool", 4, jobID); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-waiter:
+			t.Fatalf("WaitUntilBelow returned %v with %d occupied slots", err, occupied(t, rl, "pool", 4))
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	if _, err := rl.DeleteJob("pool", 4, "job-2"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-waiter:
+		if err != nil {
+			t.Errorf("WaitUntilBelow returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("WaitUntilBelow kept waiting with one of four slots occupied")
+	}
+}
+
+func TestWaitUntilBelowContextDone(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	if _, err := rl.AddJob("pool", 1, "job", 0); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := rl.WaitUntilBelow(ctx, "pool", 1, 1, 10*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitUntilBelow returned %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestWaitUntilBelowWithoutSlots(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+
+	// the deadline only fails the test if the call waits for it
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for _, limit := range []int{0, -1} {
+		if err := rl.WaitUntilBelow(ctx, "pool", limit, 0.5, 10*time.Millisecond); !errors.Is(err, concurrency.ErrInvalidLimit) {
+			t.Errorf("WaitUntilBelow with limit %d returned %v, want ErrInvalidLimit", limit, err)
+		}
+	}
+}
+
+func TestAcquireSoft(t *testing.T) {
+	rl, mr := newTestLimiter(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	granted, key, err := rl.AcquireSoft(ctx, "pool", 1, "first", 0, 100*time.Millisecond)
+	if err != nil || !granted || key != "pool-0" {
+		t.Fatalf("AcquireSoft on a free pool returned %v, %q, %v", granted, key, err)
+	}
+
+	// the slot is freed before the short retry
+	time.AfterFunc(20*time.Millisecond, func() {
+		if _, err := rl.DeleteJob("pool", 1, "first"); err != nil {
+			t.Errorf("DeleteJob: %v", err)
+		}
+	})
+	granted, key, err = rl.AcquireSoft(ctx, "pool", 1, "second", 0, 200*time.Millisecond)
+	if err != nil || !granted || key != "pool-0" {
+		t.Fatalf("AcquireSoft with a slot freed in time returned %v, %q, %v", granted, key, err)
+	}
+
+	start := time.Now()
+	granted, _, err = rl.AcquireSoft(ctx, "pool", 1, "third", 0, 50*time.Millisecond)
+	if err != nil || granted {
+		t.Errorf("AcquireSoft on a full pool returned %v, %v, want not granted without an error", granted, err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("AcquireSoft on a full pool took %v, want it within about the soft deadline", elapsed)
+	}
+
+	if _, _, err := rl.AcquireSoft(ctx, "pool", 0, "fourth", 0, 50*time.Millisecond); !errors.Is(err, concurrency.ErrPoolDisabled) {
+		t.Errorf("AcquireSoft on a disabled pool returned %v, want ErrPoolDisabled", err)
+	}
+}
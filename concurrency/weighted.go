@@ -0,0 +1,163 @@
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// luaPruneWeights removes the jobs whose ttl passed from the weights hash and the expiry set
+// KEYS[1] is the weights hash, KEYS[2] the expiry set, ARGV[1] the current time in milliseconds
+const luaPruneWeights = `
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, id in ipairs(expired) do
+	redis.call('HDEL', KEYS[1], id)
+	redis.call('ZREM', KEYS[2], id)
+end
+local function weightsum(skip)
+	local sum = 0
+	local all = redis.call('HGETALL', KEYS[1])
+	for i = 1, #all, 2 do
+		if all[i] ~= skip then
+			sum = sum + tonumber(all[i + 1])
+		end
+	end
+	return sum
+end
+`
+
+// weightedAcquireScript records the weight of a job unless the weight sum would exceed the capacity
+// a job acquiring again replaces its own weight and ttl
+// ARGV[2] is the capacity, ARGV[3] the weight, ARGV[4] the jobID and ARGV[5] the ttl in milliseconds
+// it returns the new weight sum, or -1 if the weight does not fit
+var weightedAcquireScript = newScript(luaPruneWeights + `
+local sum = weightsum(ARGV[4]) + tonumber(ARGV[3])
+if sum > tonumber(ARGV[2]) then
+	return -1
+end
+local ttl = tonumber(ARGV[5])
+redis.call('HSET', KEYS[1], ARGV[4], ARGV[3])
+if ttl > 0 then
+	redis.call('ZADD', KEYS[2], tonumber(ARGV[1]) + ttl, ARGV[4])
+else
+	redis.call('ZADD', KEYS[2], '+inf', ARGV[4])
+end
+local last = redis.call('ZRANGE', KEYS[2], -1, -1, 'WITHSCORES')
+if last[2] ~= 'inf' then
+	for i = 1, 2 do
+		redis.call('PEXPIRE', KEYS[i], math.max(1, tonumber(last[2]) - tonumber(ARGV[1])))
+	end
+else
+	for i = 1, 2 do
+		redis.call('PERSIST', KEYS[i])
+	end
+end
+return sum
+`)
+
+// weightedReleaseScript removes the weight of ARGV[2] and returns 1 if it held one
+var weightedReleaseScript = newScript(luaPruneWeights + `
+redis.call('ZREM', KEYS[2], ARGV[2])
+return redis.call('HDEL', KEYS[1], ARGV[2])
+`)
+
+// weightedUsedScript returns the weight sum of the live jobs
+var weightedUsedScript = newScript(luaPruneWeights + `
+return weightsum(nil)
+`)
+
+// WeightedPoolLimiter limits a jobType by the sum of the weights of its active jobs, e.g. memory units,
+// instead of the number of jobs: a job is only admitted if its weight fits into the capacity left
+// every job carries its own ttl like a slot, an expired job gives its weight back
+type WeightedPoolLimiter struct {
+	rl *RateLimiter
+}
+
+// NewWeightedPoolLimiter is the constructor of WeightedPoolLimiter
+// it uses the connector, default ttl, clock and metrics of rl
+func NewWeightedPoolLimiter(rl *RateLimiter) *WeightedPoolLimiter {
+	return &WeightedPoolLimiter{rl: rl}
+}
+
+// weightKeys returns the weights hash and the expiry set of jobType
+func weightKeys(jobType string) []string {
+	return []string{fmt.Sprintf("%s-weights", jobType), fmt.Sprintf("%s-weights-expiry", jobType)}
+}
+
+// Acquire admits jobID with weight if the weight sum of jobType stays within capacity
+// it returns a *RejectedError matching ErrNoSlot if the weight does not fit
+// a jobID is generated if the given one is empty, acquiring again replaces the weight and ttl of the job
+func (w *WeightedPoolLimiter) Acquire(ctx context.Context, jobType string, capacity, weight int, jobID string, ttl time.Duration) (_ string, err error) {
+	start := time.Now()
+	defer func() {
+		w.rl.observeOperation(ctx, "weighted_acquire", jobType, start, err)
+		err = rejection(jobType, err)
+	}()
+
+	if jobID == "" {
+		if jobID, err = newJobID(); err != nil {
+			return "", err
+		}
+	}
+	if err := w.rl.validateJobID(jobID); err != nil {
+		return "", err
+	}
+	if capacity < 0 {
+		return "", ErrInvalidLimit
+	}
+	if capacity == 0 {
+		return "", ErrPoolDisabled
+	}
+	if weight <= 0 {
+		return "", errors.New("weight must be positive")
+	}
+	ttl, err = w.rl.acquireTTL(ctx, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	reply, err := weightedAcquireScript.Run(ctx, w.rl.redisConnector, weightKeys(jobType),
+		unixMilli(w.rl.now()), capacity, weight, jobID, ttlMilli(ttl))
+	if err != nil {
+		return "", err
+	}
+	sum, err := toInt64(reply)
+	if err != nil {
+		return "", err
+	}
+	if sum < 0 {
+		return "", ErrNoSlot
+	}
+	w.rl.observeUtilization(jobType, int(sum), capacity)
+
+	return jobID, nil
+}
+
+// Release gives the weight of jobID back, it reports whether the job still held one
+func (w *WeightedPoolLimiter) Release(ctx context.Context, jobType, jobID string) (_ bool, err error) {
+	start := time.Now()
+	defer func() {
+		w.rl.observeOperation(ctx, "weighted_release", jobType, start, err)
+	}()
+
+	reply, err := weightedReleaseScript.Run(ctx, w.rl.redisConnector, weightKeys(jobType), unixMilli(w.rl.now()), jobID)
+	if err != nil {
+		return false, err
+	}
+	released, err := toInt64(reply)
+
+	return released == 1, err
+}
+
+// Used returns the weight sum of the active jobs of jobType
+// it runs on the primary since it removes expired jobs on the way
+func (w *WeightedPoolLimiter) Used(ctx context.Context, jobType string) (int, error) {
+	reply, err := weightedUsedScript.Run(ctx, w.rl.redisConnector, weightKeys(jobType), unixMilli(w.rl.now()))
+	if err != nil {
+		return 0, err
+	}
+	sum, err := toInt64(reply)
+
+	return int(sum), err
+}
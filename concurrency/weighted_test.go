@@ -0,0 +1,71 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/y4h2/golang-concurrency-limit/concurrency"
+)
+
+func TestWeightedPoolLimiter(t *testing.T) {
+	clock := newFakeClock()
+	rl, mr := newTestLimiter(t, concurrency.WithClock(clock.Now))
+	defer mr.Close()
+	w := concurrency.NewWeightedPoolLimiter(rl)
+	ctx := context.Background()
+
+	used := func() int {
+		t.Helper()
+		n, err := w.Used(ctx, "memory")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	for jobID, weight := range map[string]int{"a": 4, "b": 3, "c": 2} {
+		if _, err := w.Acquire(ctx, "memory", 10, weight, jobID, 0); err != nil {
+			t.Fatalf("Acquire %s with weight %d: %v", jobID, weight, err)
+		}
+	}
+	if n := used(); n != 9 {
+		t.Fatalf("Used returned %d, want 9", n)
+	}
+
+	// three jobs leave room by count, but not by weight
+	if _, err := w.Acquire(ctx, "memory", 10, 2, "heavy", 0); !errors.Is(err, concurrency.ErrNoSlot) {
+		t.Errorf("Acquire beyond the capacity returned %v, want ErrNoSlot", err)
+	}
+	if _, err := w.Acquire(ctx, "memory", 10, 1, "light", 0); err != nil {
+		t.Errorf("Acquire of the remaining weight returned %v", err)
+	}
+	if n := used(); n != 10 {
+		t.Errorf("Used returned %d, want the full capacity 10", n)
+	}
+
+	if ok, err := w.Release(ctx, "memory", "a"); err != nil || !ok {
+		t.Fatalf("Release returned %v, %v", ok, err)
+	}
+	if ok, err := w.Release(ctx, "memory", "a"); err != nil || ok {
+		t.Errorf("a second Release returned %v, %v, want a no-op", ok, err)
+	}
+	if _, err := w.Acquire(ctx, "memory", 10, 4, "heavy", 10*time.Second); err != nil {
+		t.Errorf("Acquire after the release returned %v", err)
+	}
+
+	// acquiring again replaces the weight of the job
+	if _, err := w.Acquire(ctx, "memory", 10, 1, "b", 0); err != nil {
+		t.Fatal(err)
+	}
+	if n := used(); n != 8 {
+		t.Errorf("Used returned %d after b shrank to 1, want 8", n)
+	}
+
+	// an expired job gives its weight back
+	clock.Advance(10 * time.Second)
+	if n := used(); n != 4 {
+		t.Errorf("Used returned %d after heavy expired, want 4", n)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/y4h2/golang-concurrency-limit
 go 1.13
 
 require (
+	github.com/alicebob/miniredis/v2 v2.14.3
 	github.com/go-redis/redis/v8 v8.7.1
 	github.com/google/uuid v1.2.0
 )